@@ -0,0 +1,70 @@
+package av1
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+// hdr10PlusMaxSize is an upper bound of the size in bytes of an HDR10+ payload: three
+// windows with 15 percentiles and 15 Bezier anchors each, and two 25x25 peak luminance
+// matrices.
+const hdr10PlusMaxSize = 1024
+
+// CreateHDR10PlusMetadataOBU returns a complete metadata OBU of type ITU-T T.35 carrying
+// HDR10+ (SMPTE ST 2094-40) metadata. It is the AV1 counterpart of
+// sei.CreateHDR10PlusSEIMessage and carries the same T.35 payload.
+func CreateHDR10PlusMetadataOBU(md *sei.HDR10Plus) ([]byte, error) {
+	payload, err := md.Encode()
+	if err != nil {
+		return nil, err
+	}
+	t := ITUTT35{CountryCode: payload[0], Payload: payload[1:]}
+	return t.MetadataOBU().Encode(), nil
+}
+
+// HDR10Plus returns the HDR10+ metadata of an itu_t_t35 payload, or nil if t does not
+// carry HDR10+.
+//
+// ParseMetadataOBU drops trailing zero bytes together with trailing_bits, and those may
+// belong to the HDR10+ syntax, so missing bytes are read as zero.
+func (t ITUTT35) HDR10Plus() (*sei.HDR10Plus, error) {
+	data, ok := t.ITUData()
+	if !ok || !data.IsHDR10Plus() {
+		return nil, nil
+	}
+	payload := make([]byte, 1, 1+len(t.Payload)+hdr10PlusMaxSize)
+	payload[0] = t.CountryCode
+	payload = append(payload, t.Payload...)
+	payload = append(payload, make([]byte, hdr10PlusMaxSize)...)
+	return sei.ParseHDR10Plus(payload)
+}
+
+// ExtractHDR10Plus returns the HDR10+ metadata carried by the OBUs of one temporal unit,
+// or nil if there is none. OBUs that are not HDR10+ metadata OBUs are skipped.
+func ExtractHDR10Plus(obus []OBU) (*sei.HDR10Plus, error) {
+	for i, obu := range obus {
+		if obu.Header.Type != OBUMetadata {
+			continue
+		}
+		m, err := ParseMetadataOBU(obu.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("OBU %d: %w", i, err)
+		}
+		if m.Type != MetadataTypeITUTT35 {
+			continue
+		}
+		t, err := ParseITUTT35(m.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("OBU %d: %w", i, err)
+		}
+		md, err := t.HDR10Plus()
+		if err != nil {
+			return nil, fmt.Errorf("OBU %d: %w", i, err)
+		}
+		if md != nil {
+			return md, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,53 @@
+package av1
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+func TestHDR10PlusMetadataOBU(t *testing.T) {
+	// No tone mapping and no color saturation mapping, so that the payload ends with zero
+	// bytes, which are dropped together with trailing_bits by ParseMetadataOBU.
+	md := &sei.HDR10Plus{
+		ApplicationVersion:                    1,
+		TargetedSystemDisplayMaximumLuminance: 1000,
+		Windows: []sei.HDR10PlusWindow{{
+			MaxSCL:               [3]uint32{9000, 8000, 7000},
+			AverageMaxRGB:        500,
+			DistributionMaxRGB:   []sei.HDR10PlusPercentile{{Percentage: 50, Percentile: 400}, {Percentage: 99, Percentile: 0}},
+			FractionBrightPixels: 0,
+		}},
+	}
+	obu, err := CreateHDR10PlusMetadataOBU(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := md.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(obu, payload) {
+		t.Error("OBU does not carry the same T.35 payload as the SEI message")
+	}
+	td := OBU{Header: OBUHeader{Type: OBUTemporalDelimiter, HasSizeField: true, HeaderSize: 1}}
+	tu := append(td.Encode(), obu...)
+	obus, err := SplitOBUs(tu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ExtractHDR10Plus(obus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, md); diff != nil {
+		t.Error(diff)
+	}
+	none, err := ExtractHDR10Plus(obus[:1])
+	if err != nil || none != nil {
+		t.Errorf("got %v, %v for temporal unit without HDR10+", none, err)
+	}
+}
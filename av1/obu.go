@@ -170,9 +170,30 @@ func leb128Len(v uint64) int {
 // field is only valid as the last OBU and is assumed to extend to the end of data
 // (as in the low-overhead bitstream format and the final configOBU).
 func SplitOBUs(data []byte) ([]OBU, error) {
-	obus := make([]OBU, 0, 2)
+	raws, err := SplitRawOBUs(data)
+	if err != nil {
+		return nil, err
+	}
+	obus := make([]OBU, len(raws))
+	for i, r := range raws {
+		obus[i] = r.OBU
+	}
+	return obus, nil
+}
+
+// RawOBU is a parsed OBU together with its raw bytes, including header and any obu_size field.
+type RawOBU struct {
+	OBU
+	Raw []byte
+}
+
+// SplitRawOBUs splits a byte slice into OBUs like SplitOBUs, and also keeps the raw bytes of
+// every OBU. This allows dropping or inserting OBUs while keeping the others byte for byte.
+func SplitRawOBUs(data []byte) ([]RawOBU, error) {
+	obus := make([]RawOBU, 0, 2)
 	pos := 0
 	for pos < len(data) {
+		start := pos
 		hdr, err := ParseOBUHeader(data[pos:])
 		if err != nil {
 			return nil, fmt.Errorf("OBU %d header: %w", len(obus), err)
@@ -193,7 +214,10 @@ func SplitOBUs(data []byte) ([]OBU, error) {
 		} else {
 			payloadLen = len(data) - pos
 		}
-		obus = append(obus, OBU{Header: hdr, Payload: data[pos : pos+payloadLen]})
+		obus = append(obus, RawOBU{
+			OBU: OBU{Header: hdr, Payload: data[pos : pos+payloadLen]},
+			Raw: data[start : pos+payloadLen],
+		})
 		pos += payloadLen
 	}
 	return obus, nil
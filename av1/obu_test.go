@@ -122,6 +122,30 @@ func TestSplitOBUs(t *testing.T) {
 	}
 }
 
+func TestSplitRawOBUs(t *testing.T) {
+	// The last OBU has no size field and extends to the end of data.
+	tuHex := "1200" + // temporal delimiter, size 0
+		"0a0b00000004457e3e7dfcc060" + // sequence header, size 11
+		"30aabbcc" // frame without size field
+	data, _ := hex.DecodeString(tuHex)
+	obus, err := SplitRawOBUs(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantRaw := []string{"1200", "0a0b00000004457e3e7dfcc060", "30aabbcc"}
+	if len(obus) != len(wantRaw) {
+		t.Fatalf("got %d OBUs, want %d", len(obus), len(wantRaw))
+	}
+	for i, o := range obus {
+		if got := hex.EncodeToString(o.Raw); got != wantRaw[i] {
+			t.Errorf("OBU %d: raw %s, want %s", i, got, wantRaw[i])
+		}
+	}
+	if obus[2].Header.Type != OBUFrame || len(obus[2].Payload) != 3 {
+		t.Errorf("last OBU: got type %s and payload len %d", obus[2].Header.Type, len(obus[2].Payload))
+	}
+}
+
 func TestSplitOBUsSizeless(t *testing.T) {
 	// A single OBU without a size field extends to the end of data.
 	data, _ := hex.DecodeString("08aabbcc") // sequence header, no size field
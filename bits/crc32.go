@@ -0,0 +1,29 @@
+package bits
+
+// crc32MPEG2Table is the table for the non-reflected CRC-32 with polynomial 0x04C11DB7
+// (CRC-32/MPEG-2), which is not covered by hash/crc32.
+var crc32MPEG2Table = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+// CRC32MPEG2 returns the CRC-32/MPEG-2 checksum of data, as used in MPEG-2 sections
+// such as SCTE-35 splice_info_section and in Dolby Vision RPUs.
+func CRC32MPEG2(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc = crc<<8 ^ crc32MPEG2Table[byte(crc>>24)^b]
+	}
+	return crc
+}
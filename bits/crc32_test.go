@@ -0,0 +1,22 @@
+package bits_test
+
+import (
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/bits"
+)
+
+func TestCRC32MPEG2(t *testing.T) {
+	testCases := []struct {
+		data []byte
+		want uint32
+	}{
+		{nil, 0xffffffff},
+		{[]byte("123456789"), 0x0376e6e7},
+	}
+	for _, tc := range testCases {
+		if got := bits.CRC32MPEG2(tc.data); got != tc.want {
+			t.Errorf("CRC32MPEG2(%q) = %08x, want %08x", tc.data, got, tc.want)
+		}
+	}
+}
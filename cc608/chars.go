@@ -0,0 +1,26 @@
+package cc608
+
+// basicChars maps the standard character codes 0x20-0x7f that differ from ASCII.
+var basicChars = map[byte]rune{
+	0x2a: 'á', 0x5c: 'é', 0x5e: 'í', 0x5f: 'ó', 0x60: 'ú',
+	0x7b: 'ç', 0x7c: '÷', 0x7d: 'Ñ', 0x7e: 'ñ', 0x7f: '█',
+}
+
+// specialChars are the characters 0x30-0x3f after 0x11 (0x19 for data channel 2).
+var specialChars = []rune("®°½¿™¢£♪à èâêîôû")
+
+// extendedChars1 are the Spanish, French and miscellaneous characters 0x20-0x3f
+// after 0x12 (0x1a for data channel 2).
+var extendedChars1 = []rune("ÁÉÓÚÜü‘¡*'—©℠•“”ÀÂÇÈÊËëÎÏïÔÙùÛ«»")
+
+// extendedChars2 are the Portuguese, German and Danish characters 0x20-0x3f
+// after 0x13 (0x1b for data channel 2).
+var extendedChars2 = []rune("ÃãÍÌìÒòÕõ{}\\^_|~ÄäÖöß¥¤¦ÅåØø┌┐└┘")
+
+// basicChar returns the character of a standard character code.
+func basicChar(b byte) rune {
+	if r, ok := basicChars[b]; ok {
+		return r
+	}
+	return rune(b)
+}
@@ -0,0 +1,329 @@
+package cc608
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	nrRows = 15
+	nrCols = 32
+)
+
+// Mode is the caption mode set by the last caption command.
+type Mode int
+
+// Caption modes. ModeText is the text service (T1-T4), whose data is skipped.
+const (
+	ModeNone Mode = iota
+	ModePopOn
+	ModeRollUp
+	ModePaintOn
+	ModeText
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModePopOn:
+		return "pop-on"
+	case ModeRollUp:
+		return "roll-up"
+	case ModePaintOn:
+		return "paint-on"
+	case ModeText:
+		return "text"
+	default:
+		return "none"
+	}
+}
+
+// Miscellaneous control codes, the second byte after 0x14 (field 1) or 0x15 (field 2).
+const (
+	cmdRCL = 0x20 // resume caption loading
+	cmdBS  = 0x21 // backspace
+	cmdDER = 0x24 // delete to end of row
+	cmdRU2 = 0x25 // roll-up captions, 2 rows
+	cmdRU3 = 0x26
+	cmdRU4 = 0x27
+	cmdRDC = 0x29 // resume direct captioning
+	cmdTR  = 0x2a // text restart
+	cmdRTD = 0x2b // resume text display
+	cmdEDM = 0x2c // erase displayed memory
+	cmdCR  = 0x2d // carriage return
+	cmdENM = 0x2e // erase non-displayed memory
+	cmdEOC = 0x2f // end of caption
+)
+
+// pacRows maps the low bits of the first PAC byte to the first of its two rows (1-based).
+var pacRows = [8]int{11, 1, 3, 12, 14, 5, 7, 9}
+
+// Cue is a caption that is displayed from Start to End. The times are in the units
+// of the presentation times given to Decode.
+type Cue struct {
+	Start int64
+	End   int64
+	Text  string
+}
+
+type screen [nrRows][nrCols]rune
+
+// text returns the rows with content, trimmed and joined by newlines.
+func (s *screen) text() string {
+	var lines []string
+	for _, row := range s {
+		line := strings.Map(func(r rune) rune {
+			if r == 0 {
+				return ' '
+			}
+			return r
+		}, string(row[:]))
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *screen) clearRow(row int) {
+	s[row] = [nrCols]rune{}
+}
+
+// Decoder decodes one caption channel (CC1-CC4) into cues, and collects the XDS packets of field 2.
+type Decoder struct {
+	// Cues are the completed cues.
+	Cues        []Cue
+	channel     int
+	dataChannel byte
+	mode        Mode
+	displayed   screen
+	nonDisplay  screen
+	row         int
+	col         int
+	rollUpRows  int
+	lastControl [2]byte
+	curChannel  int
+	cueText     string
+	cueStart    int64
+	xds         xdsParser
+}
+
+// NewDecoder returns a decoder for caption channel 1-4 (CC1-CC4).
+func NewDecoder(channel int) (*Decoder, error) {
+	if channel < 1 || channel > 4 {
+		return nil, fmt.Errorf("caption channel %d not in range 1-4", channel)
+	}
+	return &Decoder{
+		channel:     channel,
+		dataChannel: byte((channel - 1) % 2),
+		row:         nrRows - 1,
+		curChannel:  -1,
+	}, nil
+}
+
+// Mode returns the current caption mode.
+func (d *Decoder) Mode() Mode {
+	return d.mode
+}
+
+// XDSPackets returns the XDS packets completed so far.
+func (d *Decoder) XDSPackets() []XDSPacket {
+	return d.xds.packets
+}
+
+// Decode processes the field 1 and field 2 byte pairs (with parity bits) of one frame with
+// presentation time pts. Frames must be given in presentation order.
+func (d *Decoder) Decode(field1, field2 []byte, pts int64) {
+	for i := 0; i+1 < len(field2); i += 2 {
+		b1, b2 := field2[i]&0x7f, field2[i+1]&0x7f
+		if d.xds.add(b1, b2) {
+			continue
+		}
+		if d.channel >= 3 {
+			d.decodePair(b1, b2)
+		}
+	}
+	if d.channel <= 2 {
+		for i := 0; i+1 < len(field1); i += 2 {
+			d.decodePair(field1[i]&0x7f, field1[i+1]&0x7f)
+		}
+	}
+	d.updateCue(pts)
+}
+
+// Flush ends the cue that is displayed at time pts.
+func (d *Decoder) Flush(pts int64) {
+	if d.cueText != "" {
+		d.Cues = append(d.Cues, Cue{Start: d.cueStart, End: pts, Text: d.cueText})
+	}
+	d.cueText = ""
+}
+
+// updateCue ends the current cue and starts a new one if the displayed text has changed.
+func (d *Decoder) updateCue(pts int64) {
+	text := d.displayed.text()
+	if text == d.cueText {
+		return
+	}
+	d.Flush(pts)
+	d.cueText = text
+	d.cueStart = pts
+}
+
+// decodePair decodes one byte pair without parity bits.
+func (d *Decoder) decodePair(b1, b2 byte) {
+	switch {
+	case b1 >= 0x10 && b1 < 0x20:
+		if [2]byte{b1, b2} == d.lastControl {
+			d.lastControl = [2]byte{} // control codes are sent twice; skip the repetition
+			return
+		}
+		d.lastControl = [2]byte{b1, b2}
+		d.curChannel = int(b1>>3) & 1
+		if byte(d.curChannel) == d.dataChannel && b2 >= 0x20 {
+			d.decodeControl(b1&^0x08, b2)
+		}
+	case b1 >= 0x20:
+		d.lastControl = [2]byte{}
+		if d.curChannel != int(d.dataChannel) {
+			return
+		}
+		d.putChar(basicChar(b1))
+		if b2 >= 0x20 {
+			d.putChar(basicChar(b2))
+		}
+	default:
+		d.lastControl = [2]byte{}
+	}
+}
+
+func (d *Decoder) decodeControl(b1, b2 byte) {
+	switch {
+	case b2 >= 0x40:
+		d.decodePAC(b1, b2)
+	case b1 == 0x11 && b2 < 0x30: // mid-row code, which is displayed as a space
+		d.putChar(' ')
+	case b1 == 0x11:
+		d.putChar(specialChars[b2-0x30])
+	case (b1 == 0x12 || b1 == 0x13) && b2 < 0x40:
+		// An extended character replaces the standard character sent before it.
+		if d.col > 0 {
+			d.col--
+		}
+		if b1 == 0x12 {
+			d.putChar(extendedChars1[b2-0x20])
+		} else {
+			d.putChar(extendedChars2[b2-0x20])
+		}
+	case (b1 == 0x14 || b1 == 0x15) && b2 < 0x30:
+		d.decodeCommand(b2)
+	case b1 == 0x17 && b2 >= 0x21 && b2 <= 0x23: // tab offset
+		d.col += int(b2 - 0x20)
+		if d.col >= nrCols {
+			d.col = nrCols - 1
+		}
+	}
+}
+
+// decodePAC handles a preamble address code, which sets the row and the indentation.
+func (d *Decoder) decodePAC(b1, b2 byte) {
+	row := pacRows[b1&0x07] - 1
+	if b2&0x20 != 0 && b1&0x07 != 0 {
+		row++
+	}
+	if d.mode == ModeRollUp && row != d.row {
+		d.moveRollUpWindow(row)
+	}
+	d.row = row
+	d.col = 0
+	if b2&0x10 != 0 {
+		d.col = int(b2&0x0e) * 2
+	}
+}
+
+// moveRollUpWindow moves the roll-up rows so that the base row becomes row.
+func (d *Decoder) moveRollUpWindow(row int) {
+	var moved screen
+	for i := 0; i < d.rollUpRows; i++ {
+		from, to := d.row-i, row-i
+		if from >= 0 && to >= 0 {
+			moved[to] = d.displayed[from]
+		}
+	}
+	d.displayed = moved
+}
+
+func (d *Decoder) decodeCommand(cmd byte) {
+	switch cmd {
+	case cmdRCL:
+		d.mode = ModePopOn
+	case cmdBS:
+		if d.col > 0 {
+			d.col--
+			d.target()[d.row][d.col] = 0
+		}
+	case cmdDER:
+		for c := d.col; c < nrCols; c++ {
+			d.target()[d.row][c] = 0
+		}
+	case cmdRU2, cmdRU3, cmdRU4:
+		if d.mode != ModeRollUp {
+			d.displayed = screen{}
+			d.nonDisplay = screen{}
+			d.row = nrRows - 1
+		}
+		d.mode = ModeRollUp
+		d.rollUpRows = int(cmd-cmdRU2) + 2
+		d.col = 0
+	case cmdRDC:
+		d.mode = ModePaintOn
+	case cmdTR, cmdRTD:
+		d.mode = ModeText
+	case cmdEDM:
+		d.displayed = screen{}
+	case cmdCR:
+		if d.mode == ModeRollUp {
+			d.rollUp()
+		}
+	case cmdENM:
+		d.nonDisplay = screen{}
+	case cmdEOC:
+		d.displayed, d.nonDisplay = d.nonDisplay, d.displayed
+		d.mode = ModePopOn
+	}
+}
+
+// rollUp moves the rows of the roll-up window up one row and clears the base row.
+func (d *Decoder) rollUp() {
+	top := d.row - d.rollUpRows + 1
+	if top < 0 {
+		top = 0
+	}
+	for r := 0; r < nrRows; r++ {
+		switch {
+		case r >= top && r < d.row:
+			d.displayed[r] = d.displayed[r+1]
+		case r != d.row:
+			d.displayed.clearRow(r)
+		}
+	}
+	d.displayed.clearRow(d.row)
+	d.col = 0
+}
+
+// target returns the memory that characters are written to in the current mode.
+func (d *Decoder) target() *screen {
+	if d.mode == ModePopOn {
+		return &d.nonDisplay
+	}
+	return &d.displayed
+}
+
+func (d *Decoder) putChar(r rune) {
+	if d.mode == ModeNone || d.mode == ModeText {
+		return
+	}
+	d.target()[d.row][d.col] = r
+	if d.col < nrCols-1 {
+		d.col++
+	}
+}
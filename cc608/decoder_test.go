@@ -0,0 +1,132 @@
+package cc608_test
+
+import (
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/cc608"
+)
+
+// Control code pairs for data channel 1 in field 1.
+var (
+	rcl   = []byte{0x14, 0x20, 0x14, 0x20}
+	eoc   = []byte{0x14, 0x2f, 0x14, 0x2f}
+	edm   = []byte{0x14, 0x2c, 0x14, 0x2c}
+	ru2   = []byte{0x14, 0x25, 0x14, 0x25}
+	rdc   = []byte{0x14, 0x29, 0x14, 0x29}
+	cr    = []byte{0x14, 0x2d, 0x14, 0x2d}
+	pac15 = []byte{0x14, 0x70, 0x14, 0x70} // row 15, indent 0
+	pac1  = []byte{0x11, 0x54, 0x11, 0x54} // row 1, indent 8
+)
+
+// text returns the byte pairs of a standard character string.
+func text(s string) []byte {
+	b := []byte(s)
+	if len(b)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func cat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+type frame struct {
+	field1, field2 []byte
+	pts            int64
+}
+
+func decode(t *testing.T, channel int, frames []frame, end int64) *cc608.Decoder {
+	t.Helper()
+	d, err := cc608.NewDecoder(channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		d.Decode(f.field1, f.field2, f.pts)
+	}
+	d.Flush(end)
+	return d
+}
+
+func checkCues(t *testing.T, got, want []cc608.Cue) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d cues %v, want %d %v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("cue %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPopOn(t *testing.T) {
+	frames := []frame{
+		{field1: cat(rcl, pac15, text("Hello"), pac1, text("wor")), pts: 0},
+		{field1: cat(text("ld"), eoc), pts: 1000},
+		{field1: cat(rcl, pac15, text("Bye"), eoc), pts: 3000},
+		{field1: edm, pts: 5000},
+	}
+	d := decode(t, 1, frames, 6000)
+	checkCues(t, d.Cues, []cc608.Cue{
+		{Start: 1000, End: 3000, Text: "world\nHello"},
+		{Start: 3000, End: 5000, Text: "Bye"},
+	})
+	if d.Mode() != cc608.ModePopOn {
+		t.Errorf("got mode %s", d.Mode())
+	}
+}
+
+func TestRollUp(t *testing.T) {
+	frames := []frame{
+		{field1: cat(ru2, pac15, text("one")), pts: 0},
+		{field1: cat(cr, text("two")), pts: 1000},
+		{field1: cat(cr, text("three")), pts: 2000},
+	}
+	d := decode(t, 1, frames, 3000)
+	checkCues(t, d.Cues, []cc608.Cue{
+		{Start: 0, End: 1000, Text: "one"},
+		{Start: 1000, End: 2000, Text: "one\ntwo"},
+		{Start: 2000, End: 3000, Text: "two\nthree"},
+	})
+}
+
+func TestPaintOnAndCharacters(t *testing.T) {
+	frames := []frame{
+		// "A" followed by the extended character Á replaces the A; 0x11 0x37 is ♪,
+		// and a mid-row code adds a space.
+		{field1: cat(rdc, pac15, text("A"), []byte{0x12, 0x20, 0x11, 0x37, 0x11, 0x2e}, text("*")), pts: 0},
+		// Data for CC2 must be skipped by a CC1 decoder.
+		{field1: cat([]byte{0x1c, 0x29, 0x1c, 0x29}, text("cc2")), pts: 1000},
+		{field1: cat([]byte{0x14, 0x21, 0x14, 0x21}), pts: 2000}, // backspace
+	}
+	d := decode(t, 1, frames, 3000)
+	checkCues(t, d.Cues, []cc608.Cue{
+		{Start: 0, End: 2000, Text: "Á♪ á"},
+		{Start: 2000, End: 3000, Text: "Á♪"},
+	})
+	d = decode(t, 2, frames, 3000)
+	checkCues(t, d.Cues, []cc608.Cue{{Start: 1000, End: 3000, Text: "cc2"}})
+}
+
+func TestXDS(t *testing.T) {
+	field2 := cat([]byte{0x01, 0x03}, text("ABC"), []byte{0x0f, 0x27},
+		[]byte{0x15, 0x29, 0x15, 0x29, 0x15, 0x70, 0x15, 0x70}, text("cc3"))
+	d := decode(t, 3, []frame{{field2: field2, pts: 0}}, 1000)
+	xds := d.XDSPackets()
+	if len(xds) != 1 {
+		t.Fatalf("got %d XDS packets", len(xds))
+	}
+	if !xds[0].ChecksumOK || xds[0].String() != `XDS Current type 0x03: "ABC"` {
+		t.Errorf("got %s, checksum OK %t", xds[0], xds[0].ChecksumOK)
+	}
+	checkCues(t, d.Cues, []cc608.Cue{{Start: 0, End: 1000, Text: "cc3"}})
+	if _, err := cc608.NewDecoder(5); err == nil {
+		t.Error("expected error for channel 5")
+	}
+}
@@ -0,0 +1,15 @@
+/*
+Package cc608 decodes CTA-608 (formerly CEA-608, "line 21") closed captions into timed cues.
+
+CTA-608 byte pairs are carried in the cc_data() of AVC/HEVC SEI messages and AV1 metadata OBUs
+and are returned per frame by sei.ParseCTA608 and av1.ExtractCTA608. Field 1 carries the caption
+channels CC1 and CC2, and field 2 carries CC3, CC4 and the extended data services (XDS).
+
+Decoder interprets the control codes of one caption channel (CTA-608-E Section 6 and 7): the
+pop-on, roll-up and paint-on caption modes, preamble address codes (PACs), mid-row codes, tab
+offsets, and the standard, special and extended character sets. Every change of the displayed
+captions ends the current cue and starts a new one. Styles (colours, italics and underline) are
+not kept in the cue text. XDS packets in field 2 are collected with their class, type and checksum
+status.
+*/
+package cc608
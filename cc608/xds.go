@@ -0,0 +1,108 @@
+package cc608
+
+import "fmt"
+
+// XDS packet classes, given by the start code (CTA-608-E Section 9.3).
+const (
+	XDSClassCurrent       = 0x01
+	XDSClassFuture        = 0x03
+	XDSClassChannel       = 0x05
+	XDSClassMiscellaneous = 0x07
+	XDSClassPublicService = 0x09
+	XDSClassReserved      = 0x0b
+	XDSClassPrivateData   = 0x0d
+	xdsEnd                = 0x0f
+)
+
+// XDSPacket is an extended data services packet from field 2.
+type XDSPacket struct {
+	Class      byte
+	Type       byte
+	Data       []byte
+	ChecksumOK bool
+	sum        int
+}
+
+// ClassName returns the name of the packet class.
+func (p XDSPacket) ClassName() string {
+	switch p.Class {
+	case XDSClassCurrent:
+		return "Current"
+	case XDSClassFuture:
+		return "Future"
+	case XDSClassChannel:
+		return "Channel"
+	case XDSClassMiscellaneous:
+		return "Miscellaneous"
+	case XDSClassPublicService:
+		return "Public Service"
+	case XDSClassPrivateData:
+		return "Private Data"
+	default:
+		return "Reserved"
+	}
+}
+
+// String returns class, type and data of the packet. Data is shown as text for the
+// program name (Current/Future type 0x03) and network name (Channel type 0x01).
+func (p XDSPacket) String() string {
+	isText := (p.Class == XDSClassCurrent || p.Class == XDSClassFuture) && p.Type == 0x03 ||
+		p.Class == XDSClassChannel && p.Type == 0x01
+	if isText {
+		return fmt.Sprintf("XDS %s type 0x%02x: %q", p.ClassName(), p.Type, string(trimNUL(p.Data)))
+	}
+	return fmt.Sprintf("XDS %s type 0x%02x: % x", p.ClassName(), p.Type, p.Data)
+}
+
+func trimNUL(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// xdsParser collects XDS packets. Packets of different classes may be interleaved
+// using continue codes.
+type xdsParser struct {
+	active  bool
+	current *XDSPacket
+	open    map[byte]*XDSPacket
+	packets []XDSPacket
+}
+
+// add processes a field 2 byte pair without parity bits and reports if it was XDS data.
+func (x *xdsParser) add(b1, b2 byte) bool {
+	switch {
+	case b1 >= 0x01 && b1 < xdsEnd && b1%2 == 1: // start
+		if x.open == nil {
+			x.open = make(map[byte]*XDSPacket)
+		}
+		p := &XDSPacket{Class: b1, Type: b2, sum: int(b1) + int(b2)}
+		x.open[b1] = p
+		x.current = p
+		x.active = true
+	case b1 >= 0x02 && b1 < xdsEnd: // continue
+		x.current = x.open[b1-1]
+		x.active = true
+	case b1 == xdsEnd:
+		if x.current != nil {
+			p := x.current
+			p.ChecksumOK = (p.sum+int(b1)+int(b2))&0x7f == 0
+			x.packets = append(x.packets, *p)
+			delete(x.open, p.Class)
+		}
+		x.current = nil
+		x.active = false
+	case b1 >= 0x10 && b1 < 0x20: // caption control code ends XDS
+		x.active = false
+		return false
+	case x.active && b1 >= 0x20:
+		if x.current != nil {
+			x.current.Data = append(x.current.Data, b1, b2)
+			x.current.sum += int(b1) + int(b2)
+		}
+	default:
+		return x.active
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+package cc708_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/av1"
+	"github.com/Eyevinn/mp4ff/avc"
+	"github.com/Eyevinn/mp4ff/cc708"
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+// popOn returns the service data of a pop-on caption: the text is written to a hidden
+// window, which is then displayed.
+func popOn(t *testing.T, text string) []byte {
+	t.Helper()
+	var c cc708.Commands
+	data, err := c.DefineWindow(cc708.WindowDefinition{ID: 0, RowCount: 2, ColumnCount: 42, AnchorVertical: 70, AnchorHorizontal: 100}).
+		ClearWindows(0x01).
+		Text(text).
+		DisplayWindows(0x01).
+		Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// decodeAll passes frames from the encoder to a decoder until all data is written.
+func decodeAll(t *testing.T, enc *cc708.Encoder, dec *cc708.Decoder) int {
+	t.Helper()
+	nrFrames := 0
+	for enc.Pending() > 0 {
+		ccData, err := enc.NextFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ccData) != 3+3*enc.CCCount {
+			t.Fatalf("cc_data size %d for cc_count %d", len(ccData), enc.CCCount)
+		}
+		if _, err := dec.AddCCData(ccData); err != nil {
+			t.Fatal(err)
+		}
+		nrFrames++
+	}
+	return nrFrames
+}
+
+func TestEncodeDecode(t *testing.T) {
+	longText := strings.Repeat("Lorem ipsum dolor sit amet, ", 6) + "½ ♪ “ok” €"
+	cases := []struct {
+		desc      string
+		serviceNr int
+		ccCount   int
+		text      string
+		want      string
+	}{
+		{"short service 1", 1, cc708.CCCountForFrameRate(29.97), "Hello\nWorld", "Hello\nWorld"},
+		{"extended service", 10, cc708.CCCountForFrameRate(59.94), "Hi", "Hi"},
+		{"long text spanning packets and frames", 2, 3, "Hello\n" + longText, longText},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			enc := cc708.NewEncoder(c.ccCount)
+			if err := enc.AddServiceData(c.serviceNr, popOn(t, c.text)); err != nil {
+				t.Fatal(err)
+			}
+			dec := cc708.NewDecoder()
+			decodeAll(t, enc, dec)
+			s := dec.Services[c.serviceNr]
+			if s == nil {
+				t.Fatalf("no data for service %d", c.serviceNr)
+			}
+			// The long text rolls up, so that only the last row is left with the first.
+			got := s.Display()
+			if c.desc == "long text spanning packets and frames" {
+				got = got[strings.Index(got, "\n")+1:]
+			}
+			if got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+			if dec.Assembler.NrDropped != 0 {
+				t.Errorf("%d packets dropped", dec.Assembler.NrDropped)
+			}
+		})
+	}
+	if n := cc708.CCCountForFrameRate(25); n != 24 {
+		t.Errorf("cc_count %d for 25 Hz, want 24", n)
+	}
+}
+
+func TestWindowCommands(t *testing.T) {
+	var c cc708.Commands
+	data, err := c.DefineWindow(cc708.WindowDefinition{ID: 1, Visible: true, RowCount: 2, ColumnCount: 32, Priority: 1}).
+		Text("one\ntwo\nthree").
+		DefineWindow(cc708.WindowDefinition{ID: 2, Visible: true, RowCount: 1, ColumnCount: 32}).
+		Text("top").
+		Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := cc708.NewServiceDecoder()
+	d.Decode(data[:5]) // an incomplete DefineWindow is kept for the next block
+	d.Decode(data[5:])
+	if got, want := d.Display(), "top\ntwo\nthree"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	data, _ = (&cc708.Commands{}).HideWindows(0x04).SetCurrentWindow(1).SetPenLocation(0, 0).Text("TWO").Bytes()
+	d.Decode(data)
+	if got, want := d.Display(), "TWO\nthree"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	data, _ = (&cc708.Commands{}).DeleteWindows(0xff).Bytes()
+	d.Decode(data)
+	if d.Display() != "" || d.CurrentWindow() != nil {
+		t.Errorf("windows not deleted: %q", d.Display())
+	}
+}
+
+func avcSampleEntry() *mp4.VisualSampleEntryBox {
+	return mp4.CreateVisualSampleEntryBox("avc1", 1920, 1080, &mp4.AvcCBox{})
+}
+
+func avcSample(nalus ...[]byte) []byte {
+	var out []byte
+	for _, n := range nalus {
+		out = append(out, byte(len(n)>>24), byte(len(n)>>16), byte(len(n)>>8), byte(len(n)))
+		out = append(out, n...)
+	}
+	return out
+}
+
+func TestInsertFragment(t *testing.T) {
+	vse := avcSampleEntry()
+	unregistered := sei.NewSEIData(sei.SEIUserDataUnregisteredType, make([]byte, 20))
+	oldCC := sei.CreateCTA608SEIMessage([]byte{0xc1, 0xff, 0xfc, 0x94, 0x2c, 0xff})
+	seiNALU, err := avc.CreateSEINalu([]sei.SEIMessage{unregistered, oldCC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slice := []byte{0x65, 0x88, 0x84}
+	frag, err := mp4.CreateFragment(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second sample is presented first.
+	ctos := []int32{20, 0, 10}
+	for i, cto := range ctos {
+		data := avcSample(seiNALU, slice)
+		frag.AddFullSample(mp4.FullSample{
+			Sample:     mp4.Sample{Flags: mp4.SyncSampleFlags, Dur: 10, Size: uint32(len(data)), CompositionTimeOffset: cto},
+			DecodeTime: uint64(10 * i),
+			Data:       data,
+		})
+	}
+	// The 16-byte packet needs 8 constructs, so it spans the first two frames.
+	enc := cc708.NewEncoder(6)
+	if err := enc.AddServiceData(1, popOn(t, "Hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc708.InsertFragment(frag, nil, vse, enc); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := frag.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fss, err := f.Segments[0].Fragments[0].GetFullSamples(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := cc708.NewDecoder()
+	for _, nr := range []int{1, 2, 0} {
+		nalus, err := avc.GetNalusFromSample(fss[nr].Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nalus) != 3 || avc.GetNaluType(nalus[2][0]) != avc.NALU_IDR {
+			t.Fatalf("sample %d: wrong NAL units %v", nr, avc.FindNaluTypes(fss[nr].Data))
+		}
+		ccData, err := cc708.ExtractCCData(fss[nr].Data, vse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		triplets, err := sei.ParseCCData(ccData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nr == 1 && triplets[2].Type != sei.CCTypeDTVCCStart {
+			t.Error("first sample in presentation order does not start the packet")
+		}
+		if _, err := dec.AddCCData(ccData); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := dec.Services[1].Display(); got != "Hi" {
+		t.Errorf("got %q, want %q", got, "Hi")
+	}
+}
+
+func TestAV1CCData(t *testing.T) {
+	vse := mp4.CreateVisualSampleEntryBox("av01", 1920, 1080, &mp4.Av1CBox{})
+	frame := av1.OBU{Header: av1.OBUHeader{Type: av1.OBUFrame, HasSizeField: true, HeaderSize: 1}, Payload: []byte{0x10, 0x20}}
+	enc := cc708.NewEncoder(cc708.CCCountForFrameRate(25))
+	if err := enc.AddServiceData(1, popOn(t, "AV1")); err != nil {
+		t.Fatal(err)
+	}
+	ccData, err := enc.NextFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := frame.Encode()
+	for i := 0; i < 2; i++ { // the second insertion replaces the first
+		sample, err = cc708.InsertCCData(sample, vse, ccData)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	obus, err := av1.SplitOBUs(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obus) != 2 || obus[0].Header.Type != av1.OBUMetadata {
+		t.Fatalf("got %d OBUs", len(obus))
+	}
+	got, err := cc708.ExtractCCData(sample, vse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, ccData) {
+		t.Errorf("got cc_data %x, want %x", got, ccData)
+	}
+	dec := cc708.NewDecoder()
+	if _, err := dec.AddCCData(got); err != nil {
+		t.Fatal(err)
+	}
+	if got := dec.Services[1].Display(); got != "AV1" {
+		t.Errorf("got %q, want %q", got, "AV1")
+	}
+}
@@ -0,0 +1,151 @@
+package cc708
+
+import "fmt"
+
+// WindowDefinition holds the parameters of a DefineWindow command.
+// RowCount and ColumnCount are the actual number of rows (1-15) and columns (1-42).
+type WindowDefinition struct {
+	ID                  int
+	Visible             bool
+	RowLock             bool
+	ColumnLock          bool
+	Priority            int
+	RelativePositioning bool
+	AnchorVertical      int
+	AnchorHorizontal    int
+	AnchorPoint         int
+	RowCount            int
+	ColumnCount         int
+	WindowStyle         int
+	PenStyle            int
+}
+
+// Commands builds the service data of one caption service. Add commands and text with
+// the methods and take the result with Bytes.
+type Commands struct {
+	data []byte
+	err  error
+}
+
+// Bytes returns the service data, or the first error of a command.
+func (c *Commands) Bytes() ([]byte, error) {
+	return c.data, c.err
+}
+
+func (c *Commands) fail(err error) *Commands {
+	if c.err == nil {
+		c.err = err
+	}
+	return c
+}
+
+// DefineWindow adds a DefineWindow (DFx) command, which also makes the window current.
+func (c *Commands) DefineWindow(w WindowDefinition) *Commands {
+	if w.ID < 0 || w.ID >= nrWindows || w.RowCount < 1 || w.RowCount > 15 || w.ColumnCount < 1 || w.ColumnCount > 64 {
+		return c.fail(fmt.Errorf("bad window definition %+v", w))
+	}
+	p0 := byte(w.Priority & 0x07)
+	if w.Visible {
+		p0 |= 0x20
+	}
+	if w.RowLock {
+		p0 |= 0x10
+	}
+	if w.ColumnLock {
+		p0 |= 0x08
+	}
+	p1 := byte(w.AnchorVertical & 0x7f)
+	if w.RelativePositioning {
+		p1 |= 0x80
+	}
+	c.data = append(c.data, codeDF0+byte(w.ID), p0, p1, byte(w.AnchorHorizontal),
+		byte(w.AnchorPoint&0x0f)<<4|byte(w.RowCount-1), byte(w.ColumnCount-1),
+		byte(w.WindowStyle&0x07)<<3|byte(w.PenStyle&0x07))
+	return c
+}
+
+// SetCurrentWindow adds a SetCurrentWindow (CWx) command.
+func (c *Commands) SetCurrentWindow(id int) *Commands {
+	if id < 0 || id >= nrWindows {
+		return c.fail(fmt.Errorf("window ID %d out of range", id))
+	}
+	c.data = append(c.data, codeCW0+byte(id))
+	return c
+}
+
+// ClearWindows adds a ClearWindows (CLW) command for the windows in the bit mask.
+func (c *Commands) ClearWindows(mask byte) *Commands {
+	c.data = append(c.data, codeCLW, mask)
+	return c
+}
+
+// DisplayWindows adds a DisplayWindows (DSW) command for the windows in the bit mask.
+func (c *Commands) DisplayWindows(mask byte) *Commands {
+	c.data = append(c.data, codeDSW, mask)
+	return c
+}
+
+// HideWindows adds a HideWindows (HDW) command for the windows in the bit mask.
+func (c *Commands) HideWindows(mask byte) *Commands {
+	c.data = append(c.data, codeHDW, mask)
+	return c
+}
+
+// ToggleWindows adds a ToggleWindows (TGW) command for the windows in the bit mask.
+func (c *Commands) ToggleWindows(mask byte) *Commands {
+	c.data = append(c.data, codeTGW, mask)
+	return c
+}
+
+// DeleteWindows adds a DeleteWindows (DLW) command for the windows in the bit mask.
+func (c *Commands) DeleteWindows(mask byte) *Commands {
+	c.data = append(c.data, codeDLW, mask)
+	return c
+}
+
+// SetPenLocation adds a SetPenLocation (SPL) command.
+func (c *Commands) SetPenLocation(row, column int) *Commands {
+	c.data = append(c.data, codeSPL, byte(row&0x0f), byte(column&0x3f))
+	return c
+}
+
+// CarriageReturn adds a CR, which moves the pen to the next row or rolls up the window.
+func (c *Commands) CarriageReturn() *Commands {
+	c.data = append(c.data, codeCR)
+	return c
+}
+
+// Text adds text. Line breaks become carriage returns, and characters are coded in
+// G0 (ASCII and the music note), G1 (Latin-1), G2 or, for other characters, with P16.
+func (c *Commands) Text(text string) *Commands {
+	for _, r := range text {
+		switch {
+		case r == '\n':
+			c.data = append(c.data, codeCR)
+		case r == '♪':
+			c.data = append(c.data, 0x7f)
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			c.data = append(c.data, byte(r))
+		case r < 0x20, r >= 0x7f && r < 0xa0:
+			return c.fail(fmt.Errorf("control character %U in text", r))
+		default:
+			if b, ok := g2Code(r); ok {
+				c.data = append(c.data, codeEXT1, b)
+			} else if r <= 0xffff {
+				c.data = append(c.data, codeP16, byte(r>>8), byte(r))
+			} else {
+				return c.fail(fmt.Errorf("character %U cannot be coded", r))
+			}
+		}
+	}
+	return c
+}
+
+func g2Code(r rune) (byte, bool) {
+	for b, g := range g2Chars {
+		if g == r && b > 0x21 {
+			return b, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,410 @@
+package cc708
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+// C0, C1 and EXT1 code points (CTA-708-E Section 7.1).
+const (
+	codeETX   = 0x03
+	codeBS    = 0x08
+	codeFF    = 0x0c
+	codeCR    = 0x0d
+	codeHCR   = 0x0e
+	codeEXT1  = 0x10
+	codeP16   = 0x18
+	codeCW0   = 0x80
+	codeCLW   = 0x88
+	codeDSW   = 0x89
+	codeHDW   = 0x8a
+	codeTGW   = 0x8b
+	codeDLW   = 0x8c
+	codeDLY   = 0x8d
+	codeDLC   = 0x8e
+	codeRST   = 0x8f
+	codeSPA   = 0x90
+	codeSPC   = 0x91
+	codeSPL   = 0x92
+	codeSWA   = 0x97
+	codeDF0   = 0x98
+	nrWindows = 8
+)
+
+// c1ParamSizes is the number of parameter bytes of the C1 commands 0x80-0x9f.
+var c1ParamSizes = [32]int{
+	0, 0, 0, 0, 0, 0, 0, 0, // CW0-CW7
+	1, 1, 1, 1, 1, 1, 0, 0, // CLW, DSW, HDW, TGW, DLW, DLY, DLC, RST
+	2, 3, 2, 0, 0, 0, 0, 4, // SPA, SPC, SPL, reserved, SWA
+	6, 6, 6, 6, 6, 6, 6, 6, // DF0-DF7
+}
+
+// g2Chars maps the G2 code points that are used in practice (CTA-708-E Section 7.1.6).
+var g2Chars = map[byte]rune{
+	0x20: ' ', 0x21: ' ', 0x25: '…', 0x2a: 'Š', 0x2c: 'Œ', 0x30: '█', 0x31: '‘', 0x32: '’',
+	0x33: '“', 0x34: '”', 0x35: '•', 0x39: '™', 0x3a: 'š', 0x3c: 'œ', 0x3d: '℠', 0x3f: 'Ÿ',
+	0x76: '⅛', 0x77: '⅜', 0x78: '⅝', 0x79: '⅞', 0x7a: '│', 0x7b: '┐', 0x7c: '└', 0x7d: '─',
+	0x7e: '┘', 0x7f: '┌',
+}
+
+// Window is a caption window as set up by the DefineWindow command (CTA-708-E Section 8.4).
+type Window struct {
+	ID                  int
+	Defined             bool
+	Visible             bool
+	Priority            int
+	RowLock             bool
+	ColumnLock          bool
+	RelativePositioning bool
+	AnchorVertical      int
+	AnchorHorizontal    int
+	AnchorPoint         int
+	RowCount            int // number of rows, i.e. row_count + 1
+	ColumnCount         int // number of columns, i.e. column_count + 1
+	WindowStyle         int
+	PenStyle            int
+	PenRow              int
+	PenColumn           int
+	rows                [][]rune
+}
+
+// Text returns the non-empty rows of the window, with trailing spaces removed, joined by newlines.
+func (w *Window) Text() string {
+	var lines []string
+	for _, row := range w.rows {
+		line := strings.TrimRight(string(row), " \u0000")
+		if line != "" {
+			lines = append(lines, strings.ReplaceAll(line, "\u0000", " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *Window) clear() {
+	w.rows = make([][]rune, w.RowCount)
+	w.PenRow, w.PenColumn = 0, 0
+}
+
+func (w *Window) putChar(c rune) {
+	if w.PenRow >= len(w.rows) {
+		return
+	}
+	row := w.rows[w.PenRow]
+	for len(row) <= w.PenColumn {
+		row = append(row, 0)
+	}
+	row[w.PenColumn] = c
+	w.rows[w.PenRow] = row
+	w.PenColumn++
+}
+
+// carriageReturn moves the pen to the start of the next row and rolls the text up when the
+// pen is on the last row.
+func (w *Window) carriageReturn() {
+	w.PenColumn = 0
+	if w.PenRow+1 < w.RowCount {
+		w.PenRow++
+		return
+	}
+	if len(w.rows) > 0 {
+		w.rows = append(w.rows[1:], nil)
+	}
+}
+
+// ServiceDecoder interprets the service data of one caption service. Commands may span
+// service blocks, so an incomplete command at the end of a block is kept for the next one.
+type ServiceDecoder struct {
+	Windows [nrWindows]Window
+	current int
+	pending []byte
+}
+
+// NewServiceDecoder returns a decoder with no defined windows.
+func NewServiceDecoder() *ServiceDecoder {
+	d := &ServiceDecoder{current: -1}
+	for i := range d.Windows {
+		d.Windows[i].ID = i
+	}
+	return d
+}
+
+// CurrentWindow returns the window that text is written to, or nil if there is none.
+func (d *ServiceDecoder) CurrentWindow() *Window {
+	if d.current < 0 || !d.Windows[d.current].Defined {
+		return nil
+	}
+	return &d.Windows[d.current]
+}
+
+// VisibleWindows returns the defined and visible windows in display priority order.
+func (d *ServiceDecoder) VisibleWindows() []*Window {
+	var ws []*Window
+	for i := range d.Windows {
+		if w := &d.Windows[i]; w.Defined && w.Visible {
+			ws = append(ws, w)
+		}
+	}
+	sort.SliceStable(ws, func(i, j int) bool { return ws[i].Priority < ws[j].Priority })
+	return ws
+}
+
+// Display returns the text of the visible windows, separated by newlines. Comparing it
+// before and after Decode tells when the displayed captions change.
+func (d *ServiceDecoder) Display() string {
+	var texts []string
+	for _, w := range d.VisibleWindows() {
+		if t := w.Text(); t != "" {
+			texts = append(texts, t)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Decode interprets the data of a service block.
+func (d *ServiceDecoder) Decode(data []byte) {
+	buf := append(d.pending, data...)
+	d.pending = nil
+	pos := 0
+	for pos < len(buf) {
+		n := d.decodeOne(buf[pos:])
+		if n == 0 {
+			d.pending = append([]byte(nil), buf[pos:]...)
+			return
+		}
+		pos += n
+	}
+}
+
+// decodeOne decodes one command or character and returns the number of bytes used,
+// or 0 if more bytes are needed.
+func (d *ServiceDecoder) decodeOne(b []byte) int {
+	c := b[0]
+	switch {
+	case c == codeEXT1:
+		if len(b) < 2 {
+			return 0
+		}
+		return d.decodeExtended(b[1:]) + 1
+	case c < 0x20:
+		return d.decodeC0(b)
+	case c < 0x80:
+		if c == 0x7f {
+			d.putChar('♪')
+		} else {
+			d.putChar(rune(c))
+		}
+		return 1
+	case c < 0xa0:
+		size := 1 + c1ParamSizes[c-0x80]
+		if len(b) < size {
+			return 0
+		}
+		d.decodeC1(c, b[1:size])
+		return size
+	default:
+		d.putChar(rune(c)) // G1 is ISO 8859-1
+		return 1
+	}
+}
+
+func (d *ServiceDecoder) decodeC0(b []byte) int {
+	c := b[0]
+	switch {
+	case c >= 0x18:
+		if len(b) < 3 {
+			return 0
+		}
+		if c == codeP16 {
+			d.putChar(rune(b[1])<<8 | rune(b[2]))
+		}
+		return 3
+	case c >= 0x11:
+		if len(b) < 2 {
+			return 0
+		}
+		return 2
+	}
+	w := d.CurrentWindow()
+	if w == nil {
+		return 1
+	}
+	switch c {
+	case codeBS:
+		if w.PenColumn > 0 {
+			w.PenColumn--
+			if w.PenRow < len(w.rows) && w.PenColumn < len(w.rows[w.PenRow]) {
+				w.rows[w.PenRow] = w.rows[w.PenRow][:w.PenColumn]
+			}
+		}
+	case codeFF:
+		w.clear()
+	case codeCR:
+		w.carriageReturn()
+	case codeHCR:
+		if w.PenRow < len(w.rows) {
+			w.rows[w.PenRow] = nil
+		}
+		w.PenColumn = 0
+	}
+	return 1
+}
+
+// decodeExtended decodes the code after EXT1 and returns the number of bytes used, or 0.
+func (d *ServiceDecoder) decodeExtended(b []byte) int {
+	c := b[0]
+	var size int
+	switch {
+	case c < 0x08:
+		size = 1
+	case c < 0x10:
+		size = 2
+	case c < 0x18:
+		size = 3
+	case c < 0x20:
+		size = 4
+	case c < 0x80:
+		if r, ok := g2Chars[c]; ok {
+			d.putChar(r)
+		}
+		return 1
+	case c < 0x88:
+		size = 5
+	case c < 0x90:
+		size = 6
+	case c < 0xa0:
+		// C3 variable-length commands: a length byte follows the command byte
+		if len(b) < 3 {
+			return 0
+		}
+		size = 3 + int(b[2]&0x1f)
+	default:
+		if c == 0xa0 {
+			d.putChar('㏄') // CC icon
+		}
+		return 1
+	}
+	if len(b) < size {
+		return 0
+	}
+	return size
+}
+
+func (d *ServiceDecoder) decodeC1(c byte, p []byte) {
+	switch {
+	case c < codeCLW:
+		if d.Windows[c-codeCW0].Defined {
+			d.current = int(c - codeCW0)
+		}
+	case c == codeCLW, c == codeDSW, c == codeHDW, c == codeTGW, c == codeDLW:
+		for i := range d.Windows {
+			if p[0]&(1<<i) == 0 {
+				continue
+			}
+			w := &d.Windows[i]
+			switch c {
+			case codeCLW:
+				if w.Defined {
+					w.clear()
+				}
+			case codeDSW:
+				w.Visible = w.Defined
+			case codeHDW:
+				w.Visible = false
+			case codeTGW:
+				w.Visible = w.Defined && !w.Visible
+			case codeDLW:
+				*w = Window{ID: i}
+				if d.current == i {
+					d.current = -1
+				}
+			}
+		}
+	case c == codeRST:
+		*d = *NewServiceDecoder()
+	case c == codeSPL:
+		if w := d.CurrentWindow(); w != nil {
+			w.PenRow = int(p[0] & 0x0f)
+			w.PenColumn = int(p[1] & 0x3f)
+		}
+	case c >= codeDF0:
+		d.defineWindow(int(c-codeDF0), p)
+	}
+}
+
+// defineWindow creates or updates a window and makes it the current window.
+// Text is kept when an existing window is redefined with the same size.
+func (d *ServiceDecoder) defineWindow(id int, p []byte) {
+	w := &d.Windows[id]
+	rows := int(p[3]&0x0f) + 1
+	cols := int(p[4]&0x3f) + 1
+	isNew := !w.Defined || rows != w.RowCount
+	*w = Window{
+		ID:                  id,
+		Defined:             true,
+		Visible:             p[0]&0x20 != 0,
+		RowLock:             p[0]&0x10 != 0,
+		ColumnLock:          p[0]&0x08 != 0,
+		Priority:            int(p[0] & 0x07),
+		RelativePositioning: p[1]&0x80 != 0,
+		AnchorVertical:      int(p[1] & 0x7f),
+		AnchorHorizontal:    int(p[2]),
+		AnchorPoint:         int(p[3] >> 4),
+		RowCount:            rows,
+		ColumnCount:         cols,
+		WindowStyle:         int(p[5] >> 3 & 0x07),
+		PenStyle:            int(p[5] & 0x07),
+		PenRow:              w.PenRow,
+		PenColumn:           w.PenColumn,
+		rows:                w.rows,
+	}
+	if isNew {
+		w.clear()
+	}
+	d.current = id
+}
+
+func (d *ServiceDecoder) putChar(c rune) {
+	if w := d.CurrentWindow(); w != nil {
+		w.putChar(c)
+	}
+}
+
+// Decoder decodes the DTVCC data of a track: it assembles packets from the cc_data() of
+// consecutive frames and feeds the service blocks to one ServiceDecoder per service.
+type Decoder struct {
+	Assembler PacketAssembler
+	Services  map[int]*ServiceDecoder
+}
+
+// NewDecoder returns a decoder without any services.
+func NewDecoder() *Decoder {
+	return &Decoder{Services: make(map[int]*ServiceDecoder)}
+}
+
+// AddCCData decodes the cc_data() of one frame, given in presentation order.
+// It returns the numbers of the services that got data.
+func (d *Decoder) AddCCData(ccData []byte) ([]int, error) {
+	triplets, err := sei.ParseCCData(ccData)
+	if err != nil {
+		return nil, err
+	}
+	var updated []int
+	for _, p := range d.Assembler.AddTriplets(triplets) {
+		blocks, err := p.ServiceBlocks()
+		if err != nil {
+			return updated, err
+		}
+		for _, b := range blocks {
+			s, ok := d.Services[b.ServiceNumber]
+			if !ok {
+				s = NewServiceDecoder()
+				d.Services[b.ServiceNumber] = s
+			}
+			s.Decode(b.Data)
+			updated = append(updated, b.ServiceNumber)
+		}
+	}
+	return updated, nil
+}
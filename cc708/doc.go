@@ -0,0 +1,17 @@
+/*
+Package cc708 decodes and encodes CTA-708 (formerly CEA-708) digital television closed
+captions, also called DTVCC.
+
+DTVCC data is carried in the cc_type 2 and 3 constructs of the cc_data() structure that
+also carries CTA-608 captions, in AVC/HEVC SEI messages and AV1 metadata OBUs of type
+ITU-T T.35 (see sei.ParseCCData). The byte pairs of consecutive frames form DTVCC packets
+(CTA-708-E Section 5), which are put together by PacketAssembler. A packet holds service
+blocks (Section 6.2), and the service blocks of one caption service form a stream of
+commands and characters that ServiceDecoder interprets into caption windows with text
+(Sections 7 and 8). Decoder combines these steps for all services.
+
+In the other direction, Commands builds service data, Encoder packs it into packets and
+distributes the packets over frames with the cc_count required by the frame rate, and
+InsertFragment writes the resulting cc_data() into the samples of a fragment.
+*/
+package cc708
@@ -0,0 +1,116 @@
+package cc708
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+// ccConstructsPerSecond is the cc_data construct rate of the 9600 bit/s caption channel,
+// CTA-608 included (CTA-708-E Section 4.4).
+const ccConstructsPerSecond = 600
+
+// CCCountForFrameRate returns the cc_count of cc_data() for a frame rate, e.g. 20 for
+// 29.97 Hz, 24 for 25 Hz and 10 for 59.94 Hz.
+func CCCountForFrameRate(frameRate float64) int {
+	n := int(math.Round(ccConstructsPerSecond / frameRate))
+	switch {
+	case n < 3:
+		return 3
+	case n > 31:
+		return 31
+	}
+	return n
+}
+
+// Encoder turns service data into DTVCC packets and spreads them over the cc_data() of
+// consecutive frames. The first two constructs of every frame are reserved for CTA-608
+// field 1 and 2 and carry padding unless CTA-608 pairs are queued with AddCTA608.
+type Encoder struct {
+	CCCount int
+	seqNr   byte
+	queue   []sei.CCTriplet
+	field1  [][2]byte
+	field2  [][2]byte
+}
+
+// NewEncoder returns an encoder for frames with ccCount constructs.
+func NewEncoder(ccCount int) *Encoder {
+	return &Encoder{CCCount: ccCount}
+}
+
+// AddServiceData queues the data of a caption service. It is split into service blocks of
+// at most 31 bytes and packets of at most 128 bytes, with one service per packet.
+func (e *Encoder) AddServiceData(serviceNr int, data []byte) error {
+	const maxBlocksPerPacket = maxPacketSize / (maxBlockSize + 2)
+	var blocks []ServiceBlock
+	for len(data) > 0 || len(blocks) > 0 {
+		n := len(data)
+		if n > maxBlockSize {
+			n = maxBlockSize
+		}
+		if n > 0 {
+			blocks = append(blocks, ServiceBlock{ServiceNumber: serviceNr, Data: data[:n]})
+			data = data[n:]
+		}
+		if len(blocks) == maxBlocksPerPacket || len(data) == 0 {
+			packet, err := EncodePacket(e.seqNr, blocks)
+			if err != nil {
+				return err
+			}
+			e.seqNr = (e.seqNr + 1) & 0x03
+			e.queue = append(e.queue, PacketTriplets(packet)...)
+			blocks = blocks[:0]
+		}
+	}
+	return nil
+}
+
+// AddCTA608 queues CTA-608 byte pairs (with parity) for field 1 and field 2.
+func (e *Encoder) AddCTA608(field1, field2 []byte) error {
+	if len(field1)%2 != 0 || len(field2)%2 != 0 {
+		return fmt.Errorf("odd number of CTA-608 bytes")
+	}
+	for i := 0; i < len(field1); i += 2 {
+		e.field1 = append(e.field1, [2]byte{field1[i], field1[i+1]})
+	}
+	for i := 0; i < len(field2); i += 2 {
+		e.field2 = append(e.field2, [2]byte{field2[i], field2[i+1]})
+	}
+	return nil
+}
+
+// Pending returns the number of DTVCC constructs that are not yet written.
+func (e *Encoder) Pending() int {
+	return len(e.queue)
+}
+
+// NextFrame returns the cc_data() of the next frame in presentation order, with CCCount
+// constructs. Unused constructs are invalid padding.
+func (e *Encoder) NextFrame() ([]byte, error) {
+	if e.CCCount < 3 || e.CCCount > 31 {
+		return nil, fmt.Errorf("cc_count %d not in range 3-31", e.CCCount)
+	}
+	triplets := make([]sei.CCTriplet, 0, e.CCCount)
+	triplets = append(triplets, next608(&e.field1, sei.CCTypeNTSCField1), next608(&e.field2, sei.CCTypeNTSCField2))
+	n := e.CCCount - 2
+	if n > len(e.queue) {
+		n = len(e.queue)
+	}
+	triplets = append(triplets, e.queue[:n]...)
+	e.queue = e.queue[n:]
+	for len(triplets) < e.CCCount {
+		triplets = append(triplets, sei.CCTriplet{Type: sei.CCTypeDTVCCData})
+	}
+	return sei.CreateCCData(triplets)
+}
+
+func next608(queue *[][2]byte, ccType byte) sei.CCTriplet {
+	if len(*queue) == 0 {
+		return sei.CCTriplet{Type: ccType}
+	}
+	t := sei.CCTriplet{Valid: true, Type: ccType, Data: (*queue)[0]}
+	*queue = (*queue)[1:]
+	return t
+}
@@ -0,0 +1,143 @@
+package cc708
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+const (
+	maxPacketSize       = 128 // packet_size_code 0
+	maxBlockSize        = 31
+	extendedServiceNr   = 7
+	maxServiceNr        = 63
+	nullServiceBlockHdr = 0x00
+)
+
+// Packet is a DTVCC caption channel packet without its header byte.
+type Packet struct {
+	SequenceNumber byte
+	Data           []byte
+}
+
+// ServiceBlock is the data of one caption service in a packet.
+type ServiceBlock struct {
+	ServiceNumber int
+	Data          []byte
+}
+
+// PacketAssembler puts together DTVCC packets from the cc_type 2 and 3 constructs of
+// cc_data(). Packets may span several frames, so one assembler should be used per track.
+type PacketAssembler struct {
+	buf  []byte
+	size int
+	// NrDropped is the number of incomplete packets that were dropped when a new packet started.
+	NrDropped int
+}
+
+// AddTriplets consumes the constructs of one cc_data() and returns the packets completed by them.
+// CTA-608 constructs and invalid constructs are skipped.
+func (a *PacketAssembler) AddTriplets(triplets []sei.CCTriplet) []Packet {
+	var packets []Packet
+	for _, t := range triplets {
+		if !t.Valid {
+			continue
+		}
+		switch t.Type {
+		case sei.CCTypeDTVCCStart:
+			if len(a.buf) > 0 {
+				a.NrDropped++
+			}
+			a.size = int(t.Data[0]&0x3f) * 2
+			if a.size == 0 {
+				a.size = maxPacketSize
+			}
+			a.buf = append(a.buf[:0], t.Data[0], t.Data[1])
+		case sei.CCTypeDTVCCData:
+			if len(a.buf) == 0 {
+				continue // no packet start seen yet
+			}
+			a.buf = append(a.buf, t.Data[0], t.Data[1])
+		default:
+			continue
+		}
+		if len(a.buf) >= a.size {
+			packets = append(packets, Packet{
+				SequenceNumber: a.buf[0] >> 6,
+				Data:           append([]byte(nil), a.buf[1:a.size]...),
+			})
+			a.buf = a.buf[:0]
+		}
+	}
+	return packets
+}
+
+// ServiceBlocks splits the packet data into service blocks. Parsing stops at a null
+// service block header, which starts the padding of the packet.
+func (p Packet) ServiceBlocks() ([]ServiceBlock, error) {
+	var blocks []ServiceBlock
+	data := p.Data
+	for len(data) > 0 {
+		if data[0] == nullServiceBlockHdr {
+			break
+		}
+		serviceNr := int(data[0] >> 5)
+		size := int(data[0] & 0x1f)
+		data = data[1:]
+		if serviceNr == extendedServiceNr {
+			if len(data) == 0 {
+				return nil, fmt.Errorf("missing extended service number")
+			}
+			serviceNr = int(data[0] & 0x3f)
+			data = data[1:]
+		}
+		if size > len(data) {
+			return nil, fmt.Errorf("service %d block size %d exceeds packet", serviceNr, size)
+		}
+		blocks = append(blocks, ServiceBlock{ServiceNumber: serviceNr, Data: data[:size]})
+		data = data[size:]
+	}
+	return blocks, nil
+}
+
+// EncodePacket returns the bytes of a packet, including the header byte, with the service
+// blocks and null padding to an even size. The sequence number is a 2-bit counter.
+func EncodePacket(seqNr byte, blocks []ServiceBlock) ([]byte, error) {
+	out := []byte{0}
+	for _, b := range blocks {
+		if b.ServiceNumber < 1 || b.ServiceNumber > maxServiceNr {
+			return nil, fmt.Errorf("service number %d out of range", b.ServiceNumber)
+		}
+		if len(b.Data) == 0 || len(b.Data) > maxBlockSize {
+			return nil, fmt.Errorf("service block size %d not in range 1-%d", len(b.Data), maxBlockSize)
+		}
+		if b.ServiceNumber < extendedServiceNr {
+			out = append(out, byte(b.ServiceNumber<<5|len(b.Data)))
+		} else {
+			out = append(out, byte(extendedServiceNr<<5|len(b.Data)), byte(b.ServiceNumber))
+		}
+		out = append(out, b.Data...)
+	}
+	if len(out)%2 == 1 {
+		out = append(out, nullServiceBlockHdr)
+	}
+	if len(out) > maxPacketSize {
+		return nil, fmt.Errorf("packet size %d exceeds %d", len(out), maxPacketSize)
+	}
+	out[0] = seqNr<<6 | byte(len(out)/2)&0x3f
+	return out, nil
+}
+
+// PacketTriplets returns the cc_data constructs that carry an encoded packet:
+// one of cc_type 3 followed by cc_type 2 constructs.
+func PacketTriplets(packet []byte) []sei.CCTriplet {
+	triplets := make([]sei.CCTriplet, 0, len(packet)/2)
+	for i := 0; i+1 < len(packet); i += 2 {
+		t := sei.CCTriplet{Valid: true, Type: sei.CCTypeDTVCCData, Data: [2]byte{packet[i], packet[i+1]}}
+		if i == 0 {
+			t.Type = sei.CCTypeDTVCCStart
+		}
+		triplets = append(triplets, t)
+	}
+	return triplets
+}
@@ -0,0 +1,249 @@
+package cc708
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/Eyevinn/mp4ff/av1"
+	"github.com/Eyevinn/mp4ff/avc"
+	"github.com/Eyevinn/mp4ff/hevc"
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+type codec int
+
+const (
+	codecAVC codec = iota
+	codecHEVC
+	codecAV1
+)
+
+func sampleEntryCodec(vse *mp4.VisualSampleEntryBox) (codec, error) {
+	switch {
+	case vse.AvcC != nil:
+		return codecAVC, nil
+	case vse.HvcC != nil:
+		return codecHEVC, nil
+	case vse.Av1C != nil:
+		return codecAV1, nil
+	default:
+		return 0, fmt.Errorf("no closed captions for %s sample entry", vse.Type())
+	}
+}
+
+// ExtractCCData returns the cc_data() of the ATSC A/53 (GA94) captions in a sample, or nil
+// if there are none. The codec is taken from the sample entry, and AVC and HEVC samples
+// must have 4-byte NAL unit lengths.
+func ExtractCCData(sample []byte, vse *mp4.VisualSampleEntryBox) ([]byte, error) {
+	c, err := sampleEntryCodec(vse)
+	if err != nil {
+		return nil, err
+	}
+	if c == codecAV1 {
+		obus, err := av1.SplitOBUs(sample)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range obus {
+			if t, ok := captionT35(o); ok {
+				return t.CTA608CCData(), nil
+			}
+		}
+		return nil, nil
+	}
+	nalus, err := avc.GetNalusFromSample(sample)
+	if err != nil {
+		return nil, err
+	}
+	for _, nalu := range nalus {
+		hdrLen, ok := seiHeaderLen(nalu, c)
+		if !ok {
+			continue
+		}
+		seiDatas, err := sei.ExtractSEIData(bytes.NewReader(nalu[hdrLen:]))
+		if err != nil && err != sei.ErrRbspTrailingBitsMissing {
+			return nil, fmt.Errorf("SEI NAL unit: %w", err)
+		}
+		for i := range seiDatas {
+			if isCaptionSEI(&seiDatas[i]) {
+				return seiDatas[i].Payload()[sei.ITUDataSize:], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// InsertCCData returns a sample where any GA94 captions are replaced by ccData. For AVC and
+// HEVC, other SEI messages are kept and a new SEI NAL unit is put before the first VCL NAL
+// unit. For AV1, a metadata OBU is put before the first frame OBU, and all OBUs are written
+// with obu_size fields.
+func InsertCCData(sample []byte, vse *mp4.VisualSampleEntryBox, ccData []byte) ([]byte, error) {
+	c, err := sampleEntryCodec(vse)
+	if err != nil {
+		return nil, err
+	}
+	if c == codecAV1 {
+		return insertAV1(sample, ccData)
+	}
+	nalus, err := avc.GetNalusFromSample(sample)
+	if err != nil {
+		return nil, err
+	}
+	msg := sei.CreateCTA608SEIMessage(ccData)
+	var seiNALU []byte
+	if c == codecAVC {
+		seiNALU, err = avc.CreateSEINalu([]sei.SEIMessage{msg})
+	} else {
+		seiNALU, err = hevc.CreateSEINalu([]sei.SEIMessage{msg})
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sample)+4+len(seiNALU))
+	inserted := false
+	for _, nalu := range nalus {
+		if !inserted && isVCL(nalu, c) {
+			out = appendNALU(out, seiNALU)
+			inserted = true
+		}
+		hdrLen, ok := seiHeaderLen(nalu, c)
+		if !ok {
+			out = appendNALU(out, nalu)
+			continue
+		}
+		nalu, err = removeCaptionSEI(nalu, hdrLen)
+		if err != nil {
+			return nil, err
+		}
+		if nalu != nil {
+			out = appendNALU(out, nalu)
+		}
+	}
+	if !inserted {
+		return nil, fmt.Errorf("no VCL NAL unit in sample")
+	}
+	return out, nil
+}
+
+// removeCaptionSEI returns the SEI NAL unit without GA94 caption messages, or nil if no
+// message is left.
+func removeCaptionSEI(nalu []byte, hdrLen int) ([]byte, error) {
+	seiDatas, err := sei.ExtractSEIData(bytes.NewReader(nalu[hdrLen:]))
+	if err != nil && err != sei.ErrRbspTrailingBitsMissing {
+		return nil, fmt.Errorf("SEI NAL unit: %w", err)
+	}
+	var kept []sei.SEIMessage
+	for i := range seiDatas {
+		if !isCaptionSEI(&seiDatas[i]) {
+			kept = append(kept, &seiDatas[i])
+		}
+	}
+	switch {
+	case len(kept) == len(seiDatas):
+		return nalu, nil
+	case len(kept) == 0:
+		return nil, nil
+	}
+	buf := bytes.NewBuffer(append([]byte(nil), nalu[:hdrLen]...))
+	if err := sei.WriteSEIMessages(buf, kept); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func insertAV1(sample, ccData []byte) ([]byte, error) {
+	obus, err := av1.SplitOBUs(sample)
+	if err != nil {
+		return nil, err
+	}
+	ccOBU := av1.CreateCTA608MetadataOBU(ccData)
+	out := make([]byte, 0, len(sample)+len(ccOBU))
+	inserted := false
+	for _, o := range obus {
+		if _, ok := captionT35(o); ok {
+			continue
+		}
+		if !inserted {
+			switch o.Header.Type {
+			case av1.OBUFrameHeader, av1.OBUFrame, av1.OBUTileGroup, av1.OBURedundantFrameHeader:
+				out = append(out, ccOBU...)
+				inserted = true
+			}
+		}
+		out = append(out, o.Encode()...)
+	}
+	if !inserted {
+		return nil, fmt.Errorf("no frame OBU in temporal unit")
+	}
+	return out, nil
+}
+
+// InsertFragment writes the next frames of enc into the samples of a single-track
+// fragment. The frames are assigned in presentation order, since caption data follows the
+// display order of the pictures, and any existing GA94 captions are replaced.
+func InsertFragment(frag *mp4.Fragment, trex *mp4.TrexBox, vse *mp4.VisualSampleEntryBox, enc *Encoder) error {
+	fss, err := frag.GetFullSamples(trex)
+	if err != nil {
+		return err
+	}
+	order := make([]int, len(fss))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return fss[order[i]].PresentationTime() < fss[order[j]].PresentationTime()
+	})
+	ccDatas := make([][]byte, len(fss))
+	for _, nr := range order {
+		ccDatas[nr], err = enc.NextFrame()
+		if err != nil {
+			return err
+		}
+	}
+	return frag.ReplaceSampleData(trex, func(nr int, data []byte) ([]byte, error) {
+		return InsertCCData(data, vse, ccDatas[nr])
+	})
+}
+
+// seiHeaderLen returns the NAL unit header length if nalu is an SEI NAL unit.
+func seiHeaderLen(nalu []byte, c codec) (int, bool) {
+	if c == codecAVC {
+		return 1, avc.GetNaluType(nalu[0]) == avc.NALU_SEI
+	}
+	t := hevc.GetNaluType(nalu[0])
+	return 2, t == hevc.NALU_SEI_PREFIX || t == hevc.NALU_SEI_SUFFIX
+}
+
+func isVCL(nalu []byte, c codec) bool {
+	if c == codecAVC {
+		return avc.IsVideoNaluType(avc.GetNaluType(nalu[0]))
+	}
+	return hevc.IsVideoNaluType(hevc.GetNaluType(nalu[0]))
+}
+
+// isCaptionSEI tells if sd is a user_data_registered_itu_t_t35 message with GA94 cc_data().
+func isCaptionSEI(sd *sei.SEIData) bool {
+	return sd.Type() == sei.SEIUserDataRegisteredITUtT35Type &&
+		bytes.HasPrefix(sd.Payload(), sei.CTA608ITUData().Encode())
+}
+
+// captionT35 returns the T.35 payload of a metadata OBU carrying GA94 cc_data().
+func captionT35(o av1.OBU) (av1.ITUTT35, bool) {
+	m, err := av1.ParseMetadataOBUFromOBU(o)
+	if err != nil || m.Type != av1.MetadataTypeITUTT35 {
+		return av1.ITUTT35{}, false
+	}
+	t, err := av1.ParseITUTT35(m.Payload)
+	if err != nil || t.CTA608CCData() == nil {
+		return av1.ITUTT35{}, false
+	}
+	return t, true
+}
+
+func appendNALU(out, nalu []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(nalu)))
+	return append(out, nalu...)
+}
@@ -0,0 +1,22 @@
+/*
+mp4ff-ccextract extracts CTA-608 closed captions from a progressive or fragmented video mp4 file.
+The captions are read from ATSC A/53 SEI messages (AVC and HEVC) or ITU-T T.35 metadata OBUs (AV1)
+of the first video track, decoded for one of the channels CC1-CC4, and written as SRT, WebVTT,
+or as a fragmented mp4 file with a wvtt subtitle track.
+
+	Usage of mp4ff-ccextract:
+
+		mp4ff-ccextract [options] infile
+
+	options:
+
+		-c int
+				Caption channel (1-4 for CC1-CC4) (default 1)
+		-f string
+				Output format: srt, vtt or wvtt (default "srt")
+		-o string
+				Output file (required for wvtt, stdout for srt and vtt if not set)
+		-version
+				Get mp4ff version
+*/
+package main
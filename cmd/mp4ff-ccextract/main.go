@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/Eyevinn/mp4ff/cc608"
+	"github.com/Eyevinn/mp4ff/cc708"
+	"github.com/Eyevinn/mp4ff/internal"
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+const (
+	appName = "mp4ff-ccextract"
+)
+
+var usg = `%s extracts CTA-608 closed captions from a progressive or fragmented video mp4 file.
+The captions are read from ATSC A/53 SEI messages (AVC and HEVC) or ITU-T T.35 metadata OBUs (AV1)
+of the first video track, decoded for one of the channels CC1-CC4, and written as SRT, WebVTT,
+or as a fragmented mp4 file with a wvtt subtitle track.
+
+Usage of %s:
+`
+
+type options struct {
+	channel int
+	format  string
+	outFile string
+	version bool
+}
+
+func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usg, appName, appName)
+		fmt.Fprintf(os.Stderr, "\n%s [options] infile\n\noptions:\n", appName)
+		fs.PrintDefaults()
+	}
+
+	opts := options{}
+
+	fs.IntVar(&opts.channel, "c", 1, "Caption channel (1-4 for CC1-CC4)")
+	fs.StringVar(&opts.format, "f", "srt", "Output format: srt, vtt or wvtt")
+	fs.StringVar(&opts.outFile, "o", "", "Output file (required for wvtt, stdout for srt and vtt if not set)")
+	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
+
+	err := fs.Parse(args[1:])
+	return &opts, err
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	o, err := parseOptions(fs, args)
+
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if o.version {
+		fmt.Fprintf(stdout, "%s %s\n", appName, internal.GetVersion())
+		return nil
+	}
+
+	if len(fs.Args()) != 1 {
+		fs.Usage()
+		return fmt.Errorf("missing input file")
+	}
+
+	switch o.format {
+	case "srt", "vtt":
+	case "wvtt":
+		if o.outFile == "" {
+			return fmt.Errorf("output file must be given for wvtt")
+		}
+	default:
+		return fmt.Errorf("unknown output format %q", o.format)
+	}
+
+	dec, err := cc608.NewDecoder(o.channel)
+	if err != nil {
+		return err
+	}
+
+	ifd, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("error opening file: %w", err)
+	}
+	defer ifd.Close()
+
+	parsedMp4, err := mp4.DecodeFile(ifd)
+	if err != nil {
+		return err
+	}
+
+	var frames []ccFrame
+	if parsedMp4.IsFragmented() {
+		frames, err = fragmentedFrames(parsedMp4)
+	} else {
+		frames, err = progressiveFrames(parsedMp4)
+	}
+	if err != nil {
+		return err
+	}
+	cues := decodeFrames(dec, frames)
+
+	w := stdout
+	if o.outFile != "" && o.format != "wvtt" {
+		ofd, err := os.Create(o.outFile)
+		if err != nil {
+			return fmt.Errorf("error creating file: %w", err)
+		}
+		defer ofd.Close()
+		w = ofd
+	}
+
+	switch o.format {
+	case "srt":
+		return writeSRT(w, cues)
+	case "vtt":
+		return writeWebVTT(w, cues)
+	default:
+		return writeWvtt(o.outFile, cues)
+	}
+}
+
+// ccFrame is the CTA-608 data of one video sample with its presentation time and
+// duration in milliseconds.
+type ccFrame struct {
+	pts, dur       int64
+	field1, field2 []byte
+}
+
+func findFirstVideoTrak(moov *mp4.MoovBox) (*mp4.TrakBox, bool) {
+	for _, inTrak := range moov.Traks {
+		hdlrType := inTrak.Mdia.Hdlr.HandlerType
+		if hdlrType != "vide" {
+			continue
+		}
+		return inTrak, true
+	}
+	return nil, false
+}
+
+func videoSampleEntry(trak *mp4.TrakBox) (*mp4.VisualSampleEntryBox, error) {
+	stsd := trak.Mdia.Minf.Stbl.Stsd
+	switch {
+	case stsd.AvcX != nil:
+		return stsd.AvcX, nil
+	case stsd.HvcX != nil:
+		return stsd.HvcX, nil
+	case stsd.Av01 != nil:
+		return stsd.Av01, nil
+	}
+	return nil, fmt.Errorf("no AVC, HEVC or AV1 sample entry in video track")
+}
+
+// editListOffset returns the shift from media time to presentation time in the media
+// timescale, given by an empty edit and the media time of the first non-empty edit.
+func editListOffset(moov *mp4.MoovBox, trak *mp4.TrakBox) int64 {
+	offset := int64(0)
+	for _, ch := range trak.Children {
+		edts, ok := ch.(*mp4.EdtsBox)
+		if !ok {
+			continue
+		}
+		for _, el := range edts.Elst {
+			for _, entry := range el.Entries {
+				if entry.MediaTime < 0 {
+					offset += int64(entry.SegmentDuration) * int64(trak.Mdia.Mdhd.Timescale) / int64(moov.Mvhd.Timescale)
+					continue
+				}
+				return offset - entry.MediaTime
+			}
+		}
+	}
+	return offset
+}
+
+func newCCFrame(sample []byte, vse *mp4.VisualSampleEntryBox, pts, dur int64, timescale uint32) (ccFrame, error) {
+	frame := ccFrame{
+		pts: pts * 1000 / int64(timescale),
+		dur: dur * 1000 / int64(timescale),
+	}
+	ccData, err := cc708.ExtractCCData(sample, vse)
+	if err != nil || ccData == nil {
+		return frame, err
+	}
+	frame.field1, frame.field2, err = sei.ParseCTA608(ccData)
+	return frame, err
+}
+
+func progressiveFrames(f *mp4.File) ([]ccFrame, error) {
+	trak, ok := findFirstVideoTrak(f.Moov)
+	if !ok {
+		return nil, fmt.Errorf("no video track found")
+	}
+	vse, err := videoSampleEntry(trak)
+	if err != nil {
+		return nil, err
+	}
+	timescale := trak.Mdia.Mdhd.Timescale
+	offset := editListOffset(f.Moov, trak)
+	stbl := trak.Mdia.Minf.Stbl
+	nrSamples := stbl.Stsz.SampleNumber
+	mdat := f.Mdat
+	mdatPayloadStart := mdat.PayloadAbsoluteOffset()
+	frames := make([]ccFrame, 0, nrSamples)
+	for sampleNr := 1; sampleNr <= int(nrSamples); sampleNr++ {
+		chunkNr, sampleNrAtChunkStart, err := stbl.Stsc.ChunkNrFromSampleNr(sampleNr)
+		if err != nil {
+			return nil, err
+		}
+		chunkOffset, err := getChunkOffset(stbl, chunkNr)
+		if err != nil {
+			return nil, err
+		}
+		for sNr := sampleNrAtChunkStart; sNr < sampleNr; sNr++ {
+			chunkOffset += int64(stbl.Stsz.GetSampleSize(sNr))
+		}
+		size := stbl.Stsz.GetSampleSize(sampleNr)
+		decTime, dur := stbl.Stts.GetDecodeTime(uint32(sampleNr))
+		var cto int64 = 0
+		if stbl.Ctts != nil {
+			cto = int64(stbl.Ctts.GetCompositionTimeOffset(uint32(sampleNr)))
+		}
+		offsetInMdatData := uint64(chunkOffset) - mdatPayloadStart
+		sample := mdat.Data[offsetInMdatData : offsetInMdatData+uint64(size)]
+		frame, err := newCCFrame(sample, vse, int64(decTime)+cto+offset, int64(dur), timescale)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", sampleNr, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+func getChunkOffset(stbl *mp4.StblBox, chunkNr int) (int64, error) {
+	if stbl.Stco != nil {
+		return int64(stbl.Stco.ChunkOffset[chunkNr-1]), nil
+	}
+	if stbl.Co64 != nil {
+		return int64(stbl.Co64.ChunkOffset[chunkNr-1]), nil
+	}
+	return 0, fmt.Errorf("neither stco nor co64 is present")
+}
+
+func fragmentedFrames(f *mp4.File) ([]ccFrame, error) {
+	if f.Init == nil {
+		return nil, fmt.Errorf("no init segment")
+	}
+	moov := f.Init.Moov
+	trak, ok := findFirstVideoTrak(moov)
+	if !ok {
+		return nil, fmt.Errorf("no video track found")
+	}
+	vse, err := videoSampleEntry(trak)
+	if err != nil {
+		return nil, err
+	}
+	timescale := trak.Mdia.Mdhd.Timescale
+	offset := editListOffset(moov, trak)
+	trackID := trak.Tkhd.TrackID
+	trex, _ := moov.Mvex.GetTrex(trackID)
+	var frames []ccFrame
+	for _, iSeg := range f.Segments {
+		for _, iFrag := range iSeg.Fragments {
+			if iFrag.Moof.Traf.Tfhd.TrackID != trackID {
+				continue
+			}
+			fSamples, err := iFrag.GetFullSamples(trex)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range fSamples {
+				frame, err := newCCFrame(s.Data, vse, s.PresentationTime()+offset, int64(s.Dur), timescale)
+				if err != nil {
+					return nil, fmt.Errorf("sample at %d: %w", s.DecodeTime, err)
+				}
+				frames = append(frames, frame)
+			}
+		}
+	}
+	return frames, nil
+}
+
+// decodeFrames feeds the frames to the decoder in presentation order, and returns the cues
+// with the last one ended at the end of the last frame.
+func decodeFrames(dec *cc608.Decoder, frames []ccFrame) []cc608.Cue {
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].pts < frames[j].pts })
+	end := int64(0)
+	for _, f := range frames {
+		dec.Decode(f.field1, f.field2, f.pts)
+		end = f.pts + f.dur
+	}
+	dec.Flush(end)
+	return dec.Cues
+}
+
+func formatTime(ms int64, fracSep string) string {
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, fracSep, ms%1000)
+}
+
+func writeSRT(w io.Writer, cues []cc608.Cue) error {
+	for i, c := range cues {
+		_, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, formatTime(c.Start, ","), formatTime(c.End, ","), c.Text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeWebVTT(w io.Writer, cues []cc608.Cue) error {
+	if _, err := fmt.Fprintf(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for _, c := range cues {
+		_, err := fmt.Fprintf(w, "%s --> %s\n%s\n\n", formatTime(c.Start, "."), formatTime(c.End, "."), c.Text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWvtt writes an init segment with a wvtt track with timescale 1000 and a single
+// fragment, where each cue is a vttc sample and gaps between cues are vtte samples.
+func writeWvtt(filePath string, cues []cc608.Cue) error {
+	init := mp4.CreateEmptyInit()
+	trak := init.AddEmptyTrack(1000, "wvtt", "en")
+	if err := trak.SetWvttDescriptor("WEBVTT"); err != nil {
+		return err
+	}
+	frag, err := mp4.CreateFragment(1, trak.Tkhd.TrackID)
+	if err != nil {
+		return err
+	}
+	now := int64(0)
+	addSample := func(box mp4.Box, end int64) error {
+		buf := bytes.Buffer{}
+		if err := box.Encode(&buf); err != nil {
+			return err
+		}
+		frag.AddFullSample(mp4.FullSample{
+			Sample:     mp4.Sample{Flags: mp4.SyncSampleFlags, Dur: uint32(end - now), Size: uint32(buf.Len())},
+			DecodeTime: uint64(now),
+			Data:       buf.Bytes(),
+		})
+		now = end
+		return nil
+	}
+	for _, c := range cues {
+		start := c.Start
+		if start < now {
+			start = now
+		}
+		if c.End <= start {
+			continue
+		}
+		if start > now {
+			if err := addSample(&mp4.VtteBox{}, start); err != nil {
+				return err
+			}
+		}
+		vttc := &mp4.VttcBox{}
+		vttc.AddChild(&mp4.PaylBox{CueText: c.Text})
+		if err := addSample(vttc, c.End); err != nil {
+			return err
+		}
+	}
+
+	ofd, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+	defer ofd.Close()
+	if err := init.Encode(ofd); err != nil {
+		return err
+	}
+	if now == 0 {
+		return nil
+	}
+	return frag.Encode(ofd)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/cc708"
+	"github.com/Eyevinn/mp4ff/hevc"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// writeCaptionedFile writes a fragmented HEVC file at 25 frames per second with a pop-on
+// caption in CC1 that is displayed from frame 6 and erased at frame 18.
+func writeCaptionedFile(t *testing.T, path string) {
+	t.Helper()
+	init := mp4.CreateEmptyInit()
+	trak := init.AddEmptyTrack(90000, "video", "und")
+	hvcC := &mp4.HvcCBox{DecConfRec: hevc.DecConfRec{ConfigurationVersion: 1, LengthSizeMinusOne: 3}}
+	vse := mp4.CreateVisualSampleEntryBox("hvc1", 1280, 720, hvcC)
+	trak.Mdia.Minf.Stbl.Stsd.AddChild(vse)
+
+	enc := cc708.NewEncoder(cc708.CCCountForFrameRate(25))
+	cc1 := [][]byte{
+		{0x14, 0x20, 0x14, 0x20}, // RCL
+		{0x14, 0x70, 0x14, 0x70}, // PAC row 15
+		[]byte("Hi!\x00"),
+		{0x14, 0x2f, 0x14, 0x2f}, // EOC
+		bytes.Repeat([]byte{0x80}, 20),
+		{0x14, 0x2c, 0x14, 0x2c}, // EDM
+	}
+	for _, field1 := range cc1 {
+		if err := enc.AddCTA608(field1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frag, err := mp4.CreateFragment(1, trak.Tkhd.TrackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idr := []byte{0, 0, 0, 4, byte(hevc.NALU_IDR_N_LP) << 1, 0x01, 0x12, 0x34}
+	for i := 0; i < 25; i++ {
+		frag.AddFullSample(mp4.FullSample{
+			Sample:     mp4.Sample{Flags: mp4.SyncSampleFlags, Dur: 3600, Size: uint32(len(idr))},
+			DecodeTime: uint64(i * 3600),
+			Data:       idr,
+		})
+	}
+	if err := cc708.InsertFragment(frag, nil, vse, enc); err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.Buffer{}
+	if err := init.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := frag.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCCExtract(t *testing.T) {
+	tmpDir := t.TempDir()
+	inFile := filepath.Join(tmpDir, "cc.mp4")
+	writeCaptionedFile(t, inFile)
+	wvttFile := filepath.Join(tmpDir, "cc_wvtt.mp4")
+
+	cases := []struct {
+		desc        string
+		args        []string
+		expectedErr bool
+		wantOut     string
+	}{
+		{desc: "no args", args: []string{appName}, expectedErr: true},
+		{desc: "unknown args", args: []string{appName, "-x"}, expectedErr: true},
+		{desc: "non-existing file", args: []string{appName, "infile.mp4"}, expectedErr: true},
+		{desc: "bad file", args: []string{appName, "main.go"}, expectedErr: true},
+		{desc: "bad channel", args: []string{appName, "-c", "5", inFile}, expectedErr: true},
+		{desc: "bad format", args: []string{appName, "-f", "ttml", inFile}, expectedErr: true},
+		{desc: "wvtt without output", args: []string{appName, "-f", "wvtt", inFile}, expectedErr: true},
+		{desc: "srt", args: []string{appName, inFile},
+			wantOut: "1\n00:00:00,240 --> 00:00:00,720\nHi!\n\n"},
+		{desc: "vtt", args: []string{appName, "-f", "vtt", inFile},
+			wantOut: "WEBVTT\n\n00:00:00.240 --> 00:00:00.720\nHi!\n\n"},
+		{desc: "other channel", args: []string{appName, "-c", "2", inFile}, wantOut: ""},
+		{desc: "wvtt", args: []string{appName, "-f", "wvtt", "-o", wvttFile, inFile}, wantOut: ""},
+		{desc: "version", args: []string{appName, "-version"}, expectedErr: false},
+		{desc: "help", args: []string{appName, "-h"}, expectedErr: false},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			gotOut := bytes.Buffer{}
+			err := run(c.args, &gotOut)
+			if c.expectedErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.wantOut != "" || c.desc == "other channel" {
+				if gotOut.String() != c.wantOut {
+					t.Errorf("got %q, want %q", gotOut.String(), c.wantOut)
+				}
+			}
+		})
+	}
+
+	wvtt, err := mp4.ReadMP4File(wvttFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fss, err := wvtt.Segments[0].Fragments[0].GetFullSamples(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTypes := []string{"vtte", "vttc"}
+	wantDurs := []uint32{240, 480}
+	if len(fss) != len(wantTypes) {
+		t.Fatalf("got %d wvtt samples, want %d", len(fss), len(wantTypes))
+	}
+	for i, fs := range fss {
+		box, err := mp4.DecodeBox(0, bytes.NewReader(fs.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if box.Type() != wantTypes[i] || fs.Dur != wantDurs[i] {
+			t.Errorf("sample %d: got %s with duration %d, want %s with %d", i, box.Type(), fs.Dur, wantTypes[i], wantDurs[i])
+		}
+	}
+}
@@ -0,0 +1,21 @@
+/*
+mp4ff-compose builds an mp4 file from a JSON or XML box tree, like the one written by mp4ff-info -format json/xml.
+Boxes are created from their type and fields. Boxes with a payload (hex) are decoded from it,
+and unknown box types are written as they are. Sizes are computed, and trun data offsets and
+saio offsets are recomputed for each moof followed by an mdat unless -keepoffsets is given.
+An mdat box without data gets zero bytes up to its size.
+
+	Usage of mp4ff-compose:
+
+		mp4ff-compose [options] <inFile.json|inFile.xml> <outFile>
+
+	options:
+
+		-format string
+			input format: json or xml (default from inFile extension)
+		-keepoffsets
+			Keep trun and saio offsets from input
+		-version
+			Get mp4ff version
+*/
+package main
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Eyevinn/mp4ff/internal"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+const (
+	appName = "mp4ff-compose"
+)
+
+var usg = `%s builds an mp4 file from a JSON or XML box tree, like the one written by mp4ff-info -format json/xml.
+Boxes are created from their type and fields. Boxes with a payload (hex) are decoded from it,
+and unknown box types are written as they are. Sizes are computed, and trun data offsets and
+saio offsets are recomputed for each moof followed by an mdat unless -keepoffsets is given.
+An mdat box without data gets zero bytes up to its size.
+
+Usage of %s:
+`
+
+type options struct {
+	format      string
+	keepOffsets bool
+	version     bool
+}
+
+func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usg, appName, appName)
+		fmt.Fprintf(os.Stderr, "\n%s [options] <inFile.json|inFile.xml> <outFile>\n\noptions:\n", appName)
+		fs.PrintDefaults()
+	}
+
+	opts := options{}
+
+	fs.StringVar(&opts.format, "format", "", "input format: json or xml (default from inFile extension)")
+	fs.BoolVar(&opts.keepOffsets, "keepoffsets", false, "Keep trun and saio offsets from input")
+	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
+
+	err := fs.Parse(args[1:])
+	return &opts, err
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	o, err := parseOptions(fs, args)
+
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if o.version {
+		fmt.Fprintf(stdout, "%s %s\n", appName, internal.GetVersion())
+		return nil
+	}
+
+	if len(fs.Args()) != 2 {
+		fs.Usage()
+		return fmt.Errorf("must specify inFile and outFile")
+	}
+	inFilePath := fs.Arg(0)
+	outFilePath := fs.Arg(1)
+
+	format := o.format
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(inFilePath)), ".")
+	}
+	switch mp4.DumpFormat(format) {
+	case mp4.DumpJSON, mp4.DumpXML:
+	default:
+		return fmt.Errorf("unknown input format %q", format)
+	}
+
+	ifh, err := os.Open(inFilePath)
+	if err != nil {
+		return fmt.Errorf("error opening input file: %w", err)
+	}
+	defer ifh.Close()
+	nodes, err := mp4.ParseBoxTree(ifh, mp4.DumpFormat(format))
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", inFilePath, err)
+	}
+	boxes, err := mp4.ComposeBoxes(nodes, mp4.ComposeOptions{KeepDataOffsets: o.keepOffsets})
+	if err != nil {
+		return fmt.Errorf("error composing boxes: %w", err)
+	}
+
+	ofh, err := os.Create(outFilePath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer ofh.Close()
+	for _, b := range boxes {
+		if err := b.Encode(ofh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestCommandLines(t *testing.T) {
+	cases := []struct {
+		desc        string
+		args        []string
+		expectedErr bool
+	}{
+		{desc: "help", args: []string{appName, "-h"}, expectedErr: false},
+		{desc: "version", args: []string{appName, "-version"}, expectedErr: false},
+		{desc: "no args", args: []string{appName}, expectedErr: true},
+		{desc: "unknown args", args: []string{appName, "-x"}, expectedErr: true},
+		{desc: "unknown format", args: []string{appName, "tree.txt", "dummy.mp4"}, expectedErr: true},
+		{desc: "non-existing infile", args: []string{appName, "notExists.json", "dummy.mp4"}, expectedErr: true},
+		{desc: "not a tree", args: []string{appName, "-format", "json", "../../mp4/testdata/init.mp4", "dummy.mp4"},
+			expectedErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			gotOut := bytes.Buffer{}
+			err := run(c.args, &gotOut)
+			if c.expectedErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestComposeFromDump(t *testing.T) {
+	testFile := "../../mp4/testdata/init.mp4"
+	raw, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := mp4.DecodeFile(bytes.NewBuffer(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []mp4.DumpFormat{mp4.DumpJSON, mp4.DumpXML} {
+		dir := t.TempDir()
+		treeFile := dir + "/init." + string(format)
+		outFile := dir + "/init.mp4"
+		var tree bytes.Buffer
+		if err := in.Dump(&tree, format); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(treeFile, tree.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := run([]string{appName, treeFile, outFile}, os.Stdout); err != nil {
+			t.Fatal(err)
+		}
+		out, err := os.ReadFile(outFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, raw) {
+			t.Errorf("%s: composed file differs from %s", format, testFile)
+		}
+	}
+}
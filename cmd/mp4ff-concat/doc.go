@@ -0,0 +1,22 @@
+/*
+mp4ff-concat concatenates progressive or fragmented mp4 files with the same tracks.
+Tracks are matched in order and must have the same handler type and timescale.
+Decode times are made continuous, fragments are renumbered, and a sidx box is generated
+for fragmented output if any input has one. The output is progressive unless -frag is given.
+
+	Usage of mp4ff-concat:
+
+		mp4ff-concat [options] <inFile1> <inFile2> ... <outFile>
+
+	options:
+
+		-frag
+			Write fragmented output
+		-fragdur uint
+			Minimum fragment duration in milliseconds for progressive input (default 2000)
+		-switch
+			Allow different sample entries by adding stsd entries
+		-version
+			Get mp4ff version
+*/
+package main
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Eyevinn/mp4ff/internal"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+const (
+	appName = "mp4ff-concat"
+)
+
+var usg = `%s concatenates progressive or fragmented mp4 files with the same tracks.
+Tracks are matched in order and must have the same handler type and timescale.
+Decode times are made continuous, fragments are renumbered, and a sidx box is generated
+for fragmented output if any input has one. The output is progressive unless -frag is given.
+
+Usage of %s:
+`
+
+type options struct {
+	fragmented  bool
+	allowSwitch bool
+	fragDurMS   uint
+	version     bool
+}
+
+func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usg, appName, appName)
+		fmt.Fprintf(os.Stderr, "\n%s [options] <inFile1> <inFile2> ... <outFile>\n\noptions:\n", appName)
+		fs.PrintDefaults()
+	}
+
+	opts := options{}
+
+	fs.BoolVar(&opts.fragmented, "frag", false, "Write fragmented output")
+	fs.BoolVar(&opts.allowSwitch, "switch", false, "Allow different sample entries by adding stsd entries")
+	fs.UintVar(&opts.fragDurMS, "fragdur", 2000, "Minimum fragment duration in milliseconds for progressive input")
+	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
+
+	err := fs.Parse(args[1:])
+	return &opts, err
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	o, err := parseOptions(fs, args)
+
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if o.version {
+		fmt.Fprintf(stdout, "%s %s\n", appName, internal.GetVersion())
+		return nil
+	}
+
+	if len(fs.Args()) < 3 {
+		fs.Usage()
+		return fmt.Errorf("must specify at least two inFiles and an outFile")
+	}
+	inFilePaths := fs.Args()[:len(fs.Args())-1]
+	outFilePath := fs.Arg(len(fs.Args()) - 1)
+
+	files := make([]*mp4.File, 0, len(inFilePaths))
+	for _, inFilePath := range inFilePaths {
+		f, err := mp4.ReadMP4File(inFilePath)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", inFilePath, err)
+		}
+		files = append(files, f)
+	}
+
+	out, err := mp4.Concatenate(files, mp4.ConcatOptions{
+		Fragmented:             o.fragmented,
+		AllowSampleEntrySwitch: o.allowSwitch,
+		FragmentDurationMS:     uint32(o.fragDurMS),
+	})
+	if err != nil {
+		return fmt.Errorf("error concatenating: %w", err)
+	}
+
+	ofh, err := os.Create(outFilePath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer ofh.Close()
+	return out.Encode(ofh)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestCommandLines(t *testing.T) {
+	cases := []struct {
+		desc        string
+		args        []string
+		expectedErr bool
+	}{
+		{desc: "help", args: []string{appName, "-h"}, expectedErr: false},
+		{desc: "version", args: []string{appName, "-version"}, expectedErr: false},
+		{desc: "no args", args: []string{appName}, expectedErr: true},
+		{desc: "unknown args", args: []string{appName, "-x"}, expectedErr: true},
+		{desc: "one infile", args: []string{appName, "../../mp4/testdata/prog_8s.mp4", "dummy.mp4"}, expectedErr: true},
+		{desc: "non-existing infile", args: []string{appName, "notExists.mp4", "notExists.mp4", "dummy.mp4"}, expectedErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			gotOut := bytes.Buffer{}
+			err := run(c.args, &gotOut)
+			if c.expectedErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestConcatFiles(t *testing.T) {
+	testFile := "../../mp4/testdata/prog_8s.mp4"
+	in, err := mp4.ReadMP4File(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frag := range []bool{false, true} {
+		outFile := t.TempDir() + "/concat.mp4"
+		args := []string{appName, testFile, testFile, outFile}
+		if frag {
+			args = []string{appName, "-frag", testFile, testFile, outFile}
+		}
+		if err := run(args, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+		out, err := mp4.ReadMP4File(outFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.IsFragmented() != frag {
+			t.Errorf("fragmented=%t: got fragmented output %t", frag, out.IsFragmented())
+		}
+		moov := out.Moov
+		if frag {
+			moov = out.Init.Moov
+		}
+		for i, trak := range moov.Traks {
+			if got, want := trak.Mdia.Mdhd.Duration, 2*in.Moov.Traks[i].Mdia.Mdhd.Duration; got != want {
+				t.Errorf("fragmented=%t track %d: got duration %d instead of %d", frag, i+1, got, want)
+			}
+		}
+	}
+}
@@ -3,6 +3,9 @@ mp4ff-crop crops a (progressive) mp4 file to just before a sync frame after spec
 The goal is to leave the file structure intact except for cropping of samples and
 moving mdat to the end of the file, if not already there.
 
+A fragmented file is instead trimmed to the interval given by -start and -end (or -start plus -d).
+Whole GOPs are kept, and an edit list in the new init segment gives the exact in and out points.
+
 	Usage of mp4ff-crop:
 
 		mp4ff-crop [options] <inFile> <outFile>
@@ -11,6 +14,10 @@ moving mdat to the end of the file, if not already there.
 
 		-d uint
 			Duration in milliseconds (default 1000)
+		-end uint
+			End time in milliseconds (fragmented files only). 0 means start + duration
+		-start uint
+			Start time in milliseconds (fragmented files only)
 		-version
 			Get mp4ff version
 */
@@ -20,11 +20,16 @@ var usg = `%s crops a (progressive) mp4 file to just before a sync frame after s
 The goal is to leave the file structure intact except for cropping of samples and
 moving mdat to the end of the file, if not already there.
 
+A fragmented file is instead trimmed to the interval given by -start and -end (or -start plus -d).
+Whole GOPs are kept, and an edit list in the new init segment gives the exact in and out points.
+
 Usage of %s:
 `
 
 type options struct {
 	durationMS uint
+	startMS    uint
+	endMS      uint
 	version    bool
 }
 
@@ -38,6 +43,8 @@ func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
 	opts := options{}
 
 	fs.UintVar(&opts.durationMS, "d", 1000, "Duration in milliseconds")
+	fs.UintVar(&opts.startMS, "start", 0, "Start time in milliseconds (fragmented files only)")
+	fs.UintVar(&opts.endMS, "end", 0, "End time in milliseconds (fragmented files only). 0 means start + duration")
 	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
 
 	err := fs.Parse(args[1:])
@@ -90,6 +97,13 @@ func run(args []string, stdout io.Writer) error {
 		return fmt.Errorf("error decoding mp4 file: %w", err)
 	}
 
+	if parsedMp4.IsFragmented() {
+		return trimFragmented(ifh, o, outFilePath)
+	}
+	if o.startMS != 0 || o.endMS != 0 {
+		return fmt.Errorf("start and end times are only supported for fragmented files")
+	}
+
 	ofh, err := os.Create(outFilePath)
 	if err != nil {
 		return fmt.Errorf("error creating output file: %w", err)
@@ -103,6 +117,34 @@ func run(args []string, stdout io.Writer) error {
 	return nil
 }
 
+// trimFragmented - trim a fragmented file to [start, end) with the sample data loaded in memory
+func trimFragmented(ifh io.ReadSeeker, o *options, outFilePath string) error {
+	endMS := o.endMS
+	if endMS == 0 {
+		endMS = o.startMS + o.durationMS
+	}
+	if endMS <= o.startMS {
+		return fmt.Errorf("end %dms not after start %dms", endMS, o.startMS)
+	}
+	if _, err := ifh.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	inMP4, err := mp4.DecodeFile(ifh)
+	if err != nil {
+		return fmt.Errorf("error decoding mp4 file: %w", err)
+	}
+	outMP4, err := mp4.TrimFragmentedFile(inMP4, uint64(o.startMS), uint64(endMS), 1000)
+	if err != nil {
+		return fmt.Errorf("error trimming mp4 file: %w", err)
+	}
+	ofh, err := os.Create(outFilePath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer ofh.Close()
+	return outMP4.Encode(ofh)
+}
+
 func cropMP4(inMP4 *mp4.File, durationMS int, w io.Writer, ifh io.ReadSeeker) error {
 	if inMP4.IsFragmented() {
 		return fmt.Errorf("only progressive files are supported")
@@ -343,16 +385,10 @@ func writeUptoMdat(inMP4 *mp4.File, endTime, endTimescale uint64, w io.Writer) e
 		if newDur > prevDur {
 			return fmt.Errorf("new duration %d larger than previous %d", newDur, prevDur)
 		}
-		durDiff := prevDur - newDur
 		if trak.Edts != nil {
-			for i := range trak.Edts.Elst {
-				for j := range trak.Edts.Elst[i].Entries {
-					prevDur := trak.Edts.Elst[i].Entries[j].SegmentDuration
-					if prevDur > durDiff {
-						trak.Edts.Elst[i].Entries[j].SegmentDuration -= durDiff
-					}
-				}
-			}
+			tl := trak.Timeline(mvhd.Timescale)
+			end := mp4.RescaleTime(newDur, mvhd.Timescale, tl.Timescale)
+			trak.SetEdits(mvhd.Timescale, tl.Clip(0, int64(end)))
 		}
 	}
 	for _, box := range inMP4.Children {
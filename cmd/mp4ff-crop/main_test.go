@@ -70,3 +70,32 @@ func TestCroppedFileDuration(t *testing.T) {
 		t.Errorf("got %d/%dms instead of %dms", moovDur, moovTimescale, cropDur)
 	}
 }
+
+func TestTrimFragmentedFile(t *testing.T) {
+	testFile := "../../mp4/testdata/v300_multiple_segments.mp4"
+	outFile := t.TempDir() + "/trimmed.mp4"
+	err := run([]string{appName, "-start", "1000", "-end", "2500", testFile, outFile}, os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trimmed, err := mp4.ReadMP4File(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trak := trimmed.Init.Moov.Trak
+	if trak.Edts == nil {
+		t.Fatal("no edit list in trimmed file")
+	}
+	elstDur := trak.Edts.Elst[0].Entries[0].SegmentDuration
+	if elstDur*1000 != 1500*uint64(trimmed.Init.Moov.Mvhd.Timescale) {
+		t.Errorf("got edit duration %d", elstDur)
+	}
+	if trimmed.Segments[0].Fragments[0].Moof.Mfhd.SequenceNumber != 1 {
+		t.Errorf("sequence numbers not rewritten")
+	}
+
+	err = run([]string{appName, "-start", "1000", "../../mp4/testdata/prog_8s.mp4", outFile}, os.Stdout)
+	if err == nil {
+		t.Error("expected error for start time with progressive file")
+	}
+}
@@ -1,13 +1,11 @@
 package main
 
 import (
-	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 
 	"github.com/Eyevinn/mp4ff/internal"
 	"github.com/Eyevinn/mp4ff/mp4"
@@ -25,75 +23,10 @@ Usage of %s:
 
 type options struct {
 	initFilePath string
-	keyStrs      stringSliceFlag
+	keyStrs      internal.StringSliceFlag
 	version      bool
 }
 
-type stringSliceFlag []string
-
-func (s *stringSliceFlag) String() string {
-	return strings.Join(*s, ",")
-}
-
-func (s *stringSliceFlag) Set(value string) error {
-	*s = append(*s, value)
-	return nil
-}
-
-func parseKeys(keyStrs []string) (key []byte, keysByKID map[string][]byte, strictKIDMode bool, err error) {
-	if len(keyStrs) == 0 {
-		return nil, nil, false, fmt.Errorf("no key specified")
-	}
-
-	hasKIDPair := false
-	hasLegacyKey := false
-	for _, keyStr := range keyStrs {
-		if strings.Contains(keyStr, ":") {
-			hasKIDPair = true
-		} else {
-			hasLegacyKey = true
-		}
-	}
-
-	if hasKIDPair && hasLegacyKey {
-		return nil, nil, false, fmt.Errorf("cannot mix legacy key and kid:key key format")
-	}
-
-	if !hasKIDPair {
-		if len(keyStrs) != 1 {
-			return nil, nil, false, fmt.Errorf("multiple legacy keys are not supported")
-		}
-		key, err = mp4.UnpackKey(keyStrs[0])
-		if err != nil {
-			return nil, nil, false, fmt.Errorf("unpacking key: %w", err)
-		}
-		return key, nil, false, nil
-	}
-
-	keysByKID = make(map[string][]byte, len(keyStrs))
-	for _, keyStr := range keyStrs {
-		parts := strings.SplitN(keyStr, ":", 2)
-		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-			return nil, nil, false, fmt.Errorf("bad kid:key format %q", keyStr)
-		}
-		kid, err := mp4.UnpackKey(parts[0])
-		if err != nil {
-			return nil, nil, false, fmt.Errorf("unpacking kid: %w", err)
-		}
-		kidHex := hex.EncodeToString(kid)
-		if _, exists := keysByKID[kidHex]; exists {
-			return nil, nil, false, fmt.Errorf("duplicate kid %s", kidHex)
-		}
-		k, err := mp4.UnpackKey(parts[1])
-		if err != nil {
-			return nil, nil, false, fmt.Errorf("unpacking key for kid %s: %w", kidHex, err)
-		}
-		keysByKID[kidHex] = k
-	}
-
-	return nil, keysByKID, true, nil
-}
-
 func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, usg, appName, appName)
@@ -140,7 +73,11 @@ func run(args []string) error {
 	var inFilePath = fs.Arg(0)
 	var outFilePath = fs.Arg(1)
 
-	key, keysByKID, strictKIDMode, err := parseKeys(opts.keyStrs)
+	if len(opts.keyStrs) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no key specified")
+	}
+	key, keysByKID, strictKIDMode, err := internal.ParseKeys(opts.keyStrs)
 	if err != nil {
 		fs.Usage()
 		return err
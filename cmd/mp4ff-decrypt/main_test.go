@@ -211,101 +211,6 @@ func TestDecodeFiles(t *testing.T) {
 	}
 }
 
-func TestParseKeys(t *testing.T) {
-	legacyKey := "00112233445566778899aabbccddeeff"
-	kidWithDash := "855ca997-b201-5736-f3d6-a59c9eff84d9"
-	kidNoDash := "855ca997b2015736f3d6a59c9eff84d9"
-
-	t.Run("legacy key", func(t *testing.T) {
-		key, keysByKID, strictMode, err := parseKeys([]string{legacyKey})
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
-		if strictMode {
-			t.Fatal("expected non-strict mode")
-		}
-		if len(key) != 16 {
-			t.Fatalf("unexpected key length: %d", len(key))
-		}
-		if len(keysByKID) != 0 {
-			t.Fatalf("expected no kid map, got %d", len(keysByKID))
-		}
-	})
-
-	t.Run("duplicate kid fails", func(t *testing.T) {
-		_, _, _, err := parseKeys([]string{kidWithDash + ":" + legacyKey, kidNoDash + ":" + legacyKey})
-		if err == nil {
-			t.Fatal("expected duplicate kid error")
-		}
-		if !strings.Contains(err.Error(), "duplicate kid") {
-			t.Fatalf("unexpected error: %v", err)
-		}
-	})
-
-	t.Run("single kid:key pair", func(t *testing.T) {
-		_, keysByKID, strictMode, err := parseKeys([]string{kidNoDash + ":" + legacyKey})
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
-		if !strictMode {
-			t.Fatal("expected strict mode")
-		}
-		if len(keysByKID) != 1 {
-			t.Fatalf("expected 1 kid map entry, got %d", len(keysByKID))
-		}
-	})
-
-	t.Run("multiple legacy keys fails", func(t *testing.T) {
-		_, _, _, err := parseKeys([]string{legacyKey, legacyKey})
-		if err == nil {
-			t.Fatal("expected error")
-		}
-		if !strings.Contains(err.Error(), "multiple legacy keys") {
-			t.Fatalf("unexpected error: %v", err)
-		}
-	})
-
-	t.Run("bad kid:key format", func(t *testing.T) {
-		_, _, _, err := parseKeys([]string{":"})
-		if err == nil {
-			t.Fatal("expected error")
-		}
-		if !strings.Contains(err.Error(), "bad kid:key format") {
-			t.Fatalf("unexpected error: %v", err)
-		}
-	})
-
-	t.Run("bad kid in pair", func(t *testing.T) {
-		_, _, _, err := parseKeys([]string{"badkid:" + legacyKey})
-		if err == nil {
-			t.Fatal("expected error")
-		}
-		if !strings.Contains(err.Error(), "unpacking kid") {
-			t.Fatalf("unexpected error: %v", err)
-		}
-	})
-
-	t.Run("bad key in pair", func(t *testing.T) {
-		_, _, _, err := parseKeys([]string{kidNoDash + ":badkey"})
-		if err == nil {
-			t.Fatal("expected error")
-		}
-		if !strings.Contains(err.Error(), "unpacking key for kid") {
-			t.Fatalf("unexpected error: %v", err)
-		}
-	})
-
-	t.Run("mixed mode fails", func(t *testing.T) {
-		_, _, _, err := parseKeys([]string{legacyKey, kidNoDash + ":" + legacyKey})
-		if err == nil {
-			t.Fatal("expected strict mixed mode error")
-		}
-		if !strings.Contains(err.Error(), "cannot mix") {
-			t.Fatalf("unexpected error: %v", err)
-		}
-	})
-}
-
 func TestStrictKIDKeySelection(t *testing.T) {
 	inFile := "../../mp4/testdata/cbcs_audio.mp4"
 	expectedOutFile := "../../mp4/testdata/cbcs_audiodec.mp4"
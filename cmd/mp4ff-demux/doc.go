@@ -0,0 +1,23 @@
+/*
+mp4ff-demux splits a multi-track progressive or fragmented mp4 file into one fragmented
+output per track, with track ID 1. By default, each track is written as an init segment
+<name>_<trackID>_<handler>_init.mp4 and media segments <name>_<trackID>_<handler>_<nr>.m4s.
+With -single, each track is written as one CMAF track file <name>_<trackID>_<handler>.mp4.
+Encryption boxes, pssh, sample groups and events are carried over to the tracks they belong to.
+
+	Usage of mp4ff-demux:
+
+		mp4ff-demux [options] <inFile> <outDir>
+
+	options:
+
+		-fragdur uint
+			Minimum fragment duration in milliseconds for progressive input (default 2000)
+		-sidx
+			Add sidx to CMAF track files even if the input has none
+		-single
+			Write one CMAF track file per track instead of init and media segment files
+		-version
+			Get mp4ff version
+*/
+package main
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Eyevinn/mp4ff/internal"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+const (
+	appName = "mp4ff-demux"
+)
+
+var usg = `%s splits a multi-track progressive or fragmented mp4 file into one fragmented
+output per track, with track ID 1. By default, each track is written as an init segment
+<name>_<trackID>_<handler>_init.mp4 and media segments <name>_<trackID>_<handler>_<nr>.m4s.
+With -single, each track is written as one CMAF track file <name>_<trackID>_<handler>.mp4.
+Encryption boxes, pssh, sample groups and events are carried over to the tracks they belong to.
+
+Usage of %s:
+`
+
+type options struct {
+	single    bool
+	sidx      bool
+	fragDurMS uint
+	version   bool
+}
+
+func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usg, appName, appName)
+		fmt.Fprintf(os.Stderr, "\n%s [options] <inFile> <outDir>\n\noptions:\n", appName)
+		fs.PrintDefaults()
+	}
+
+	opts := options{}
+
+	fs.BoolVar(&opts.single, "single", false, "Write one CMAF track file per track instead of init and media segment files")
+	fs.BoolVar(&opts.sidx, "sidx", false, "Add sidx to CMAF track files even if the input has none")
+	fs.UintVar(&opts.fragDurMS, "fragdur", 2000, "Minimum fragment duration in milliseconds for progressive input")
+	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
+
+	err := fs.Parse(args[1:])
+	return &opts, err
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	o, err := parseOptions(fs, args)
+
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if o.version {
+		fmt.Fprintf(stdout, "%s %s\n", appName, internal.GetVersion())
+		return nil
+	}
+
+	if len(fs.Args()) != 2 {
+		fs.Usage()
+		return fmt.Errorf("must specify inFile and outDir")
+	}
+	inFilePath := fs.Arg(0)
+	outDir := fs.Arg(1)
+
+	inMP4, err := mp4.ReadMP4File(inFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", inFilePath, err)
+	}
+	outs, err := mp4.Demux(inMP4, mp4.DemuxOptions{
+		FragmentDurationMS: uint32(o.fragDurMS),
+		AddSidx:            o.single && o.sidx,
+	})
+	if err != nil {
+		return fmt.Errorf("error demuxing: %w", err)
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(path.Base(inFilePath), path.Ext(inFilePath))
+	inMoov := inMP4.Moov
+	if inMP4.IsFragmented() {
+		inMoov = inMP4.Init.Moov
+	}
+	for i, out := range outs {
+		inTrak := inMoov.Traks[i]
+		prefix := path.Join(outDir, fmt.Sprintf("%s_%d_%s", name, inTrak.Tkhd.TrackID, inTrak.Mdia.Hdlr.HandlerType))
+		if o.single {
+			if err := writeFile(out, prefix+".mp4", stdout); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeFile(out.Init, prefix+"_init.mp4", stdout); err != nil {
+			return err
+		}
+		for j, seg := range out.Segments {
+			if err := writeFile(seg, fmt.Sprintf("%s_%d.m4s", prefix, j+1), stdout); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type encoder interface {
+	Encode(w io.Writer) error
+}
+
+func writeFile(e encoder, filePath string, stdout io.Writer) error {
+	ofh, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer ofh.Close()
+	if err := e.Encode(ofh); err != nil {
+		return fmt.Errorf("error writing %s: %w", filePath, err)
+	}
+	fmt.Fprintf(stdout, "wrote %s\n", filePath)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestCommandLines(t *testing.T) {
+	cases := []struct {
+		desc        string
+		args        []string
+		expectedErr bool
+	}{
+		{desc: "help", args: []string{appName, "-h"}, expectedErr: false},
+		{desc: "version", args: []string{appName, "-version"}, expectedErr: false},
+		{desc: "no args", args: []string{appName}, expectedErr: true},
+		{desc: "unknown args", args: []string{appName, "-x"}, expectedErr: true},
+		{desc: "non-existing infile", args: []string{appName, "notExists.mp4", "outDir"}, expectedErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			gotOut := bytes.Buffer{}
+			err := run(c.args, &gotOut)
+			if c.expectedErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestDemuxFiles(t *testing.T) {
+	inFile := "../../mp4/testdata/prog_8s_enc_dashinit.mp4"
+	outDir := t.TempDir()
+	if err := run([]string{appName, inFile, outDir}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"prog_8s_enc_dashinit_2_vide_init.mp4", "prog_8s_enc_dashinit_1_soun_2.m4s"} {
+		if _, err := os.Stat(path.Join(outDir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := run([]string{appName, "-single", inFile, outDir}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.ReadMP4File(path.Join(outDir, "prog_8s_enc_dashinit_2_vide.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Init.Moov.Traks) != 1 || f.Init.Moov.Trak.Tkhd.TrackID != 1 || f.Sidx == nil {
+		t.Errorf("bad CMAF track file")
+	}
+}
@@ -0,0 +1,24 @@
+/*
+mp4ff-diff reports structural differences between two mp4 files.
+Boxes are matched by type and order, and added, removed, and changed boxes are listed
+with field-level differences. The mdat data is compared byte by byte, or per sample with -samples.
+The exit code is 1 if the files differ.
+
+	Usage of mp4ff-diff:
+
+		mp4ff-diff [options] <file1> <file2>
+
+	options:
+
+		-format string
+			Output format: text or json (default "text")
+		-ignore string
+			Comma-separated boxes and box fields to ignore, e.g. emsg,tfdt.BaseMediaDecodeTime
+		-samples
+			Compare sample data hashes per track instead of mdat bytes
+		-version
+			Get mp4ff version
+		-volatile
+			Ignore volatile fields: creation times in mvhd/tkhd/mdhd, mfhd sequence numbers, and prft boxes
+*/
+package main
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Eyevinn/mp4ff/internal"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+const (
+	appName = "mp4ff-diff"
+)
+
+var usg = `%s reports structural differences between two mp4 files.
+Boxes are matched by type and order, and added, removed, and changed boxes are listed
+with field-level differences. The mdat data is compared byte by byte, or per sample with -samples.
+The exit code is 1 if the files differ.
+
+Usage of %s:
+`
+
+// errFilesDiffer - files differ, which gives exit code 1 without error message
+var errFilesDiffer = errors.New("files differ")
+
+type options struct {
+	ignoreVolatile bool
+	ignore         string
+	samples        bool
+	format         string
+	version        bool
+}
+
+func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usg, appName, appName)
+		fmt.Fprintf(os.Stderr, "\n%s [options] <file1> <file2>\n\noptions:\n", appName)
+		fs.PrintDefaults()
+	}
+
+	opts := options{}
+
+	fs.BoolVar(&opts.ignoreVolatile, "volatile", false,
+		"Ignore volatile fields: creation times in mvhd/tkhd/mdhd, mfhd sequence numbers, and prft boxes")
+	fs.StringVar(&opts.ignore, "ignore", "", "Comma-separated boxes and box fields to ignore, e.g. emsg,tfdt.BaseMediaDecodeTime")
+	fs.BoolVar(&opts.samples, "samples", false, "Compare sample data hashes per track instead of mdat bytes")
+	fs.StringVar(&opts.format, "format", "text", "Output format: text or json")
+	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
+
+	err := fs.Parse(args[1:])
+	return &opts, err
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		if !errors.Is(err, errFilesDiffer) {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	o, err := parseOptions(fs, args)
+
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if o.version {
+		fmt.Fprintf(stdout, "%s %s\n", appName, internal.GetVersion())
+		return nil
+	}
+
+	if o.format != "text" && o.format != "json" {
+		return fmt.Errorf("unknown format %q", o.format)
+	}
+
+	if len(fs.Args()) != 2 {
+		fs.Usage()
+		return fmt.Errorf("need two input files")
+	}
+
+	files := make([]*mp4.File, 0, 2)
+	for _, path := range fs.Args() {
+		f, err := mp4.ReadMP4File(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		files = append(files, f)
+	}
+
+	diffOpts := mp4.DiffOptions{
+		IgnoreVolatile: o.ignoreVolatile,
+		CompareSamples: o.samples,
+	}
+	if o.ignore != "" {
+		diffOpts.Ignore = strings.Split(o.ignore, ",")
+	}
+	res, err := mp4.Diff(files[0], files[1], diffOpts)
+	if err != nil {
+		return err
+	}
+	if o.format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprint(stdout, res.String())
+	}
+	if !res.Equal() {
+		return errFilesDiffer
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestCommandLines(t *testing.T) {
+	testFile := "../../mp4/testdata/prog_8s.mp4"
+	cases := []struct {
+		desc        string
+		args        []string
+		expectedErr bool
+	}{
+		{desc: "help", args: []string{appName, "-h"}, expectedErr: false},
+		{desc: "version", args: []string{appName, "-version"}, expectedErr: false},
+		{desc: "no args", args: []string{appName}, expectedErr: true},
+		{desc: "unknown args", args: []string{appName, "-x"}, expectedErr: true},
+		{desc: "one file", args: []string{appName, testFile}, expectedErr: true},
+		{desc: "bad format", args: []string{appName, "-format", "xml", testFile, testFile}, expectedErr: true},
+		{desc: "non-existing file", args: []string{appName, testFile, "notExists.mp4"}, expectedErr: true},
+		{desc: "same file", args: []string{appName, testFile, testFile}, expectedErr: false},
+		{desc: "same file json", args: []string{appName, "-format", "json", "-samples", testFile, testFile}, expectedErr: false},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			gotOut := bytes.Buffer{}
+			err := run(c.args, &gotOut)
+			if c.expectedErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	testFile := "../../mp4/testdata/prog_8s.mp4"
+	f, err := mp4.ReadMP4File(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Moov.Mvhd.CreationTime++
+	f.Moov.Traks[0].Tkhd.Volume = 0
+	outFile := t.TempDir() + "/changed.mp4"
+	ofh, err := os.Create(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Encode(ofh); err != nil {
+		t.Fatal(err)
+	}
+	ofh.Close()
+
+	var out bytes.Buffer
+	err = run([]string{appName, "-volatile", testFile, outFile}, &out)
+	if !errors.Is(err, errFilesDiffer) {
+		t.Fatalf("expected files to differ, got %v", err)
+	}
+	want := "~ moov/trak[1]/tkhd"
+	if !strings.HasPrefix(out.String(), want) || strings.Contains(out.String(), "CreationTime") {
+		t.Errorf("got diff output\n%s", out.String())
+	}
+	out.Reset()
+	if err := run([]string{appName, "-volatile", "-ignore", "tkhd.Volume", testFile, outFile}, &out); err != nil {
+		t.Errorf("expected no differences, got %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,30 @@
+/*
+mp4ff-extract writes the samples of a track in a progressive or fragmented mp4 file as an
+elementary stream, for example only the sync samples for a thumbnailer.
+AVC, HEVC and VVC are written as Annex B byte streams with the parameter sets from avcC, hvcC
+or vvcC inserted before the first sample and every sync sample that lacks them.
+VP8, VP9 and AV1 are written as IVF files, AAC as ADTS, and other codecs as raw sample payloads.
+Without -sync, the output starts at the last sync sample at or before -start, so that it can be decoded.
+Encrypted fragmented files are decrypted on the fly if keys are given.
+The outFile - writes to stdout.
+
+	Usage of mp4ff-extract:
+
+		mp4ff-extract [options] <inFile> <outFile>
+
+	options:
+
+		-end float
+			End time in seconds (0 for the end of the track)
+		-key value
+			key (32 hex or 24 base64 chars) or kid:key pair for encrypted input. Can be repeated
+		-start float
+			Start time in seconds
+		-sync
+			Only extract sync samples
+		-track uint
+			trackID to extract (0 for the first video track, or the first track if there is no video)
+		-version
+			Get mp4ff version
+*/
+package main
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Eyevinn/mp4ff/aac"
+	"github.com/Eyevinn/mp4ff/av1"
+	"github.com/Eyevinn/mp4ff/avc"
+	"github.com/Eyevinn/mp4ff/hevc"
+	"github.com/Eyevinn/mp4ff/internal"
+	"github.com/Eyevinn/mp4ff/ivf"
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/vvc"
+)
+
+const (
+	appName = "mp4ff-extract"
+)
+
+var usg = `%s writes the samples of a track in a progressive or fragmented mp4 file as an
+elementary stream, for example only the sync samples for a thumbnailer.
+AVC, HEVC and VVC are written as Annex B byte streams with the parameter sets from avcC, hvcC
+or vvcC inserted before the first sample and every sync sample that lacks them.
+VP8, VP9 and AV1 are written as IVF files, AAC as ADTS, and other codecs as raw sample payloads.
+Without -sync, the output starts at the last sync sample at or before -start, so that it can be decoded.
+Encrypted fragmented files are decrypted on the fly if keys are given.
+The outFile - writes to stdout.
+
+Usage of %s:
+`
+
+type options struct {
+	trackID uint
+	sync    bool
+	start   float64
+	end     float64
+	keyStrs internal.StringSliceFlag
+	version bool
+}
+
+func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usg, appName, appName)
+		fmt.Fprintf(os.Stderr, "\n%s [options] <inFile> <outFile>\n\noptions:\n", appName)
+		fs.PrintDefaults()
+	}
+
+	opts := options{}
+
+	fs.UintVar(&opts.trackID, "track", 0, "trackID to extract (0 for the first video track, or the first track if there is no video)")
+	fs.BoolVar(&opts.sync, "sync", false, "Only extract sync samples")
+	fs.Float64Var(&opts.start, "start", 0, "Start time in seconds")
+	fs.Float64Var(&opts.end, "end", 0, "End time in seconds (0 for the end of the track)")
+	fs.Var(&opts.keyStrs, "key", "key (32 hex or 24 base64 chars) or kid:key pair for encrypted input. Can be repeated")
+	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
+
+	err := fs.Parse(args[1:])
+	return &opts, err
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	o, err := parseOptions(fs, args)
+
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if o.version {
+		fmt.Fprintf(stdout, "%s %s\n", appName, internal.GetVersion())
+		return nil
+	}
+
+	if len(fs.Args()) != 2 {
+		fs.Usage()
+		return fmt.Errorf("must specify inFile and outFile")
+	}
+	if o.start < 0 || (o.end != 0 && o.end <= o.start) {
+		return fmt.Errorf("bad time range %g-%g", o.start, o.end)
+	}
+	key, keysByKID, strictKIDMode, err := internal.ParseKeys(o.keyStrs)
+	if err != nil {
+		return err
+	}
+	inFilePath, outFilePath := fs.Arg(0), fs.Arg(1)
+
+	ifh, err := os.Open(inFilePath)
+	if err != nil {
+		return fmt.Errorf("could not open input file: %w", err)
+	}
+	defer ifh.Close()
+	f, err := mp4.DecodeFile(ifh, mp4.WithDecodeMode(mp4.DecModeLazyMdat))
+	if err != nil {
+		return fmt.Errorf("could not parse input file: %w", err)
+	}
+	if f.Moov == nil {
+		return fmt.Errorf("no moov box in %s", inFilePath)
+	}
+	trak, err := findTrak(f.Moov, uint32(o.trackID))
+	if err != nil {
+		return err
+	}
+	trackID := trak.Tkhd.TrackID
+
+	var d *decrypter
+	if len(o.keyStrs) > 0 {
+		if d, err = newDecrypter(f, key, keysByKID, strictKIDMode); err != nil {
+			return err
+		}
+	}
+	entry := trak.Mdia.Minf.Stbl.Stsd.Children[0]
+	if t := entry.Type(); t == "encv" || t == "enca" {
+		return fmt.Errorf("track %d is encrypted, a key is needed", trackID)
+	}
+
+	infos, err := f.SampleInfos(trackID)
+	if err != nil {
+		return err
+	}
+	timescale := float64(trak.Mdia.Mdhd.Timescale)
+	selected := selectSamples(infos, o.sync, int64(o.start*timescale), int64(o.end*timescale))
+	if len(selected) == 0 {
+		return fmt.Errorf("no samples to extract for track %d", trackID)
+	}
+	var samples []sample
+	if d == nil {
+		samples, err = readSamples(ifh, selected)
+	} else {
+		samples, err = d.readSamples(ifh, trackID, infos, selected)
+	}
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = stdout
+	if outFilePath != "-" {
+		ofh, err := os.Create(outFilePath)
+		if err != nil {
+			return fmt.Errorf("could not create output file: %w", err)
+		}
+		defer ofh.Close()
+		w = ofh
+	}
+	sw, err := newSampleWriter(w, entry, trak.Mdia.Mdhd.Timescale, len(samples))
+	if err != nil {
+		return err
+	}
+	for _, s := range samples {
+		if err := sw.writeSample(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findTrak returns the track with trackID, or for trackID 0 the first video track or first track
+func findTrak(moov *mp4.MoovBox, trackID uint32) (*mp4.TrakBox, error) {
+	for _, trak := range moov.Traks {
+		if trackID == trak.Tkhd.TrackID || (trackID == 0 && trak.Mdia.Hdlr.HandlerType == "vide") {
+			return trak, nil
+		}
+	}
+	if trackID == 0 && len(moov.Traks) > 0 {
+		return moov.Traks[0], nil
+	}
+	return nil, fmt.Errorf("no track with ID %d", trackID)
+}
+
+// sample - timing and data of a sample to extract
+type sample struct {
+	pts  int64
+	sync bool
+	data []byte
+}
+
+// selectSamples returns the samples with presentation time in [start, end), where end 0 means no end.
+// Unless syncOnly, it starts at the last sync sample at or before start.
+func selectSamples(infos []mp4.SampleInfo, syncOnly bool, start, end int64) []mp4.SampleInfo {
+	first := 0
+	if !syncOnly {
+		for i, info := range infos {
+			if info.Sync && info.PTS <= start {
+				first = i
+			}
+		}
+	}
+	var selected []mp4.SampleInfo
+	for _, info := range infos[first:] {
+		if end > 0 && info.PTS >= end {
+			continue
+		}
+		if syncOnly && (!info.Sync || info.PTS < start) {
+			continue
+		}
+		selected = append(selected, info)
+	}
+	return selected
+}
+
+// readSamples reads the data of the selected samples from ra. Only the selected samples are
+// read, so the file can be decoded with DecModeLazyMdat.
+func readSamples(ra io.ReaderAt, selected []mp4.SampleInfo) ([]sample, error) {
+	datas, err := mp4.ReadSampleData(ra, selected, 1024)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]sample, len(selected))
+	for i, info := range selected {
+		samples[i] = sample{pts: info.PTS, sync: info.Sync, data: datas[i]}
+	}
+	return samples, nil
+}
+
+// decrypter decrypts the fragments of a file decoded with DecModeLazyMdat
+type decrypter struct {
+	f             *mp4.File
+	di            mp4.DecryptInfo
+	key           []byte
+	keysByKID     map[string][]byte
+	strictKIDMode bool
+}
+
+// newDecrypter decrypts the init segment in place. The fragments are decrypted when read.
+func newDecrypter(f *mp4.File, key []byte, keysByKID map[string][]byte, strictKIDMode bool) (*decrypter, error) {
+	if !f.IsFragmented() || f.Init == nil {
+		return nil, fmt.Errorf("decryption is only supported for fragmented files with init segment")
+	}
+	di, err := mp4.DecryptInit(f.Init)
+	if err != nil {
+		return nil, err
+	}
+	return &decrypter{f: f, di: di, key: key, keysByKID: keysByKID, strictKIDMode: strictKIDMode}, nil
+}
+
+// readSamples reads and decrypts the fragments with selected samples one at a time, and returns
+// copies of the selected sample data, so that only one mdat is in memory at a time.
+// infos are all samples of trackID, which give the position of the selected samples in their fragments.
+func (d *decrypter) readSamples(rs io.ReadSeeker, trackID uint32, infos, selected []mp4.SampleInfo) ([]sample, error) {
+	trex, ok := d.f.Moov.Mvex.GetTrex(trackID)
+	if !ok {
+		return nil, fmt.Errorf("no trex for track with ID %d", trackID)
+	}
+	firstNrInFrag := make(map[uint32]uint32)
+	for _, info := range infos {
+		if _, ok := firstNrInFrag[info.FragmentNr]; !ok {
+			firstNrInFrag[info.FragmentNr] = info.SampleNr
+		}
+	}
+	samples := make([]sample, 0, len(selected))
+	next := 0
+	for _, seg := range d.f.Segments {
+		for _, frag := range seg.Fragments {
+			if next == len(selected) {
+				return samples, nil
+			}
+			seqNr := frag.Moof.Mfhd.SequenceNumber
+			if selected[next].FragmentNr != seqNr {
+				continue
+			}
+			if frag.Mdat == nil {
+				return nil, fmt.Errorf("fragment %d: no mdat box", seqNr)
+			}
+			mdat := frag.Mdat
+			data, err := mdat.ReadData(int64(mdat.PayloadAbsoluteOffset()), int64(mdat.GetLazyDataSize()), rs)
+			if err != nil {
+				return nil, fmt.Errorf("fragment %d: %w", seqNr, err)
+			}
+			mdat.SetData(data)
+			if err := mp4.DecryptFragmentWithKeys(frag, d.di, d.key, d.keysByKID, d.strictKIDMode); err != nil {
+				return nil, fmt.Errorf("decrypt fragment %d: %w", seqNr, err)
+			}
+			fss, err := frag.GetFullSamples(trex)
+			if err != nil {
+				return nil, err
+			}
+			for ; next < len(selected) && selected[next].FragmentNr == seqNr; next++ {
+				info := selected[next]
+				idx := int(info.SampleNr - firstNrInFrag[seqNr])
+				if idx >= len(fss) {
+					return nil, fmt.Errorf("fragment %d: sample %d missing", seqNr, info.SampleNr)
+				}
+				samples = append(samples, sample{pts: info.PTS, sync: info.Sync,
+					data: append([]byte(nil), fss[idx].Data...)})
+			}
+			mdat.SetData(nil)
+		}
+	}
+	if next < len(selected) {
+		return nil, fmt.Errorf("fragment %d of sample %d not found", selected[next].FragmentNr, selected[next].SampleNr)
+	}
+	return samples, nil
+}
+
+type sampleWriter interface {
+	writeSample(s sample) error
+}
+
+// newSampleWriter returns a writer for the codec of the sample entry
+func newSampleWriter(w io.Writer, entry mp4.Box, timescale uint32, nrSamples int) (sampleWriter, error) {
+	switch e := entry.(type) {
+	case *mp4.VisualSampleEntryBox:
+		switch e.Type() {
+		case "avc1", "avc3":
+			if e.AvcC == nil {
+				return nil, fmt.Errorf("no avcC box")
+			}
+			return &annexBWriter{
+				w:          w,
+				lengthSize: 4,
+				paramSets:  append(append([][]byte{}, e.AvcC.SPSnalus...), e.AvcC.PPSnalus...),
+				naluType:   func(nalu []byte) byte { return byte(avc.GetNaluType(nalu[0])) },
+				spsType:    byte(avc.NALU_SPS),
+				audType:    byte(avc.NALU_AUD),
+			}, nil
+		case "hvc1", "hev1":
+			if e.HvcC == nil {
+				return nil, fmt.Errorf("no hvcC box")
+			}
+			var paramSets [][]byte
+			for _, na := range e.HvcC.NaluArrays {
+				paramSets = append(paramSets, na.Nalus...)
+			}
+			return &annexBWriter{
+				w:          w,
+				lengthSize: 4,
+				paramSets:  paramSets,
+				naluType:   func(nalu []byte) byte { return byte(hevc.GetNaluType(nalu[0])) },
+				spsType:    byte(hevc.NALU_SPS),
+				audType:    byte(hevc.NALU_AUD),
+			}, nil
+		case "vvc1", "vvi1":
+			if e.VvcC == nil {
+				return nil, fmt.Errorf("no vvcC box")
+			}
+			var paramSets [][]byte
+			for _, na := range e.VvcC.NaluArrays {
+				paramSets = append(paramSets, na.Nalus...)
+			}
+			return &annexBWriter{
+				w:          w,
+				lengthSize: int(e.VvcC.LengthSizeMinusOne) + 1,
+				paramSets:  paramSets,
+				naluType: func(nalu []byte) byte {
+					if len(nalu) < 2 {
+						return 0xff
+					}
+					return nalu[1] >> 3 // nal_unit_type in the second header byte
+				},
+				spsType: byte(vvc.NALU_SPS),
+				audType: byte(vvc.NALU_AUD),
+			}, nil
+		case "vp08", "vp09", "av01":
+			fourCC := map[string]string{"vp08": ivf.CodecVP8, "vp09": ivf.CodecVP9, "av01": ivf.CodecAV1}[e.Type()]
+			iw, err := ivf.NewWriter(w, ivf.FileHeader{
+				FourCC:    fourCC,
+				Width:     e.Width,
+				Height:    e.Height,
+				Rate:      timescale,
+				Scale:     1,
+				NumFrames: uint32(nrSamples),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &ivfWriter{w: iw, isAV1: fourCC == ivf.CodecAV1}, nil
+		}
+	case *mp4.AudioSampleEntryBox:
+		if e.Type() == "mp4a" && e.Esds != nil && e.Esds.DecConfigDescriptor != nil &&
+			e.Esds.DecConfigDescriptor.ObjectType == 0x40 && e.Esds.DecConfigDescriptor.DecSpecificInfo != nil {
+			return newADTSWriter(w, e.Esds.DecConfigDescriptor.DecSpecificInfo.DecConfig)
+		}
+	}
+	return &rawWriter{w: w}, nil
+}
+
+var startCode = []byte{0, 0, 0, 1}
+
+// annexBWriter writes length-prefixed NAL units as an Annex B byte stream
+type annexBWriter struct {
+	w          io.Writer
+	lengthSize int
+	paramSets  [][]byte
+	naluType   func(nalu []byte) byte
+	spsType    byte
+	audType    byte
+	nrWritten  int
+}
+
+// writeSample inserts the parameter sets after any access unit delimiter of the first sample and
+// of sync samples without SPS
+func (a *annexBWriter) writeSample(s sample) error {
+	nalus, err := splitNalus(s.data, a.lengthSize)
+	if err != nil {
+		return err
+	}
+	insertPS := s.sync || a.nrWritten == 0
+	for _, nalu := range nalus {
+		if a.naluType(nalu) == a.spsType {
+			insertPS = false
+		}
+	}
+	var buf []byte
+	for i, nalu := range nalus {
+		if insertPS && (i > 0 || a.naluType(nalu) != a.audType) {
+			for _, ps := range a.paramSets {
+				buf = append(buf, startCode...)
+				buf = append(buf, ps...)
+			}
+			insertPS = false
+		}
+		buf = append(buf, startCode...)
+		buf = append(buf, nalu...)
+	}
+	a.nrWritten++
+	_, err = a.w.Write(buf)
+	return err
+}
+
+// splitNalus splits a sample into NAL units with lengthSize-byte length prefixes. Empty NAL units are dropped.
+func splitNalus(data []byte, lengthSize int) ([][]byte, error) {
+	var nalus [][]byte
+	for pos := 0; pos < len(data); {
+		if pos+lengthSize > len(data) {
+			return nil, fmt.Errorf("truncated NALU length at byte %d", pos)
+		}
+		size := 0
+		for _, b := range data[pos : pos+lengthSize] {
+			size = size<<8 | int(b)
+		}
+		pos += lengthSize
+		if pos+size > len(data) {
+			return nil, fmt.Errorf("NALU size %d at byte %d beyond sample end", size, pos)
+		}
+		if size > 0 {
+			nalus = append(nalus, data[pos:pos+size])
+		}
+		pos += size
+	}
+	return nalus, nil
+}
+
+// ivfWriter writes samples as IVF frames with presentation time in the track timescale
+type ivfWriter struct {
+	w     *ivf.Writer
+	isAV1 bool
+}
+
+// temporalDelimiter - AV1 temporal delimiter OBU with obu_has_size_field set and size 0
+var temporalDelimiter = []byte{byte(av1.OBUTemporalDelimiter)<<3 | 0x02, 0x00}
+
+// writeSample starts AV1 temporal units with a temporal delimiter, as in IVF files from AV1 encoders
+func (i *ivfWriter) writeSample(s sample) error {
+	data := s.data
+	if i.isAV1 && (len(data) == 0 || av1.OBUType((data[0]>>3)&0x0f) != av1.OBUTemporalDelimiter) {
+		data = append(append([]byte{}, temporalDelimiter...), data...)
+	}
+	pts := s.pts
+	if pts < 0 {
+		pts = 0
+	}
+	return i.w.WriteFrame(ivf.Frame{Timestamp: uint64(pts), Data: data})
+}
+
+// adtsWriter writes AAC frames with ADTS headers
+type adtsWriter struct {
+	w   io.Writer
+	hdr *aac.ADTSHeader
+}
+
+// newADTSWriter returns an ADTS writer for the AudioSpecificConfig ascData. ADTS only signals
+// the core AAC-LC stream, so HE-AAC and HE-AACv2 get the AAC-LC profile and the core sampling
+// frequency, and SBR and PS are left for the decoder to detect. Other object types give an error.
+func newADTSWriter(w io.Writer, ascData []byte) (*adtsWriter, error) {
+	asc, err := aac.DecodeAudioSpecificConfig(bytes.NewReader(ascData))
+	if err != nil {
+		return nil, fmt.Errorf("cannot write AAC as ADTS: %w", err)
+	}
+	hdr, err := aac.NewADTSHeader(asc.SamplingFrequency, asc.ChannelConfiguration, aac.AAClc, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write AAC as ADTS: %w", err)
+	}
+	return &adtsWriter{w: w, hdr: hdr}, nil
+}
+
+func (a *adtsWriter) writeSample(s sample) error {
+	if len(s.data) > 0x1fff-7 {
+		return fmt.Errorf("AAC frame of %d bytes too big for ADTS", len(s.data))
+	}
+	hdr := *a.hdr
+	hdr.PayloadLength = uint16(len(s.data))
+	if _, err := a.w.Write(hdr.Encode()); err != nil {
+		return err
+	}
+	_, err := a.w.Write(s.data)
+	return err
+}
+
+// rawWriter writes the sample payloads back to back
+type rawWriter struct {
+	w io.Writer
+}
+
+func (r *rawWriter) writeSample(s sample) error {
+	_, err := r.w.Write(s.data)
+	return err
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/aac"
+	"github.com/Eyevinn/mp4ff/avc"
+	"github.com/Eyevinn/mp4ff/ivf"
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/vp8"
+)
+
+func TestCommandLines(t *testing.T) {
+	inFile := "../../mp4/testdata/prog_8s.mp4"
+	outFile := path.Join(t.TempDir(), "out.264")
+	cases := []struct {
+		desc        string
+		args        []string
+		expectedErr bool
+	}{
+		{desc: "help", args: []string{appName, "-h"}, expectedErr: false},
+		{desc: "version", args: []string{appName, "-version"}, expectedErr: false},
+		{desc: "no args", args: []string{appName}, expectedErr: true},
+		{desc: "unknown args", args: []string{appName, "-x"}, expectedErr: true},
+		{desc: "non-existing infile", args: []string{appName, "notExists.mp4", outFile}, expectedErr: true},
+		{desc: "bad track", args: []string{appName, "-track", "3", inFile, outFile}, expectedErr: true},
+		{desc: "bad range", args: []string{appName, "-start", "4", "-end", "2", inFile, outFile}, expectedErr: true},
+		{desc: "range after end", args: []string{appName, "-start", "100", "-sync", inFile, outFile}, expectedErr: true},
+		{desc: "bad key", args: []string{appName, "-key", "ab", inFile, outFile}, expectedErr: true},
+		{desc: "key for progressive", args: []string{appName, "-key", "00112233445566778899aabbccddeeff", inFile, outFile}, expectedErr: true},
+		{desc: "encrypted without key", args: []string{appName, "../../mp4/testdata/cbcs.mp4", outFile}, expectedErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			gotOut := bytes.Buffer{}
+			err := run(c.args, &gotOut)
+			if c.expectedErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestExtractAnnexB(t *testing.T) {
+	inFile := "../../mp4/testdata/prog_8s.mp4"
+	f, err := mp4.ReadMP4File(inFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := f.SampleInfos(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nrSync := 0
+	for _, info := range infos {
+		if info.Sync {
+			nrSync++
+		}
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{appName, "-sync", inFile, "-"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	nalus := avc.ExtractNalusFromByteStream(out.Bytes())
+	if len(nalus) == 0 || avc.GetNaluType(nalus[0][0]) != avc.NALU_SPS {
+		t.Fatal("stream does not start with SPS")
+	}
+	nrIDR, nrSPS := 0, 0
+	for _, nalu := range nalus {
+		switch avc.GetNaluType(nalu[0]) {
+		case avc.NALU_IDR:
+			nrIDR++
+		case avc.NALU_SPS:
+			nrSPS++
+		case avc.NALU_NON_IDR:
+			t.Error("non-IDR slice in sync sample output")
+		}
+	}
+	if nrIDR != nrSync || nrSPS != nrSync {
+		t.Errorf("got %d IDR and %d SPS for %d sync samples", nrIDR, nrSPS, nrSync)
+	}
+
+	out.Reset()
+	if err := run([]string{appName, "-start", "2.5", "-end", "4", inFile, "-"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	nalus = avc.ExtractNalusFromByteStream(out.Bytes())
+	if len(nalus) < 2 || avc.GetNaluType(nalus[0][0]) != avc.NALU_SPS {
+		t.Fatal("time range does not start with SPS")
+	}
+	if !avc.IsIDRSample(avc.ConvertByteStreamToNaluSample(out.Bytes())) {
+		t.Error("time range does not start at IDR")
+	}
+}
+
+func TestExtractDecrypted(t *testing.T) {
+	dir := t.TempDir()
+	encOut := path.Join(dir, "enc.264")
+	clearOut := path.Join(dir, "clear.264")
+	for _, opts := range [][]string{nil, {"-sync"}, {"-start", "1"}} {
+		encArgs := append(append([]string{appName, "-key", "22bdb0063805260307ee5045c0f3835a"}, opts...),
+			"../../mp4/testdata/cbcs.mp4", encOut)
+		if err := run(encArgs, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+		clearArgs := append(append([]string{appName}, opts...), "../../mp4/testdata/cbcsdec.mp4", clearOut)
+		if err := run(clearArgs, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(encOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(clearOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) == 0 || !bytes.Equal(got, want) {
+			t.Errorf("options %v: decrypted extraction differs from extraction of decrypted file", opts)
+		}
+	}
+}
+
+func TestExtractADTS(t *testing.T) {
+	inFile := "../../mp4/testdata/prog_8s.mp4"
+	f, err := mp4.ReadMP4File(inFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := f.SampleInfos(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := run([]string{appName, "-track", "1", inFile, "-"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(out.Bytes())
+	for i, info := range infos {
+		hdr, offset, err := aac.DecodeADTSHeader(r)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i+1, err)
+		}
+		if offset != 0 || hdr.PayloadLength != uint16(info.Size) || hdr.Frequency() != 48000 {
+			t.Fatalf("frame %d: got header %+v at offset %d", i+1, hdr, offset)
+		}
+		if _, err := r.Seek(int64(hdr.PayloadLength), io.SeekCurrent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes after last ADTS frame", r.Len())
+	}
+}
+
+func TestADTSWriterProfiles(t *testing.T) {
+	cases := []struct {
+		desc          string
+		asc           aac.AudioSpecificConfig
+		wantFrequency uint16
+	}{
+		{desc: "AAC-LC", asc: aac.AudioSpecificConfig{ObjectType: aac.AAClc, SamplingFrequency: 48000,
+			ChannelConfiguration: 2}, wantFrequency: 48000},
+		{desc: "HE-AAC", asc: aac.AudioSpecificConfig{ObjectType: aac.HEAACv1, SamplingFrequency: 24000,
+			ExtensionFrequency: 48000, ChannelConfiguration: 2}, wantFrequency: 24000},
+		{desc: "HE-AACv2", asc: aac.AudioSpecificConfig{ObjectType: aac.HEAACv2, SamplingFrequency: 24000,
+			ExtensionFrequency: 48000, ChannelConfiguration: 1}, wantFrequency: 24000},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var ascBuf bytes.Buffer
+			if err := c.asc.Encode(&ascBuf); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			aw, err := newADTSWriter(&out, ascBuf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := aw.writeSample(sample{data: []byte{1, 2, 3}}); err != nil {
+				t.Fatal(err)
+			}
+			hdr, _, err := aac.DecodeADTSHeader(&out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.ObjectType != aac.AAClc || hdr.Frequency() != c.wantFrequency ||
+				hdr.ChannelConfig != c.asc.ChannelConfiguration || hdr.PayloadLength != 3 {
+				t.Errorf("got header %+v", hdr)
+			}
+		})
+	}
+
+	// AAC Main (object type 1) cannot be written with an AAC-LC ADTS profile
+	if _, err := newADTSWriter(io.Discard, []byte{0x09, 0x90}); err == nil {
+		t.Error("expected error for AAC Main")
+	}
+}
+
+func TestExtractIVF(t *testing.T) {
+	ifh, err := os.Open("../../examples/ivf-to-mp4/testdata/vp8.ivf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ifh.Close()
+	rd, err := ivf.NewReader(ifh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames []ivf.Frame
+	for {
+		fr, err := rd.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, fr)
+	}
+
+	// Mux the VP8 frames into a fragmented mp4 file with the IVF timebase as timescale
+	init := mp4.CreateEmptyInit()
+	trak := init.AddEmptyTrack(rd.Header.Rate, "video", "und")
+	vpcC := &mp4.VppCBox{Version: 1, BitDepth: 8, ChromaSubsampling: 1,
+		ColourPrimaries: 2, TransferCharacteristics: 2, MatrixCoefficients: 2}
+	if err := trak.SetVPxDescriptor("vp08", vpcC, rd.Header.Width, rd.Header.Height); err != nil {
+		t.Fatal(err)
+	}
+	frag, err := mp4.CreateFragment(1, trak.Tkhd.TrackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scale := uint64(rd.Header.Scale)
+	nrKey := 0
+	for i, fr := range frames {
+		flags := mp4.SetNonSyncSampleFlags(0)
+		isKey, err := vp8.IsKeyFrame(fr.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isKey {
+			flags = mp4.SetSyncSampleFlags(0)
+			nrKey++
+		}
+		dur := uint32(scale)
+		if i+1 < len(frames) {
+			dur = uint32((frames[i+1].Timestamp - fr.Timestamp) * scale)
+		}
+		frag.AddFullSample(mp4.FullSample{
+			Sample:     mp4.Sample{Flags: flags, Dur: dur, Size: uint32(len(fr.Data))},
+			DecodeTime: fr.Timestamp * scale,
+			Data:       fr.Data,
+		})
+	}
+	var mp4Buf bytes.Buffer
+	if err := init.Encode(&mp4Buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := frag.Encode(&mp4Buf); err != nil {
+		t.Fatal(err)
+	}
+	inFile := path.Join(t.TempDir(), "vp8.mp4")
+	if err := os.WriteFile(inFile, mp4Buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, syncOnly := range []bool{false, true} {
+		args := []string{appName, inFile, "-"}
+		wantFrames := len(frames)
+		if syncOnly {
+			args = []string{appName, "-sync", inFile, "-"}
+			wantFrames = nrKey
+		}
+		var out bytes.Buffer
+		if err := run(args, &out); err != nil {
+			t.Fatal(err)
+		}
+		ord, err := ivf.NewReader(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ord.Header.FourCC != ivf.CodecVP8 || ord.Header.Width != rd.Header.Width ||
+			ord.Header.NumFrames != uint32(wantFrames) {
+			t.Fatalf("sync %t: got header %+v", syncOnly, ord.Header)
+		}
+		nrRead := 0
+		for i := 0; ; i++ {
+			fr, err := ord.ReadFrame()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			nrRead++
+			if !syncOnly && (fr.Timestamp != frames[i].Timestamp*scale || !bytes.Equal(fr.Data, frames[i].Data)) {
+				t.Errorf("frame %d differs", i)
+			}
+			if isKey, err := vp8.IsKeyFrame(fr.Data); syncOnly && (err != nil || !isKey) {
+				t.Errorf("frame %d is not a key frame", i)
+			}
+		}
+		if nrRead != wantFrames {
+			t.Errorf("sync %t: got %d frames instead of %d", syncOnly, nrRead, wantFrames)
+		}
+	}
+}
+
+func TestExtractOtherCodecs(t *testing.T) {
+	cases := []struct {
+		file    string
+		trackID string
+	}{
+		{file: "../../mp4/testdata/ed_hevc.mp4", trackID: "1"},
+		{file: "../../mp4/testdata/vvc_400kbps_2s.mp4", trackID: "1"},
+	}
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := run([]string{appName, "-sync", "-track", c.trackID, c.file, "-"}, &out); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(out.Bytes(), startCode) {
+				t.Error("output is not an Annex B byte stream")
+			}
+		})
+	}
+}
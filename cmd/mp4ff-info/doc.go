@@ -1,5 +1,10 @@
 /*
 mp4ff-info prints the box tree of input mp4 (ISOBMFF) file.
+The input can be an http(s) URL, in which case only the needed byte ranges are downloaded.
+
+With -format json, yaml, or xml, the box tree is written as a list of nodes with
+type, offset, size, version, flags, fields, and children (see mp4.BoxNode).
+The json and xml output can be turned back into mp4 with mp4ff-compose.
 
 	Usage of mp4ff-info:
 
@@ -7,6 +12,8 @@ mp4ff-info prints the box tree of input mp4 (ISOBMFF) file.
 
 	options:
 
+		-format string
+			output format: text, json, yaml, or xml (default "text")
 		-l string
 			level of details, e.g. all:1 or trun:1,subs:1
 		-version
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/Eyevinn/mp4ff/httprange"
 	"github.com/Eyevinn/mp4ff/internal"
 	"github.com/Eyevinn/mp4ff/mp4"
 )
@@ -16,12 +17,14 @@ const (
 )
 
 var usg = `%s prints the box tree of input mp4 (ISOBMFF) file.
+The input can be an http(s) URL, in which case only the needed byte ranges are downloaded.
 
 Usage of %s:
 `
 
 type options struct {
 	levels  string
+	format  string
 	version bool
 }
 
@@ -35,6 +38,7 @@ func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
 	opts := options{}
 
 	fs.StringVar(&opts.levels, "l", "", "level of details, e.g. all:1 or trun:1,subs:1")
+	fs.StringVar(&opts.format, "format", "text", "output format: text, json, yaml, or xml")
 	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
 
 	err := fs.Parse(args[1:])
@@ -64,27 +68,51 @@ func run(args []string, w io.Writer) error {
 		return nil
 	}
 
+	format := mp4.DumpFormat(opts.format)
+	switch format {
+	case mp4.DumpText, mp4.DumpJSON, mp4.DumpYAML, mp4.DumpXML:
+	default:
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+
 	if len(fs.Args()) != 1 {
 		fs.Usage()
 		return fmt.Errorf("need input file")
 	}
 	inFilePath := fs.Arg(0)
 
-	ifd, err := os.Open(inFilePath)
-	if err != nil {
-		return fmt.Errorf("could not open input file: %w", err)
+	var parsedMp4 *mp4.File
+	var parseErr error
+	if httprange.IsURL(inFilePath) {
+		ra, err := httprange.NewReaderAt(inFilePath, nil)
+		if err != nil {
+			return fmt.Errorf("could not open input URL: %w", err)
+		}
+		parsedMp4, parseErr = mp4.DecodeFileReaderAt(mp4.NewCachedReaderAt(ra, ra.Size(), 0, 0), ra.Size())
+	} else {
+		ifd, err := os.Open(inFilePath)
+		if err != nil {
+			return fmt.Errorf("could not open input file: %w", err)
+		}
+		defer ifd.Close()
+		parsedMp4, parseErr = mp4.DecodeFile(ifd, mp4.WithDecodeMode(mp4.DecModeLazyMdat))
 	}
-	defer ifd.Close()
-	parsedMp4, parseErr := mp4.DecodeFile(ifd, mp4.WithDecodeMode(mp4.DecModeLazyMdat))
 	if parseErr != nil {
 		if parsedMp4 == nil {
-			return fmt.Errorf("could not parse input file: %w", err)
+			return fmt.Errorf("could not parse input file: %w", parseErr)
 		}
 		_, _ = fmt.Fprintf(os.Stderr, "Warning: could not parse input file completely: %v\n", parseErr)
 	}
-	err = parsedMp4.Info(w, opts.levels, "", "  ")
+	if format == mp4.DumpText {
+		err = parsedMp4.Info(w, opts.levels, "", "  ")
+	} else {
+		err = parsedMp4.Dump(w, format)
+	}
 	if err != nil {
 		return fmt.Errorf("could not print info: %w", err)
 	}
-	return parseErr
+	if parseErr != nil {
+		return fmt.Errorf("could not parse input file completely: %w", parseErr)
+	}
+	return nil
 }
@@ -2,8 +2,13 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -21,6 +26,10 @@ func TestOptions(t *testing.T) {
 		{desc: "bad writer", args: []string{appName, "../../mp4/testdata/init.mp4"}, w: &badWriter{}, err: true},
 		{desc: "good file", args: []string{appName, "../../mp4/testdata/init.mp4"}, w: os.Stdout, err: false},
 		{desc: "good with details", args: []string{appName, "-l", "all:1", "../../mp4/testdata/init.mp4"}, w: os.Stdout, err: false},
+		{desc: "json", args: []string{appName, "-format", "json", "../../mp4/testdata/init.mp4"}, w: io.Discard, err: false},
+		{desc: "yaml", args: []string{appName, "-format", "yaml", "../../mp4/testdata/1.m4s"}, w: io.Discard, err: false},
+		{desc: "xml", args: []string{appName, "-format", "xml", "../../mp4/testdata/init.mp4"}, w: io.Discard, err: false},
+		{desc: "bad format", args: []string{appName, "-format", "csv", "../../mp4/testdata/init.mp4"}, w: os.Stdout, err: true},
 		{desc: "version", args: []string{appName, "-version"}, w: os.Stdout, err: false},
 		{desc: "help", args: []string{appName, "-h"}, w: os.Stdout, err: false},
 	}
@@ -63,8 +72,42 @@ func TestTruncatedFile(t *testing.T) {
 	})
 }
 
+func TestURL(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("../../mp4/testdata")))
+	defer srv.Close()
+	var local, remote bytes.Buffer
+	if err := run([]string{appName, "-l", "all:1", "../../mp4/testdata/v300_multiple_segments.mp4"}, &local); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{appName, "-l", "all:1", srv.URL + "/v300_multiple_segments.mp4"}, &remote); err != nil {
+		t.Fatal(err)
+	}
+	if remote.String() != local.String() {
+		t.Error("output for URL differs from output for local file")
+	}
+	if err := run([]string{appName, srv.URL + "/missing.mp4"}, io.Discard); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
 type badWriter struct{}
 
 func (w *badWriter) Write(p []byte) (n int, err error) {
 	return 0, os.ErrClosed
 }
+
+func TestUnparsableFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "bad.mp4")
+	// Box size 4 is smaller than the 8-byte box header
+	if err := os.WriteFile(fileName, []byte{0, 0, 0, 4, 'f', 't', 'y', 'p'}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := run([]string{appName, fileName}, io.Discard)
+	if err == nil {
+		t.Fatal("expected error for unparsable file")
+	}
+	if !strings.HasPrefix(err.Error(), "could not parse input file") || errors.Unwrap(err) == nil ||
+		!strings.Contains(err.Error(), "exceeds box size 4") {
+		t.Errorf("parse error not wrapped: %s", err)
+	}
+}
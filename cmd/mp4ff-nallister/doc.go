@@ -3,7 +3,8 @@ mp4ff-nallister lists NAL units and slice types of AVC or HEVC tracks of an mp4
 or a file containing a byte stream in Annex B format.
 
 Takes first video track in a progressive file and the first track in a fragmented file.
-It can also output information about SEI NAL units.
+It can also output information about SEI NAL units, such as the per-frame
+statistics of HDR10+ metadata.
 
 The parameter-sets can be further
 analyzed using mp4ff-pslister.
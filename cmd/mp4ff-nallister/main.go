@@ -25,7 +25,8 @@ var usg = `%s lists NAL units and slice types of AVC, HEVC, or VVC tracks of an
 or a file containing a byte stream in Annex B format.
 
 Takes first video track in a progressive file and the first track in a fragmented file.
-It can also output information about SEI NAL units.
+It can also output information about SEI NAL units, such as the per-frame
+statistics of HDR10+ metadata.
 
 The parameter-sets can be further analyzed using mp4ff-pslister.
 
@@ -6,7 +6,9 @@ import (
 	"testing"
 
 	"github.com/Eyevinn/mp4ff/avc"
+	"github.com/Eyevinn/mp4ff/hevc"
 	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/sei"
 )
 
 func TestOptions(t *testing.T) {
@@ -73,6 +75,37 @@ func TestOptions(t *testing.T) {
 	}
 }
 
+func TestHDR10PlusSEI(t *testing.T) {
+	md := &sei.HDR10Plus{
+		ApplicationVersion:                    1,
+		TargetedSystemDisplayMaximumLuminance: 400,
+		Windows: []sei.HDR10PlusWindow{{
+			MaxSCL:             [3]uint32{17830, 16895, 12862},
+			AverageMaxRGB:      1038,
+			DistributionMaxRGB: []sei.HDR10PlusPercentile{{Percentage: 50, Percentile: 1034}, {Percentage: 99, Percentile: 8979}},
+		}},
+	}
+	msg, err := sei.CreateHDR10PlusSEIMessage(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seiNALU, err := hevc.CreateSEINalu([]sei.SEIMessage{msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idr := []byte{byte(hevc.NALU_IDR_N_LP) << 1, 0x01, 0x12, 0x34}
+	gotOut := bytes.Buffer{}
+	if err := printHEVCNalus(&gotOut, [][]byte{seiNALU, idr}, 1, 0, 1, false, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := "Sample 1, pts=0 (45B): SEI_39 (33B), RAP_IDR_20 (4B)\n" +
+		"  * SEI type 4 HDR10+, size=28, version=1, targetMaxLum=400, window 0: maxscl=[17830 16895 12862], " +
+		"avgMaxRGB=1038, percentiles=[50:1034 99:8979], brightPixels=0\n"
+	if gotOut.String() != want {
+		t.Errorf("got %q, want %q", gotOut.String(), want)
+	}
+}
+
 func getExpected(t *testing.T, filename string) string {
 	t.Helper()
 	b, err := os.ReadFile(filename)
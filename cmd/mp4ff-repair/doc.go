@@ -0,0 +1,22 @@
+/*
+mp4ff-repair rewrites a corrupt or truncated mp4 file into a valid one with what can be recovered.
+The input is decoded leniently: bad boxes are skipped and truncated mdat boxes keep the data present.
+Decode errors and the number of usable samples per track and fragment are printed.
+Fragments with missing sample data are rebuilt with the usable samples, or dropped if encrypted.
+With -ref, a file without moov box, like an unfinalized recording, gets a new moov box built from
+the tracks of a reference file from the same encoder and the samples found in the mdat box.
+
+	Usage of mp4ff-repair:
+
+		mp4ff-repair [options] <inFile> [<outFile>]
+
+	options:
+
+		-check
+			Only report decode errors and usable samples, no outFile
+		-ref string
+			Reference file to recover a file without moov box
+		-version
+			Get mp4ff version
+*/
+package main
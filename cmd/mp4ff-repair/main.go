@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Eyevinn/mp4ff/internal"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+const (
+	appName = "mp4ff-repair"
+)
+
+var usg = `%s rewrites a corrupt or truncated mp4 file into a valid one with what can be recovered.
+The input is decoded leniently: bad boxes are skipped and truncated mdat boxes keep the data present.
+Decode errors and the number of usable samples per track and fragment are printed.
+Fragments with missing sample data are rebuilt with the usable samples, or dropped if encrypted.
+With -ref, a file without moov box, like an unfinalized recording, gets a new moov box built from
+the tracks of a reference file from the same encoder and the samples found in the mdat box.
+
+Usage of %s:
+`
+
+type options struct {
+	check   bool
+	ref     string
+	version bool
+}
+
+func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usg, appName, appName)
+		fmt.Fprintf(os.Stderr, "\n%s [options] <inFile> [<outFile>]\n\noptions:\n", appName)
+		fs.PrintDefaults()
+	}
+
+	opts := options{}
+
+	fs.BoolVar(&opts.check, "check", false, "Only report decode errors and usable samples, no outFile")
+	fs.StringVar(&opts.ref, "ref", "", "Reference file to recover a file without moov box")
+	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
+
+	err := fs.Parse(args[1:])
+	return &opts, err
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	o, err := parseOptions(fs, args)
+
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if o.version {
+		fmt.Fprintf(stdout, "%s %s\n", appName, internal.GetVersion())
+		return nil
+	}
+
+	nrFiles := 2
+	if o.check {
+		nrFiles = 1
+	}
+	if len(fs.Args()) != nrFiles {
+		fs.Usage()
+		return fmt.Errorf("need %d file arguments", nrFiles)
+	}
+
+	inFilePath := fs.Arg(0)
+	ifh, err := os.Open(inFilePath)
+	if err != nil {
+		return fmt.Errorf("could not open input file: %w", err)
+	}
+	defer ifh.Close()
+	if o.ref != "" {
+		return recoverMoov(ifh, o, fs.Arg(1), stdout)
+	}
+	f, err := mp4.DecodeFile(ifh, mp4.WithDecodeFlags(mp4.DecLenient))
+	if err != nil {
+		return fmt.Errorf("error decoding file: %w", err)
+	}
+	for _, decErr := range f.DecodeErrors {
+		fmt.Fprintf(stdout, "decode error: %s\n", decErr.Error())
+	}
+	statuses, err := f.CheckSampleData()
+	if err != nil {
+		return fmt.Errorf("error checking sample data: %w", err)
+	}
+	for _, st := range statuses {
+		if st.FragmentNr != 0 {
+			fmt.Fprintf(stdout, "fragment %d track %d: %d of %d samples usable\n",
+				st.FragmentNr, st.TrackID, st.NrUsable, st.NrSamples)
+			continue
+		}
+		fmt.Fprintf(stdout, "track %d: %d of %d samples usable\n", st.TrackID, st.NrUsable, st.NrSamples)
+	}
+	if o.check {
+		return nil
+	}
+
+	out, err := mp4.Repair(f)
+	if err != nil {
+		return fmt.Errorf("error repairing file: %w", err)
+	}
+	ofh, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("could not create output file: %w", err)
+	}
+	defer ofh.Close()
+	return out.Encode(ofh)
+}
+
+func recoverMoov(ifh *os.File, o *options, outFilePath string, stdout io.Writer) error {
+	ref, err := mp4.ReadMP4File(o.ref)
+	if err != nil {
+		return fmt.Errorf("error reading reference file: %w", err)
+	}
+	fi, err := ifh.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat input file: %w", err)
+	}
+	out, report, err := mp4.RecoverMoov(ifh, fi.Size(), ref)
+	if report != nil {
+		for _, t := range report.Tracks {
+			if t.Reason != "" {
+				fmt.Fprintf(stdout, "track %d (%s): not recovered: %s\n", t.TrackID, t.Format, t.Reason)
+				continue
+			}
+			fmt.Fprintf(stdout, "track %d (%s): %d samples in %d chunks\n", t.TrackID, t.Format, t.NrSamples, t.NrChunks)
+		}
+		fmt.Fprintf(stdout, "skipped bytes: %d, trailing bytes: %d\n", report.NrSkippedBytes, report.NrTrailingBytes)
+	}
+	if err != nil {
+		return fmt.Errorf("error recovering moov: %w", err)
+	}
+	if o.check {
+		return nil
+	}
+	ofh, err := os.Create(outFilePath)
+	if err != nil {
+		return fmt.Errorf("could not create output file: %w", err)
+	}
+	defer ofh.Close()
+	return mp4.EncodeRecovered(ofh, out, ifh)
+}
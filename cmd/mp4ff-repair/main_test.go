@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestCommandLines(t *testing.T) {
+	testFile := "../../mp4/testdata/prog_8s.mp4"
+	tmpDir := t.TempDir()
+	cases := []struct {
+		desc        string
+		args        []string
+		expectedErr bool
+	}{
+		{desc: "help", args: []string{appName, "-h"}, expectedErr: false},
+		{desc: "version", args: []string{appName, "-version"}, expectedErr: false},
+		{desc: "no args", args: []string{appName}, expectedErr: true},
+		{desc: "unknown args", args: []string{appName, "-x"}, expectedErr: true},
+		{desc: "no outfile", args: []string{appName, testFile}, expectedErr: true},
+		{desc: "non-existing file", args: []string{appName, "notExists.mp4", tmpDir + "/out.mp4"}, expectedErr: true},
+		{desc: "check", args: []string{appName, "-check", testFile}, expectedErr: false},
+		{desc: "repair", args: []string{appName, testFile, tmpDir + "/out.mp4"}, expectedErr: false},
+		{desc: "recover file with moov", args: []string{appName, "-check", "-ref", testFile, testFile}, expectedErr: true},
+		{desc: "non-existing ref", args: []string{appName, "-ref", "notExists.mp4", testFile, tmpDir + "/out.mp4"},
+			expectedErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			gotOut := bytes.Buffer{}
+			err := run(c.args, &gotOut)
+			if c.expectedErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestRepairTruncated(t *testing.T) {
+	data, err := os.ReadFile("../../mp4/testdata/v300_multiple_segments.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	inFile := tmpDir + "/truncated.mp4"
+	outFile := tmpDir + "/repaired.mp4"
+	if err := os.WriteFile(inFile, data[:len(data)-10000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	gotOut := bytes.Buffer{}
+	if err := run([]string{appName, inFile, outFile}, &gotOut); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(gotOut.String(), "decode error: mdat box") {
+		t.Errorf("no mdat decode error in output:\n%s", gotOut.String())
+	}
+	f, err := mp4.ReadMP4File(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Segments) != 4 {
+		t.Errorf("got %d segments instead of 4", len(f.Segments))
+	}
+}
+
+func TestRecoverMoov(t *testing.T) {
+	refFile := "../../mp4/testdata/prog_8s.mp4"
+	ref, err := mp4.ReadMP4File(refFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	inFile := tmpDir + "/nomoov.mp4"
+	outFile := tmpDir + "/recovered.mp4"
+	var buf bytes.Buffer
+	if err := ref.Ftyp.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Mdat.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(inFile, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gotOut := bytes.Buffer{}
+	if err := run([]string{appName, "-ref", refFile, inFile, outFile}, &gotOut); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(gotOut.String(), "track 2 (avc1): 240 samples") {
+		t.Errorf("unexpected output:\n%s", gotOut.String())
+	}
+	f, err := mp4.ReadMP4File(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Moov == nil || len(f.Moov.Traks) != 1 {
+		t.Errorf("no recovered video track")
+	}
+}
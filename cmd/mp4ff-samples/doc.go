@@ -0,0 +1,24 @@
+/*
+mp4ff-samples lists the samples of progressive or fragmented mp4 files as CSV or JSON.
+For every sample, track, sample number, fragment sequence number, DTS, PTS, duration, size,
+byte offset, sync flag, sdtp dependencies, and senc IV and subsamples are listed.
+With -stats, summary statistics per track are printed instead: bitrate per second,
+GOP lengths, frame-rate consistency, CTO range compared to cslg, and decode time gaps and overlaps.
+The input can be an http(s) URL, in which case only the needed byte ranges are downloaded.
+
+	Usage of mp4ff-samples:
+
+		mp4ff-samples [options] infile
+
+	options:
+
+		-format string
+			output format: csv or json (csv gives text for -stats) (default "csv")
+		-stats
+			print statistics per track instead of samples
+		-track uint
+			trackID to list (0 for all tracks)
+		-version
+			Get mp4ff version
+*/
+package main
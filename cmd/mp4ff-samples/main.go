@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Eyevinn/mp4ff/httprange"
+	"github.com/Eyevinn/mp4ff/internal"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+const (
+	appName = "mp4ff-samples"
+)
+
+var usg = `%s lists the samples of progressive or fragmented mp4 files as CSV or JSON.
+For every sample, track, sample number, fragment sequence number, DTS, PTS, duration, size,
+byte offset, sync flag, sdtp dependencies, and senc IV and subsamples are listed.
+With -stats, summary statistics per track are printed instead: bitrate per second,
+GOP lengths, frame-rate consistency, CTO range compared to cslg, and decode time gaps and overlaps.
+The input can be an http(s) URL, in which case only the needed byte ranges are downloaded.
+
+Usage of %s:
+`
+
+type options struct {
+	format  string
+	trackID uint
+	stats   bool
+	version bool
+}
+
+func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usg, appName, appName)
+		fmt.Fprintf(os.Stderr, "\n%s [options] infile\n\noptions:\n", appName)
+		fs.PrintDefaults()
+	}
+
+	opts := options{}
+
+	fs.StringVar(&opts.format, "format", "csv", "output format: csv or json (csv gives text for -stats)")
+	fs.UintVar(&opts.trackID, "track", 0, "trackID to list (0 for all tracks)")
+	fs.BoolVar(&opts.stats, "stats", false, "print statistics per track instead of samples")
+	fs.BoolVar(&opts.version, "version", false, "Get mp4ff version")
+
+	err := fs.Parse(args[1:])
+	return &opts, err
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	o, err := parseOptions(fs, args)
+
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if o.version {
+		fmt.Fprintf(stdout, "%s %s\n", appName, internal.GetVersion())
+		return nil
+	}
+
+	if o.format != "csv" && o.format != "json" {
+		return fmt.Errorf("unknown format %q", o.format)
+	}
+
+	if len(fs.Args()) != 1 {
+		fs.Usage()
+		return fmt.Errorf("need input file")
+	}
+	inFilePath := fs.Arg(0)
+
+	f, err := decodeInput(inFilePath)
+	if err != nil {
+		return fmt.Errorf("could not parse input file: %w", err)
+	}
+	if f.Moov == nil {
+		return fmt.Errorf("no moov box in %s", inFilePath)
+	}
+
+	var traks []*mp4.TrakBox
+	for _, trak := range f.Moov.Traks {
+		if o.trackID == 0 || trak.Tkhd.TrackID == uint32(o.trackID) {
+			traks = append(traks, trak)
+		}
+	}
+	if len(traks) == 0 {
+		return fmt.Errorf("no track with ID %d", o.trackID)
+	}
+
+	if o.stats {
+		allStats := make([]*mp4.TrackStats, 0, len(traks))
+		for _, trak := range traks {
+			st, err := f.TrackStats(trak.Tkhd.TrackID)
+			if err != nil {
+				return err
+			}
+			allStats = append(allStats, st)
+		}
+		if o.format == "json" {
+			return writeJSON(stdout, allStats)
+		}
+		for i, st := range allStats {
+			writeStats(stdout, st, traks[i].Mdia.Hdlr.HandlerType)
+		}
+		return nil
+	}
+
+	var samples []mp4.SampleInfo
+	for _, trak := range traks {
+		infos, err := f.SampleInfos(trak.Tkhd.TrackID)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, infos...)
+	}
+	if o.format == "json" {
+		return writeJSON(stdout, samples)
+	}
+	return writeCSV(stdout, samples)
+}
+
+// decodeInput decodes a local file or an http(s) URL without reading the mdat data
+func decodeInput(inFilePath string) (*mp4.File, error) {
+	if httprange.IsURL(inFilePath) {
+		ra, err := httprange.NewReaderAt(inFilePath, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not open input URL: %w", err)
+		}
+		return mp4.DecodeFileReaderAt(mp4.NewCachedReaderAt(ra, ra.Size(), 0, 0), ra.Size())
+	}
+	ifh, err := os.Open(inFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open input file: %w", err)
+	}
+	defer ifh.Close()
+	return mp4.DecodeFile(ifh, mp4.WithDecodeMode(mp4.DecModeLazyMdat))
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+var csvHeader = []string{"track", "sample", "fragment", "dts", "pts", "dur", "size", "offset", "sync",
+	"leading", "dependsOn", "dependedOn", "redundancy", "iv", "subsamples"}
+
+func writeCSV(w io.Writer, samples []mp4.SampleInfo) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		subsamples := make([]string, 0, len(s.SubSamples))
+		for _, ss := range s.SubSamples {
+			subsamples = append(subsamples, fmt.Sprintf("%d/%d", ss.BytesOfClearData, ss.BytesOfProtectedData))
+		}
+		record := []string{
+			strconv.FormatUint(uint64(s.TrackID), 10),
+			strconv.FormatUint(uint64(s.SampleNr), 10),
+			strconv.FormatUint(uint64(s.FragmentNr), 10),
+			strconv.FormatUint(s.DTS, 10),
+			strconv.FormatInt(s.PTS, 10),
+			strconv.FormatUint(uint64(s.Dur), 10),
+			strconv.FormatUint(uint64(s.Size), 10),
+			strconv.FormatUint(s.Offset, 10),
+			strconv.FormatBool(s.Sync),
+			strconv.Itoa(int(s.IsLeading)),
+			strconv.Itoa(int(s.DependsOn)),
+			strconv.Itoa(int(s.IsDependedOn)),
+			strconv.Itoa(int(s.HasRedundancy)),
+			s.IV,
+			strings.Join(subsamples, " "),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeStats(w io.Writer, st *mp4.TrackStats, hdlrType string) {
+	fmt.Fprintf(w, "track %d (%s) timescale=%d\n", st.TrackID, hdlrType, st.Timescale)
+	fmt.Fprintf(w, "  samples: %d, sync samples: %d, duration: %.3fs, size: %d bytes\n",
+		st.NrSamples, st.NrSyncSamples, float64(st.Duration)/float64(st.Timescale), st.TotalSize)
+	bitrates := make([]string, 0, len(st.Bitrates))
+	for _, b := range st.Bitrates {
+		bitrates = append(bitrates, strconv.FormatUint(b, 10))
+	}
+	fmt.Fprintf(w, "  bitrate: avg %.0f bps, per second: %s\n", st.AvgBitrate, strings.Join(bitrates, " "))
+	fmt.Fprintf(w, "  GOP length: max %d, avg %.2f samples\n", st.MaxGOPLength, st.AvgGOPLength)
+	fmt.Fprintf(w, "  sample duration: min %d, max %d, constant: %t, avg frame rate: %.3f\n",
+		st.MinSampleDur, st.MaxSampleDur, st.ConstantFrameRate, st.AvgFrameRate)
+	fmt.Fprintf(w, "  CTO range: %d to %d", st.MinCTO, st.MaxCTO)
+	if st.Cslg != nil {
+		fmt.Fprintf(w, ", cslg: %d to %d, matches: %t", st.Cslg.LeastDecodeToDisplayDelta,
+			st.Cslg.GreatestDecodeToDisplayDelta, st.CslgMatchesCTO)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  discontinuities: %d\n", len(st.Discontinuities))
+	for _, d := range st.Discontinuities {
+		kind := "gap"
+		gap := d.Gap()
+		if gap < 0 {
+			kind, gap = "overlap", -gap
+		}
+		fmt.Fprintf(w, "    %s of %d before sample %d (fragment %d) at DTS %d\n", kind, gap, d.SampleNr, d.FragmentNr, d.DTS)
+	}
+}
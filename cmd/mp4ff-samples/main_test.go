@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestCommandLines(t *testing.T) {
+	cases := []struct {
+		desc        string
+		args        []string
+		expectedErr bool
+	}{
+		{desc: "help", args: []string{appName, "-h"}, expectedErr: false},
+		{desc: "version", args: []string{appName, "-version"}, expectedErr: false},
+		{desc: "no args", args: []string{appName}, expectedErr: true},
+		{desc: "unknown args", args: []string{appName, "-x"}, expectedErr: true},
+		{desc: "bad format", args: []string{appName, "-format", "xml", "../../mp4/testdata/prog_8s.mp4"}, expectedErr: true},
+		{desc: "non-existing infile", args: []string{appName, "notExists.mp4"}, expectedErr: true},
+		{desc: "unknown track", args: []string{appName, "-track", "7", "../../mp4/testdata/prog_8s.mp4"}, expectedErr: true},
+		{desc: "no moov", args: []string{appName, "../../mp4/testdata/1.m4s"}, expectedErr: true},
+		{desc: "stats", args: []string{appName, "-stats", "../../mp4/testdata/cbcs.mp4"}, expectedErr: false},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			gotOut := bytes.Buffer{}
+			err := run(c.args, &gotOut)
+			if c.expectedErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestSampleList(t *testing.T) {
+	testFile := "../../mp4/testdata/prog_8s_enc_dashinit.mp4"
+	var csvOut, jsonOut bytes.Buffer
+	if err := run([]string{appName, "-track", "2", testFile}, &csvOut); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	if len(lines) != 241 {
+		t.Fatalf("got %d csv lines instead of 241", len(lines))
+	}
+	if want := "2,1,1,0,6000,3000,3092,8792,true,0,2,0,0,bb5738fe08f11341,772/2320"; lines[1] != want {
+		t.Errorf("got first sample %q instead of %q", lines[1], want)
+	}
+	if err := run([]string{appName, "-format", "json", "-stats", "-track", "2", testFile}, &jsonOut); err != nil {
+		t.Fatal(err)
+	}
+	var stats []mp4.TrackStats
+	if err := json.Unmarshal(jsonOut.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].NrSamples != 240 || stats[0].MaxGOPLength != 30 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestURL(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("../../mp4/testdata")))
+	defer srv.Close()
+	var local, remote bytes.Buffer
+	if err := run([]string{appName, "../../mp4/testdata/prog_8s_enc_dashinit.mp4"}, &local); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{appName, srv.URL + "/prog_8s_enc_dashinit.mp4"}, &remote); err != nil {
+		t.Fatal(err)
+	}
+	if remote.String() != local.String() {
+		t.Error("output for URL differs from output for local file")
+	}
+}
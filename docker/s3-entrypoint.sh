@@ -24,7 +24,9 @@ else
 fi
 
 IS_INPUT="true"
+# Rebuild the argument list one argument at a time, so that quoting is kept
 for arg in "$@"; do
+  shift
   case "$arg" in
     *s3://*|*s3-url*)
       # Check for credentials
@@ -40,8 +42,16 @@ for arg in "$@"; do
       S3_URL="$arg"
       LOCAL_FILE="$STAGING_DIR/$(basename "$S3_URL")"
       if [ "$IS_INPUT" = "true" ]; then
-        echo "Downloading $S3_URL to $LOCAL_FILE"
-        aws s3 $ENDPOINT_URL cp "$S3_URL" "$LOCAL_FILE"
+        case "$CMD" in
+          mp4ff-info|mp4ff-samples)
+            # These commands read byte ranges of a presigned URL instead of the whole file
+            LOCAL_FILE="$(aws s3 $ENDPOINT_URL presign "$S3_URL")"
+            ;;
+          *)
+            echo "Downloading $S3_URL to $LOCAL_FILE"
+            aws s3 $ENDPOINT_URL cp "$S3_URL" "$LOCAL_FILE"
+            ;;
+        esac
         IS_INPUT="false"
       else
         if [ -z "$UPLOAD_FILES" ]; then
@@ -50,11 +60,12 @@ for arg in "$@"; do
           UPLOAD_FILES="$UPLOAD_FILES $S3_URL"
         fi
       fi
-      # Replace S3 URL with local file path in arguments
-      echo "$@" | sed "s|$S3_URL|$LOCAL_FILE|g"
-      set -- $(echo "$@" | sed "s|$S3_URL|$LOCAL_FILE|g")
+      # Replace the S3 URL with the local file path or presigned URL. The presigned URL
+      # carries credentials in its query string, so it is not printed.
+      arg="$LOCAL_FILE"
       ;;
   esac
+  set -- "$@" "$arg"
 done
 
 $CMD "$@"
@@ -0,0 +1,128 @@
+package dovi
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/av1"
+	"github.com/Eyevinn/mp4ff/bits"
+)
+
+// ITU-T T.35 identification of a Dolby Vision RPU in an AV1 metadata OBU.
+const (
+	t35CountryCodeUSA  = 0xb5
+	t35ProviderDolby   = 0x003b
+	t35ProviderOrCode  = 0x00000800
+	emdfVersion        = 0
+	emdfKeyID          = 6
+	emdfPayloadIDDoVi  = 256
+	emdfPayloadIDShort = 31 // escape value of the 5-bit emdf_payload_id
+)
+
+// IsAV1RPU reports whether an ITU-T T.35 metadata payload carries a Dolby Vision RPU.
+func IsAV1RPU(t35 av1.ITUTT35) bool {
+	p := t35.Payload
+	return t35.CountryCode == t35CountryCodeUSA && len(p) >= 6 &&
+		uint16(p[0])<<8|uint16(p[1]) == t35ProviderDolby &&
+		uint32(p[2])<<24|uint32(p[3])<<16|uint32(p[4])<<8|uint32(p[5]) == t35ProviderOrCode
+}
+
+// ParseAV1T35 parses the RPU in an ITU-T T.35 metadata payload of an AV1 metadata OBU.
+// The RPU is wrapped in an EMDF container, and lacks the 0x19 prefix of HEVC RPUs.
+func ParseAV1T35(t35 av1.ITUTT35) (*RPU, error) {
+	if !IsAV1RPU(t35) {
+		return nil, ErrNotRPU
+	}
+	payload := t35.Payload[6:]
+	r := bits.NewReader(bytes.NewReader(payload))
+	if v := r.Read(2); v != emdfVersion {
+		return nil, fmt.Errorf("emdf: unsupported emdf_version %d", v)
+	}
+	if k := r.Read(3); k != emdfKeyID {
+		return nil, fmt.Errorf("emdf: unexpected key_id %d", k)
+	}
+	payloadID := r.Read(5)
+	if payloadID == emdfPayloadIDShort {
+		payloadID += readVariableBits(r, 5)
+	}
+	if payloadID != emdfPayloadIDDoVi {
+		return nil, fmt.Errorf("emdf: unexpected emdf_payload_id %d", payloadID)
+	}
+	// emdf_payload_config: smploffste, duratione, groupide, codecdatae, discard_unknown_payload
+	if r.Read(4) != 0 {
+		return nil, fmt.Errorf("emdf: unsupported emdf_payload_config")
+	}
+	_ = r.ReadFlag() // discard_unknown_payload
+	size := readVariableBits(r, 8)
+	if err := r.AccError(); err != nil {
+		return nil, fmt.Errorf("emdf: %w", err)
+	}
+	if remaining := uint(len(payload)*8-r.NrBitsRead()) / 8; size > remaining {
+		return nil, fmt.Errorf("emdf: payload size %d exceeds remaining %d bytes", size, remaining)
+	}
+	data := make([]byte, 1, size+1)
+	data[0] = rpuNALPrefix
+	for i := uint(0); i < size; i++ {
+		data = append(data, byte(r.Read(8)))
+	}
+	if err := r.AccError(); err != nil {
+		return nil, fmt.Errorf("emdf payload: %w", err)
+	}
+	return ParseRPU(data)
+}
+
+// readVariableBits reads the EMDF variable_bits(n) syntax element.
+func readVariableBits(r *bits.Reader, n int) uint {
+	var value uint
+	for {
+		value += r.Read(n)
+		if !r.ReadFlag() || r.AccError() != nil {
+			return value
+		}
+		value = (value + 1) << n
+	}
+}
+
+// FindAV1RPU returns the RPU of an AV1 temporal unit, or nil if there is none.
+func FindAV1RPU(sample []byte) (*RPU, error) {
+	obus, err := av1.SplitOBUs(sample)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range obus {
+		t35, ok := dolbyT35(o)
+		if ok {
+			return ParseAV1T35(t35)
+		}
+	}
+	return nil, nil
+}
+
+// dolbyT35 returns the T.35 payload of a metadata OBU carrying a Dolby Vision RPU.
+func dolbyT35(o av1.OBU) (av1.ITUTT35, bool) {
+	m, err := av1.ParseMetadataOBUFromOBU(o)
+	if err != nil || m.Type != av1.MetadataTypeITUTT35 {
+		return av1.ITUTT35{}, false
+	}
+	t35, err := av1.ParseITUTT35(m.Payload)
+	if err != nil || !IsAV1RPU(t35) {
+		return av1.ITUTT35{}, false
+	}
+	return t35, true
+}
+
+// StripAV1Sample removes the metadata OBUs carrying Dolby Vision RPUs from an AV1 temporal
+// unit. The other OBUs are kept byte for byte.
+func StripAV1Sample(sample []byte) ([]byte, error) {
+	obus, err := av1.SplitRawOBUs(sample)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sample))
+	for _, o := range obus {
+		if _, ok := dolbyT35(o.OBU); !ok {
+			out = append(out, o.Raw...)
+		}
+	}
+	return out, nil
+}
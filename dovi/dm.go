@@ -0,0 +1,155 @@
+package dovi
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/bits"
+)
+
+// DMData is vdr_dm_data_payload(): the display management metadata of an RPU.
+type DMData struct {
+	AffectedDMMetadataID uint
+	CurrentDMMetadataID  uint
+	SceneRefreshFlag     uint
+	YCCToRGBCoef         [9]int16
+	YCCToRGBOffset       [3]uint32
+	RGBToLMSCoef         [9]int16
+	SignalEOTF           uint16
+	SignalEOTFParam0     uint16
+	SignalEOTFParam1     uint16
+	SignalEOTFParam2     uint32
+	SignalBitDepth       byte
+	SignalColorSpace     byte
+	SignalChromaFormat   byte
+	SignalFullRangeFlag  byte
+	SourceMinPQ          uint16
+	SourceMaxPQ          uint16
+	SourceDiagonal       uint16
+	// ExtBlockLevels lists the levels of all extension blocks in order, both the CM v2.9 blocks
+	// and the CM v4.0 blocks that may follow them.
+	ExtBlockLevels []byte
+	// CMv40 is true if CM v4.0 extension blocks are present.
+	CMv40 bool
+	L1    *L1Metadata
+	L2    []L2Metadata
+	L6    *L6Metadata
+}
+
+// L1Metadata is the level 1 extension block: the PQ-coded brightness of the frame.
+type L1Metadata struct {
+	MinPQ uint16
+	MaxPQ uint16
+	AvgPQ uint16
+}
+
+// L2Metadata is a level 2 extension block: trims for one target display.
+type L2Metadata struct {
+	TargetMaxPQ        uint16
+	TrimSlope          uint16
+	TrimOffset         uint16
+	TrimPower          uint16
+	TrimChromaWeight   uint16
+	TrimSaturationGain uint16
+	MSWeight           int16
+}
+
+// L6Metadata is the level 6 extension block: the static HDR10 metadata (ST 2086 and CTA-861.3).
+type L6Metadata struct {
+	MaxDisplayMasteringLuminance uint16 // cd/m2
+	MinDisplayMasteringLuminance uint16 // 0.0001 cd/m2
+	MaxContentLightLevel         uint16
+	MaxFrameAverageLightLevel    uint16
+}
+
+// parseDMData reads vdr_dm_data_payload() and the extension blocks. endBit is the bit position
+// where the CRC starts, used to detect CM v4.0 blocks after the CM v2.9 blocks.
+func parseDMData(r *bits.Reader, endBit int) (*DMData, error) {
+	dm := &DMData{}
+	dm.AffectedDMMetadataID = r.ReadExpGolomb()
+	dm.CurrentDMMetadataID = r.ReadExpGolomb()
+	dm.SceneRefreshFlag = r.ReadExpGolomb()
+	for i := range dm.YCCToRGBCoef {
+		dm.YCCToRGBCoef[i] = int16(r.Read(16))
+	}
+	for i := range dm.YCCToRGBOffset {
+		dm.YCCToRGBOffset[i] = uint32(r.Read(32))
+	}
+	for i := range dm.RGBToLMSCoef {
+		dm.RGBToLMSCoef[i] = int16(r.Read(16))
+	}
+	dm.SignalEOTF = uint16(r.Read(16))
+	dm.SignalEOTFParam0 = uint16(r.Read(16))
+	dm.SignalEOTFParam1 = uint16(r.Read(16))
+	dm.SignalEOTFParam2 = uint32(r.Read(32))
+	dm.SignalBitDepth = byte(r.Read(5))
+	dm.SignalColorSpace = byte(r.Read(2))
+	dm.SignalChromaFormat = byte(r.Read(2))
+	dm.SignalFullRangeFlag = byte(r.Read(2))
+	dm.SourceMinPQ = uint16(r.Read(12))
+	dm.SourceMaxPQ = uint16(r.Read(12))
+	dm.SourceDiagonal = uint16(r.Read(10))
+	if err := dm.parseExtBlocks(r); err != nil {
+		return nil, err
+	}
+	// CM v4.0 blocks follow if more than the alignment bits remain before the CRC
+	if endBit-r.NrBitsRead() >= 8 {
+		dm.CMv40 = true
+		if err := dm.parseExtBlocks(r); err != nil {
+			return nil, err
+		}
+	}
+	return dm, r.AccError()
+}
+
+// parseExtBlocks reads num_ext_blocks and the byte-aligned ext_metadata_block()s that follow.
+func (dm *DMData) parseExtBlocks(r *bits.Reader) error {
+	nrBlocks := r.ReadExpGolomb()
+	if nrBlocks == 0 {
+		return r.AccError()
+	}
+	for r.NrBitsRead()%8 != 0 {
+		if r.ReadFlag() {
+			return fmt.Errorf("rpu: non-zero dm_alignment_zero_bit")
+		}
+	}
+	for i := uint(0); i < nrBlocks; i++ {
+		length := r.ReadExpGolomb()
+		level := byte(r.Read(8))
+		if err := r.AccError(); err != nil {
+			return fmt.Errorf("rpu: ext block %d: %w", i, err)
+		}
+		dm.ExtBlockLevels = append(dm.ExtBlockLevels, level)
+		start := r.NrBitsRead()
+		switch level {
+		case 1:
+			dm.L1 = &L1Metadata{
+				MinPQ: uint16(r.Read(12)),
+				MaxPQ: uint16(r.Read(12)),
+				AvgPQ: uint16(r.Read(12)),
+			}
+		case 2:
+			dm.L2 = append(dm.L2, L2Metadata{
+				TargetMaxPQ:        uint16(r.Read(12)),
+				TrimSlope:          uint16(r.Read(12)),
+				TrimOffset:         uint16(r.Read(12)),
+				TrimPower:          uint16(r.Read(12)),
+				TrimChromaWeight:   uint16(r.Read(12)),
+				TrimSaturationGain: uint16(r.Read(12)),
+				MSWeight:           int16(r.ReadSigned(13)),
+			})
+		case 6:
+			dm.L6 = &L6Metadata{
+				MaxDisplayMasteringLuminance: uint16(r.Read(16)),
+				MinDisplayMasteringLuminance: uint16(r.Read(16)),
+				MaxContentLightLevel:         uint16(r.Read(16)),
+				MaxFrameAverageLightLevel:    uint16(r.Read(16)),
+			}
+		}
+		used := r.NrBitsRead() - start
+		if used > int(length)*8 {
+			return fmt.Errorf("rpu: level %d ext block longer than %d bytes", level, length)
+		}
+		skipBits(r, int(length)*8-used) // ext_dm_alignment_zero_bit and unknown payload
+	}
+	return r.AccError()
+}
@@ -0,0 +1,17 @@
+/*
+Package dovi parses Dolby Vision reference processing unit (RPU) data and checks that Dolby Vision
+tracks are consistently signalled.
+
+An RPU is carried once per picture, in an HEVC NAL unit of type 62 (UNSPEC62) or, for AV1, in an
+ITU-T T.35 metadata OBU with the Dolby provider code. ParseRPU decodes the RPU header, skips the
+reshaping and NLQ data, and decodes the display management metadata with the L1 (frame
+brightness), L2 (trims) and L6 (static HDR10 metadata) extension blocks.
+
+ValidateSampleEntry cross-checks a dvh1/dvhe/dav1 (or backwards-compatible hvc1/hev1/av01) sample
+entry and its dvcC/dvvC/dvwC box against an RPU. StripHEVCSample, StripAV1Sample, StripFragment
+and StripSampleEntry remove the Dolby Vision layer to produce an HDR10 fallback track.
+
+The RPU syntax follows the public Dolby Vision bitstream documentation and the open source
+libdovi implementation.
+*/
+package dovi
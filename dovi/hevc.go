@@ -0,0 +1,54 @@
+package dovi
+
+import (
+	"encoding/binary"
+
+	"github.com/Eyevinn/mp4ff/avc"
+	"github.com/Eyevinn/mp4ff/hevc"
+)
+
+// HEVC NAL unit types used by Dolby Vision.
+const (
+	// NALUTypeRPU is UNSPEC62, which carries the RPU.
+	NALUTypeRPU = hevc.NaluType(62)
+	// NALUTypeEL is UNSPEC63, which wraps enhancement layer NAL units in single-track
+	// dual-layer streams (profile 4 and 7).
+	NALUTypeEL = hevc.NaluType(63)
+)
+
+// FindHEVCRPU returns the RPU of an HEVC sample with 4-byte NAL unit lengths, or nil if there
+// is none.
+func FindHEVCRPU(sample []byte) (*RPU, error) {
+	nalus, err := avc.GetNalusFromSample(sample)
+	if err != nil {
+		return nil, err
+	}
+	for _, nalu := range nalus {
+		if len(nalu) > 0 && hevc.GetNaluType(nalu[0]) == NALUTypeRPU {
+			return ParseHEVCNALU(nalu)
+		}
+	}
+	return nil, nil
+}
+
+// StripHEVCSample removes the RPU and enhancement layer NAL units from an HEVC sample with
+// 4-byte NAL unit lengths, leaving only the base layer.
+func StripHEVCSample(sample []byte) ([]byte, error) {
+	nalus, err := avc.GetNalusFromSample(sample)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sample))
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch hevc.GetNaluType(nalu[0]) {
+		case NALUTypeRPU, NALUTypeEL:
+			continue
+		}
+		out = binary.BigEndian.AppendUint32(out, uint32(len(nalu)))
+		out = append(out, nalu...)
+	}
+	return out, nil
+}
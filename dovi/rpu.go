@@ -0,0 +1,303 @@
+package dovi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/bits"
+	"github.com/Eyevinn/mp4ff/hevc"
+)
+
+// RPU errors
+var (
+	ErrNotRPU      = errors.New("not a Dolby Vision RPU")
+	ErrCRCMismatch = errors.New("RPU CRC-32 mismatch")
+)
+
+const (
+	// rpuNALPrefix is the first byte of rpu_data() in an HEVC UNSPEC62 NAL unit.
+	rpuNALPrefix = 0x19
+	// rpuTrailingByte is rpu_data_end: the final byte of an RPU after the CRC.
+	rpuTrailingByte = 0x80
+	// rpuTypeDolbyVision is the only defined rpu_type.
+	rpuTypeDolbyVision = 2
+)
+
+// Mapping idc values for the reshaping curves.
+const (
+	mappingPolynomial = 0
+	mappingMMR        = 1
+)
+
+// RPU is a parsed Dolby Vision reference processing unit.
+type RPU struct {
+	Header RPUHeader
+	// DM is the display management metadata. It is nil if vdr_dm_metadata_present_flag is 0.
+	DM *DMData
+	// CRC is the rpu_data_crc32 read from the RPU. ParseRPU checks it against the data.
+	CRC uint32
+}
+
+// RPUHeader is rpu_data_header() with the leading parts of the mapping syntax that define
+// the profile and layer structure.
+type RPUHeader struct {
+	RPUType                        byte
+	RPUFormat                      uint16
+	VDRRPUProfile                  byte
+	VDRRPULevel                    byte
+	VDRSeqInfoPresent              bool
+	ChromaResamplingExplicitFilter bool
+	CoefficientDataType            byte
+	CoefficientLog2Denom           uint
+	VDRRPUNormalizedIdc            byte
+	BLVideoFullRange               bool
+	BLBitDepth                     byte
+	ELBitDepth                     byte
+	VDRBitDepth                    byte
+	SpatialResamplingFilter        bool
+	ELSpatialResamplingFilter      bool
+	DisableResidual                bool
+	VDRDMMetadataPresent           bool
+	UsePrevVDRRPU                  bool
+	PrevVDRRPUID                   uint
+	VDRRPUID                       uint
+	MappingColorSpace              uint
+	MappingChromaFormatIdc         uint
+	NumPivotsMinus2                [3]uint
+	// PredPivotValues are the absolute pivot values per component (cumulated from the coded deltas).
+	PredPivotValues [3][]uint32
+	NLQMethodIdc    byte
+	NumXPartitions  uint
+	NumYPartitions  uint
+}
+
+// Profile returns the Dolby Vision profile (4, 5, 7 or 8) signalled by the RPU, or 0 if the
+// combination of header fields does not match a known profile. Profile 8 and 10 RPUs are
+// identical, the codec of the base layer tells them apart.
+func (h RPUHeader) Profile() byte {
+	switch h.VDRRPUProfile {
+	case 0:
+		if h.BLVideoFullRange {
+			return 5
+		}
+		return 0
+	case 1:
+		if h.ELSpatialResamplingFilter && !h.DisableResidual {
+			if h.VDRBitDepth == 12 {
+				return 7
+			}
+			return 4
+		}
+		return 8
+	default:
+		return 0
+	}
+}
+
+// hasNLQ reports whether the RPU carries NLQ (enhancement layer residual) data.
+func (h RPUHeader) hasNLQ() bool {
+	return h.RPUFormat&0x700 == 0 && !h.DisableResidual
+}
+
+// coefLen is the number of bits of the fractional part of reshaping coefficients.
+func (h RPUHeader) coefLen() int {
+	if h.CoefficientDataType == 0 {
+		return int(h.CoefficientLog2Denom)
+	}
+	return 32
+}
+
+// ParseHEVCNALU parses the RPU in an HEVC NAL unit of type 62 (UNSPEC62), including its
+// two-byte NAL unit header. Emulation prevention bytes are removed before parsing.
+func ParseHEVCNALU(nalu []byte) (*RPU, error) {
+	if len(nalu) < 3 || hevc.GetNaluType(nalu[0]) != NALUTypeRPU {
+		return nil, ErrNotRPU
+	}
+	r := bits.NewEBSPReader(bytes.NewReader(nalu[2:]))
+	rbsp := make([]byte, 0, len(nalu)-2)
+	for {
+		b := r.Read(8)
+		if r.AccError() != nil {
+			break
+		}
+		rbsp = append(rbsp, byte(b))
+	}
+	return ParseRPU(rbsp)
+}
+
+// ParseRPU parses an RPU as found in a UNSPEC62 NAL unit payload after removal of emulation
+// prevention bytes: the 0x19 prefix, rpu_data(), the CRC-32 and the final 0x80 byte.
+func ParseRPU(data []byte) (*RPU, error) {
+	data = bytes.TrimRight(data, "\x00")
+	if len(data) < 7 || data[0] != rpuNALPrefix || data[len(data)-1] != rpuTrailingByte {
+		return nil, ErrNotRPU
+	}
+	payload := data[1 : len(data)-5]
+	rpu := &RPU{CRC: binary.BigEndian.Uint32(data[len(data)-5:])}
+	if crc := bits.CRC32MPEG2(payload); crc != rpu.CRC {
+		return nil, fmt.Errorf("%w: got %08x, want %08x", ErrCRCMismatch, crc, rpu.CRC)
+	}
+	r := bits.NewReader(bytes.NewReader(payload))
+	if err := rpu.Header.parse(r); err != nil {
+		return nil, err
+	}
+	if !rpu.Header.UsePrevVDRRPU {
+		skipMapping(r, &rpu.Header)
+		if rpu.Header.hasNLQ() {
+			skipNLQ(r, &rpu.Header)
+		}
+	}
+	if rpu.Header.VDRDMMetadataPresent {
+		dm, err := parseDMData(r, len(payload)*8)
+		if err != nil {
+			return nil, err
+		}
+		rpu.DM = dm
+	}
+	if err := r.AccError(); err != nil {
+		return nil, fmt.Errorf("rpu: %w", err)
+	}
+	return rpu, nil
+}
+
+func (h *RPUHeader) parse(r *bits.Reader) error {
+	h.RPUType = byte(r.Read(6))
+	h.RPUFormat = uint16(r.Read(11))
+	if h.RPUType != rpuTypeDolbyVision {
+		return fmt.Errorf("rpu: unsupported rpu_type %d", h.RPUType)
+	}
+	h.VDRRPUProfile = byte(r.Read(4))
+	h.VDRRPULevel = byte(r.Read(4))
+	h.VDRSeqInfoPresent = r.ReadFlag()
+	if h.VDRSeqInfoPresent {
+		h.ChromaResamplingExplicitFilter = r.ReadFlag()
+		h.CoefficientDataType = byte(r.Read(2))
+		if h.CoefficientDataType == 0 {
+			h.CoefficientLog2Denom = r.ReadExpGolomb()
+		}
+		h.VDRRPUNormalizedIdc = byte(r.Read(2))
+		h.BLVideoFullRange = r.ReadFlag()
+		if h.RPUFormat&0x700 == 0 {
+			h.BLBitDepth = byte(r.ReadExpGolomb()) + 8
+			h.ELBitDepth = byte(r.ReadExpGolomb()) + 8
+			h.VDRBitDepth = byte(r.ReadExpGolomb()) + 8
+			h.SpatialResamplingFilter = r.ReadFlag()
+			_ = r.Read(3) // reserved_zero_3bits
+			h.ELSpatialResamplingFilter = r.ReadFlag()
+			h.DisableResidual = r.ReadFlag()
+		}
+	}
+	h.VDRDMMetadataPresent = r.ReadFlag()
+	h.UsePrevVDRRPU = r.ReadFlag()
+	if h.UsePrevVDRRPU {
+		h.PrevVDRRPUID = r.ReadExpGolomb()
+		return r.AccError()
+	}
+	if h.BLBitDepth == 0 {
+		return fmt.Errorf("rpu: mapping without sequence info is not supported")
+	}
+	h.VDRRPUID = r.ReadExpGolomb()
+	h.MappingColorSpace = r.ReadExpGolomb()
+	h.MappingChromaFormatIdc = r.ReadExpGolomb()
+	for cmp := 0; cmp < 3; cmp++ {
+		h.NumPivotsMinus2[cmp] = r.ReadExpGolomb()
+		if h.NumPivotsMinus2[cmp] > 8 {
+			return fmt.Errorf("rpu: num_pivots_minus2 %d too large", h.NumPivotsMinus2[cmp])
+		}
+		nrPivots := int(h.NumPivotsMinus2[cmp]) + 2
+		h.PredPivotValues[cmp] = make([]uint32, nrPivots)
+		var acc uint32
+		for p := 0; p < nrPivots; p++ {
+			acc += uint32(r.Read(int(h.BLBitDepth)))
+			h.PredPivotValues[cmp][p] = acc
+		}
+	}
+	if h.hasNLQ() {
+		h.NLQMethodIdc = byte(r.Read(3))
+		h.NumXPartitions = r.ReadExpGolomb() + 1
+		h.NumYPartitions = r.ReadExpGolomb() + 1
+	}
+	return r.AccError()
+}
+
+// skipMapping reads past rpu_data_mapping(): the polynomial or MMR reshaping curves.
+func skipMapping(r *bits.Reader, h *RPUHeader) {
+	coefLen := h.coefLen()
+	readCoef := func(signedInt bool) {
+		if h.CoefficientDataType == 0 {
+			if signedInt {
+				_ = r.ReadSignedGolomb()
+			} else {
+				_ = r.ReadExpGolomb()
+			}
+		}
+		skipBits(r, coefLen)
+	}
+	for cmp := 0; cmp < 3; cmp++ {
+		nrPieces := int(h.NumPivotsMinus2[cmp]) + 1
+		for piece := 0; piece < nrPieces; piece++ {
+			switch r.ReadExpGolomb() { // mapping_idc
+			case mappingPolynomial:
+				polyOrderMinus1 := r.ReadExpGolomb()
+				linearInterp := false
+				if polyOrderMinus1 == 0 {
+					linearInterp = r.ReadFlag()
+				}
+				if linearInterp {
+					readCoef(false) // pred_linear_interp_value
+					if piece == nrPieces-1 {
+						readCoef(false)
+					}
+					continue
+				}
+				for i := uint(0); i <= polyOrderMinus1+1 && r.AccError() == nil; i++ {
+					readCoef(true) // poly_coef
+				}
+			case mappingMMR:
+				mmrOrderMinus1 := int(r.Read(2))
+				readCoef(true) // mmr_constant
+				for i := 0; i <= mmrOrderMinus1; i++ {
+					for j := 0; j < 7; j++ {
+						readCoef(true) // mmr_coef
+					}
+				}
+			default:
+				r.Read(64) // provoke an error for an unknown mapping
+				return
+			}
+		}
+	}
+}
+
+// skipNLQ reads past rpu_data_nlq(), present for dual-layer profiles with a residual.
+func skipNLQ(r *bits.Reader, h *RPUHeader) {
+	coefLen := h.coefLen()
+	readCoef := func() {
+		if h.CoefficientDataType == 0 {
+			_ = r.ReadExpGolomb()
+		}
+		skipBits(r, coefLen)
+	}
+	for cmp := 0; cmp < 3; cmp++ {
+		skipBits(r, int(h.ELBitDepth)) // nlq_offset
+		readCoef()                     // vdr_in_max
+		if h.NLQMethodIdc == 0 {       // NLQ_LINEAR_DZ
+			readCoef() // linear_deadzone_slope
+			readCoef() // linear_deadzone_threshold
+		}
+	}
+}
+
+// skipBits reads and drops n bits.
+func skipBits(r *bits.Reader, n int) {
+	for n > 0 {
+		m := n
+		if m > 32 {
+			m = 32
+		}
+		_ = r.Read(m)
+		n -= m
+	}
+}
@@ -0,0 +1,312 @@
+package dovi_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/av1"
+	mp4bits "github.com/Eyevinn/mp4ff/bits"
+	"github.com/Eyevinn/mp4ff/dovi"
+)
+
+// rpuWriter writes RBSP bits and keeps track of the bit position for alignment.
+type rpuWriter struct {
+	buf bytes.Buffer
+	w   *mp4bits.Writer
+	n   int
+}
+
+func newRPUWriter() *rpuWriter {
+	rw := &rpuWriter{}
+	rw.w = mp4bits.NewWriter(&rw.buf)
+	return rw
+}
+
+func (rw *rpuWriter) write(v uint, n int) {
+	rw.w.Write(v, n)
+	rw.n += n
+}
+
+func (rw *rpuWriter) ue(v uint) {
+	n := bits.Len(v + 1)
+	rw.write(0, n-1)
+	rw.write(v+1, n)
+}
+
+func (rw *rpuWriter) align() {
+	for rw.n%8 != 0 {
+		rw.write(0, 1)
+	}
+}
+
+// buildRPU returns a profile 8.1 RPU (0x19 prefix, rpu_data, CRC-32, 0x80) with one-piece
+// second-order polynomial mappings, and L1, L2 and L6 metadata.
+func buildRPU() []byte {
+	rw := newRPUWriter()
+	rw.write(2, 6)   // rpu_type
+	rw.write(18, 11) // rpu_format
+	rw.write(1, 4)   // vdr_rpu_profile
+	rw.write(0, 4)   // vdr_rpu_level
+	rw.write(1, 1)   // vdr_seq_info_present_flag
+	rw.write(0, 1)   // chroma_resampling_explicit_filter_flag
+	rw.write(0, 2)   // coefficient_data_type
+	rw.ue(23)        // coefficient_log2_denom
+	rw.write(1, 2)   // vdr_rpu_normalized_idc
+	rw.write(0, 1)   // bl_video_full_range_flag
+	rw.ue(2)         // bl_bit_depth_minus8
+	rw.ue(2)         // el_bit_depth_minus8
+	rw.ue(4)         // vdr_bit_depth_minus8
+	rw.write(0, 1)   // spatial_resampling_filter_flag
+	rw.write(0, 3)   // reserved_zero_3bits
+	rw.write(0, 1)   // el_spatial_resampling_filter_flag
+	rw.write(1, 1)   // disable_residual_flag
+	rw.write(1, 1)   // vdr_dm_metadata_present_flag
+	rw.write(0, 1)   // use_prev_vdr_rpu_flag
+	rw.ue(0)         // vdr_rpu_id
+	rw.ue(0)         // mapping_color_space
+	rw.ue(0)         // mapping_chroma_format_idc
+	for cmp := 0; cmp < 3; cmp++ {
+		rw.ue(0)           // num_pivots_minus2
+		rw.write(0, 10)    // pred_pivot_value[0]
+		rw.write(1023, 10) // pred_pivot_value[1]
+	}
+	for cmp := 0; cmp < 3; cmp++ {
+		rw.ue(0) // mapping_idc: polynomial
+		rw.ue(1) // poly_order_minus1
+		for i := 0; i < 3; i++ {
+			rw.ue(0)            // poly_coef_int (se(v) 0)
+			rw.write(1<<22, 23) // poly_coef
+		}
+	}
+	// vdr_dm_data_payload
+	rw.ue(0) // affected_dm_metadata_id
+	rw.ue(0) // current_dm_metadata_id
+	rw.ue(1) // scene_refresh_flag
+	for i := 0; i < 9; i++ {
+		rw.write(uint(8192+i), 16) // ycc_to_rgb_coef
+	}
+	for i := 0; i < 3; i++ {
+		rw.write(1<<28, 32) // ycc_to_rgb_offset
+	}
+	for i := 0; i < 9; i++ {
+		rw.write(uint(i), 16) // rgb_to_lms_coef
+	}
+	rw.write(65535, 16) // signal_eotf
+	rw.write(0, 16)
+	rw.write(0, 16)
+	rw.write(0, 32)
+	rw.write(12, 5)    // signal_bit_depth
+	rw.write(0, 2)     // signal_color_space
+	rw.write(0, 2)     // signal_chroma_format
+	rw.write(1, 2)     // signal_full_range_flag
+	rw.write(62, 12)   // source_min_pq
+	rw.write(3696, 12) // source_max_pq
+	rw.write(42, 10)   // source_diagonal
+	rw.ue(3)           // num_ext_blocks
+	rw.align()
+	// L1
+	rw.ue(5)
+	rw.write(1, 8)
+	rw.write(10, 12)
+	rw.write(3000, 12)
+	rw.write(1200, 12)
+	rw.write(0, 4)
+	// L2
+	rw.ue(11)
+	rw.write(2, 8)
+	for _, v := range []uint{2081, 2048, 2048, 2048, 2048, 2048} {
+		rw.write(v, 12)
+	}
+	rw.write(0x1fff, 13) // ms_weight = -1
+	rw.write(0, 3)
+	// L6
+	rw.ue(8)
+	rw.write(6, 8)
+	for _, v := range []uint{1000, 50, 1000, 400} {
+		rw.write(v, 16)
+	}
+	rw.align()
+	rw.w.Flush()
+	payload := rw.buf.Bytes()
+	crc := mp4bits.CRC32MPEG2(payload)
+	out := append([]byte{0x19}, payload...)
+	out = binary.BigEndian.AppendUint32(out, crc)
+	return append(out, 0x80)
+}
+
+func checkRPU(t *testing.T, rpu *dovi.RPU) {
+	t.Helper()
+	h := rpu.Header
+	if h.Profile() != 8 {
+		t.Errorf("profile = %d, want 8", h.Profile())
+	}
+	if h.BLBitDepth != 10 || h.VDRBitDepth != 12 || h.CoefficientLog2Denom != 23 {
+		t.Errorf("bit depths %d/%d, denom %d", h.BLBitDepth, h.VDRBitDepth, h.CoefficientLog2Denom)
+	}
+	if got := h.PredPivotValues[0]; len(got) != 2 || got[1] != 1023 {
+		t.Errorf("pivots = %v", got)
+	}
+	dm := rpu.DM
+	if dm == nil {
+		t.Fatal("no DM data")
+	}
+	if dm.SourceMaxPQ != 3696 || dm.SignalBitDepth != 12 || dm.YCCToRGBCoef[8] != 8200 {
+		t.Errorf("unexpected DM data %+v", dm)
+	}
+	if want := []byte{1, 2, 6}; !bytes.Equal(dm.ExtBlockLevels, want) {
+		t.Errorf("ext block levels = %v, want %v", dm.ExtBlockLevels, want)
+	}
+	if dm.CMv40 {
+		t.Error("unexpected CM v4.0")
+	}
+	if dm.L1 == nil || *dm.L1 != (dovi.L1Metadata{MinPQ: 10, MaxPQ: 3000, AvgPQ: 1200}) {
+		t.Errorf("L1 = %+v", dm.L1)
+	}
+	if len(dm.L2) != 1 || dm.L2[0].TargetMaxPQ != 2081 || dm.L2[0].MSWeight != -1 {
+		t.Errorf("L2 = %+v", dm.L2)
+	}
+	want6 := dovi.L6Metadata{MaxDisplayMasteringLuminance: 1000, MinDisplayMasteringLuminance: 50,
+		MaxContentLightLevel: 1000, MaxFrameAverageLightLevel: 400}
+	if dm.L6 == nil || *dm.L6 != want6 {
+		t.Errorf("L6 = %+v", dm.L6)
+	}
+}
+
+func TestParseRPU(t *testing.T) {
+	data := buildRPU()
+	rpu, err := dovi.ParseRPU(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRPU(t, rpu)
+
+	bad := append([]byte{}, data...)
+	bad[5] ^= 0x01
+	if _, err := dovi.ParseRPU(bad); !errors.Is(err, dovi.ErrCRCMismatch) {
+		t.Errorf("got %v, want CRC mismatch", err)
+	}
+	if _, err := dovi.ParseRPU([]byte{0x01, 0x02}); !errors.Is(err, dovi.ErrNotRPU) {
+		t.Errorf("got %v, want ErrNotRPU", err)
+	}
+}
+
+// hevcSample returns a sample with 4-byte lengths holding a slice NAL unit and an RPU NAL unit.
+func hevcSample(rpu []byte) (sample, slice []byte) {
+	slice = []byte{0x26, 0x01, 0xaf, 0x00, 0x00, 0x03, 0x01}
+	// Insert emulation prevention bytes into the RPU payload
+	var ebsp []byte
+	zeros := 0
+	for _, b := range rpu {
+		if zeros >= 2 && b <= 3 {
+			ebsp = append(ebsp, 0x03)
+			zeros = 0
+		}
+		ebsp = append(ebsp, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	rpuNALU := append([]byte{0x7c, 0x01}, ebsp...)
+	for _, n := range [][]byte{slice, rpuNALU} {
+		sample = binary.BigEndian.AppendUint32(sample, uint32(len(n)))
+		sample = append(sample, n...)
+	}
+	return sample, slice
+}
+
+func TestHEVCRPU(t *testing.T) {
+	sample, slice := hevcSample(buildRPU())
+	rpu, err := dovi.FindHEVCRPU(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpu == nil {
+		t.Fatal("no RPU found")
+	}
+	checkRPU(t, rpu)
+
+	stripped, err := dovi.StripHEVCSample(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := binary.BigEndian.AppendUint32(nil, uint32(len(slice)))
+	want = append(want, slice...)
+	if !bytes.Equal(stripped, want) {
+		t.Errorf("stripped sample = %x, want %x", stripped, want)
+	}
+	rpu, err = dovi.FindHEVCRPU(stripped)
+	if err != nil || rpu != nil {
+		t.Errorf("stripped sample: got (%v, %v), want no RPU", rpu, err)
+	}
+}
+
+// av1T35 wraps an RPU (without its 0x19 prefix) in an EMDF container in a T.35 payload.
+func av1T35(rpu []byte) av1.ITUTT35 {
+	rw := newRPUWriter()
+	rw.write(0x003b, 16)     // terminal provider code
+	rw.write(0x00000800, 32) // terminal provider oriented code
+	rw.write(0, 2)           // emdf_version
+	rw.write(6, 3)           // key_id
+	rw.write(31, 5)          // emdf_payload_id
+	rw.write(6, 5)           // variable_bits(5) = 225
+	rw.write(1, 1)
+	rw.write(1, 5)
+	rw.write(0, 1)
+	rw.write(0, 4)             // smploffste, duratione, groupide, codecdatae
+	rw.write(1, 1)             // discard_unknown_payload
+	size := uint(len(rpu) - 1) // variable_bits(8)
+	if size >= 256 {
+		rw.write(size>>8-1, 8)
+		rw.write(1, 1)
+	}
+	rw.write(size&0xff, 8)
+	rw.write(0, 1)
+	for _, b := range rpu[1:] {
+		rw.write(uint(b), 8)
+	}
+	rw.align()
+	rw.w.Flush()
+	return av1.ITUTT35{CountryCode: 0xb5, Payload: rw.buf.Bytes()}
+}
+
+func TestAV1RPU(t *testing.T) {
+	t35 := av1T35(buildRPU())
+	if !dovi.IsAV1RPU(t35) {
+		t.Fatal("not detected as Dolby Vision T.35 payload")
+	}
+	temporalDelimiter := av1.OBU{Header: av1.OBUHeader{Type: av1.OBUTemporalDelimiter, HasSizeField: true, HeaderSize: 1}}
+	frame := av1.OBU{Header: av1.OBUHeader{Type: av1.OBUFrame, HasSizeField: true, HeaderSize: 1}, Payload: []byte{1, 2, 3}}
+	var sample []byte
+	sample = append(sample, temporalDelimiter.Encode()...)
+	sample = append(sample, t35.MetadataOBU().Encode()...)
+	sample = append(sample, frame.Encode()...)
+
+	rpu, err := dovi.FindAV1RPU(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpu == nil {
+		t.Fatal("no RPU found")
+	}
+	checkRPU(t, rpu)
+
+	stripped, err := dovi.StripAV1Sample(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(temporalDelimiter.Encode(), frame.Encode()...)
+	if !bytes.Equal(stripped, want) {
+		t.Errorf("stripped = %x, want %x", stripped, want)
+	}
+
+	// A payload size beyond the end of the T.35 payload must give an error
+	truncated := av1.ITUTT35{CountryCode: t35.CountryCode, Payload: t35.Payload[:12]}
+	if _, err := dovi.ParseAV1T35(truncated); err == nil {
+		t.Error("no error for truncated EMDF payload")
+	}
+}
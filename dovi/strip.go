@@ -0,0 +1,54 @@
+package dovi
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// fallbackSampleEntryTypes maps Dolby Vision sample entry types to the plain codec types.
+var fallbackSampleEntryTypes = map[string]string{
+	"dvh1": "hvc1", "dvhe": "hev1", "dav1": "av01", "dva1": "avc1", "dvav": "avc3",
+}
+
+// StripSampleEntry turns a Dolby Vision sample entry into a plain one for the base layer,
+// e.g. dvh1 into hvc1, and removes the dvcC/dvvC/dvwC box. For an HDR10-compatible stream
+// (compatibility ID 1, as in profile 8.1) the result is an HDR10 fallback track once the RPUs
+// are stripped from the samples. Profiles without a compatible base layer give an error.
+func StripSampleEntry(vse *mp4.VisualSampleEntryBox) error {
+	cfg := vse.DoViConfig
+	if cfg == nil {
+		return fmt.Errorf("%s sample entry has no Dolby Vision configuration box", vse.Type())
+	}
+	if cfg.DVBLSignalCompatibilityID == 0 {
+		return fmt.Errorf("profile %d has no backwards-compatible base layer", cfg.DVProfile)
+	}
+	if newType, ok := fallbackSampleEntryTypes[vse.Type()]; ok {
+		vse.SetType(newType)
+	}
+	for i, c := range vse.Children {
+		if c == mp4.Box(cfg) {
+			vse.Children = append(vse.Children[:i], vse.Children[i+1:]...)
+			break
+		}
+	}
+	vse.DoViConfig = nil
+	return nil
+}
+
+// StripFragment removes RPUs (and for HEVC enhancement layer NAL units) from all samples of a
+// single-track fragment. The codec is taken from the sample entry of the track.
+func StripFragment(frag *mp4.Fragment, trex *mp4.TrexBox, vse *mp4.VisualSampleEntryBox) error {
+	var strip func([]byte) ([]byte, error)
+	switch {
+	case vse.HvcC != nil:
+		strip = StripHEVCSample
+	case vse.Av1C != nil:
+		strip = StripAV1Sample
+	default:
+		return fmt.Errorf("no RPU stripping for %s sample entry", vse.Type())
+	}
+	return frag.ReplaceSampleData(trex, func(_ int, data []byte) ([]byte, error) {
+		return strip(data)
+	})
+}
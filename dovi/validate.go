@@ -0,0 +1,130 @@
+package dovi
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// Base-layer codecs of Dolby Vision sample entries.
+const (
+	codecAVC  = "avc"
+	codecHEVC = "hevc"
+	codecAV1  = "av1"
+)
+
+// sampleEntryCodecs maps sample entry types to the base-layer codec. The dv* types signal a
+// Dolby Vision track, while the plain codec types are used for backwards-compatible tracks
+// with a Dolby Vision configuration box.
+var sampleEntryCodecs = map[string]string{
+	"dvh1": codecHEVC, "dvhe": codecHEVC, "hvc1": codecHEVC, "hev1": codecHEVC,
+	"dav1": codecAV1, "av01": codecAV1,
+	"dva1": codecAVC, "dvav": codecAVC, "avc1": codecAVC, "avc3": codecAVC,
+}
+
+// profileCodecs maps Dolby Vision profiles to the base-layer codec.
+var profileCodecs = map[byte]string{
+	4: codecHEVC, 5: codecHEVC, 7: codecHEVC, 8: codecHEVC, 9: codecAVC, 10: codecAV1,
+}
+
+// profileCompatIDs lists the allowed dv_bl_signal_compatibility_id values per profile.
+// 0 is no compatible base layer, 1 HDR10, 2 SDR, 4 HLG and 6 Ultra HD Blu-ray.
+var profileCompatIDs = map[byte][]byte{
+	4: {2}, 5: {0}, 7: {6}, 8: {1, 2, 4, 6}, 9: {2}, 10: {0, 1, 2, 4},
+}
+
+// compatTransfers lists the transfer characteristics of the base layer per compatibility ID.
+var compatTransfers = map[byte][]uint16{
+	1: {16}, 2: {1, 6, 14, 15}, 4: {18}, 6: {16},
+}
+
+// rpuProfile returns the profile an RPU reports for a track of a given profile. Profile 9
+// and 10 tracks carry the same RPUs as profile 8.
+func rpuProfile(dvProfile byte) byte {
+	switch dvProfile {
+	case 9, 10:
+		return 8
+	}
+	return dvProfile
+}
+
+// ValidateSampleEntry checks that a Dolby Vision video sample entry is consistent: the
+// sample entry type matches the base-layer codec of the profile in its dvcC/dvvC/dvwC box,
+// the box type matches the profile, the base-layer compatibility ID is allowed for the profile
+// and agrees with the transfer characteristics in an nclx colr box, and a backwards-compatible
+// (non-dv) sample entry has a compatible base layer. If rpu is not nil, its profile must match
+// the configuration box.
+func ValidateSampleEntry(vse *mp4.VisualSampleEntryBox, rpu *RPU) error {
+	cfg := vse.DoViConfig
+	if cfg == nil {
+		return fmt.Errorf("%s sample entry has no Dolby Vision configuration box", vse.Type())
+	}
+	entryCodec, ok := sampleEntryCodecs[vse.Type()]
+	if !ok {
+		return fmt.Errorf("sample entry type %s cannot carry Dolby Vision", vse.Type())
+	}
+	profile := cfg.DVProfile
+	profileCodec, ok := profileCodecs[profile]
+	if !ok {
+		return fmt.Errorf("unsupported Dolby Vision profile %d", profile)
+	}
+	if entryCodec != profileCodec {
+		return fmt.Errorf("profile %d has %s base layer, but sample entry is %s", profile, profileCodec, vse.Type())
+	}
+	if wantType := mp4.CreateDoViConfigurationBox(0, 0, profile, 0, false, false, false, 0).Type(); cfg.Type() != wantType {
+		return fmt.Errorf("profile %d must use %s, not %s", profile, wantType, cfg.Type())
+	}
+	compatID := cfg.DVBLSignalCompatibilityID
+	if !containsByte(profileCompatIDs[profile], compatID) {
+		return fmt.Errorf("compatibility ID %d not allowed for profile %d", compatID, profile)
+	}
+	if compatID == 0 && vse.Type()[0] != 'd' {
+		return fmt.Errorf("profile %d without compatible base layer requires a dv sample entry, not %s",
+			profile, vse.Type())
+	}
+	if transfers, ok := compatTransfers[compatID]; ok {
+		if colr := findNclx(vse); colr != nil && !containsUint16(transfers, colr.TransferCharacteristics) {
+			return fmt.Errorf("compatibility ID %d does not match base-layer transfer characteristics %d",
+				compatID, colr.TransferCharacteristics)
+		}
+	}
+	if !cfg.RPUPresentFlag || !cfg.BLPresentFlag {
+		return fmt.Errorf("profile %d requires RPU and base layer", profile)
+	}
+	if cfg.ELPresentFlag && profile != 4 && profile != 7 {
+		return fmt.Errorf("single-layer profile %d has el_present_flag set", profile)
+	}
+	if rpu != nil {
+		if got, want := rpu.Header.Profile(), rpuProfile(profile); got != want {
+			return fmt.Errorf("RPU signals profile %d, but configuration box has profile %d", got, profile)
+		}
+	}
+	return nil
+}
+
+func findNclx(vse *mp4.VisualSampleEntryBox) *mp4.ColrBox {
+	for _, c := range vse.Children {
+		if colr, ok := c.(*mp4.ColrBox); ok && colr.ColorType == mp4.ColorTypeOnScreenColors {
+			return colr
+		}
+	}
+	return nil
+}
+
+func containsByte(s []byte, v byte) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsUint16(s []uint16, v uint16) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package dovi_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/dovi"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func dvSampleEntry(name string, profile, compatID byte, transfer uint16) *mp4.VisualSampleEntryBox {
+	vse := mp4.CreateVisualSampleEntryBox(name, 1920, 1080, &mp4.HvcCBox{})
+	vse.AddChild(mp4.CreateDoViConfigurationBox(1, 0, profile, 6, true, false, true, compatID))
+	if transfer != 0 {
+		vse.AddChild(&mp4.ColrBox{ColorType: mp4.ColorTypeOnScreenColors, ColorPrimaries: 9,
+			TransferCharacteristics: transfer, MatrixCoefficients: 9})
+	}
+	return vse
+}
+
+func TestValidateSampleEntry(t *testing.T) {
+	rpu, err := dovi.ParseRPU(buildRPU())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		desc    string
+		vse     *mp4.VisualSampleEntryBox
+		wantErr bool
+	}{
+		{"profile 8.1 dvh1", dvSampleEntry("dvh1", 8, 1, 16), false},
+		{"profile 8.1 hvc1", dvSampleEntry("hvc1", 8, 1, 16), false},
+		{"profile 8.4 with PQ base layer", dvSampleEntry("hvc1", 8, 4, 16), true},
+		{"profile 8 with compat ID 0", dvSampleEntry("dvh1", 8, 0, 0), true},
+		{"profile 5 in hvc1", dvSampleEntry("hvc1", 5, 0, 0), true},
+		{"profile 5 RPU mismatch", dvSampleEntry("dvh1", 5, 0, 0), true},
+		{"profile 10 in dvh1", dvSampleEntry("dvh1", 10, 1, 0), true},
+		{"no dovi config", mp4.CreateVisualSampleEntryBox("dvh1", 1920, 1080, &mp4.HvcCBox{}), true},
+	}
+	for _, c := range cases {
+		err := dovi.ValidateSampleEntry(c.vse, rpu)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error %t", c.desc, err, c.wantErr)
+		}
+	}
+}
+
+func TestStripSampleEntry(t *testing.T) {
+	vse := dvSampleEntry("dvh1", 8, 1, 16)
+	if err := dovi.StripSampleEntry(vse); err != nil {
+		t.Fatal(err)
+	}
+	if vse.Type() != "hvc1" || vse.DoViConfig != nil {
+		t.Errorf("got type %s, DoViConfig %v", vse.Type(), vse.DoViConfig)
+	}
+	for _, c := range vse.Children {
+		if c.Type() == "dvvC" {
+			t.Error("dvvC box not removed")
+		}
+	}
+	if err := dovi.StripSampleEntry(dvSampleEntry("dvh1", 5, 0, 0)); err == nil {
+		t.Error("expected error for profile 5")
+	}
+}
+
+func TestStripFragment(t *testing.T) {
+	sample, slice := hevcSample(buildRPU())
+	frag, err := mp4.CreateFragment(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		frag.AddFullSample(mp4.FullSample{
+			Sample:     mp4.Sample{Flags: mp4.SyncSampleFlags, Dur: 1000, Size: uint32(len(sample))},
+			DecodeTime: uint64(i) * 1000,
+			Data:       sample,
+		})
+	}
+	if err := dovi.StripFragment(frag, nil, dvSampleEntry("dvh1", 8, 1, 16)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := frag.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fss, err := f.Segments[0].Fragments[0].GetFullSamples(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fss) != 3 {
+		t.Fatalf("got %d samples, want 3", len(fss))
+	}
+	for i, fs := range fss {
+		if len(fs.Data) != 4+len(slice) || !bytes.Equal(fs.Data[4:], slice) {
+			t.Errorf("sample %d: data %x", i, fs.Data)
+		}
+	}
+}
@@ -117,7 +117,8 @@ func setupAV1(hdr ivf.FileHeader, frames []ivf.Frame) (*mp4.InitSegment, keyFram
 	return init, isKey, nil
 }
 
-// setupVP9 builds the init segment for a VP9 track from the first key frame's header.
+// setupVP9 builds the init segment for a VP9 track. The vpcC is derived from all frames,
+// including those inside superframes, so that profile and level cover the whole stream.
 func setupVP9(hdr ivf.FileHeader, frames []ivf.Frame) (*mp4.InitSegment, keyFrameFunc, error) {
 	h, err := vp9.ParseFrameHeader(frames[0].Data)
 	if err != nil {
@@ -126,22 +127,19 @@ func setupVP9(hdr ivf.FileHeader, frames []ivf.Frame) (*mp4.InitSegment, keyFram
 	if !h.KeyFrame {
 		return nil, nil, fmt.Errorf("first VP9 frame is not a key frame")
 	}
-	prim, trc, mtx := h.CICP()
 	scale := hdr.Scale
 	if scale == 0 {
 		scale = 1
 	}
-	vpcC := &mp4.VppCBox{
-		Version:                 1,
-		Profile:                 h.Profile,
-		Level:                   vp9.Level(h.Width, h.Height, float64(hdr.Rate)/float64(scale)),
-		BitDepth:                h.BitDepth,
-		ChromaSubsampling:       h.VpcCChromaSubsampling(),
-		VideoFullRangeFlag:      boolToByte(h.ColorRange),
-		ColourPrimaries:         prim,
-		TransferCharacteristics: trc,
-		MatrixCoefficients:      mtx,
+	samples := make([][]byte, len(frames))
+	for i := range frames {
+		samples[i] = frames[i].Data
+	}
+	cfg, err := vp9.CodecConfigFromSamples(samples, float64(hdr.Rate)/float64(scale))
+	if err != nil {
+		return nil, nil, fmt.Errorf("VP9 codec config: %w", err)
 	}
+	vpcC := mp4.CreateVppCFromVP9(cfg)
 	width, height := frameSize(hdr, uint16(h.Width), uint16(h.Height))
 
 	init := mp4.CreateEmptyInit()
@@ -250,13 +248,6 @@ func frameSize(hdr ivf.FileHeader, bsWidth, bsHeight uint16) (uint16, uint16) {
 	return w, h
 }
 
-func boolToByte(b bool) byte {
-	if b {
-		return 1
-	}
-	return 0
-}
-
 // findOBU returns the first OBU of the given type in a temporal unit.
 func findOBU(tu []byte, t av1.OBUType) (av1.OBU, error) {
 	obus, err := av1.SplitOBUs(tu)
@@ -0,0 +1,29 @@
+/*
+ll-chunker is an HTTP server that streams one track of an mp4 file as low-latency CMAF chunks.
+
+The init segment is served at /init.mp4 and the chunked media at /live.mp4 using chunked transfer
+encoding, with one flush per chunk. Every segment starts with a styp box, and prft boxes give
+the wall-clock time of the chunks. The corresponding HLS EXT-X-PART tags are logged.
+
+	Usage of ll-chunker:
+
+		ll-chunker [options]
+
+	options:
+
+		-chunkdur uint
+			Chunk duration in milliseconds (0 for one chunk per segment) (default 500)
+		-input string
+			Input MP4 file path (default "../../mp4/testdata/prog_8s.mp4")
+		-pace
+			Send chunks in real time
+		-port int
+			HTTP server port (default 8080)
+		-prftchunk
+			Add prft to every chunk instead of only the first chunk of a segment
+		-segdur uint
+			Segment duration in milliseconds (default 2000)
+		-track int
+			Track number (1-based, in moov order) (default 1)
+*/
+package main
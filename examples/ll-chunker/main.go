@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+const (
+	appName = "ll-chunker"
+)
+
+var usg = `%s is an HTTP server that streams one track of an mp4 file as low-latency CMAF chunks.
+
+The init segment is served at /init.mp4 and the chunked media at /live.mp4 using chunked transfer
+encoding, with one flush per chunk. Every segment starts with a styp box, and prft boxes give
+the wall-clock time of the chunks. The corresponding HLS EXT-X-PART tags are logged.
+
+Usage of %s:
+`
+
+type options struct {
+	port        int
+	inputFile   string
+	trackNr     int
+	segmentMS   uint
+	chunkMS     uint
+	prftOnChunk bool
+	pace        bool
+}
+
+func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usg, appName, appName)
+		fmt.Fprintf(os.Stderr, "\n%s [options]\n\noptions:\n", appName)
+		fs.PrintDefaults()
+	}
+
+	opts := options{}
+
+	fs.IntVar(&opts.port, "port", 8080, "HTTP server port")
+	fs.StringVar(&opts.inputFile, "input", "../../mp4/testdata/prog_8s.mp4", "Input MP4 file path")
+	fs.IntVar(&opts.trackNr, "track", 1, "Track number (1-based, in moov order)")
+	fs.UintVar(&opts.segmentMS, "segdur", 2000, "Segment duration in milliseconds")
+	fs.UintVar(&opts.chunkMS, "chunkdur", 500, "Chunk duration in milliseconds (0 for one chunk per segment)")
+	fs.BoolVar(&opts.prftOnChunk, "prftchunk", false, "Add prft to every chunk instead of only the first chunk of a segment")
+	fs.BoolVar(&opts.pace, "pace", false, "Send chunks in real time")
+
+	err := fs.Parse(args[1:])
+	return &opts, err
+}
+
+// track - one demuxed track of the input
+type track struct {
+	init      *mp4.InitSegment
+	timescale uint32
+	samples   []mp4.FullSample
+}
+
+func readTrack(inputFile string, trackNr int) (*track, error) {
+	f, err := mp4.ReadMP4File(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	outs, err := mp4.Demux(f, mp4.DemuxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if trackNr < 1 || trackNr > len(outs) {
+		return nil, fmt.Errorf("track %d not in range 1-%d", trackNr, len(outs))
+	}
+	out := outs[trackNr-1]
+	tr := &track{init: out.Init, timescale: out.Init.Moov.Trak.Mdia.Mdhd.Timescale}
+	for _, seg := range out.Segments {
+		for _, frag := range seg.Fragments {
+			samples, err := frag.GetFullSamples(out.Init.Moov.Mvex.Trex)
+			if err != nil {
+				return nil, err
+			}
+			tr.samples = append(tr.samples, samples...)
+		}
+	}
+	return tr, nil
+}
+
+// partTag - HLS EXT-X-PART tag for a chunk
+func partTag(c *mp4.CMAFChunk, timescale uint32, uri string) string {
+	tag := fmt.Sprintf("#EXT-X-PART:DURATION=%.5f,URI=%q", float64(c.Duration)/float64(timescale), uri)
+	if c.Independent {
+		tag += ",INDEPENDENT=YES"
+	}
+	return tag
+}
+
+func makeInitHandler(tr *track) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		if err := tr.init.Encode(w); err != nil {
+			log.Printf("Write init failed: %v", err)
+		}
+	}
+}
+
+func makeLiveHandler(tr *track, opts options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Transfer-Encoding", "chunked")
+
+		prftMode := mp4.PrftSegment
+		if opts.prftOnChunk {
+			prftMode = mp4.PrftChunk
+		}
+		start := time.Now()
+		var firstTime uint64
+		if len(tr.samples) > 0 {
+			firstTime = tr.samples[0].DecodeTime
+		}
+		mediaToWallClock := func(decodeTime uint64) time.Time {
+			return start.Add(time.Duration(decodeTime-firstTime) * time.Second / time.Duration(tr.timescale))
+		}
+		cfg := mp4.ChunkerConfig{
+			TrackID:         1,
+			SegmentDuration: uint64(opts.segmentMS) * uint64(tr.timescale) / 1000,
+			ChunkDuration:   uint64(opts.chunkMS) * uint64(tr.timescale) / 1000,
+			Prft:            prftMode,
+			PrftFlags:       mp4.PrftTimeEncoderOutput,
+			WallClock:       mediaToWallClock,
+		}
+		chunker, err := mp4.NewChunker(cfg, func(c *mp4.CMAFChunk) error {
+			if opts.pace {
+				// A chunk is available when its last sample has been produced
+				time.Sleep(time.Until(mediaToWallClock(c.DecodeTime + c.Duration)))
+			}
+			if err := c.Encode(w); err != nil {
+				return err
+			}
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+			log.Print(partTag(c, tr.timescale, fmt.Sprintf("seg%d.part%d.m4s", c.SegmentNr, c.ChunkNr)))
+			return nil
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create chunker: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, s := range tr.samples {
+			if err := chunker.AddSample(s); err != nil {
+				log.Printf("Chunking failed: %v", err)
+				return
+			}
+		}
+		if err := chunker.Flush(); err != nil {
+			log.Printf("Chunking failed: %v", err)
+		}
+	}
+}
+
+func main() {
+	if err := run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	opts, err := parseOptions(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if opts.segmentMS == 0 {
+		return fmt.Errorf("segment duration must be larger than 0")
+	}
+	tr, err := readTrack(opts.inputFile, opts.trackNr)
+	if err != nil {
+		return err
+	}
+
+	http.HandleFunc("/init.mp4", makeInitHandler(tr))
+	http.HandleFunc("/live.mp4", makeLiveHandler(tr, *opts))
+	addr := fmt.Sprintf(":%d", opts.port)
+	log.Printf("Server starting on %s, serving %s at /init.mp4 and /live.mp4", addr, opts.inputFile)
+	return http.ListenAndServe(addr, nil)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestLiveChunks(t *testing.T) {
+	tr, err := readTrack("../../mp4/testdata/prog_8s.mp4", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := options{segmentMS: 2000, chunkMS: 500}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/init.mp4", makeInitHandler(tr))
+	mux.HandleFunc("/live.mp4", makeLiveHandler(tr, opts))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var body []byte
+	for _, p := range []string{"/init.mp4", "/live.mp4"} {
+		resp, err := http.Get(server.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = append(body, data...)
+	}
+	f, err := mp4.DecodeFile(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Segments) != 4 {
+		t.Fatalf("got %d segments instead of 4", len(f.Segments))
+	}
+	var nrSamples int
+	for i, seg := range f.Segments {
+		if seg.Styp == nil || len(seg.Fragments) < 2 {
+			t.Errorf("segment %d: no styp or only one chunk", i)
+		}
+		if seg.Fragments[0].Prft == nil {
+			t.Errorf("segment %d: no prft in first chunk", i)
+		}
+		for _, frag := range seg.Fragments {
+			samples, err := frag.GetFullSamples(f.Init.Moov.Mvex.Trex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nrSamples += len(samples)
+		}
+	}
+	if nrSamples != len(tr.samples) {
+		t.Errorf("got %d samples instead of %d", nrSamples, len(tr.samples))
+	}
+}
+
+func TestPartTag(t *testing.T) {
+	c := &mp4.CMAFChunk{Duration: 45000, Independent: true}
+	got := partTag(c, 90000, "seg1.part1.m4s")
+	want := `#EXT-X-PART:DURATION=0.50000,URI="seg1.part1.m4s",INDEPENDENT=YES`
+	if got != want {
+		t.Errorf("got %s instead of %s", got, want)
+	}
+}
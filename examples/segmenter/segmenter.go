@@ -75,6 +75,8 @@ func (s *Segmenter) MakeInitSegments() ([]*mp4.InitSegment, error) {
 		init.Moov.Mvex.AddChild(&mp4.MehdBox{FragmentDuration: int64(inMovieDuration)})
 		outTrak := init.AddEmptyTrack(tr.timeScale, tr.trackType, tr.lang)
 		tr.trackID = outTrak.Tkhd.TrackID
+		inTimeline := tr.inTrak.Timeline(s.inFile.Moov.Mvhd.Timescale)
+		outTrak.SetEdits(init.Moov.Mvhd.Timescale, inTimeline.Edits)
 
 		inStsd := tr.inTrak.Mdia.Minf.Stbl.Stsd
 		outStsd := outTrak.Mdia.Minf.Stbl.Stsd
@@ -109,6 +111,8 @@ func (s *Segmenter) MakeMuxedInitSegment() (*mp4.InitSegment, error) {
 	for _, tr := range s.tracks {
 		outTrak := init.AddEmptyTrack(tr.timeScale, tr.trackType, tr.lang)
 		tr.trackID = outTrak.Tkhd.TrackID
+		inTimeline := tr.inTrak.Timeline(s.inFile.Moov.Mvhd.Timescale)
+		outTrak.SetEdits(init.Moov.Mvhd.Timescale, inTimeline.Edits)
 		inStsd := tr.inTrak.Mdia.Minf.Stbl.Stsd
 		outStsd := outTrak.Mdia.Minf.Stbl.Stsd
 		switch tr.trackType {
@@ -12,6 +12,8 @@ type EncryptConfig struct {
 	KeyID  []byte
 	IV     []byte
 	Scheme string
+	// Workers is the number of goroutines encrypting the samples of a fragment (<= 1 is sequential)
+	Workers int
 }
 
 type StreamEncryptor struct {
@@ -59,10 +61,14 @@ func (se *StreamEncryptor) EncryptFragment(frag *mp4.Fragment) error {
 
 	iv := se.deriveIV(se.fragNum)
 
-	_, err := mp4.EncryptFragment(frag, se.config.Key, iv, se.ipd)
+	enc, err := se.ipd.NewFragmentEncryptor(se.config.Key, iv)
 	if err != nil {
 		return fmt.Errorf("encrypt fragment %d: %w", se.fragNum, err)
 	}
+	enc.SetWorkers(se.config.Workers)
+	if err := enc.EncryptFragment(frag); err != nil {
+		return fmt.Errorf("encrypt fragment %d: %w", se.fragNum, err)
+	}
 
 	return nil
 }
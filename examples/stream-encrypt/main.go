@@ -30,6 +30,7 @@ type options struct {
 	iv             string
 	scheme         string
 	inputFile      string
+	workers        int
 }
 
 func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
@@ -47,6 +48,7 @@ func parseOptions(fs *flag.FlagSet, args []string) (*options, error) {
 	fs.StringVar(&opts.keyID, "keyid", "", "Key ID (hex)")
 	fs.StringVar(&opts.iv, "iv", "", "IV (hex)")
 	fs.StringVar(&opts.scheme, "scheme", "cenc", "Encryption scheme (cenc/cbcs)")
+	fs.IntVar(&opts.workers, "workers", 1, "Goroutines encrypting the samples of a fragment in parallel")
 	fs.StringVar(&opts.inputFile, "input", "../../mp4/testdata/v300_multiple_segments.mp4", "Input MP4 file path")
 
 	err := fs.Parse(args[1:])
@@ -113,10 +115,11 @@ func makeStreamHandler(opts options) http.HandlerFunc {
 			}
 
 			encConfig := EncryptConfig{
-				Key:    keyBytes,
-				KeyID:  keyIDBytes,
-				IV:     ivBytes,
-				Scheme: opts.scheme,
+				Key:     keyBytes,
+				KeyID:   keyIDBytes,
+				IV:      ivBytes,
+				Scheme:  opts.scheme,
+				Workers: opts.workers,
 			}
 
 			encryptor, err = NewStreamEncryptor(sf.Init, encConfig)
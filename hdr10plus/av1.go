@@ -0,0 +1,80 @@
+package hdr10plus
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/av1"
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+// ExtractAV1 returns the HDR10+ metadata of an AV1 temporal unit, or nil if there is none.
+func ExtractAV1(sample []byte) (*sei.HDR10Plus, error) {
+	obus, err := av1.SplitOBUs(sample)
+	if err != nil {
+		return nil, err
+	}
+	return av1.ExtractHDR10Plus(obus)
+}
+
+// InsertAV1 returns an AV1 temporal unit where any HDR10+ metadata OBU is replaced by one
+// carrying md. The new OBU is put right before the first frame header, frame or tile group
+// OBU, i.e. after the sequence header and other metadata OBUs.
+func InsertAV1(sample []byte, md *sei.HDR10Plus) ([]byte, error) {
+	obu, err := av1.CreateHDR10PlusMetadataOBU(md)
+	if err != nil {
+		return nil, err
+	}
+	obus, err := av1.SplitRawOBUs(sample)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sample)+len(obu))
+	inserted := false
+	for _, o := range obus {
+		if isHDR10PlusOBU(o.OBU) {
+			continue
+		}
+		if !inserted {
+			switch o.Header.Type {
+			case av1.OBUFrameHeader, av1.OBUFrame, av1.OBUTileGroup, av1.OBURedundantFrameHeader:
+				out = append(out, obu...)
+				inserted = true
+			}
+		}
+		out = append(out, o.Raw...)
+	}
+	if !inserted {
+		return nil, fmt.Errorf("no frame OBU in temporal unit")
+	}
+	return out, nil
+}
+
+// StripAV1 removes HDR10+ metadata OBUs from an AV1 temporal unit.
+// The other OBUs are kept byte for byte.
+func StripAV1(sample []byte) ([]byte, error) {
+	obus, err := av1.SplitRawOBUs(sample)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sample))
+	for _, o := range obus {
+		if !isHDR10PlusOBU(o.OBU) {
+			out = append(out, o.Raw...)
+		}
+	}
+	return out, nil
+}
+
+// isHDR10PlusOBU tells if o is a metadata OBU carrying HDR10+.
+func isHDR10PlusOBU(o av1.OBU) bool {
+	m, err := av1.ParseMetadataOBUFromOBU(o)
+	if err != nil || m.Type != av1.MetadataTypeITUTT35 {
+		return false
+	}
+	t35, err := av1.ParseITUTT35(m.Payload)
+	if err != nil {
+		return false
+	}
+	data, ok := t35.ITUData()
+	return ok && data.IsHDR10Plus()
+}
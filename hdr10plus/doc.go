@@ -0,0 +1,14 @@
+/*
+Package hdr10plus inserts, extracts and strips HDR10+ (SMPTE ST 2094-40) dynamic metadata in
+HEVC and AV1 samples, and keeps the colour signalling of the sample entry consistent with it.
+
+The metadata itself is parsed and encoded by sei.ParseHDR10Plus and sei.HDR10Plus.Encode.
+In HEVC it is carried in a prefix SEI NAL unit with a user_data_registered_itu_t_t35 message,
+and in AV1 in a metadata OBU of type ITU-T T.35. Both carry the same payload.
+
+HDR10+ is an extension of HDR10, so a track with HDR10+ should signal BT.2020 primaries and
+the PQ transfer function in a colr box, and normally has static mdcv and clli boxes.
+ConfigureSampleEntry writes these boxes, and ContentLightLevel derives the clli values from the
+per-frame metadata. Stripping HDR10+ leaves an HDR10 track, so the sample entry is kept as is.
+*/
+package hdr10plus
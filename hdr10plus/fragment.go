@@ -0,0 +1,52 @@
+package hdr10plus
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+// InsertFragment sets the HDR10+ metadata of all samples of a single-track fragment.
+// mds has one entry per sample; a nil entry leaves the sample without HDR10+.
+// The codec is taken from the sample entry, which should be set up with ConfigureSampleEntry.
+func InsertFragment(frag *mp4.Fragment, trex *mp4.TrexBox, vse *mp4.VisualSampleEntryBox, mds []*sei.HDR10Plus) error {
+	insert, strip, err := sampleFuncs(vse)
+	if err != nil {
+		return err
+	}
+	return frag.ReplaceSampleData(trex, func(nr int, data []byte) ([]byte, error) {
+		if nr >= len(mds) {
+			return nil, fmt.Errorf("no HDR10+ entry for sample %d", nr)
+		}
+		if mds[nr] == nil {
+			return strip(data)
+		}
+		return insert(data, mds[nr])
+	})
+}
+
+// StripFragment removes HDR10+ metadata from all samples of a single-track fragment.
+// The result is an HDR10 track, so the sample entry needs no change.
+func StripFragment(frag *mp4.Fragment, trex *mp4.TrexBox, vse *mp4.VisualSampleEntryBox) error {
+	_, strip, err := sampleFuncs(vse)
+	if err != nil {
+		return err
+	}
+	return frag.ReplaceSampleData(trex, func(_ int, data []byte) ([]byte, error) {
+		return strip(data)
+	})
+}
+
+// sampleFuncs returns the insert and strip functions for the codec of a sample entry.
+func sampleFuncs(vse *mp4.VisualSampleEntryBox) (
+	insert func([]byte, *sei.HDR10Plus) ([]byte, error), strip func([]byte) ([]byte, error), err error) {
+	switch {
+	case vse.HvcC != nil:
+		return InsertHEVC, StripHEVC, nil
+	case vse.Av1C != nil:
+		return InsertAV1, StripAV1, nil
+	default:
+		return nil, nil, fmt.Errorf("no HDR10+ for %s sample entry", vse.Type())
+	}
+}
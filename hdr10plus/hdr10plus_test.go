@@ -0,0 +1,233 @@
+package hdr10plus_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/Eyevinn/mp4ff/av1"
+	"github.com/Eyevinn/mp4ff/hdr10plus"
+	"github.com/Eyevinn/mp4ff/hevc"
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+func testMetadata(maxSCL uint32) *sei.HDR10Plus {
+	return &sei.HDR10Plus{
+		ApplicationVersion:                    1,
+		TargetedSystemDisplayMaximumLuminance: 400,
+		Windows: []sei.HDR10PlusWindow{{
+			MaxSCL:             [3]uint32{maxSCL, maxSCL / 2, maxSCL / 4},
+			AverageMaxRGB:      maxSCL / 10,
+			DistributionMaxRGB: []sei.HDR10PlusPercentile{{Percentage: 50, Percentile: maxSCL / 20}, {Percentage: 99, Percentile: maxSCL / 2}},
+			ToneMapping:        &sei.HDR10PlusToneMapping{KneePointX: 17, KneePointY: 64, BezierCurveAnchors: []uint16{265, 666}},
+		}},
+	}
+}
+
+func lengthPrefixed(nalus ...[]byte) []byte {
+	var out []byte
+	for _, n := range nalus {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(n)))
+		out = append(out, n...)
+	}
+	return out
+}
+
+// hevcSample returns a sample with an SPS, a prefix SEI with CTA-608 captions, and an IDR slice.
+func hevcSample(t *testing.T) []byte {
+	t.Helper()
+	cc, err := hevc.CreateSEINalu([]sei.SEIMessage{sei.CreateCTA608SEIMessage([]byte{0xc1, 0xff, 0xfc, 0x94, 0x2c, 0xff})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sps := []byte{byte(hevc.NALU_SPS) << 1, 0x01, 0xaa}
+	idr := []byte{byte(hevc.NALU_IDR_N_LP) << 1, 0x01, 0x12, 0x34}
+	return lengthPrefixed(sps, cc, idr)
+}
+
+func TestHEVC(t *testing.T) {
+	sample := hevcSample(t)
+	md := testMetadata(20000)
+	withMD, err := hdr10plus.InsertHEVC(sample, md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := hdr10plus.ExtractHEVC(withMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, md); diff != nil {
+		t.Error(diff)
+	}
+	// Inserting again replaces the metadata.
+	md2 := testMetadata(30000)
+	replaced, err := hdr10plus.InsertHEVC(withMD, md2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replaced) != len(withMD) {
+		t.Errorf("replaced sample has size %d, want %d", len(replaced), len(withMD))
+	}
+	if got, _ := hdr10plus.ExtractHEVC(replaced); got == nil || got.Windows[0].MaxSCL[0] != 30000 {
+		t.Errorf("metadata not replaced: %v", got)
+	}
+	stripped, err := hdr10plus.StripHEVC(replaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, sample) {
+		t.Errorf("stripped sample %x, want %x", stripped, sample)
+	}
+	// HDR10+ sharing a NAL unit with another SEI message.
+	both, err := hevc.CreateSEINalu([]sei.SEIMessage{
+		sei.CreateCTA608SEIMessage([]byte{0xc1, 0xff, 0xfc, 0x94, 0x2c, 0xff}),
+		mustHDR10PlusSEI(t, md),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idr := []byte{byte(hevc.NALU_IDR_N_LP) << 1, 0x01, 0x12, 0x34}
+	stripped, err = hdr10plus.StripHEVC(lengthPrefixed(both, idr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := hevcSample(t)[4+3:] // without the SPS
+	if !bytes.Equal(stripped, want) {
+		t.Errorf("stripped sample %x, want %x", stripped, want)
+	}
+}
+
+func mustHDR10PlusSEI(t *testing.T, md *sei.HDR10Plus) sei.SEIMessage {
+	t.Helper()
+	msg, err := sei.CreateHDR10PlusSEIMessage(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestAV1(t *testing.T) {
+	seqHdr := av1.OBU{Header: av1.OBUHeader{Type: av1.OBUSequenceHeader, HasSizeField: true, HeaderSize: 1},
+		Payload: []byte{0x00, 0x00, 0x00}}
+	frame := av1.OBU{Header: av1.OBUHeader{Type: av1.OBUFrame, HasSizeField: true, HeaderSize: 1},
+		Payload: []byte{0x10, 0x20}}
+	sample := append(seqHdr.Encode(), frame.Encode()...)
+	md := testMetadata(20000)
+	withMD, err := hdr10plus.InsertAV1(sample, md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obus, err := av1.SplitOBUs(withMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obus) != 3 || obus[1].Header.Type != av1.OBUMetadata {
+		t.Fatalf("metadata OBU not inserted before the frame: %v", obus)
+	}
+	got, err := hdr10plus.ExtractAV1(withMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, md); diff != nil {
+		t.Error(diff)
+	}
+	stripped, err := hdr10plus.StripAV1(withMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, sample) {
+		t.Errorf("stripped sample %x, want %x", stripped, sample)
+	}
+}
+
+func TestConfigureSampleEntry(t *testing.T) {
+	vse := mp4.CreateVisualSampleEntryBox("hvc1", 1920, 1080, &mp4.HvcCBox{})
+	vse.AddChild(&mp4.ColrBox{ColorType: mp4.ColorTypeOnScreenColors, ColorPrimaries: 1,
+		TransferCharacteristics: 1, MatrixCoefficients: 1, FullRangeFlag: true})
+	if err := hdr10plus.ConfigureSampleEntry(vse, nil, nil); err == nil {
+		t.Error("expected error for missing mdcv")
+	}
+	mdcv := mp4.CreateMdcvBox([3]uint16{8500, 6550, 35400}, [3]uint16{39850, 2300, 14600}, 15635, 16450, 10000000, 50)
+	clli := hdr10plus.ContentLightLevel([]*sei.HDR10Plus{testMetadata(20000), nil, testMetadata(45000)})
+	if clli.MaxContentLightLevel != 4500 || clli.MaxPicAverageLightLevel != 450 {
+		t.Errorf("got clli %d %d", clli.MaxContentLightLevel, clli.MaxPicAverageLightLevel)
+	}
+	if err := hdr10plus.ConfigureSampleEntry(vse, mdcv, clli); err != nil {
+		t.Fatal(err)
+	}
+	if vse.Mdcv != mdcv || vse.Clli != clli {
+		t.Error("mdcv or clli not set")
+	}
+	nrColr := 0
+	for _, c := range vse.Children {
+		if colr, ok := c.(*mp4.ColrBox); ok {
+			nrColr++
+			if colr.ColorPrimaries != 9 || colr.TransferCharacteristics != 16 || colr.MatrixCoefficients != 9 || !colr.FullRangeFlag {
+				t.Errorf("got colr %+v", colr)
+			}
+		}
+	}
+	if nrColr != 1 {
+		t.Errorf("got %d colr boxes, want 1", nrColr)
+	}
+}
+
+func TestFragment(t *testing.T) {
+	frag, err := mp4.CreateFragment(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mds := make([]*sei.HDR10Plus, 3)
+	for i := range mds {
+		data := hevcSample(t)
+		frag.AddFullSample(mp4.FullSample{
+			Sample:     mp4.Sample{Flags: mp4.SyncSampleFlags, Dur: 10, Size: uint32(len(data))},
+			DecodeTime: uint64(10 * i),
+			Data:       data,
+		})
+		if i != 1 {
+			mds[i] = testMetadata(uint32(10000 * (i + 1)))
+		}
+	}
+	vse := mp4.CreateVisualSampleEntryBox("hvc1", 1920, 1080, &mp4.HvcCBox{})
+	if err := hdr10plus.InsertFragment(frag, nil, vse, mds); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := frag.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decFrag := f.Segments[0].Fragments[0]
+	fss, err := decFrag.GetFullSamples(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, fs := range fss {
+		got, err := hdr10plus.ExtractHEVC(fs.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := deep.Equal(got, mds[i]); diff != nil {
+			t.Errorf("sample %d: %v", i, diff)
+		}
+	}
+	if err := hdr10plus.StripFragment(decFrag, nil, vse); err != nil {
+		t.Fatal(err)
+	}
+	fss, err = decFrag.GetFullSamples(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, fs := range fss {
+		if !bytes.Equal(fs.Data, hevcSample(t)) {
+			t.Errorf("sample %d not restored", i)
+		}
+	}
+}
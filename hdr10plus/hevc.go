@@ -0,0 +1,137 @@
+package hdr10plus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/avc"
+	"github.com/Eyevinn/mp4ff/hevc"
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+// ExtractHEVC returns the HDR10+ metadata of an HEVC sample with 4-byte NAL unit lengths,
+// or nil if there is none.
+func ExtractHEVC(sample []byte) (*sei.HDR10Plus, error) {
+	nalus, err := avc.GetNalusFromSample(sample)
+	if err != nil {
+		return nil, err
+	}
+	for _, nalu := range nalus {
+		if len(nalu) == 0 || hevc.GetNaluType(nalu[0]) != hevc.NALU_SEI_PREFIX {
+			continue
+		}
+		seiDatas, err := seiMessages(nalu)
+		if err != nil {
+			return nil, err
+		}
+		for i := range seiDatas {
+			if msg := hdr10PlusSEI(&seiDatas[i]); msg != nil {
+				return msg.Metadata, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// InsertHEVC returns an HEVC sample with 4-byte NAL unit lengths where any HDR10+ metadata
+// is replaced by md. The new prefix SEI NAL unit is put right before the first VCL NAL unit,
+// i.e. after parameter sets and other prefix SEI NAL units.
+func InsertHEVC(sample []byte, md *sei.HDR10Plus) ([]byte, error) {
+	msg, err := sei.CreateHDR10PlusSEIMessage(md)
+	if err != nil {
+		return nil, err
+	}
+	seiNALU, err := hevc.CreateSEINalu([]sei.SEIMessage{msg})
+	if err != nil {
+		return nil, err
+	}
+	stripped, err := StripHEVC(sample)
+	if err != nil {
+		return nil, err
+	}
+	nalus, err := avc.GetNalusFromSample(stripped)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(stripped)+4+len(seiNALU))
+	inserted := false
+	for _, nalu := range nalus {
+		if !inserted && hevc.IsVideoNaluType(hevc.GetNaluType(nalu[0])) {
+			out = appendNALU(out, seiNALU)
+			inserted = true
+		}
+		out = appendNALU(out, nalu)
+	}
+	if !inserted {
+		return nil, fmt.Errorf("no VCL NAL unit in sample")
+	}
+	return out, nil
+}
+
+// StripHEVC removes HDR10+ SEI messages from an HEVC sample with 4-byte NAL unit lengths.
+// Other SEI messages in the same NAL unit are kept, and a NAL unit left empty is dropped.
+func StripHEVC(sample []byte) ([]byte, error) {
+	nalus, err := avc.GetNalusFromSample(sample)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sample))
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+		if hevc.GetNaluType(nalu[0]) != hevc.NALU_SEI_PREFIX {
+			out = appendNALU(out, nalu)
+			continue
+		}
+		seiDatas, err := seiMessages(nalu)
+		if err != nil {
+			return nil, err
+		}
+		var kept []sei.SEIMessage
+		for i := range seiDatas {
+			if hdr10PlusSEI(&seiDatas[i]) == nil {
+				kept = append(kept, &seiDatas[i])
+			}
+		}
+		switch {
+		case len(kept) == len(seiDatas):
+			out = appendNALU(out, nalu)
+		case len(kept) > 0:
+			buf := bytes.NewBuffer(append([]byte(nil), nalu[:2]...))
+			if err := sei.WriteSEIMessages(buf, kept); err != nil {
+				return nil, err
+			}
+			out = appendNALU(out, buf.Bytes())
+		}
+	}
+	return out, nil
+}
+
+// seiMessages returns the SEI messages of an HEVC SEI NAL unit.
+func seiMessages(nalu []byte) ([]sei.SEIData, error) {
+	seiDatas, err := sei.ExtractSEIData(bytes.NewReader(nalu[2:]))
+	if err != nil && err != sei.ErrRbspTrailingBitsMissing {
+		return nil, fmt.Errorf("SEI NAL unit: %w", err)
+	}
+	return seiDatas, nil
+}
+
+// hdr10PlusSEI returns the decoded HDR10+ message, or nil if sd is something else.
+func hdr10PlusSEI(sd *sei.SEIData) *sei.HDR10PlusSEI {
+	if sd.Type() != sei.SEIUserDataRegisteredITUtT35Type {
+		return nil
+	}
+	msg, err := sei.DecodeUserDataRegisteredSEI(sd)
+	if err != nil {
+		return nil
+	}
+	h, _ := msg.(*sei.HDR10PlusSEI)
+	return h
+}
+
+func appendNALU(out, nalu []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(nalu)))
+	return append(out, nalu...)
+}
@@ -0,0 +1,96 @@
+package hdr10plus
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+// Colour code points (ITU-T H.273) that HDR10 and HDR10+ require.
+const (
+	ColorPrimariesBT2020     = 9
+	TransferCharacteristicPQ = 16
+	MatrixCoefficientsBT2020 = 9
+)
+
+// ConfigureSampleEntry makes the colour boxes of an HEVC or AV1 sample entry consistent with
+// HDR10+: any colr box is replaced by an nclx box with BT.2020 primaries, the PQ transfer
+// function and the BT.2020 non-constant luminance matrix (keeping the full range flag), and
+// mdcv and clli replace the existing boxes of these types if they are not nil.
+// An error is returned if the sample entry ends up without an mdcv box, since HDR10+ is
+// defined on top of the static HDR10 metadata.
+func ConfigureSampleEntry(vse *mp4.VisualSampleEntryBox, mdcv *mp4.MdcvBox, clli *mp4.ClliBox) error {
+	if vse.HvcC == nil && vse.Av1C == nil {
+		return fmt.Errorf("no HDR10+ for %s sample entry", vse.Type())
+	}
+	colr := &mp4.ColrBox{
+		ColorType:               mp4.ColorTypeOnScreenColors,
+		ColorPrimaries:          ColorPrimariesBT2020,
+		TransferCharacteristics: TransferCharacteristicPQ,
+		MatrixCoefficients:      MatrixCoefficientsBT2020,
+	}
+	for _, c := range vse.Children {
+		if old, ok := c.(*mp4.ColrBox); ok && old.ColorType == mp4.ColorTypeOnScreenColors {
+			colr.FullRangeFlag = old.FullRangeFlag
+		}
+	}
+	removeChildren(vse, "colr")
+	vse.AddChild(colr)
+	if mdcv != nil {
+		removeChildren(vse, "mdcv")
+		vse.Mdcv = nil
+		vse.AddChild(mdcv)
+	}
+	if clli != nil {
+		removeChildren(vse, "clli")
+		vse.Clli = nil
+		vse.AddChild(clli)
+	}
+	if vse.Mdcv == nil {
+		return fmt.Errorf("%s sample entry has no mdcv box", vse.Type())
+	}
+	return nil
+}
+
+// removeChildren removes all child boxes of type boxType.
+func removeChildren(vse *mp4.VisualSampleEntryBox, boxType string) {
+	kept := vse.Children[:0]
+	for _, c := range vse.Children {
+		if c.Type() != boxType {
+			kept = append(kept, c)
+		}
+	}
+	vse.Children = kept
+}
+
+// ContentLightLevel returns a clli box derived from the per-frame metadata of a whole track:
+// MaxCLL is the largest maxscl component and MaxFALL the largest average maxRGB of the first
+// window, both converted to cd/m2. This approximates CTA-861.3, which is based on
+// the maximum and frame-average of max(R,G,B) over the pictures.
+func ContentLightLevel(mds []*sei.HDR10Plus) *mp4.ClliBox {
+	var maxCLL, maxFALL uint32
+	for _, md := range mds {
+		if md == nil || len(md.Windows) == 0 {
+			continue
+		}
+		w := md.Windows[0]
+		for _, v := range w.MaxSCL {
+			if v > maxCLL {
+				maxCLL = v
+			}
+		}
+		if w.AverageMaxRGB > maxFALL {
+			maxFALL = w.AverageMaxRGB
+		}
+	}
+	return mp4.CreateClliBox(cdPerM2(maxCLL), cdPerM2(maxFALL))
+}
+
+// cdPerM2 converts a linearized value in units of 0.1 cd/m2 to cd/m2.
+func cdPerM2(v uint32) uint16 {
+	if v/10 > 0xffff {
+		return 0xffff
+	}
+	return uint16(v / 10)
+}
@@ -0,0 +1,8 @@
+/*
+Package httprange provides an io.ReaderAt for files served over HTTP with range requests,
+like objects in S3 or other object storage accessed via (presigned) HTTPS URLs.
+
+Combined with mp4.CachedReaderAt and mp4.DecodeFileReaderAt, only box headers, the
+non-mdat boxes, and the sample data asked for are downloaded.
+*/
+package httprange
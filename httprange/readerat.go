@@ -0,0 +1,111 @@
+package httprange
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ReaderAt - io.ReaderAt for a resource that is read with HTTP range requests
+type ReaderAt struct {
+	url    string
+	client *http.Client
+	size   int64
+}
+
+// IsURL - is path an http or https URL
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// NewReaderAt - create a ReaderAt for url. The size is found with a request for the first byte,
+// which fails if the server does not support range requests. A nil client means http.DefaultClient.
+func NewReaderAt(url string, client *http.Client) (*ReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r := &ReaderAt{url: url, client: client}
+	resp, err := r.get(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	size, err := totalSize(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, err
+	}
+	r.size = size
+	return r, nil
+}
+
+// Size - size of the resource in bytes
+func (r *ReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt - read len(p) bytes at offset off with one range request
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := off + int64(len(p))
+	var eofErr error
+	if end > r.size {
+		end = r.size
+		eofErr = io.EOF
+	}
+	resp, err := r.get(off, end-1)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.ReadFull(resp.Body, p[:end-off])
+	if err != nil {
+		return n, fmt.Errorf("read range %d-%d: %w", off, end-1, err)
+	}
+	return n, eofErr
+}
+
+// get requests the byte range first to last, and checks that it is a partial response
+func (r *ReaderAt) get(first, last int64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil, fmt.Errorf("range requests not supported by server for %s", r.url)
+		}
+		return nil, fmt.Errorf("range request for %s: %s", r.url, resp.Status)
+	}
+	return resp, nil
+}
+
+// totalSize returns the complete length from a Content-Range header like "bytes 0-0/1234"
+func totalSize(contentRange string) (int64, error) {
+	idx := strings.LastIndex(contentRange, "/")
+	if !strings.HasPrefix(contentRange, "bytes ") || idx < 0 {
+		return 0, fmt.Errorf("bad Content-Range %q", contentRange)
+	}
+	size, err := strconv.ParseInt(contentRange[idx+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unknown size in Content-Range %q", contentRange)
+	}
+	return size, nil
+}
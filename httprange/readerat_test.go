@@ -0,0 +1,128 @@
+package httprange_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Eyevinn/mp4ff/httprange"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestReaderAt(t *testing.T) {
+	data := make([]byte, 5000)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+	var nrRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&nrRequests, 1)
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	ra, err := httprange.NewReaderAt(srv.URL, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra.Size() != int64(len(data)) {
+		t.Fatalf("got size %d instead of %d", ra.Size(), len(data))
+	}
+	cases := []struct {
+		off, size int
+		wantErr   error
+	}{
+		{off: 0, size: 10},
+		{off: 1000, size: 3000},
+		{off: 4990, size: 20, wantErr: io.EOF},
+		{off: 5000, size: 1, wantErr: io.EOF},
+	}
+	for _, c := range cases {
+		p := make([]byte, c.size)
+		n, err := ra.ReadAt(p, int64(c.off))
+		if err != c.wantErr {
+			t.Errorf("read %d at %d: got error %v instead of %v", c.size, c.off, err, c.wantErr)
+		}
+		end := c.off + c.size
+		if end > len(data) {
+			end = len(data)
+		}
+		if n != end-c.off || !bytes.Equal(p[:n], data[c.off:end]) {
+			t.Errorf("read %d at %d: wrong data", c.size, c.off)
+		}
+	}
+	if n := atomic.LoadInt32(&nrRequests); n != 4 {
+		t.Errorf("got %d requests instead of 4", n)
+	}
+}
+
+func TestReaderAtNoRangeSupport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("no ranges here"))
+	}))
+	defer srv.Close()
+	if _, err := httprange.NewReaderAt(srv.URL, srv.Client()); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestDecodeOverHTTP(t *testing.T) {
+	var nrBytes int64
+	fileServer := http.FileServer(http.Dir("../mp4/testdata"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &countingWriter{ResponseWriter: w, n: &nrBytes}
+		fileServer.ServeHTTP(cw, r)
+	}))
+	defer srv.Close()
+
+	ra, err := httprange.NewReaderAt(srv.URL+"/v300_multiple_segments.mp4", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cra := mp4.NewCachedReaderAt(ra, ra.Size(), 0, 0)
+	f, err := mp4.DecodeFileReaderAt(cra, ra.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Segments) != 4 {
+		t.Fatalf("got %d segments instead of 4", len(f.Segments))
+	}
+	if nrBytes >= ra.Size()/4 {
+		t.Errorf("downloaded %d bytes of %d to decode", nrBytes, ra.Size())
+	}
+	trackID := f.Moov.Trak.Tkhd.TrackID
+	infos, err := f.SampleInfos(trackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := mp4.ReadSampleData(ra, infos[:10], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frag := f.Segments[0].Fragments[0]
+	sr := io.NewSectionReader(ra, 0, ra.Size())
+	for i, info := range infos[:10] {
+		want, err := frag.Mdat.ReadData(int64(info.Offset), int64(info.Size), sr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(samples[i], want) {
+			t.Fatalf("sample %d: data differs", i+1)
+		}
+	}
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
@@ -0,0 +1,14 @@
+/*
+Package id3 parses and writes ID3v2 tags and creates ID3 timed metadata tracks.
+
+Parse and Tag.Encode handle ID3v2.3 and ID3v2.4 tags. TXXX (user-defined text), PRIV
+(private data), GEOB (general encapsulated object) and the other text information frames
+are decoded, and remaining frames are kept as raw bytes.
+
+In CMAF and HLS fragmented mp4, ID3 tags are carried as samples of a timed metadata track
+with an id3 sample entry, as specified by AOM "Carriage of ID3 Timed Metadata in the Common
+Media Application Format". AddTrack creates such a track, and CreateFragment and
+CreateAlignedFragments write the tags into fragments that cover the same time ranges as the
+fragments of a video track.
+*/
+package id3
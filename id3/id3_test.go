@@ -0,0 +1,152 @@
+package id3_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/id3"
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/go-test/deep"
+)
+
+func TestTagRoundTrip(t *testing.T) {
+	for _, version := range []byte{3, 4} {
+		tag := &id3.Tag{
+			Version: version,
+			Frames: []id3.Frame{
+				&id3.TXXXFrame{Encoding: id3.EncodingISO88591, Description: "ad", Value: "break"},
+				&id3.TXXXFrame{Encoding: id3.EncodingUTF16, Description: "titel", Value: "Grüße ♪"},
+				&id3.PRIVFrame{Owner: "com.apple.streaming.transportStreamTimestamp",
+					Data: []byte{0, 0, 0, 0, 0, 0, 0x1b, 0x58}},
+				&id3.GEOBFrame{Encoding: id3.EncodingISO88591, MIMEType: "application/json",
+					Filename: "a.json", Description: "desc", Object: []byte(`{"a":1}`)},
+				&id3.TextFrame{FrameID: "TIT2", Encoding: id3.EncodingISO88591, Text: "Title"},
+				&id3.RawFrame{FrameID: "WXXX", Data: []byte{0, 0, 'u'}},
+			},
+		}
+		data, err := tag.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := id3.Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := deep.Equal(got, tag); diff != nil {
+			t.Errorf("v2.%d: %v", version, diff)
+		}
+		if v, ok := got.TXXX("titel"); !ok || v != "Grüße ♪" {
+			t.Errorf("TXXX got %q", v)
+		}
+		if p := got.PRIV("com.apple.streaming.transportStreamTimestamp"); len(p) != 8 {
+			t.Errorf("PRIV got %v", p)
+		}
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	// ID3v2.4 tag with PRIV frame from HLS, followed by padding
+	data := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 0x3f,
+		'P', 'R', 'I', 'V', 0, 0, 0, 0x35, 0, 0}
+	data = append(data, []byte("com.apple.streaming.transportStreamTimestamp\x00")...)
+	data = append(data, 0, 0, 0, 0, 0, 0x01, 0x5f, 0x90)
+	data = append(data, 0, 0)
+	tag, err := id3.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tag.Frames) != 1 {
+		t.Fatalf("got %d frames", len(tag.Frames))
+	}
+	if p := tag.PRIV("com.apple.streaming.transportStreamTimestamp"); !bytes.Equal(p, []byte{0, 0, 0, 0, 0, 0x01, 0x5f, 0x90}) {
+		t.Errorf("got PRIV data %v", p)
+	}
+
+	// ID3v2.3 with unsynchronisation of 0xff 0x00
+	unsync := []byte{'I', 'D', '3', 3, 0, 0x80, 0, 0, 0, 14,
+		'P', 'R', 'I', 'V', 0, 0, 0, 3, 0, 0, 'o', 0, 0xff, 0}
+	tag, err = id3.Parse(unsync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := tag.PRIV("o"); !bytes.Equal(p, []byte{0xff}) {
+		t.Errorf("got unsync PRIV data %v", p)
+	}
+
+	for _, bad := range [][]byte{
+		[]byte("ID3"),
+		{'I', 'D', '3', 2, 0, 0, 0, 0, 0, 0},
+		{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20},
+	} {
+		if _, err := id3.Parse(bad); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestAlignedFragments(t *testing.T) {
+	init := mp4.CreateEmptyInit()
+	init.AddEmptyTrack(90000, "video", "und")
+	trak, err := id3.AddTrack(init, 1000, "und")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trak.Mdia.Minf.Stbl.Stsd.ID3 == nil {
+		t.Fatal("no id3 sample entry")
+	}
+	videoTrex := init.Moov.Mvex.Trexs[0]
+	var videoFrags []*mp4.Fragment
+	for i := 0; i < 2; i++ {
+		vf, err := mp4.CreateFragment(uint32(i+1), videoTrex.TrackID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 2; j++ {
+			vf.AddFullSample(mp4.FullSample{
+				Sample:     mp4.NewSample(mp4.SyncSampleFlags, 90000, 1, 0),
+				DecodeTime: uint64(2*i+j) * 90000,
+				Data:       []byte{0},
+			})
+		}
+		videoFrags = append(videoFrags, vf)
+	}
+	tag1, err := id3.NewTimedTag(500, &id3.Tag{Frames: []id3.Frame{&id3.TXXXFrame{Description: "a", Value: "1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag2 := id3.TimedTag{PresentationTime: 2000, Data: tag1.Data}
+	tagOut := id3.TimedTag{PresentationTime: 5000, Data: tag1.Data}
+	frags, err := id3.CreateAlignedFragments([]id3.TimedTag{tag2, tag1, tagOut}, trak.Tkhd.TrackID, 1000,
+		videoFrags, videoTrex, 90000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) != 2 {
+		t.Fatalf("got %d fragments", len(frags))
+	}
+	wantDurs := [][]uint32{{500, 1500}, {2000}}
+	wantSizes := [][]uint32{{0, uint32(len(tag1.Data))}, {uint32(len(tag1.Data))}}
+	for i, f := range frags {
+		if f.Moof.Mfhd.SequenceNumber != uint32(i+1) {
+			t.Errorf("fragment %d: sequence number %d", i, f.Moof.Mfhd.SequenceNumber)
+		}
+		samples, err := f.GetFullSamples(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if samples[0].DecodeTime != uint64(2000*i) {
+			t.Errorf("fragment %d: start %d", i, samples[0].DecodeTime)
+		}
+		var durs, sizes []uint32
+		for _, s := range samples {
+			durs = append(durs, s.Dur)
+			sizes = append(sizes, s.Size)
+		}
+		if diff := deep.Equal(durs, wantDurs[i]); diff != nil {
+			t.Errorf("fragment %d durations: %v", i, diff)
+		}
+		if diff := deep.Equal(sizes, wantSizes[i]); diff != nil {
+			t.Errorf("fragment %d sizes: %v", i, diff)
+		}
+	}
+}
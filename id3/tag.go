@@ -0,0 +1,461 @@
+package id3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Text encodings of ID3v2 frames.
+const (
+	EncodingISO88591 = 0
+	EncodingUTF16    = 1 // UTF-16 with byte order mark
+	EncodingUTF16BE  = 2 // ID3v2.4 only
+	EncodingUTF8     = 3 // ID3v2.4 only
+)
+
+const headerSize = 10
+
+// Frame is an ID3v2 frame.
+type Frame interface {
+	// ID returns the four-character frame ID.
+	ID() string
+	body() ([]byte, error)
+}
+
+// TXXXFrame is a user-defined text information frame.
+type TXXXFrame struct {
+	Encoding    byte
+	Description string
+	Value       string
+}
+
+// ID returns "TXXX".
+func (f *TXXXFrame) ID() string { return "TXXX" }
+
+func (f *TXXXFrame) body() ([]byte, error) {
+	desc, err := encodeText(f.Encoding, f.Description, true)
+	if err != nil {
+		return nil, err
+	}
+	value, err := encodeText(f.Encoding, f.Value, false)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{f.Encoding}, desc...), value...), nil
+}
+
+// PRIVFrame is a private frame, identified by an owner, often a URL or reverse domain name.
+type PRIVFrame struct {
+	Owner string
+	Data  []byte
+}
+
+// ID returns "PRIV".
+func (f *PRIVFrame) ID() string { return "PRIV" }
+
+func (f *PRIVFrame) body() ([]byte, error) {
+	owner, err := encodeText(EncodingISO88591, f.Owner, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(owner, f.Data...), nil
+}
+
+// GEOBFrame is a general encapsulated object frame.
+type GEOBFrame struct {
+	Encoding    byte
+	MIMEType    string
+	Filename    string
+	Description string
+	Object      []byte
+}
+
+// ID returns "GEOB".
+func (f *GEOBFrame) ID() string { return "GEOB" }
+
+func (f *GEOBFrame) body() ([]byte, error) {
+	mime, err := encodeText(EncodingISO88591, f.MIMEType, true)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte{f.Encoding}, mime...)
+	for _, s := range []string{f.Filename, f.Description} {
+		b, err := encodeText(f.Encoding, s, true)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return append(out, f.Object...), nil
+}
+
+// TextFrame is a text information frame, with an ID starting with T, such as TIT2 (title).
+// Multiple ID3v2.4 values are separated by zero characters in Text.
+type TextFrame struct {
+	FrameID  string
+	Encoding byte
+	Text     string
+}
+
+// ID returns the frame ID.
+func (f *TextFrame) ID() string { return f.FrameID }
+
+func (f *TextFrame) body() ([]byte, error) {
+	text, err := encodeText(f.Encoding, f.Text, false)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{f.Encoding}, text...), nil
+}
+
+// RawFrame is a frame that is not decoded. Compressed and encrypted frames are always raw,
+// and Flags are the frame format flags of the tag version.
+type RawFrame struct {
+	FrameID string
+	Flags   uint16
+	Data    []byte
+}
+
+// ID returns the frame ID.
+func (f *RawFrame) ID() string { return f.FrameID }
+
+func (f *RawFrame) body() ([]byte, error) { return f.Data, nil }
+
+// Tag is an ID3v2 tag.
+type Tag struct {
+	// Version is the major version, 3 or 4. 0 is written as 4.
+	Version byte
+	Frames  []Frame
+}
+
+// Frame returns the first frame with the given ID, or nil.
+func (t *Tag) Frame(id string) Frame {
+	for _, f := range t.Frames {
+		if f.ID() == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// PRIV returns the data of the first PRIV frame with the given owner, or nil.
+func (t *Tag) PRIV(owner string) []byte {
+	for _, f := range t.Frames {
+		if p, ok := f.(*PRIVFrame); ok && p.Owner == owner {
+			return p.Data
+		}
+	}
+	return nil
+}
+
+// TXXX returns the value of the first TXXX frame with the given description.
+func (t *Tag) TXXX(description string) (string, bool) {
+	for _, f := range t.Frames {
+		if x, ok := f.(*TXXXFrame); ok && x.Description == description {
+			return x.Value, true
+		}
+	}
+	return "", false
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func appendSyncsafe(out []byte, n int) []byte {
+	return append(out, byte(n>>21&0x7f), byte(n>>14&0x7f), byte(n>>7&0x7f), byte(n&0x7f))
+}
+
+// removeUnsync undoes the unsynchronisation scheme, which inserts a zero byte after 0xff.
+func removeUnsync(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// Parse decodes an ID3v2.3 or ID3v2.4 tag. Padding and any data after the tag are ignored.
+func Parse(data []byte) (*Tag, error) {
+	if len(data) < headerSize || !bytes.Equal(data[:3], []byte("ID3")) {
+		return nil, fmt.Errorf("no ID3v2 tag header")
+	}
+	t := &Tag{Version: data[3]}
+	if t.Version != 3 && t.Version != 4 {
+		return nil, fmt.Errorf("ID3v2.%d not supported", t.Version)
+	}
+	flags := data[5]
+	size := syncsafe(data[6:10])
+	if size > len(data)-headerSize {
+		return nil, fmt.Errorf("tag size %d exceeds %d bytes", size, len(data)-headerSize)
+	}
+	body := data[headerSize : headerSize+size]
+	tagUnsync := flags&0x80 != 0
+	if tagUnsync && t.Version == 3 {
+		body = removeUnsync(body)
+	}
+	if flags&0x40 != 0 { // extended header
+		if len(body) < 4 {
+			return nil, fmt.Errorf("truncated extended header")
+		}
+		extSize := int(binary.BigEndian.Uint32(body)) + 4
+		if t.Version == 4 {
+			extSize = syncsafe(body)
+		}
+		if extSize > len(body) {
+			return nil, fmt.Errorf("extended header size %d exceeds tag", extSize)
+		}
+		body = body[extSize:]
+	}
+	for len(body) >= headerSize && body[0] != 0 {
+		id := string(body[:4])
+		frameSize := int(binary.BigEndian.Uint32(body[4:]))
+		if t.Version == 4 {
+			frameSize = syncsafe(body[4:8])
+		}
+		frameFlags := binary.BigEndian.Uint16(body[8:])
+		if frameSize > len(body)-headerSize {
+			return nil, fmt.Errorf("frame %s size %d exceeds tag", id, frameSize)
+		}
+		frameData := body[headerSize : headerSize+frameSize]
+		body = body[headerSize+frameSize:]
+		f, err := parseFrame(t.Version, id, frameFlags, frameData, tagUnsync)
+		if err != nil {
+			return nil, fmt.Errorf("frame %s: %w", id, err)
+		}
+		t.Frames = append(t.Frames, f)
+	}
+	return t, nil
+}
+
+func parseFrame(version byte, id string, flags uint16, data []byte, tagUnsync bool) (Frame, error) {
+	raw := &RawFrame{FrameID: id, Flags: flags, Data: data}
+	if version == 3 {
+		if flags&0x00c0 != 0 { // compression or encryption
+			return raw, nil
+		}
+		if flags&0x0020 != 0 { // grouping identity
+			if len(data) < 1 {
+				return nil, fmt.Errorf("missing group identifier")
+			}
+			data = data[1:]
+		}
+	} else {
+		if flags&0x000c != 0 { // compression or encryption
+			return raw, nil
+		}
+		if flags&0x0040 != 0 { // grouping identity
+			if len(data) < 1 {
+				return nil, fmt.Errorf("missing group identifier")
+			}
+			data = data[1:]
+		}
+		if flags&0x0001 != 0 { // data length indicator
+			if len(data) < 4 {
+				return nil, fmt.Errorf("missing data length indicator")
+			}
+			data = data[4:]
+		}
+		if flags&0x0002 != 0 || tagUnsync {
+			data = removeUnsync(data)
+		}
+	}
+	switch {
+	case id == "TXXX":
+		if len(data) < 1 {
+			return nil, fmt.Errorf("empty frame")
+		}
+		desc, rest, err := readText(data[0], data[1:])
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeText(data[0], trimTerminator(data[0], rest))
+		if err != nil {
+			return nil, err
+		}
+		return &TXXXFrame{Encoding: data[0], Description: desc, Value: value}, nil
+	case id == "PRIV":
+		owner, rest, err := readText(EncodingISO88591, data)
+		if err != nil {
+			return nil, err
+		}
+		return &PRIVFrame{Owner: owner, Data: rest}, nil
+	case id == "GEOB":
+		if len(data) < 1 {
+			return nil, fmt.Errorf("empty frame")
+		}
+		f := &GEOBFrame{Encoding: data[0]}
+		var err error
+		rest := data[1:]
+		if f.MIMEType, rest, err = readText(EncodingISO88591, rest); err != nil {
+			return nil, err
+		}
+		if f.Filename, rest, err = readText(f.Encoding, rest); err != nil {
+			return nil, err
+		}
+		if f.Description, rest, err = readText(f.Encoding, rest); err != nil {
+			return nil, err
+		}
+		f.Object = rest
+		return f, nil
+	case id[0] == 'T':
+		if len(data) < 1 {
+			return nil, fmt.Errorf("empty frame")
+		}
+		text, err := decodeText(data[0], trimTerminator(data[0], data[1:]))
+		if err != nil {
+			return nil, err
+		}
+		return &TextFrame{FrameID: id, Encoding: data[0], Text: text}, nil
+	}
+	return &RawFrame{FrameID: id, Data: data}, nil
+}
+
+// Encode returns the tag without padding. Frames are written without flags, except for the
+// flags of raw frames.
+func (t *Tag) Encode() ([]byte, error) {
+	version := t.Version
+	if version == 0 {
+		version = 4
+	}
+	if version != 3 && version != 4 {
+		return nil, fmt.Errorf("ID3v2.%d not supported", version)
+	}
+	var frames []byte
+	for _, f := range t.Frames {
+		id := f.ID()
+		if len(id) != 4 {
+			return nil, fmt.Errorf("bad frame ID %q", id)
+		}
+		body, err := f.body()
+		if err != nil {
+			return nil, fmt.Errorf("frame %s: %w", id, err)
+		}
+		frames = append(frames, id...)
+		if version == 4 {
+			if len(body) >= 1<<28 {
+				return nil, fmt.Errorf("frame %s too large", id)
+			}
+			frames = appendSyncsafe(frames, len(body))
+		} else {
+			frames = binary.BigEndian.AppendUint32(frames, uint32(len(body)))
+		}
+		var flags uint16
+		if raw, ok := f.(*RawFrame); ok {
+			flags = raw.Flags
+		}
+		frames = binary.BigEndian.AppendUint16(frames, flags)
+		frames = append(frames, body...)
+	}
+	if len(frames) >= 1<<28 {
+		return nil, fmt.Errorf("tag too large")
+	}
+	out := make([]byte, 0, headerSize+len(frames))
+	out = append(out, 'I', 'D', '3', version, 0, 0)
+	out = appendSyncsafe(out, len(frames))
+	return append(out, frames...), nil
+}
+
+// terminatorSize returns the size of the string terminator for an encoding.
+func terminatorSize(enc byte) int {
+	if enc == EncodingUTF16 || enc == EncodingUTF16BE {
+		return 2
+	}
+	return 1
+}
+
+// trimTerminator removes one trailing string terminator, if present.
+func trimTerminator(enc byte, data []byte) []byte {
+	n := terminatorSize(enc)
+	if len(data) >= n && len(data)%n == 0 && bytes.Equal(data[len(data)-n:], make([]byte, n)) {
+		return data[:len(data)-n]
+	}
+	return data
+}
+
+// readText reads a terminated string and returns it with the data after the terminator.
+func readText(enc byte, data []byte) (string, []byte, error) {
+	n := terminatorSize(enc)
+	end := -1
+	for i := 0; i+n <= len(data); i += n {
+		if data[i] == 0 && (n == 1 || data[i+1] == 0) {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return "", nil, fmt.Errorf("unterminated string")
+	}
+	s, err := decodeText(enc, data[:end])
+	return s, data[end+n:], err
+}
+
+func decodeText(enc byte, data []byte) (string, error) {
+	switch enc {
+	case EncodingISO88591:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	case EncodingUTF8:
+		return string(data), nil
+	case EncodingUTF16, EncodingUTF16BE:
+		if len(data)%2 != 0 {
+			return "", fmt.Errorf("odd UTF-16 length %d", len(data))
+		}
+		bigEndian := true
+		if enc == EncodingUTF16 && len(data) >= 2 {
+			switch {
+			case data[0] == 0xff && data[1] == 0xfe:
+				bigEndian = false
+				data = data[2:]
+			case data[0] == 0xfe && data[1] == 0xff:
+				data = data[2:]
+			}
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if bigEndian {
+				units[i] = binary.BigEndian.Uint16(data[2*i:])
+			} else {
+				units[i] = binary.LittleEndian.Uint16(data[2*i:])
+			}
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	return "", fmt.Errorf("unknown text encoding %d", enc)
+}
+
+func encodeText(enc byte, s string, terminated bool) ([]byte, error) {
+	var out []byte
+	switch enc {
+	case EncodingISO88591:
+		for _, r := range s {
+			if r > 0xff {
+				return nil, fmt.Errorf("%q not representable in ISO-8859-1", r)
+			}
+			out = append(out, byte(r))
+		}
+	case EncodingUTF8:
+		out = []byte(s)
+	case EncodingUTF16, EncodingUTF16BE:
+		if enc == EncodingUTF16 {
+			out = append(out, 0xfe, 0xff)
+		}
+		for _, u := range utf16.Encode([]rune(s)) {
+			out = binary.BigEndian.AppendUint16(out, u)
+		}
+	default:
+		return nil, fmt.Errorf("unknown text encoding %d", enc)
+	}
+	if terminated {
+		out = append(out, make([]byte, terminatorSize(enc))...)
+	}
+	return out, nil
+}
@@ -0,0 +1,126 @@
+package id3
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// TimedTag is an encoded ID3 tag with a presentation time in the timescale of the metadata track.
+type TimedTag struct {
+	PresentationTime uint64
+	Data             []byte
+}
+
+// NewTimedTag encodes tag and returns it as a TimedTag.
+func NewTimedTag(presentationTime uint64, tag *Tag) (TimedTag, error) {
+	data, err := tag.Encode()
+	if err != nil {
+		return TimedTag{}, err
+	}
+	return TimedTag{PresentationTime: presentationTime, Data: data}, nil
+}
+
+// AddTrack adds an ID3 timed metadata track with an id3 sample entry to init.
+func AddTrack(init *mp4.InitSegment, timescale uint32, language string) (*mp4.TrakBox, error) {
+	trak := init.AddEmptyTrack(timescale, "meta", language)
+	if err := trak.SetID3Descriptor(); err != nil {
+		return nil, err
+	}
+	return trak, nil
+}
+
+// CreateSamples returns samples covering [start, end) for the tags with presentation times in that range.
+// Each tag sample lasts until the next tag or end. If the first tag is later than start,
+// the range starts with an empty sample, so that the samples have no gaps.
+func CreateSamples(tags []TimedTag, start, end uint64) ([]mp4.FullSample, error) {
+	if end <= start {
+		return nil, fmt.Errorf("empty time range [%d, %d)", start, end)
+	}
+	var inRange []TimedTag
+	for _, t := range tags {
+		if t.PresentationTime >= start && t.PresentationTime < end {
+			inRange = append(inRange, t)
+		}
+	}
+	sort.SliceStable(inRange, func(i, j int) bool {
+		return inRange[i].PresentationTime < inRange[j].PresentationTime
+	})
+	samples := make([]mp4.FullSample, 0, len(inRange)+1)
+	addSample := func(sStart, sEnd uint64, data []byte) error {
+		if sEnd-sStart > 0xffffffff {
+			return fmt.Errorf("sample duration %d too large", sEnd-sStart)
+		}
+		samples = append(samples, mp4.FullSample{
+			Sample:     mp4.NewSample(mp4.SyncSampleFlags, uint32(sEnd-sStart), uint32(len(data)), 0),
+			DecodeTime: sStart,
+			Data:       data,
+		})
+		return nil
+	}
+	if len(inRange) == 0 || inRange[0].PresentationTime > start {
+		sEnd := end
+		if len(inRange) > 0 {
+			sEnd = inRange[0].PresentationTime
+		}
+		if err := addSample(start, sEnd, nil); err != nil {
+			return nil, err
+		}
+	}
+	for i, t := range inRange {
+		sEnd := end
+		if i+1 < len(inRange) {
+			sEnd = inRange[i+1].PresentationTime
+		}
+		if err := addSample(t.PresentationTime, sEnd, t.Data); err != nil {
+			return nil, err
+		}
+	}
+	return samples, nil
+}
+
+// CreateFragment returns a fragment of an ID3 track covering [start, end).
+func CreateFragment(seqNr, trackID uint32, tags []TimedTag, start, end uint64) (*mp4.Fragment, error) {
+	samples, err := CreateSamples(tags, start, end)
+	if err != nil {
+		return nil, err
+	}
+	frag, err := mp4.CreateFragment(seqNr, trackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range samples {
+		frag.AddFullSample(s)
+	}
+	return frag, nil
+}
+
+// CreateAlignedFragments returns one ID3 track fragment per video fragment, covering the same
+// time range and using the same sequence number. The video track is identified by videoTrex.
+// Tag times are in the ID3 track timescale, and tags outside all video fragments are dropped.
+func CreateAlignedFragments(tags []TimedTag, trackID, timescale uint32,
+	videoFrags []*mp4.Fragment, videoTrex *mp4.TrexBox, videoTimescale uint32) ([]*mp4.Fragment, error) {
+	if videoTimescale == 0 || timescale == 0 {
+		return nil, fmt.Errorf("zero timescale")
+	}
+	frags := make([]*mp4.Fragment, 0, len(videoFrags))
+	for i, vf := range videoFrags {
+		samples, err := vf.GetFullSamples(videoTrex)
+		if err != nil {
+			return nil, fmt.Errorf("video fragment %d: %w", i, err)
+		}
+		if len(samples) == 0 {
+			return nil, fmt.Errorf("video fragment %d has no samples for track %d", i, videoTrex.TrackID)
+		}
+		last := samples[len(samples)-1]
+		start := mp4.RescaleTime(samples[0].DecodeTime, videoTimescale, timescale)
+		end := mp4.RescaleTime(last.DecodeTime+uint64(last.Dur), videoTimescale, timescale)
+		frag, err := CreateFragment(vf.Moof.Mfhd.SequenceNumber, trackID, tags, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("video fragment %d: %w", i, err)
+		}
+		frags = append(frags, frag)
+	}
+	return frags, nil
+}
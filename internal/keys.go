@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// StringSliceFlag - flag.Value that collects the values of a repeated command line option
+type StringSliceFlag []string
+
+func (s *StringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *StringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// ParseKeys - parse decryption keys given as one legacy key or as kid:key pairs.
+// Keys and KIDs are 32 hex or 24 base64 chars, or uuids. With kid:key pairs, keysByKID is
+// indexed by hex KID and strictKIDMode is true. No keys gives no key and no error.
+func ParseKeys(keyStrs []string) (key []byte, keysByKID map[string][]byte, strictKIDMode bool, err error) {
+	if len(keyStrs) == 0 {
+		return nil, nil, false, nil
+	}
+
+	hasKIDPair := false
+	hasLegacyKey := false
+	for _, keyStr := range keyStrs {
+		if strings.Contains(keyStr, ":") {
+			hasKIDPair = true
+		} else {
+			hasLegacyKey = true
+		}
+	}
+
+	if hasKIDPair && hasLegacyKey {
+		return nil, nil, false, fmt.Errorf("cannot mix legacy key and kid:key key format")
+	}
+
+	if !hasKIDPair {
+		if len(keyStrs) != 1 {
+			return nil, nil, false, fmt.Errorf("multiple legacy keys are not supported")
+		}
+		key, err = mp4.UnpackKey(keyStrs[0])
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("unpacking key: %w", err)
+		}
+		return key, nil, false, nil
+	}
+
+	keysByKID = make(map[string][]byte, len(keyStrs))
+	for _, keyStr := range keyStrs {
+		parts := strings.SplitN(keyStr, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, nil, false, fmt.Errorf("bad kid:key format %q", keyStr)
+		}
+		kid, err := mp4.UnpackKey(parts[0])
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("unpacking kid: %w", err)
+		}
+		kidHex := hex.EncodeToString(kid)
+		if _, exists := keysByKID[kidHex]; exists {
+			return nil, nil, false, fmt.Errorf("duplicate kid %s", kidHex)
+		}
+		k, err := mp4.UnpackKey(parts[1])
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("unpacking key for kid %s: %w", kidHex, err)
+		}
+		keysByKID[kidHex] = k
+	}
+
+	return nil, keysByKID, true, nil
+}
@@ -93,6 +93,7 @@ func init() {
 		"lhvC":    DecodeLhvC,
 		"iacb":    DecodeIacb,
 		"iamf":    DecodeAudioSampleEntry,
+		"id3 ":    DecodeID3SampleEntry,
 		"iden":    DecodeIden,
 		"ID32":    DecodeID32,
 		"ilst":    DecodeIlst,
@@ -111,6 +112,8 @@ func init() {
 		"mdhd":    DecodeMdhd,
 		"mdia":    DecodeMdia,
 		"meta":    DecodeMeta,
+		"mett":    DecodeMett,
+		"metx":    DecodeMetx,
 		"mfhd":    DecodeMfhd,
 		"mfra":    DecodeMfra,
 		"mfro":    DecodeMfro,
@@ -183,8 +186,12 @@ func init() {
 		"trgr":    DecodeTrgr,
 		"trun":    DecodeTrun,
 		"twos":    DecodeQuickTimeAudioSampleEntry,
+		"txtC":    DecodeTxtC,
 		"udta":    DecodeUdta,
 		"url ":    DecodeURLBox,
+		"uri ":    DecodeURI,
+		"uriI":    DecodeURIInit,
+		"urim":    DecodeUrim,
 		"uuid":    DecodeUUIDBox,
 		"vdep":    DecodeTrefType,
 		"vexu":    DecodeVexu,
@@ -244,6 +244,33 @@ func (bsr *BoxSeekReader) Seek(offset int64, whence int) (int64, error) {
 		newPos, bsr.currentPos)
 }
 
+// SkipTo moves forward to the absolute position pos and clears the buffer.
+// The underlying reader is seeked if it is an io.Seeker, and otherwise read and discarded up to pos.
+// pos must not be before the current position, unless the underlying reader is an io.Seeker.
+func (bsr *BoxSeekReader) SkipTo(pos uint64) error {
+	if !bsr.mdatActive && pos == bsr.bufferPos {
+		// Keep a peeked box header
+		bsr.currentPos = pos
+		return nil
+	}
+	readerPos := bsr.bufferPos + uint64(len(bsr.buffer))
+	if seeker, ok := bsr.reader.(io.Seeker); ok {
+		if _, err := seeker.Seek(int64(pos), io.SeekStart); err != nil {
+			return err
+		}
+	} else {
+		if pos < readerPos {
+			return fmt.Errorf("cannot skip back to %d from %d in stream", pos, readerPos)
+		}
+		if _, err := io.CopyN(io.Discard, bsr.reader, int64(pos-readerPos)); err != nil {
+			return fmt.Errorf("skip to %d: %w", pos, err)
+		}
+	}
+	bsr.currentPos = pos
+	bsr.ResetBuffer()
+	return nil
+}
+
 // GetBufferInfo returns current buffer state for debugging.
 func (bsr *BoxSeekReader) GetBufferInfo() (bufferStart uint64, bufferLen int, currentPos uint64) {
 	return bsr.bufferPos, len(bsr.buffer), bsr.currentPos
@@ -84,6 +84,7 @@ func init() {
 		"lhvC":    DecodeLhvCSR,
 		"iacb":    DecodeIacbSR,
 		"iamf":    DecodeAudioSampleEntrySR,
+		"id3 ":    DecodeID3SampleEntrySR,
 		"iden":    DecodeIdenSR,
 		"ID32":    DecodeID32SR,
 		"ilst":    DecodeIlstSR,
@@ -102,6 +103,8 @@ func init() {
 		"mdhd":    DecodeMdhdSR,
 		"mdia":    DecodeMdiaSR,
 		"meta":    DecodeMetaSR,
+		"mett":    DecodeMettSR,
+		"metx":    DecodeMetxSR,
 		"mfhd":    DecodeMfhdSR,
 		"mfra":    DecodeMfraSR,
 		"mfro":    DecodeMfroSR,
@@ -174,8 +177,12 @@ func init() {
 		"trgr":    DecodeTrgrSR,
 		"trun":    DecodeTrunSR,
 		"twos":    DecodeQuickTimeAudioSampleEntrySR,
+		"txtC":    DecodeTxtCSR,
 		"udta":    DecodeUdtaSR,
 		"url ":    DecodeURLBoxSR,
+		"uri ":    DecodeURISR,
+		"uriI":    DecodeURIInitSR,
+		"urim":    DecodeUrimSR,
 		"uuid":    DecodeUUIDBoxSR,
 		"vdep":    DecodeTrefTypeSR,
 		"vexu":    DecodeVexuSR,
@@ -0,0 +1,600 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DumpFormat - output format of Dump methods
+type DumpFormat string
+
+const (
+	// DumpText - indented human-readable text, same as Info with no specific levels
+	DumpText DumpFormat = "text"
+	// DumpJSON - JSON array of BoxNode
+	DumpJSON DumpFormat = "json"
+	// DumpYAML - YAML sequence of BoxNode
+	DumpYAML DumpFormat = "yaml"
+	// DumpXML - XML boxes element with one box element per BoxNode.
+	// Scalar fields are attributes and other fields are field elements with JSON values
+	DumpXML DumpFormat = "xml"
+)
+
+// BoxNode - structured representation of a decoded box that can be serialized with json.Marshal.
+//
+// Fields contains the exported fields of the box struct, with Version and Flags lifted to the node,
+// and without child boxes, pointers to child boxes, and decode positions. Byte slices are hex strings,
+// nested structs are maps with their exported fields, and numbers are int64, uint64 or float64.
+// Sample data in mdat is not included.
+//
+// Type has each byte of the box type as a Latin-1 character, so \xa9too is written as ©too.
+// Payload is the hex-encoded box body. It is only set for boxes without children that cannot be
+// rebuilt from the fields alone, like unknown boxes, codec configuration boxes, and unparsed senc boxes.
+// NewBoxFromNode is the inverse, and rebuilds a box from a BoxNode.
+type BoxNode struct {
+	Type     string                 `json:"type"`
+	Offset   uint64                 `json:"offset"`
+	Size     uint64                 `json:"size"`
+	Version  *byte                  `json:"version,omitempty"`
+	Flags    *uint32                `json:"flags,omitempty"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Payload  string                 `json:"payload,omitempty"`
+	Children []*BoxNode             `json:"children,omitempty"`
+}
+
+// maxTreeFieldDepth - maximum nesting of field values, as protection against cyclic structures
+const maxTreeFieldDepth = 10
+
+var (
+	boxInterfaceType = reflect.TypeOf((*Box)(nil)).Elem()
+	byteType         = reflect.TypeOf(byte(0))
+)
+
+// NewBoxNode - structured representation of box b starting at offset.
+// Child box offsets are derived from the box size, since children follow the box-specific fields.
+func NewBoxNode(b Box, offset uint64) *BoxNode {
+	n := &BoxNode{Type: boxTypeText(b.Type()), Offset: offset, Size: b.Size()}
+	v := reflect.ValueOf(b)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return n
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return n
+	}
+	var children []Box
+	var nrTrailingBytes uint64
+	incomplete := false // fields do not fully describe the box
+	hasChildrenField, hasBoxRefs := false, false
+	fields := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf, fv := t.Field(i), v.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		switch sf.Name {
+		case "Children":
+			if cs, ok := fv.Interface().([]Box); ok {
+				children = cs
+				hasChildrenField = true
+				continue
+			}
+		case "Version":
+			if fv.Kind() == reflect.Uint8 {
+				version := byte(fv.Uint())
+				n.Version = &version
+				continue
+			}
+		case "Flags":
+			if fv.Kind() == reflect.Uint32 {
+				flags := uint32(fv.Uint())
+				n.Flags = &flags
+				continue
+			}
+		case "StartPos":
+			continue
+		case "TrailingBytes":
+			nrTrailingBytes = uint64(fv.Len())
+		}
+		if (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface) && !fv.IsNil() &&
+			fv.Type().Implements(boxInterfaceType) {
+			hasBoxRefs = true
+			continue
+		}
+		val, ok := treeFieldValue(fv, 0, &incomplete)
+		if !ok {
+			continue
+		}
+		if m, isMap := val.(map[string]interface{}); isMap && sf.Anonymous {
+			for k, mv := range m {
+				fields[k] = mv
+			}
+			continue
+		}
+		fields[sf.Name] = val
+	}
+	switch box := b.(type) {
+	case *FtypBox:
+		fields = brandFields(box.MajorBrand(), box.MinorVersion(), box.CompatibleBrands())
+	case *StypBox:
+		fields = brandFields(box.MajorBrand(), box.MinorVersion(), box.CompatibleBrands())
+	case *MdatBox:
+		fields = map[string]interface{}{"LargeSize": box.LargeSize}
+	case *FreeBox:
+		fields["Data"] = hex.EncodeToString(box.notDecoded)
+	case *UnknownBox:
+		incomplete = true
+	case *UUIDBox:
+		fields["UUID"] = hex.EncodeToString(box.uuid)
+	case *TfdtBox:
+		fields["BaseMediaDecodeTime"] = box.BaseMediaDecodeTime()
+	case *TrunBox:
+		if flags, present := box.FirstSampleFlags(); present {
+			fields["FirstSampleFlags"] = uint64(flags)
+		}
+		clearAbsentTrunValues(box, fields)
+	case *StscBox:
+		if len(box.SampleDescriptionID) == 0 {
+			fields["SingleSampleDescriptionID"] = uint64(box.singleSampleDescriptionID)
+		}
+	case *SencBox:
+		incomplete = incomplete || box.ReadButNotParsed()
+	case *MetaBox:
+		fields["IsQuickTime"] = box.IsQuickTime()
+	}
+	if hasBoxRefs && !hasChildrenField {
+		incomplete = true // boxes inside the box that are not children
+	}
+	if len(fields) > 0 {
+		n.Fields = fields
+	}
+	if len(children) == 0 && (incomplete || !hasZeroBox(b.Type())) {
+		if data, err := encodeBox(b); err == nil {
+			if hdr, err := DecodeHeader(bytes.NewReader(data)); err == nil {
+				n.Payload = hex.EncodeToString(data[hdr.Hdrlen:])
+			}
+		}
+	}
+	if len(children) > 0 {
+		var childrenSize uint64
+		for _, c := range children {
+			childrenSize += c.Size()
+		}
+		n.Children = boxNodes(children, offset+n.Size-nrTrailingBytes-childrenSize)
+	}
+	return n
+}
+
+// clearAbsentTrunValues zeroes sample values that are not present in the trun box,
+// since they may have been filled in from tfhd or trex defaults.
+func clearAbsentTrunValues(trun *TrunBox, fields map[string]interface{}) {
+	samples, ok := fields["Samples"].([]interface{})
+	if !ok {
+		return
+	}
+	for _, s := range samples {
+		m, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if !trun.HasSampleDuration() {
+			m["Dur"] = uint64(0)
+		}
+		if !trun.HasSampleSize() {
+			m["Size"] = uint64(0)
+		}
+		if !trun.HasSampleFlags() {
+			m["Flags"] = uint64(0)
+		}
+		if !trun.HasSampleCompositionTimeOffset() {
+			m["CompositionTimeOffset"] = int64(0)
+		}
+	}
+}
+
+// boxTypeText - box type with each byte as a Latin-1 character, so that types like \xa9too are valid text
+func boxTypeText(boxType string) string {
+	runes := make([]rune, 0, len(boxType))
+	for i := 0; i < len(boxType); i++ {
+		runes = append(runes, rune(boxType[i]))
+	}
+	return string(runes)
+}
+
+func brandFields(majorBrand string, minorVersion uint32, compatibleBrands []string) map[string]interface{} {
+	brands := make([]interface{}, 0, len(compatibleBrands))
+	for _, cb := range compatibleBrands {
+		brands = append(brands, cb)
+	}
+	return map[string]interface{}{
+		"MajorBrand":       majorBrand,
+		"MinorVersion":     uint64(minorVersion),
+		"CompatibleBrands": brands,
+	}
+}
+
+// boxNodes - BoxNodes for consecutive boxes starting at offset
+func boxNodes(boxes []Box, offset uint64) []*BoxNode {
+	nodes := make([]*BoxNode, 0, len(boxes))
+	for _, b := range boxes {
+		nodes = append(nodes, NewBoxNode(b, offset))
+		offset += b.Size()
+	}
+	return nodes
+}
+
+// treeFieldValue - value of a box field for BoxNode.Fields. ok is false if the field should be left out.
+// incomplete is set if the value cannot be restored by NewBoxFromNode.
+func treeFieldValue(v reflect.Value, depth int, incomplete *bool) (val interface{}, ok bool) {
+	if depth > maxTreeFieldDepth {
+		*incomplete = true
+		return nil, false
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.Type().Implements(boxInterfaceType) {
+			return nil, false
+		}
+		if v.IsNil() {
+			return nil, true
+		}
+		if v.Kind() == reflect.Interface {
+			if v.Elem().Type().Implements(boxInterfaceType) {
+				return nil, false
+			}
+			*incomplete = true // the concrete type is not known when restoring
+		}
+		return treeFieldValue(v.Elem(), depth+1, incomplete)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		return v.String(), true
+	case reflect.Slice, reflect.Array:
+		elemType := v.Type().Elem()
+		if elemType == byteType {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return hex.EncodeToString(data), true
+		}
+		if elemType.Implements(boxInterfaceType) {
+			return nil, false
+		}
+		list := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if ev, ok := treeFieldValue(v.Index(i), depth+1, incomplete); ok {
+				list = append(list, ev)
+			}
+		}
+		return list, true
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if mv, ok := treeFieldValue(iter.Value(), depth+1, incomplete); ok {
+				m[fmt.Sprint(iter.Key().Interface())] = mv
+			}
+		}
+		return m, true
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fv, ok := treeFieldValue(v.Field(i), depth+1, incomplete)
+			if !ok {
+				continue
+			}
+			if sm, isMap := fv.(map[string]interface{}); isMap && sf.Anonymous {
+				for k, smv := range sm {
+					m[k] = smv
+				}
+				continue
+			}
+			m[sf.Name] = fv
+		}
+		if v.CanAddr() {
+			if typer, ok := v.Addr().Interface().(interface{ Type() string }); ok {
+				m["Type"] = typer.Type()
+			}
+		} else if typer, ok := v.Interface().(interface{ Type() string }); ok {
+			m["Type"] = typer.Type()
+		}
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+// BoxTree - structured representation of all top-level boxes of the file
+func (f *File) BoxTree() []*BoxNode {
+	return boxNodes(f.Children, 0)
+}
+
+// BoxTree - structured representation of all boxes of the init segment.
+// Offsets are positions in the encoded init segment.
+func (s *InitSegment) BoxTree() []*BoxNode {
+	return boxNodes(s.Children, 0)
+}
+
+// BoxTree - structured representation of all top-level boxes of the fragment, starting at StartPos
+func (f *Fragment) BoxTree() []*BoxNode {
+	return boxNodes(f.Children, f.StartPos)
+}
+
+// BoxTree - structured representation of all top-level boxes of the segment, starting at StartPos
+func (s *MediaSegment) BoxTree() []*BoxNode {
+	var boxes []Box
+	if s.Styp != nil {
+		boxes = append(boxes, s.Styp)
+	}
+	for _, sidx := range s.Sidxs {
+		boxes = append(boxes, sidx)
+	}
+	for _, frag := range s.Fragments {
+		boxes = append(boxes, frag.Children...)
+	}
+	return boxNodes(boxes, s.StartPos)
+}
+
+// Dump - write file box tree in format
+func (f *File) Dump(w io.Writer, format DumpFormat) error {
+	return dumpTree(w, format, f, f.BoxTree)
+}
+
+// Dump - write init segment box tree in format
+func (s *InitSegment) Dump(w io.Writer, format DumpFormat) error {
+	return dumpTree(w, format, s, s.BoxTree)
+}
+
+// Dump - write fragment box tree in format
+func (f *Fragment) Dump(w io.Writer, format DumpFormat) error {
+	return dumpTree(w, format, f, f.BoxTree)
+}
+
+// Dump - write media segment box tree in format
+func (s *MediaSegment) Dump(w io.Writer, format DumpFormat) error {
+	return dumpTree(w, format, s, s.BoxTree)
+}
+
+func dumpTree(w io.Writer, format DumpFormat, informer Informer, tree func() []*BoxNode) error {
+	switch format {
+	case DumpText, "":
+		return informer.Info(w, "", "", "  ")
+	case DumpJSON:
+		data, err := json.MarshalIndent(tree(), "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		_, err = w.Write(data)
+		return err
+	case DumpYAML:
+		_, err := w.Write(yamlTree(tree()))
+		return err
+	case DumpXML:
+		return writeXMLTree(w, tree())
+	default:
+		return fmt.Errorf("unknown dump format %q", format)
+	}
+}
+
+// xmlBoxTree - XML representation of a list of BoxNode
+type xmlBoxTree struct {
+	XMLName xml.Name     `xml:"boxes"`
+	Boxes   []xmlBoxNode `xml:"box"`
+}
+
+// xmlBoxNode - XML representation of a BoxNode.
+// Node properties and scalar fields are attributes, other fields are field elements with JSON values.
+type xmlBoxNode struct {
+	Attrs    []xml.Attr   `xml:",any,attr"`
+	Fields   []xmlField   `xml:"field"`
+	Children []xmlBoxNode `xml:"box"`
+}
+
+type xmlField struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeXMLTree(w io.Writer, nodes []*BoxNode) error {
+	tree := xmlBoxTree{Boxes: xmlNodes(nodes)}
+	data, err := xml.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+func xmlNodes(nodes []*BoxNode) []xmlBoxNode {
+	xNodes := make([]xmlBoxNode, 0, len(nodes))
+	for _, n := range nodes {
+		x := xmlBoxNode{Attrs: []xml.Attr{
+			{Name: xml.Name{Local: "type"}, Value: n.Type},
+			{Name: xml.Name{Local: "offset"}, Value: strconv.FormatUint(n.Offset, 10)},
+			{Name: xml.Name{Local: "size"}, Value: strconv.FormatUint(n.Size, 10)},
+		}}
+		if n.Version != nil {
+			x.Attrs = append(x.Attrs, xml.Attr{Name: xml.Name{Local: "version"}, Value: strconv.Itoa(int(*n.Version))})
+		}
+		if n.Flags != nil {
+			x.Attrs = append(x.Attrs, xml.Attr{Name: xml.Name{Local: "flags"},
+				Value: strconv.FormatUint(uint64(*n.Flags), 10)})
+		}
+		if n.Payload != "" {
+			x.Attrs = append(x.Attrs, xml.Attr{Name: xml.Name{Local: "payload"}, Value: n.Payload})
+		}
+		keys := make([]string, 0, len(n.Fields))
+		for k := range n.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			switch v := n.Fields[k].(type) {
+			case string, bool, int64, uint64, float64, json.Number:
+				x.Attrs = append(x.Attrs, xml.Attr{Name: xml.Name{Local: k}, Value: fmt.Sprint(v)})
+			default:
+				data, err := json.Marshal(v)
+				if err != nil {
+					data = []byte("null")
+				}
+				x.Fields = append(x.Fields, xmlField{Name: k, Value: string(data)})
+			}
+		}
+		x.Children = xmlNodes(n.Children)
+		xNodes = append(xNodes, x)
+	}
+	return xNodes
+}
+
+// yamlPair - key and value of a YAML mapping. Mappings are []yamlPair to keep the key order.
+type yamlPair struct {
+	key string
+	val interface{}
+}
+
+func yamlTree(nodes []*BoxNode) []byte {
+	var buf bytes.Buffer
+	list := yamlNodes(nodes)
+	if len(list) == 0 {
+		buf.WriteString("[]\n")
+		return buf.Bytes()
+	}
+	writeYAMLBlock(&buf, list, 0, false)
+	return buf.Bytes()
+}
+
+func yamlNodes(nodes []*BoxNode) []interface{} {
+	list := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		pairs := []yamlPair{{"type", n.Type}, {"offset", n.Offset}, {"size", n.Size}}
+		if n.Version != nil {
+			pairs = append(pairs, yamlPair{"version", uint64(*n.Version)})
+		}
+		if n.Flags != nil {
+			pairs = append(pairs, yamlPair{"flags", uint64(*n.Flags)})
+		}
+		if len(n.Fields) > 0 {
+			pairs = append(pairs, yamlPair{"fields", yamlValue(n.Fields)})
+		}
+		if n.Payload != "" {
+			pairs = append(pairs, yamlPair{"payload", n.Payload})
+		}
+		if len(n.Children) > 0 {
+			pairs = append(pairs, yamlPair{"children", yamlNodes(n.Children)})
+		}
+		list = append(list, pairs)
+	}
+	return list
+}
+
+// yamlValue - field value with maps converted to []yamlPair sorted by key
+func yamlValue(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]yamlPair, 0, len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, yamlPair{k, yamlValue(c[k])})
+		}
+		return pairs
+	case []interface{}:
+		list := make([]interface{}, 0, len(c))
+		for _, e := range c {
+			list = append(list, yamlValue(e))
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+// writeYAMLBlock writes a non-empty mapping or sequence in block style at indent.
+// If firstInline is set, the first line continues a "- " already written by the caller.
+func writeYAMLBlock(buf *bytes.Buffer, v interface{}, indent int, firstInline bool) {
+	pad := strings.Repeat(" ", indent)
+	switch c := v.(type) {
+	case []yamlPair:
+		for i, p := range c {
+			if i > 0 || !firstInline {
+				buf.WriteString(pad)
+			}
+			buf.WriteString(p.key + ":")
+			if isYAMLBlock(p.val) {
+				buf.WriteString("\n")
+				writeYAMLBlock(buf, p.val, indent+2, false)
+			} else {
+				buf.WriteString(" " + yamlScalar(p.val) + "\n")
+			}
+		}
+	case []interface{}:
+		for i, e := range c {
+			if i > 0 || !firstInline {
+				buf.WriteString(pad)
+			}
+			if isYAMLBlock(e) {
+				buf.WriteString("- ")
+				writeYAMLBlock(buf, e, indent+2, true)
+			} else {
+				buf.WriteString("- " + yamlScalar(e) + "\n")
+			}
+		}
+	}
+}
+
+func isYAMLBlock(v interface{}) bool {
+	switch c := v.(type) {
+	case []yamlPair:
+		return len(c) > 0
+	case []interface{}:
+		return len(c) > 0
+	}
+	return false
+}
+
+func yamlScalar(v interface{}) string {
+	switch c := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(c)
+	case []yamlPair:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	case float64:
+		return strconv.FormatFloat(c, 'g', -1, 64)
+	default:
+		return fmt.Sprint(c)
+	}
+}
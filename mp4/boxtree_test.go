@@ -0,0 +1,140 @@
+package mp4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// checkNodeOffsets checks that the size and type of every node matches the box header at its offset.
+func checkNodeOffsets(t *testing.T, data []byte, nodes []*mp4.BoxNode) {
+	t.Helper()
+	for _, n := range nodes {
+		if n.Offset+8 > uint64(len(data)) {
+			t.Fatalf("%s box offset %d outside data", n.Type, n.Offset)
+		}
+		hdr := data[n.Offset : n.Offset+8]
+		size := uint64(binary.BigEndian.Uint32(hdr[:4]))
+		if size == 1 {
+			size = binary.BigEndian.Uint64(data[n.Offset+8 : n.Offset+16])
+		}
+		// node types map each byte to a Latin-1 character, like \xa9 to ©
+		typeText := make([]rune, 0, 4)
+		for _, c := range hdr[4:8] {
+			typeText = append(typeText, rune(c))
+		}
+		if string(typeText) != n.Type || (size != 0 && size != n.Size) {
+			t.Fatalf("%s box with size %d does not match header %q with size %d at offset %d",
+				n.Type, n.Size, hdr[4:8], size, n.Offset)
+		}
+		checkNodeOffsets(t, data, n.Children)
+	}
+}
+
+func TestBoxTreeOffsets(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.m*4*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if strings.Contains(file, "truncated") || strings.Contains(file, "bad") {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := mp4.DecodeFile(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		t.Run(file, func(t *testing.T) {
+			checkNodeOffsets(t, data, f.BoxTree())
+			for _, seg := range f.Segments {
+				checkNodeOffsets(t, data, seg.BoxTree())
+				for _, frag := range seg.Fragments {
+					checkNodeOffsets(t, data, frag.BoxTree())
+				}
+			}
+			if _, err := json.Marshal(f.BoxTree()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDump(t *testing.T) {
+	init, err := mp4.ReadMP4File("testdata/init.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := init.Init.Dump(&buf, mp4.DumpJSON); err != nil {
+		t.Fatal(err)
+	}
+	var nodes []*mp4.BoxNode
+	if err := json.Unmarshal(buf.Bytes(), &nodes); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[1].Type != "moov" || nodes[1].Offset != 32 {
+		t.Fatalf("unexpected top-level nodes %+v", nodes)
+	}
+	mvhd := nodes[1].Children[0]
+	if mvhd.Type != "mvhd" || mvhd.Version == nil || *mvhd.Version != 0 || mvhd.Fields["Timescale"] != 90000.0 {
+		t.Errorf("unexpected mvhd node %+v", mvhd)
+	}
+
+	seg, err := mp4.ReadMP4File("testdata/1.m4s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := seg.Segments[0].Dump(&buf, mp4.DumpYAML); err != nil {
+		t.Fatal(err)
+	}
+	wantStart := "- type: \"styp\"\n  offset: 0\n  size: 24\n  fields:\n    CompatibleBrands:\n"
+	if !strings.HasPrefix(buf.String(), wantStart) {
+		t.Errorf("unexpected yaml start:\n%s", buf.String()[:len(wantStart)])
+	}
+	if !strings.Contains(buf.String(), "\n        - type: \"trun\"\n") {
+		t.Errorf("no trun box in yaml output")
+	}
+	buf.Reset()
+	if err := seg.Segments[0].Fragments[0].Dump(&buf, mp4.DumpText); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "[moof] size=") {
+		t.Errorf("unexpected text dump start: %q", buf.String()[:12])
+	}
+	if err := seg.Dump(&buf, "csv"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestBoxTreeShortBrandBoxes(t *testing.T) {
+	// ftyp and styp boxes with only a major brand and no minor version
+	for _, boxType := range []string{"ftyp", "styp"} {
+		data := []byte{0, 0, 0, 12, boxType[0], boxType[1], boxType[2], boxType[3], 'i', 's', 'o', 'm'}
+		if _, err := mp4.DecodeBox(0, bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected error for short box", boxType)
+		}
+	}
+	for _, b := range []mp4.Box{&mp4.FtypBox{}, &mp4.StypBox{}} {
+		n := mp4.NewBoxNode(b, 0)
+		if n.Fields["MajorBrand"] != "" {
+			t.Errorf("%s: unexpected fields %v", b.Type(), n.Fields)
+		}
+		var buf bytes.Buffer
+		f := mp4.NewFile()
+		f.AddChild(b, 0)
+		if err := f.Dump(&buf, mp4.DumpJSON); err != nil {
+			t.Errorf("%s: %v", b.Type(), err)
+		}
+	}
+}
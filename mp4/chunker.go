@@ -0,0 +1,184 @@
+package mp4
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// PrftMode - which chunks get a prft box from a Chunker
+type PrftMode int
+
+const (
+	// PrftNone - no prft boxes
+	PrftNone PrftMode = iota
+	// PrftSegment - prft box in the first chunk of every segment
+	PrftSegment
+	// PrftChunk - prft box in every chunk
+	PrftChunk
+)
+
+// ChunkerConfig - configuration of a Chunker. Durations are in the track timescale.
+type ChunkerConfig struct {
+	TrackID uint32
+	// SegmentDuration - nominal segment duration. A segment starts at the first sync sample at or after
+	// each multiple of SegmentDuration counted from the first sample
+	SegmentDuration uint64
+	// ChunkDuration - target chunk duration. A chunk ends when it has at least this duration.
+	// 0 means one chunk per segment
+	ChunkDuration uint64
+	// Prft - which chunks get a prft box
+	Prft PrftMode
+	// PrftFlags - prft flags, like PrftTimeEncoderOutput
+	PrftFlags uint32
+	// WallClock - wall-clock time for the decode time of a chunk's first sample. nil means time.Now
+	WallClock func(decodeTime uint64) time.Time
+}
+
+// CMAFChunk - a CMAF chunk (prft + moof + mdat) produced by a Chunker.
+// A chunk starting a segment also has a styp box.
+type CMAFChunk struct {
+	Styp        *StypBox // non-nil for the first chunk of a segment
+	Fragment    *Fragment
+	SegmentNr   uint32 // one-based segment number
+	ChunkNr     uint32 // one-based chunk number in segment
+	DecodeTime  uint64 // decode time of the first sample
+	Duration    uint64 // sum of sample durations
+	Independent bool   // starts with a sync sample (HLS part with INDEPENDENT=YES)
+}
+
+// Encode - write styp (if present) and fragment of chunk
+func (c *CMAFChunk) Encode(w io.Writer) error {
+	if c.Styp != nil {
+		if err := c.Styp.Encode(w); err != nil {
+			return err
+		}
+	}
+	return c.Fragment.Encode(w)
+}
+
+// Size - size of the encoded chunk
+func (c *CMAFChunk) Size() uint64 {
+	size := c.Fragment.Size()
+	if c.Styp != nil {
+		size += c.Styp.Size()
+	}
+	return size
+}
+
+// Chunker - build low-latency CMAF chunks from a sample stream of one track.
+// Samples are added in decode order with AddSample, and every finished chunk is passed to the
+// callback. The last chunk is emitted by Flush. No sidx or ssix boxes are produced, since chunks are
+// written before their segment is complete.
+// Sample flags are rewritten to SyncSampleFlags or NonSyncSampleFlags|SampleDependsOn1 based on
+// the sample_is_non_sync_sample bit of the input.
+type Chunker struct {
+	cfg         ChunkerConfig
+	callback    func(*CMAFChunk) error
+	started     bool
+	segNr       uint32
+	chunkNr     uint32
+	seqNr       uint32
+	nextSegTime uint64
+	chunk       *CMAFChunk
+}
+
+// NewChunker - create a Chunker that calls callback for each chunk
+func NewChunker(cfg ChunkerConfig, callback func(*CMAFChunk) error) (*Chunker, error) {
+	if cfg.TrackID == 0 {
+		return nil, fmt.Errorf("trackID must be larger than 0")
+	}
+	if cfg.SegmentDuration == 0 {
+		return nil, fmt.Errorf("segment duration must be larger than 0")
+	}
+	if callback == nil {
+		return nil, fmt.Errorf("no chunk callback")
+	}
+	if cfg.WallClock == nil {
+		cfg.WallClock = func(uint64) time.Time { return time.Now() }
+	}
+	return &Chunker{cfg: cfg, callback: callback}, nil
+}
+
+// AddSample - add the next sample in decode order. Finished chunks are passed to the callback.
+func (c *Chunker) AddSample(s FullSample) error {
+	isSync := !DecodeSampleFlags(s.Flags).SampleIsNonSync
+	if isSync {
+		s.Flags = SyncSampleFlags
+	} else {
+		s.Flags = NonSyncSampleFlags | SampleDependsOn1
+	}
+	if !c.started {
+		c.started = true
+		c.nextSegTime = s.DecodeTime
+	}
+	newSegment := isSync && s.DecodeTime >= c.nextSegTime
+	if c.chunk != nil {
+		if newSegment || (c.cfg.ChunkDuration > 0 && c.chunk.Duration >= c.cfg.ChunkDuration) {
+			if err := c.emit(); err != nil {
+				return err
+			}
+		}
+	}
+	if newSegment {
+		c.segNr++
+		c.chunkNr = 0
+		for c.nextSegTime <= s.DecodeTime {
+			c.nextSegTime += c.cfg.SegmentDuration
+		}
+	}
+	if c.segNr == 0 {
+		return fmt.Errorf("first sample is not a sync sample")
+	}
+	if c.chunk == nil {
+		if err := c.startChunk(s, isSync); err != nil {
+			return err
+		}
+	}
+	c.chunk.Fragment.AddFullSample(s)
+	c.chunk.Duration += uint64(s.Dur)
+	return nil
+}
+
+func (c *Chunker) startChunk(s FullSample, isSync bool) error {
+	c.seqNr++
+	c.chunkNr++
+	frag, err := CreateFragment(c.seqNr, c.cfg.TrackID)
+	if err != nil {
+		return err
+	}
+	chunk := &CMAFChunk{
+		SegmentNr:   c.segNr,
+		ChunkNr:     c.chunkNr,
+		DecodeTime:  s.DecodeTime,
+		Independent: isSync,
+	}
+	if c.chunkNr == 1 {
+		chunk.Styp = CreateStyp()
+	}
+	if c.cfg.Prft == PrftChunk || (c.cfg.Prft == PrftSegment && c.chunkNr == 1) {
+		wallClock := c.cfg.WallClock(s.DecodeTime)
+		ntp := NewNTP64(float64(wallClock.UnixNano()) / 1e9)
+		prft := CreatePrftBox(1, c.cfg.PrftFlags, c.cfg.TrackID, ntp, s.DecodeTime)
+		// prft must precede moof
+		frag.Children = append([]Box{prft}, frag.Children...)
+		frag.Prft = prft
+	}
+	chunk.Fragment = frag
+	c.chunk = chunk
+	return nil
+}
+
+func (c *Chunker) emit() error {
+	chunk := c.chunk
+	c.chunk = nil
+	return c.callback(chunk)
+}
+
+// Flush - emit the last chunk, if any
+func (c *Chunker) Flush() error {
+	if c.chunk == nil {
+		return nil
+	}
+	return c.emit()
+}
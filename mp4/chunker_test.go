@@ -0,0 +1,136 @@
+package mp4_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestChunker(t *testing.T) {
+	init := mp4.CreateEmptyInit()
+	init.AddEmptyTrack(90000, "video", "und")
+	var buf bytes.Buffer
+	if err := init.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	wallClockStart := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cfg := mp4.ChunkerConfig{
+		TrackID:         1,
+		SegmentDuration: 180000,
+		ChunkDuration:   36000,
+		Prft:            mp4.PrftSegment,
+		PrftFlags:       mp4.PrftTimeEncoderOutput,
+		WallClock: func(decodeTime uint64) time.Time {
+			return wallClockStart.Add(time.Duration(decodeTime) * time.Second / 90000)
+		},
+	}
+	var chunks []*mp4.CMAFChunk
+	chunker, err := mp4.NewChunker(cfg, func(c *mp4.CMAFChunk) error {
+		chunks = append(chunks, c)
+		return c.Encode(&buf)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		flags := mp4.NonSyncSampleFlags
+		if i%25 == 0 {
+			flags = 0 // sync samples without depends_on, which should be set by the chunker
+		}
+		err := chunker.AddSample(mp4.FullSample{
+			Sample:     mp4.NewSample(flags, 3600, 2, 0),
+			DecodeTime: uint64(i) * 3600,
+			Data:       []byte{byte(i), 0},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(chunks) != 9 {
+		t.Errorf("got %d chunks before flush instead of 9", len(chunks))
+	}
+	if err := chunker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 10 {
+		t.Fatalf("got %d chunks instead of 10", len(chunks))
+	}
+	for i, c := range chunks {
+		wantSegNr, wantChunkNr := uint32(i/5+1), uint32(i%5+1)
+		if c.SegmentNr != wantSegNr || c.ChunkNr != wantChunkNr || c.Duration != 36000 {
+			t.Errorf("chunk %d: got segment %d chunk %d duration %d", i, c.SegmentNr, c.ChunkNr, c.Duration)
+		}
+		if wantIndependent := c.DecodeTime%90000 == 0; c.Independent != wantIndependent {
+			t.Errorf("chunk %d: got independent %t", i, c.Independent)
+		}
+	}
+
+	f, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Segments) != 2 {
+		t.Fatalf("got %d segments instead of 2", len(f.Segments))
+	}
+	trex := f.Init.Moov.Mvex.Trex
+	var seqNr uint32
+	for i, seg := range f.Segments {
+		if seg.Styp == nil || len(seg.Fragments) != 5 {
+			t.Fatalf("segment %d: bad structure", i)
+		}
+		for j, frag := range seg.Fragments {
+			seqNr++
+			if frag.Moof.Mfhd.SequenceNumber != seqNr {
+				t.Errorf("segment %d chunk %d: sequence number %d", i, j, frag.Moof.Mfhd.SequenceNumber)
+			}
+			if (frag.Prft != nil) != (j == 0) {
+				t.Errorf("segment %d chunk %d: prft presence %t", i, j, frag.Prft != nil)
+			}
+			samples, err := frag.GetFullSamples(trex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frag.Prft != nil {
+				wantNTP := mp4.NewNTP64(float64(wallClockStart.Unix()) + float64(samples[0].DecodeTime)/90000)
+				if frag.Prft.MediaTime != samples[0].DecodeTime || frag.Prft.NTPTimestamp != wantNTP {
+					t.Errorf("segment %d: bad prft %+v", i, frag.Prft)
+				}
+			}
+			for _, s := range samples {
+				wantSync := s.DecodeTime%90000 == 0
+				if s.IsSync() != wantSync {
+					t.Errorf("sample at %d: got sync %t", s.DecodeTime, s.IsSync())
+				}
+			}
+		}
+	}
+}
+
+func TestChunkerOneChunkPerSegment(t *testing.T) {
+	var chunks []*mp4.CMAFChunk
+	chunker, err := mp4.NewChunker(mp4.ChunkerConfig{TrackID: 1, SegmentDuration: 1000},
+		func(c *mp4.CMAFChunk) error {
+			chunks = append(chunks, c)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chunker.AddSample(mp4.FullSample{Sample: mp4.NewSample(mp4.NonSyncSampleFlags, 100, 1, 0)}); err == nil {
+		t.Errorf("expected error for non-sync first sample")
+	}
+	for i := 0; i < 25; i++ {
+		s := mp4.FullSample{Sample: mp4.NewSample(mp4.SyncSampleFlags, 100, 1, 0), DecodeTime: uint64(i) * 100}
+		if err := chunker.AddSample(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := chunker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 || chunks[2].Duration != 500 || chunks[2].Styp == nil || chunks[2].Fragment.Prft != nil {
+		t.Errorf("got %d chunks instead of 3", len(chunks))
+	}
+}
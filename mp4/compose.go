@@ -0,0 +1,662 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// maxZeroPayloadSize - largest all-zero payload tried when creating an empty box of a registered type
+const maxZeroPayloadSize = 512
+
+var (
+	zeroPayloadMu    sync.Mutex
+	zeroPayloadSizes = make(map[string]int) // -1 if no all-zero payload is accepted
+)
+
+// newZeroBox returns a box of a registered type decoded from the shortest all-zero payload that
+// its decoder accepts, or false if there is none.
+func newZeroBox(boxType string) (Box, bool) {
+	dec, ok := decoders[boxType]
+	if !ok {
+		return nil, false
+	}
+	zeroPayloadMu.Lock()
+	defer zeroPayloadMu.Unlock()
+	size, known := zeroPayloadSizes[boxType]
+	if known {
+		if size < 0 {
+			return nil, false
+		}
+		return decodeZeroBox(dec, boxType, size), true
+	}
+	for size := 0; size <= maxZeroPayloadSize; size++ {
+		if b := decodeZeroBox(dec, boxType, size); b != nil {
+			zeroPayloadSizes[boxType] = size
+			return b, true
+		}
+	}
+	zeroPayloadSizes[boxType] = -1
+	return nil, false
+}
+
+// decodeZeroBox - box decoded from size zero bytes, or nil if the decoder fails or is inconsistent
+func decodeZeroBox(dec BoxDecoder, boxType string, size int) (b Box) {
+	defer func() {
+		if r := recover(); r != nil {
+			b = nil
+		}
+	}()
+	hdr := BoxHeader{Name: boxType, Size: uint64(boxHeaderSize + size), Hdrlen: boxHeaderSize}
+	box, err := dec(hdr, 0, bytes.NewReader(make([]byte, size)))
+	if err != nil || box == nil || box.Size() != hdr.Size {
+		return nil
+	}
+	return box
+}
+
+// hasZeroBox - true if an empty box of type boxType can be created by newZeroBox
+func hasZeroBox(boxType string) bool {
+	_, ok := newZeroBox(boxType)
+	return ok
+}
+
+// NewBoxFromNode builds a box from a BoxNode, as produced by NewBoxNode or written by hand.
+//
+// If the node has a payload, the box is decoded from it via the registered box decoder, and
+// version, flags and fields of the node are ignored.
+// Otherwise, the box starts as the registered box type decoded from an all-zero payload, or as an
+// UnknownBox with empty payload for unregistered types.
+// Children are then built and added, and finally version, flags and fields are set. Unknown field
+// names are errors. Sizes follow from the content, so Offset and Size of the node are not used,
+// except that an mdat box without Data gets Size-8 zero bytes of payload.
+func NewBoxFromNode(n *BoxNode) (Box, error) {
+	boxType := boxTypeFromText(n.Type)
+	if len(boxType) != 4 {
+		return nil, fmt.Errorf("box type %q is not 4 characters", n.Type)
+	}
+	if n.Payload != "" {
+		if len(n.Children) > 0 {
+			return nil, fmt.Errorf("%s: payload together with children", n.Type)
+		}
+		return decodePayload(boxType, n.Payload)
+	}
+	var b Box
+	switch {
+	case boxType == "meta":
+		b = &MetaBox{}
+	default:
+		var ok bool
+		b, ok = newZeroBox(boxType)
+		if !ok {
+			if _, registered := decoders[boxType]; registered {
+				return nil, fmt.Errorf("%s: box needs a payload", n.Type)
+			}
+			b = &UnknownBox{name: boxType, size: boxHeaderSize}
+		}
+	}
+	for _, cn := range n.Children {
+		child, err := NewBoxFromNode(cn)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", n.Type, err)
+		}
+		if err := addChildBox(b, child); err != nil {
+			return nil, fmt.Errorf("%s: %w", n.Type, err)
+		}
+	}
+	if err := setNodeFields(b, n); err != nil {
+		return nil, fmt.Errorf("%s: %w", n.Type, err)
+	}
+	return b, nil
+}
+
+func decodePayload(boxType, payloadHex string) (Box, error) {
+	payload, err := hex.DecodeString(payloadHex)
+	if err != nil {
+		return nil, fmt.Errorf("%s: payload: %w", boxType, err)
+	}
+	buf := bytes.Buffer{}
+	if err := EncodeHeaderWithSize(boxType, uint64(boxHeaderSize+len(payload)), false, &buf); err != nil {
+		return nil, err
+	}
+	buf.Write(payload)
+	return DecodeBox(0, &buf)
+}
+
+// boxTypeFromText - inverse of boxTypeText
+func boxTypeFromText(text string) string {
+	boxType := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > 0xff {
+			return text
+		}
+		boxType = append(boxType, byte(r))
+	}
+	return string(boxType)
+}
+
+// addChildBox adds child to parent using its AddChild method, or appending to its Children field.
+func addChildBox(parent, child Box) error {
+	switch p := parent.(type) {
+	case interface{ AddChild(Box) error }:
+		return p.AddChild(child)
+	case interface{ AddChild(Box) }:
+		p.AddChild(child)
+		return nil
+	}
+	v := reflect.ValueOf(parent)
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+		cv := v.Elem().FieldByName("Children")
+		if cv.IsValid() && cv.CanSet() && cv.Type() == reflect.TypeOf([]Box(nil)) {
+			cv.Set(reflect.Append(cv, reflect.ValueOf(child)))
+			return nil
+		}
+	}
+	return fmt.Errorf("%s box cannot have children", parent.Type())
+}
+
+// setNodeFields sets version, flags and fields of node n in box b.
+func setNodeFields(b Box, n *BoxNode) error {
+	v := reflect.ValueOf(b)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	v = v.Elem()
+	if n.Version != nil {
+		if err := setNamedField(v, "Version", uint64(*n.Version)); err != nil {
+			return err
+		}
+	}
+	if n.Flags != nil {
+		if err := setNamedField(v, "Flags", uint64(*n.Flags)); err != nil {
+			return err
+		}
+	}
+	fields := make(map[string]interface{}, len(n.Fields))
+	for k, val := range n.Fields {
+		fields[k] = val
+	}
+	if err := setSpecialFields(b, n, fields); err != nil {
+		return err
+	}
+	for name, val := range fields {
+		if err := setNamedField(v, name, val); err != nil {
+			return err
+		}
+	}
+	if senc, ok := b.(*SencBox); ok {
+		senc.readBoxSize = 0
+		if len(senc.IVs) > 0 || len(senc.SubSamples) > 0 {
+			senc.readButNotParsed = false
+			senc.perSampleIVSize = 0
+			if len(senc.IVs) > 0 {
+				senc.perSampleIVSize = byte(len(senc.IVs[0]))
+			}
+		}
+	}
+	return nil
+}
+
+// setSpecialFields sets fields that are not exported struct fields, and removes them from fields.
+// It is the inverse of the box-specific fields in NewBoxNode.
+func setSpecialFields(b Box, n *BoxNode, fields map[string]interface{}) error {
+	var err error
+	take := func(name string, dst interface{}) {
+		val, ok := fields[name]
+		if !ok || err != nil {
+			return
+		}
+		delete(fields, name)
+		err = setTreeField(reflect.ValueOf(dst).Elem(), val)
+		if err != nil {
+			err = fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	switch box := b.(type) {
+	case *FtypBox, *StypBox:
+		var majorBrand string
+		var minorVersion uint32
+		var compatibleBrands []string
+		take("MajorBrand", &majorBrand)
+		take("MinorVersion", &minorVersion)
+		take("CompatibleBrands", &compatibleBrands)
+		if len(majorBrand) != 4 {
+			return fmt.Errorf("major brand %q is not 4 characters", majorBrand)
+		}
+		for _, cb := range compatibleBrands {
+			if len(cb) != 4 {
+				return fmt.Errorf("compatible brand %q is not 4 characters", cb)
+			}
+		}
+		if ftyp, ok := box.(*FtypBox); ok {
+			*ftyp = *NewFtyp(majorBrand, minorVersion, compatibleBrands)
+		} else {
+			*box.(*StypBox) = *NewStyp(majorBrand, minorVersion, compatibleBrands)
+		}
+	case *MdatBox:
+		take("Data", &box.Data)
+		take("LargeSize", &box.LargeSize)
+		if _, ok := n.Fields["Data"]; !ok && n.Size > boxHeaderSize {
+			box.Data = make([]byte, n.Size-boxHeaderSize)
+		}
+	case *FreeBox:
+		take("Data", &box.notDecoded)
+	case *UUIDBox:
+		take("UUID", &box.uuid)
+	case *TfdtBox:
+		var bmdt uint64
+		if _, ok := fields["BaseMediaDecodeTime"]; ok {
+			take("BaseMediaDecodeTime", &bmdt)
+			box.SetBaseMediaDecodeTime(bmdt)
+			if n.Version != nil && *n.Version > box.Version {
+				box.Version = *n.Version
+			}
+		}
+	case *TrunBox:
+		var firstSampleFlags uint32
+		if _, ok := fields["FirstSampleFlags"]; ok {
+			take("FirstSampleFlags", &firstSampleFlags)
+			box.SetFirstSampleFlags(firstSampleFlags)
+		}
+	case *StscBox:
+		var sdi uint32
+		if _, ok := fields["SingleSampleDescriptionID"]; ok {
+			take("SingleSampleDescriptionID", &sdi)
+			box.SetSingleSampleDescriptionID(sdi)
+		}
+	case *MetaBox:
+		take("IsQuickTime", &box.isQuickTime)
+	}
+	return err
+}
+
+// setNamedField sets the exported field name of struct v, including promoted fields.
+func setNamedField(v reflect.Value, name string, val interface{}) error {
+	sf, ok := v.Type().FieldByName(name)
+	if !ok || !sf.IsExported() || name == "Children" {
+		return fmt.Errorf("unknown field %s", name)
+	}
+	fv := v.FieldByIndex(sf.Index)
+	if err := setTreeField(fv, val); err != nil {
+		return fmt.Errorf("field %s: %w", name, err)
+	}
+	return nil
+}
+
+// setTreeField sets v from a BoxNode field value. It is the inverse of treeFieldValue, and also
+// accepts strings for numbers and booleans, as given by XML attributes.
+func setTreeField(v reflect.Value, val interface{}) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Implements(boxInterfaceType) {
+			return nil
+		}
+		if val == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setTreeField(v.Elem(), val)
+	case reflect.Interface:
+		if val == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot set interface value of type %s", v.Type())
+	case reflect.Bool:
+		switch c := val.(type) {
+		case bool:
+			v.SetBool(c)
+		case string:
+			bv, err := strconv.ParseBool(c)
+			if err != nil {
+				return err
+			}
+			v.SetBool(bv)
+		default:
+			return fmt.Errorf("bad bool value %v", val)
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		var err error
+		switch c := val.(type) {
+		case json.Number:
+			i, err = strconv.ParseInt(string(c), 10, 64)
+		case string:
+			i, err = strconv.ParseInt(c, 0, 64)
+		case float64:
+			i = int64(c)
+		case int64:
+			i = c
+		case uint64:
+			i = int64(c)
+		default:
+			err = fmt.Errorf("bad integer value %v", val)
+		}
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("value %d out of range", i)
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		var err error
+		switch c := val.(type) {
+		case json.Number:
+			u, err = strconv.ParseUint(string(c), 10, 64)
+		case string:
+			u, err = strconv.ParseUint(c, 0, 64)
+		case float64:
+			u = uint64(c)
+		case int64:
+			u = uint64(c)
+		case uint64:
+			u = c
+		default:
+			err = fmt.Errorf("bad unsigned integer value %v", val)
+		}
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("value %d out of range", u)
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		var err error
+		switch c := val.(type) {
+		case json.Number:
+			f, err = c.Float64()
+		case string:
+			f, err = strconv.ParseFloat(c, 64)
+		case float64:
+			f = c
+		default:
+			err = fmt.Errorf("bad float value %v", val)
+		}
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.String:
+		switch c := val.(type) {
+		case string:
+			v.SetString(c)
+		case json.Number:
+			v.SetString(string(c))
+		default:
+			return fmt.Errorf("bad string value %v", val)
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem() == byteType {
+			s, ok := val.(string)
+			if !ok && val != nil {
+				return fmt.Errorf("bad hex value %v", val)
+			}
+			data, err := hex.DecodeString(s)
+			if err != nil {
+				return err
+			}
+			if v.Kind() == reflect.Array {
+				if len(data) != v.Len() {
+					return fmt.Errorf("got %d bytes instead of %d", len(data), v.Len())
+				}
+				reflect.Copy(v, reflect.ValueOf(data))
+				return nil
+			}
+			if val == nil {
+				data = nil
+			}
+			v.Set(reflect.ValueOf(data).Convert(v.Type()))
+			return nil
+		}
+		if v.Type().Elem().Implements(boxInterfaceType) {
+			return nil
+		}
+		if val == nil && v.Kind() == reflect.Slice {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		list, ok := val.([]interface{})
+		if !ok {
+			return fmt.Errorf("bad list value %v", val)
+		}
+		if v.Kind() == reflect.Array {
+			if len(list) != v.Len() {
+				return fmt.Errorf("got %d values instead of %d", len(list), v.Len())
+			}
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), len(list), len(list)))
+		}
+		for i, e := range list {
+			if err := setTreeField(v.Index(i), e); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+		return nil
+	case reflect.Map:
+		if val == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("bad map value %v", val)
+		}
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(m)))
+		for k, mv := range m {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := setTreeField(key, k); err != nil {
+				return fmt.Errorf("key %s: %w", k, err)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setTreeField(elem, mv); err != nil {
+				return fmt.Errorf("key %s: %w", k, err)
+			}
+			v.SetMapIndex(key, elem)
+		}
+		return nil
+	case reflect.Struct:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("bad struct value %v", val)
+		}
+		for name, mv := range m {
+			if name == "Type" {
+				continue // Added by treeFieldValue for values with a Type method
+			}
+			if err := setNamedField(v, name, mv); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("cannot set value of kind %s", v.Kind())
+	}
+}
+
+// ComposeOptions - options for ComposeBoxes
+type ComposeOptions struct {
+	// KeepDataOffsets - keep trun data offsets and saio offsets instead of recomputing them
+	KeepDataOffsets bool
+}
+
+// ComposeBoxes builds the top-level boxes described by nodes using NewBoxFromNode.
+// Unless opts.KeepDataOffsets is set, trun data offsets are recomputed for every moof followed by an
+// mdat, as well as saio offsets to senc data, assuming the offsets are relative to the moof start.
+func ComposeBoxes(nodes []*BoxNode, opts ComposeOptions) ([]Box, error) {
+	boxes := make([]Box, 0, len(nodes))
+	for _, n := range nodes {
+		b, err := NewBoxFromNode(n)
+		if err != nil {
+			return nil, err
+		}
+		boxes = append(boxes, b)
+	}
+	if opts.KeepDataOffsets {
+		return boxes, nil
+	}
+	var moov *MoovBox
+	for i, b := range boxes {
+		switch box := b.(type) {
+		case *MoovBox:
+			moov = box
+		case *MoofBox:
+			if i+1 < len(boxes) {
+				if mdat, ok := boxes[i+1].(*MdatBox); ok {
+					if err := fixMoofOffsets(box, mdat, moov); err != nil {
+						return nil, fmt.Errorf("moof %d: %w", i, err)
+					}
+				}
+			}
+		}
+	}
+	return boxes, nil
+}
+
+// fixMoofOffsets sets trun data offsets and saio offsets relative to the start of moof.
+// The sample data of the truns is laid out in the order of their current data offsets, so that
+// interleaving is kept, and in traf and trun order for equal offsets.
+func fixMoofOffsets(moof *MoofBox, mdat *MdatBox, moov *MoovBox) error {
+	type trunData struct {
+		trun      *TrunBox
+		oldOffset int32
+		size      uint64
+	}
+	var truns []trunData
+	for _, traf := range moof.Trafs {
+		if traf.Tfhd == nil || traf.Tfhd.HasBaseDataOffset() {
+			continue
+		}
+		var trex *TrexBox
+		if moov != nil && moov.Mvex != nil {
+			trex, _ = moov.Mvex.GetTrex(traf.Tfhd.TrackID)
+		}
+		var prevOffset int32
+		for _, trun := range traf.Truns {
+			td := trunData{trun: trun, oldOffset: prevOffset}
+			if trun.HasDataOffset() {
+				td.oldOffset = trun.DataOffset
+			}
+			prevOffset = td.oldOffset
+			for _, s := range trun.Samples {
+				switch {
+				case trun.HasSampleSize():
+					td.size += uint64(s.Size)
+				case traf.Tfhd.HasDefaultSampleSize():
+					td.size += uint64(traf.Tfhd.DefaultSampleSize)
+				case trex != nil:
+					td.size += uint64(trex.DefaultSampleSize)
+				}
+			}
+			truns = append(truns, td)
+		}
+		if traf.Saio != nil && len(traf.Saio.Offset) == 1 {
+			if offset, err := sencDataOffset(moof, traf); err == nil {
+				traf.Saio.Offset[0] = int64(offset)
+			}
+		}
+	}
+	sort.SliceStable(truns, func(i, j int) bool { return truns[i].oldOffset < truns[j].oldOffset })
+	dataOffset := moof.Size() + mdat.HeaderSize()
+	for _, td := range truns {
+		if td.trun.HasDataOffset() {
+			td.trun.DataOffset = int32(dataOffset)
+		}
+		dataOffset += td.size
+	}
+	return nil
+}
+
+// ParseBoxTree parses a box tree written by Dump in JSON or XML format.
+// JSON numbers are kept as json.Number to avoid loss of precision.
+func ParseBoxTree(r io.Reader, format DumpFormat) ([]*BoxNode, error) {
+	switch format {
+	case DumpJSON:
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		var nodes []*BoxNode
+		if err := dec.Decode(&nodes); err != nil {
+			return nil, err
+		}
+		return nodes, nil
+	case DumpXML:
+		var tree xmlBoxTree
+		if err := xml.NewDecoder(r).Decode(&tree); err != nil {
+			return nil, err
+		}
+		return nodesFromXML(tree.Boxes)
+	default:
+		return nil, fmt.Errorf("cannot parse box tree in format %q", format)
+	}
+}
+
+func nodesFromXML(xNodes []xmlBoxNode) ([]*BoxNode, error) {
+	nodes := make([]*BoxNode, 0, len(xNodes))
+	for _, x := range xNodes {
+		n := &BoxNode{Fields: make(map[string]interface{})}
+		for _, a := range x.Attrs {
+			var err error
+			switch a.Name.Local {
+			case "type":
+				n.Type = a.Value
+			case "offset":
+				n.Offset, err = strconv.ParseUint(a.Value, 0, 64)
+			case "size":
+				n.Size, err = strconv.ParseUint(a.Value, 0, 64)
+			case "version":
+				var version uint64
+				version, err = strconv.ParseUint(a.Value, 0, 8)
+				v := byte(version)
+				n.Version = &v
+			case "flags":
+				var flags uint64
+				flags, err = strconv.ParseUint(a.Value, 0, 32)
+				f := uint32(flags)
+				n.Flags = &f
+			case "payload":
+				n.Payload = a.Value
+			default:
+				n.Fields[a.Name.Local] = a.Value
+			}
+			if err != nil {
+				return nil, fmt.Errorf("box %s attribute %s: %w", n.Type, a.Name.Local, err)
+			}
+		}
+		for _, f := range x.Fields {
+			dec := json.NewDecoder(bytes.NewReader([]byte(f.Value)))
+			dec.UseNumber()
+			var val interface{}
+			if err := dec.Decode(&val); err != nil {
+				return nil, fmt.Errorf("box %s field %s: %w", n.Type, f.Name, err)
+			}
+			n.Fields[f.Name] = val
+		}
+		children, err := nodesFromXML(x.Children)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) > 0 {
+			n.Children = children
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,128 @@
+package mp4_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestComposeRoundTrip(t *testing.T) {
+	files := []string{
+		"testdata/init.mp4",
+		"testdata/1.m4s",
+		"testdata/aac_init.mp4",
+		"testdata/av1_init.mp4",
+		"testdata/cbcs.mp4",
+		"testdata/prog_8s_enc_dashinit.mp4",
+		"testdata/moof_enc.m4s",
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := mp4.DecodeFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, format := range []mp4.DumpFormat{mp4.DumpJSON, mp4.DumpXML} {
+			t.Run(file+" "+string(format), func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := f.Dump(&buf, format); err != nil {
+					t.Fatal(err)
+				}
+				nodes, err := mp4.ParseBoxTree(&buf, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				boxes, err := mp4.ComposeBoxes(nodes, mp4.ComposeOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(boxes) != len(f.Children) {
+					t.Fatalf("got %d boxes instead of %d", len(boxes), len(f.Children))
+				}
+				var out bytes.Buffer
+				for i, b := range boxes {
+					if mdat, ok := b.(*mp4.MdatBox); ok {
+						// Sample data is not part of the box tree
+						if mdat.Size() != f.Children[i].Size() {
+							t.Fatalf("mdat %d: got size %d instead of %d", i, mdat.Size(), f.Children[i].Size())
+						}
+						mdat.Data = f.Children[i].(*mp4.MdatBox).Data
+					}
+					if err := b.Encode(&out); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if !bytes.Equal(out.Bytes(), data) {
+					t.Errorf("composed file differs from %s", file)
+				}
+			})
+		}
+	}
+}
+
+func TestComposeHandWritten(t *testing.T) {
+	desc := `[
+  {"type": "styp", "fields": {"MajorBrand": "msdh", "MinorVersion": 0, "CompatibleBrands": ["msdh", "msix"]}},
+  {"type": "xtra", "payload": "0102"},
+  {"type": "moof", "children": [
+    {"type": "mfhd", "fields": {"SequenceNumber": 7}},
+    {"type": "traf", "children": [
+      {"type": "tfhd", "flags": 131072, "fields": {"TrackID": 1}},
+      {"type": "tfdt", "version": 1, "fields": {"BaseMediaDecodeTime": 1000}},
+      {"type": "trun", "flags": 769, "fields": {"Samples": [
+        {"Flags": 0, "Dur": 512, "Size": 10, "CompositionTimeOffset": 0},
+        {"Flags": 0, "Dur": 512, "Size": 6, "CompositionTimeOffset": 0}]}}
+    ]}
+  ]},
+  {"type": "mdat", "size": 24}
+]`
+	nodes, err := mp4.ParseBoxTree(strings.NewReader(desc), mp4.DumpJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes, err := mp4.ComposeBoxes(nodes, mp4.ComposeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, b := range boxes {
+		if err := b.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Segments) != 1 || len(f.Segments[0].Fragments) != 1 {
+		t.Fatalf("bad file structure")
+	}
+	frag := f.Segments[0].Fragments[0]
+	trun := frag.Moof.Traf.Trun
+	if frag.Moof.Mfhd.SequenceNumber != 7 || frag.Moof.Traf.Tfdt.BaseMediaDecodeTime() != 1000 ||
+		frag.Moof.Traf.Tfdt.Version != 1 {
+		t.Errorf("bad moof %+v", frag.Moof)
+	}
+	if trun.DataOffset != int32(frag.Moof.Size()+8) || len(trun.Samples) != 2 || frag.Mdat.Size() != 24 {
+		t.Errorf("got trun data offset %d and mdat size %d", trun.DataOffset, frag.Mdat.Size())
+	}
+	if f.Segments[0].Styp.MajorBrand() != "msdh" {
+		t.Errorf("bad styp")
+	}
+	unknown, ok := f.Children[1].(*mp4.UnknownBox)
+	if !ok || !bytes.Equal(unknown.Payload(), []byte{1, 2}) {
+		t.Errorf("bad unknown box %+v", f.Children[1])
+	}
+
+	_, err = mp4.ComposeBoxes([]*mp4.BoxNode{{Type: "mfhd", Fields: map[string]interface{}{"SeqNr": 1}}},
+		mp4.ComposeOptions{})
+	if err == nil || !strings.Contains(err.Error(), "unknown field SeqNr") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
@@ -0,0 +1,579 @@
+package mp4
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ConcatOptions - options for Concatenate
+type ConcatOptions struct {
+	// Fragmented - write fragmented output instead of progressive output
+	Fragmented bool
+	// AllowSampleEntrySwitch - add differing sample entries as extra stsd entries, instead of failing
+	AllowSampleEntrySwitch bool
+	// FragmentDurationMS - minimum fragment duration when fragmenting progressive input. 0 means 2000
+	FragmentDurationMS uint32
+	// DropIncompleteSamples - drop the samples of a progressive track from the first one with data
+	// outside mdat, like at the end of a truncated file, instead of failing
+	DropIncompleteSamples bool
+}
+
+// concatGroup - samples of a fragment or GOP group, per output track
+type concatGroup struct {
+	samples    [][]FullSample
+	descIdxs   []uint32 // sample description index per track
+	styp       *StypBox
+	newSegment bool
+}
+
+// Concatenate joins progressive or fragmented files with the same tracks into one file.
+//
+// The files must have the same number of tracks, with the same handler types and timescales,
+// matched in track order. Sample entries must be identical, unless AllowSampleEntrySwitch is set,
+// in which case the output has several stsd entries and samples refer to them by
+// sample_description_index. Each track continues directly after the same track of the
+// previous file, and the edit list of the first file gives the start offset.
+// Fragmented output has renumbered fragments and a merged sidx if any input has one.
+// Sample data must be loaded, so progressive files must not be decoded with lazy mdat.
+func Concatenate(files []*File, opts ConcatOptions) (*File, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to concatenate")
+	}
+	if opts.FragmentDurationMS == 0 {
+		opts.FragmentDurationMS = 2000
+	}
+	moovs := make([]*MoovBox, len(files))
+	for k, f := range files {
+		moovs[k] = f.Moov
+		if f.IsFragmented() && f.Init != nil {
+			moovs[k] = f.Init.Moov
+		}
+		if moovs[k] == nil {
+			return nil, fmt.Errorf("file %d: no moov box", k)
+		}
+		if len(moovs[k].Traks) != len(moovs[0].Traks) {
+			return nil, fmt.Errorf("file %d: %d tracks instead of %d", k, len(moovs[k].Traks), len(moovs[0].Traks))
+		}
+		for i, trak := range moovs[k].Traks {
+			first := moovs[0].Traks[i]
+			if trak.Mdia.Hdlr.HandlerType != first.Mdia.Hdlr.HandlerType {
+				return nil, fmt.Errorf("file %d track %d: handler %s instead of %s", k, i+1,
+					trak.Mdia.Hdlr.HandlerType, first.Mdia.Hdlr.HandlerType)
+			}
+			if trak.Mdia.Mdhd.Timescale != first.Mdia.Mdhd.Timescale {
+				return nil, fmt.Errorf("file %d track %d: timescale %d instead of %d", k, i+1,
+					trak.Mdia.Mdhd.Timescale, first.Mdia.Mdhd.Timescale)
+			}
+		}
+	}
+
+	moov, err := copyMoov(moovs[0])
+	if err != nil {
+		return nil, err
+	}
+	nrTracks := len(moov.Traks)
+	entries := make([][][]byte, nrTracks)
+	for i, trak := range moov.Traks {
+		for _, c := range trak.Mdia.Minf.Stbl.Stsd.Children {
+			b, err := encodeBox(c)
+			if err != nil {
+				return nil, err
+			}
+			entries[i] = append(entries[i], b)
+		}
+	}
+
+	var groups []concatGroup
+	trackEnds := make([]uint64, nrTracks)
+	anySidx := false
+	for k, f := range files {
+		descMaps := make([][]uint32, nrTracks)
+		for i, trak := range moovs[k].Traks {
+			descMaps[i], err = mapSampleEntries(moov.Traks[i], &entries[i], trak.Mdia.Minf.Stbl.Stsd,
+				opts.AllowSampleEntrySwitch)
+			if err != nil {
+				return nil, fmt.Errorf("file %d track %d: %w", k, i+1, err)
+			}
+		}
+		var fileGroups []concatGroup
+		if f.IsFragmented() {
+			anySidx = anySidx || f.Sidx != nil
+			fileGroups, err = fragmentedGroups(f, moovs[k], descMaps)
+		} else {
+			fileGroups, err = progressiveGroups(f, descMaps, opts.FragmentDurationMS, opts.DropIncompleteSamples)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("file %d: %w", k, err)
+		}
+		rebaseGroups(fileGroups, trackEnds)
+		groups = append(groups, fileGroups...)
+	}
+
+	movieTS := moov.Mvhd.Timescale
+	var movieDur uint64
+	for i, trak := range moov.Traks {
+		trak.Mdia.Mdhd.Duration = trackEnds[i]
+		trak.Tkhd.Duration = RescaleTime(trackEnds[i], trak.Mdia.Mdhd.Timescale, movieTS)
+		if trak.Tkhd.Duration > movieDur {
+			movieDur = trak.Tkhd.Duration
+		}
+		offset := moovs[0].Traks[i].Timeline(moovs[0].Mvhd.Timescale).Offset()
+		var edits []TimelineEdit
+		switch {
+		case offset < 0 && uint64(-offset) < trackEnds[i]:
+			edits = []TimelineEdit{{Duration: trackEnds[i] - uint64(-offset), MediaTime: -offset, MediaRate: 0x10000}}
+		case offset > 0:
+			edits = []TimelineEdit{
+				{Duration: uint64(offset), MediaTime: -1, MediaRate: 0x10000},
+				{Duration: trackEnds[i], MediaTime: 0, MediaRate: 0x10000},
+			}
+		}
+		trak.SetEdits(movieTS, edits)
+	}
+	moov.Mvhd.Duration = movieDur
+
+	ftyp := files[0].Ftyp
+	if ftyp == nil && files[0].Init != nil {
+		ftyp = files[0].Init.Ftyp
+	}
+	if ftyp == nil {
+		ftyp = CreateFtyp()
+	}
+	if opts.Fragmented {
+		return writeFragmentedConcat(ftyp, moov, groups, anySidx)
+	}
+	return writeProgressiveConcat(ftyp, moov, groups)
+}
+
+// copyMoov returns a deep copy of moov with empty sample tables.
+// Sample entries and sample group descriptions are kept.
+func copyMoov(in *MoovBox) (*MoovBox, error) {
+	data, err := encodeBox(in)
+	if err != nil {
+		return nil, err
+	}
+	box, err := DecodeBox(0, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	moov := box.(*MoovBox)
+	for _, trak := range moov.Traks {
+		minf := trak.Mdia.Minf
+		stbl := NewStblBox()
+		stbl.AddChild(minf.Stbl.Stsd)
+		stbl.AddChild(&SttsBox{})
+		stbl.AddChild(&StscBox{})
+		stbl.AddChild(&StszBox{})
+		stbl.AddChild(&StcoBox{})
+		for _, c := range minf.Stbl.Children {
+			if c.Type() == "sgpd" {
+				stbl.AddChild(c)
+			}
+		}
+		for j, c := range minf.Children {
+			if c == minf.Stbl {
+				minf.Children[j] = stbl
+			}
+		}
+		minf.Stbl = stbl
+	}
+	return moov, nil
+}
+
+func encodeBox(b Box) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := b.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mapSampleEntries maps the one-based sample entries of stsd to indices in the output track,
+// adding new entries to the output stsd if allowed.
+func mapSampleEntries(outTrak *TrakBox, entries *[][]byte, stsd *StsdBox, allowSwitch bool) ([]uint32, error) {
+	descMap := make([]uint32, len(stsd.Children)+1)
+	for j, c := range stsd.Children {
+		b, err := encodeBox(c)
+		if err != nil {
+			return nil, err
+		}
+		for n, e := range *entries {
+			if bytes.Equal(b, e) {
+				descMap[j+1] = uint32(n + 1)
+				break
+			}
+		}
+		if descMap[j+1] != 0 {
+			continue
+		}
+		if !allowSwitch {
+			return nil, fmt.Errorf("sample entry %s differs from the first file", c.Type())
+		}
+		copied, err := DecodeBox(0, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		// Append without AddChild, so that the typed pointers keep referring to the first entry
+		outStsd := outTrak.Mdia.Minf.Stbl.Stsd
+		outStsd.Children = append(outStsd.Children, copied)
+		outStsd.SampleCount++
+		*entries = append(*entries, b)
+		descMap[j+1] = uint32(len(*entries))
+	}
+	return descMap, nil
+}
+
+// fragmentedGroups returns one group per fragment of a fragmented file.
+func fragmentedGroups(f *File, moov *MoovBox, descMaps [][]uint32) ([]concatGroup, error) {
+	var groups []concatGroup
+	for _, seg := range f.Segments {
+		for fNr, frag := range seg.Fragments {
+			g := concatGroup{
+				samples:    make([][]FullSample, len(moov.Traks)),
+				descIdxs:   make([]uint32, len(moov.Traks)),
+				styp:       seg.Styp,
+				newSegment: fNr == 0,
+			}
+			for i, trak := range moov.Traks {
+				trex, ok := moov.Mvex.GetTrex(trak.Tkhd.TrackID)
+				if !ok {
+					return nil, fmt.Errorf("no trex for track %d", trak.Tkhd.TrackID)
+				}
+				for _, traf := range frag.Moof.Trafs {
+					if traf.Tfhd.TrackID != trak.Tkhd.TrackID {
+						continue
+					}
+					if traf.Senc != nil {
+						return nil, fmt.Errorf("encrypted fragments not supported")
+					}
+					descIdx := trex.DefaultSampleDescriptionIndex
+					if traf.Tfhd.HasSampleDescriptionIndex() {
+						descIdx = traf.Tfhd.SampleDescriptionIndex
+					}
+					if descIdx == 0 || int(descIdx) >= len(descMaps[i]) {
+						return nil, fmt.Errorf("bad sample description index %d", descIdx)
+					}
+					g.descIdxs[i] = descMaps[i][descIdx]
+				}
+				samples, err := frag.GetFullSamples(trex)
+				if err != nil {
+					return nil, err
+				}
+				g.samples[i] = samples
+			}
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+// progressiveGroups splits a progressive file into groups starting at sync samples of the
+// reference track, at least fragDurMS apart. If dropIncomplete is set, each track ends before its
+// first sample with data outside mdat.
+func progressiveGroups(f *File, descMaps [][]uint32, fragDurMS uint32, dropIncomplete bool) ([]concatGroup, error) {
+	if f.Mdat == nil || f.Mdat.IsLazy() {
+		return nil, fmt.Errorf("sample data not loaded")
+	}
+	readers, err := NewSampleReaders(f, nil)
+	if err != nil {
+		return nil, err
+	}
+	refTrak, err := findReferenceTrak(&InitSegment{Moov: f.Moov})
+	if err != nil {
+		return nil, err
+	}
+	refIdx := 0
+	for i, trak := range f.Moov.Traks {
+		if trak == refTrak {
+			refIdx = i
+		}
+	}
+	mdatStart := f.Mdat.PayloadAbsoluteOffset()
+	mdatData := f.Mdat.Data
+	all := make([][]*TrackSample, len(readers))
+	for i, r := range readers {
+		for {
+			s, err := r.Next()
+			if err != nil {
+				break
+			}
+			if s.Offset < mdatStart || s.Offset+uint64(s.Size) > mdatStart+uint64(len(mdatData)) {
+				if dropIncomplete {
+					break
+				}
+				return nil, fmt.Errorf("track %d sample %d: data outside mdat", s.TrackID, s.SampleNr)
+			}
+			s.Data = mdatData[s.Offset-mdatStart : s.Offset-mdatStart+uint64(s.Size)]
+			if int(s.SampleDescriptionIndex) >= len(descMaps[i]) {
+				return nil, fmt.Errorf("track %d: bad sample description index %d", s.TrackID, s.SampleDescriptionIndex)
+			}
+			all[i] = append(all[i], s)
+		}
+	}
+	refTS := readers[refIdx].Timescale()
+	minDur := uint64(fragDurMS) * uint64(refTS) / 1000
+	var starts []uint64 // group start times in reference timescale
+	for j, s := range all[refIdx] {
+		if j == 0 || (s.IsSync() && s.DecodeTime-starts[len(starts)-1] >= minDur) {
+			starts = append(starts, s.DecodeTime)
+		}
+	}
+	if len(starts) == 0 {
+		starts = []uint64{0}
+	}
+	groups := make([]concatGroup, len(starts))
+	for g := range groups {
+		groups[g] = concatGroup{
+			samples:    make([][]FullSample, len(readers)),
+			descIdxs:   make([]uint32, len(readers)),
+			newSegment: true,
+		}
+	}
+	for i, samples := range all {
+		g := 0
+		for _, s := range samples {
+			t := RescaleTime(s.DecodeTime, readers[i].Timescale(), refTS)
+			for g+1 < len(starts) && t >= starts[g+1] {
+				g++
+			}
+			descIdx := descMaps[i][s.SampleDescriptionIndex]
+			if len(groups[g].samples[i]) == 0 {
+				groups[g].descIdxs[i] = descIdx
+			} else if groups[g].descIdxs[i] != descIdx {
+				return nil, fmt.Errorf("track %d: sample description changes inside fragment", s.TrackID)
+			}
+			groups[g].samples[i] = append(groups[g].samples[i], s.FullSample)
+		}
+	}
+	return groups, nil
+}
+
+// rebaseGroups shifts the decode times of a file's groups so that each track continues at trackEnds,
+// and updates trackEnds.
+func rebaseGroups(groups []concatGroup, trackEnds []uint64) {
+	for i := range trackEnds {
+		var first, end uint64
+		found := false
+		for _, g := range groups {
+			for _, s := range g.samples[i] {
+				if !found {
+					first, found = s.DecodeTime, true
+				}
+				end = s.DecodeTime + uint64(s.Dur)
+			}
+		}
+		if !found {
+			continue
+		}
+		for _, g := range groups {
+			for j := range g.samples[i] {
+				g.samples[i][j].DecodeTime = g.samples[i][j].DecodeTime - first + trackEnds[i]
+			}
+		}
+		trackEnds[i] += end - first
+	}
+}
+
+func writeFragmentedConcat(ftyp *FtypBox, moov *MoovBox, groups []concatGroup, addSidx bool) (*File, error) {
+	if moov.Mvex == nil {
+		mvex := NewMvexBox()
+		for _, trak := range moov.Traks {
+			mvex.AddChild(CreateTrex(trak.Tkhd.TrackID))
+		}
+		moov.AddChild(mvex)
+	}
+	if moov.Mvex.Mehd != nil {
+		moov.Mvex.Mehd.FragmentDuration = int64(moov.Mvhd.Duration)
+	}
+	init := NewMP4Init()
+	init.AddChild(ftyp)
+	init.AddChild(moov)
+	out := NewFile()
+	out.isFragmented = true
+	out.Init = init
+	out.Children = append(out.Children, ftyp, moov)
+	var seqNr uint32 = 1
+	var seg *MediaSegment
+	for _, g := range groups {
+		var trackIDs []uint32
+		for i, trak := range moov.Traks {
+			if len(g.samples[i]) > 0 {
+				trackIDs = append(trackIDs, trak.Tkhd.TrackID)
+			}
+		}
+		if len(trackIDs) == 0 {
+			continue
+		}
+		frag, err := CreateMultiTrackFragment(seqNr, trackIDs)
+		if err != nil {
+			return nil, err
+		}
+		seqNr++
+		for i, trak := range moov.Traks {
+			trackID := trak.Tkhd.TrackID
+			for _, s := range g.samples[i] {
+				if err := frag.AddFullSampleToTrack(s, trackID); err != nil {
+					return nil, err
+				}
+			}
+			trex, _ := moov.Mvex.GetTrex(trackID)
+			for _, traf := range frag.Moof.Trafs {
+				if traf.Tfhd.TrackID == trackID && g.descIdxs[i] != 0 && g.descIdxs[i] != trex.DefaultSampleDescriptionIndex {
+					traf.Tfhd.Flags |= TfhdSampleDescriptionIndexPresentFlag
+					traf.Tfhd.SampleDescriptionIndex = g.descIdxs[i]
+				}
+			}
+		}
+		if seg == nil || g.newSegment {
+			if g.styp != nil {
+				seg = NewMediaSegmentWithStyp(g.styp)
+			} else {
+				seg = NewMediaSegment()
+			}
+			out.AddMediaSegment(seg)
+		}
+		seg.AddFragment(frag)
+	}
+	if addSidx && len(out.Segments) > 0 {
+		if err := addNewSidx(out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func writeProgressiveConcat(ftyp *FtypBox, moov *MoovBox, groups []concatGroup) (*File, error) {
+	if moov.Mvex != nil {
+		for j, c := range moov.Children {
+			if c == moov.Mvex {
+				moov.Children = append(moov.Children[:j], moov.Children[j+1:]...)
+				break
+			}
+		}
+		moov.Mvex = nil
+	}
+	mdat := &MdatBox{}
+	var chunkOffsets [][]uint64 // per track, relative to mdat payload
+	chunkOffsets = make([][]uint64, len(moov.Traks))
+	for i, trak := range moov.Traks {
+		stbl := trak.Mdia.Minf.Stbl
+		var ctts *CttsBox
+		var syncNrs []uint32
+		var sampleNr uint32
+		var nrChunks uint32
+		var lastPerChunk, lastDesc uint32
+		hasNonSync := false
+		for _, g := range groups {
+			samples := g.samples[i]
+			if len(samples) == 0 {
+				continue
+			}
+			nrChunks++
+			chunkOffsets[i] = append(chunkOffsets[i], mdat.DataLength())
+			descIdx := g.descIdxs[i]
+			if descIdx == 0 {
+				descIdx = 1
+			}
+			if uint32(len(samples)) != lastPerChunk || descIdx != lastDesc {
+				if err := stbl.Stsc.AddEntry(nrChunks, uint32(len(samples)), descIdx); err != nil {
+					return nil, err
+				}
+				lastPerChunk, lastDesc = uint32(len(samples)), descIdx
+			}
+			for _, s := range samples {
+				sampleNr++
+				stts := stbl.Stts
+				if n := len(stts.SampleCount); n > 0 && stts.SampleTimeDelta[n-1] == s.Dur {
+					stts.SampleCount[n-1]++
+				} else {
+					stts.SampleCount = append(stts.SampleCount, 1)
+					stts.SampleTimeDelta = append(stts.SampleTimeDelta, s.Dur)
+				}
+				if s.CompositionTimeOffset != 0 && ctts == nil {
+					ctts = &CttsBox{}
+					if sampleNr > 1 {
+						_ = ctts.AddSampleCountsAndOffset([]uint32{sampleNr - 1}, []int32{0})
+					}
+				}
+				if ctts != nil {
+					n := len(ctts.SampleOffset)
+					if n > 0 && ctts.SampleOffset[n-1] == s.CompositionTimeOffset {
+						ctts.EndSampleNr[n]++
+					} else {
+						_ = ctts.AddSampleCountsAndOffset([]uint32{1}, []int32{s.CompositionTimeOffset})
+					}
+					if s.CompositionTimeOffset < 0 {
+						ctts.Version = 1
+					}
+				}
+				if DecodeSampleFlags(s.Flags).SampleIsNonSync {
+					hasNonSync = true
+				} else {
+					syncNrs = append(syncNrs, sampleNr)
+				}
+				stbl.Stsz.SampleSize = append(stbl.Stsz.SampleSize, s.Size)
+				mdat.AddSampleData(s.Data)
+			}
+		}
+		stbl.Stsz.SampleNumber = sampleNr
+		if hasNonSync {
+			insertStblChild(stbl, &StssBox{SampleNumber: syncNrs}, "stts")
+		}
+		if ctts != nil {
+			insertStblChild(stbl, ctts, "stts")
+		}
+	}
+
+	useCo64 := mdat.DataLength() >= 1<<32-1<<20
+	if useCo64 {
+		for _, trak := range moov.Traks {
+			stbl := trak.Mdia.Minf.Stbl
+			co64 := &Co64Box{}
+			for j, c := range stbl.Children {
+				if c == stbl.Stco {
+					stbl.Children[j] = co64
+				}
+			}
+			stbl.Stco = nil
+			stbl.Co64 = co64
+		}
+	}
+	for i, trak := range moov.Traks {
+		stbl := trak.Mdia.Minf.Stbl
+		if useCo64 {
+			stbl.Co64.ChunkOffset = make([]uint64, len(chunkOffsets[i]))
+		} else {
+			stbl.Stco.ChunkOffset = make([]uint32, len(chunkOffsets[i]))
+		}
+	}
+	base := ftyp.Size() + moov.Size() + mdat.HeaderSize()
+	for i, trak := range moov.Traks {
+		stbl := trak.Mdia.Minf.Stbl
+		for j, o := range chunkOffsets[i] {
+			if useCo64 {
+				stbl.Co64.ChunkOffset[j] = base + o
+			} else {
+				stbl.Stco.ChunkOffset[j] = uint32(base + o)
+			}
+		}
+	}
+	out := NewFile()
+	out.AddChild(ftyp, 0)
+	out.AddChild(moov, ftyp.Size())
+	out.AddChild(mdat, ftyp.Size()+moov.Size())
+	return out, nil
+}
+
+// insertStblChild inserts box into stbl after the child of type after.
+func insertStblChild(stbl *StblBox, box Box, after string) {
+	stbl.AddChild(box)
+	children := stbl.Children[:len(stbl.Children)-1]
+	pos := len(children)
+	for j, c := range children {
+		if c.Type() == after {
+			pos = j + 1
+			break
+		}
+	}
+	stbl.Children = append(children[:pos], append([]Box{box}, children[pos:]...)...)
+}
@@ -0,0 +1,203 @@
+package mp4_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/aac"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// createConcatInput creates a two-track fragmented file with sample entries.
+func createConcatInput(t *testing.T, nrSegs, audioFreq int) *mp4.File {
+	t.Helper()
+	f := createTwoTrackFile(t, nrSegs)
+	traks := f.Init.Moov.Traks
+	if err := traks[0].SetMJpegDescriptor(640, 360, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := traks[1].SetAACDescriptor(aac.AAClc, audioFreq); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func encodeAndDecode(t *testing.T, f *mp4.File) *mp4.File {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := f.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dec
+}
+
+func TestConcatenateFragmented(t *testing.T) {
+	in := []*mp4.File{createConcatInput(t, 2, 48000), createConcatInput(t, 3, 48000)}
+	out, err := mp4.Concatenate(in, mp4.ConcatOptions{Fragmented: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := encodeAndDecode(t, out)
+	if len(dec.Segments) != 5 {
+		t.Fatalf("got %d segments instead of 5", len(dec.Segments))
+	}
+	if dec.Sidx == nil || len(dec.Sidx.SidxRefs) != 5 {
+		t.Fatalf("bad sidx %+v", dec.Sidx)
+	}
+	moov := dec.Init.Moov
+	if d := moov.Traks[0].Tkhd.Duration; d != 2000 {
+		t.Errorf("got video duration %d instead of 2000", d)
+	}
+	var audioEnd uint64
+	for i, seg := range dec.Segments {
+		frag := seg.Fragments[0]
+		if frag.Moof.Mfhd.SequenceNumber != uint32(i+1) {
+			t.Errorf("segment %d: sequence number %d", i, frag.Moof.Mfhd.SequenceNumber)
+		}
+		if tfdt := frag.Moof.Trafs[0].Tfdt.BaseMediaDecodeTime(); tfdt != uint64(i)*36000 {
+			t.Errorf("segment %d: video tfdt %d", i, tfdt)
+		}
+		audio, err := frag.GetFullSamples(moov.Mvex.Trexs[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if audio[0].DecodeTime != audioEnd {
+			t.Errorf("segment %d: audio tfdt %d instead of %d", i, audio[0].DecodeTime, audioEnd)
+		}
+		last := audio[len(audio)-1]
+		audioEnd = last.DecodeTime + uint64(last.Dur)
+	}
+}
+
+func TestConcatenateSampleEntrySwitch(t *testing.T) {
+	in := []*mp4.File{createConcatInput(t, 1, 48000), createConcatInput(t, 1, 44100)}
+	if _, err := mp4.Concatenate(in, mp4.ConcatOptions{Fragmented: true}); err == nil {
+		t.Fatalf("expected error for different sample entries")
+	}
+	for _, fragmented := range []bool{true, false} {
+		out, err := mp4.Concatenate(in, mp4.ConcatOptions{Fragmented: fragmented, AllowSampleEntrySwitch: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := encodeAndDecode(t, out)
+		if fragmented {
+			stsd := dec.Init.Moov.Traks[1].Mdia.Minf.Stbl.Stsd
+			if stsd.SampleCount != 2 || len(stsd.Children) != 2 {
+				t.Fatalf("got %d sample entries instead of 2", len(stsd.Children))
+			}
+			tfhd := dec.Segments[1].Fragments[0].Moof.Trafs[1].Tfhd
+			if !tfhd.HasSampleDescriptionIndex() || tfhd.SampleDescriptionIndex != 2 {
+				t.Errorf("second fragment: bad sample description index in %+v", tfhd)
+			}
+			continue
+		}
+		readers, err := mp4.NewSampleReaders(dec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var descIdxs []uint32
+		for {
+			s, err := readers[1].Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(descIdxs) == 0 || descIdxs[len(descIdxs)-1] != s.SampleDescriptionIndex {
+				descIdxs = append(descIdxs, s.SampleDescriptionIndex)
+			}
+		}
+		if len(descIdxs) != 2 || descIdxs[0] != 1 || descIdxs[1] != 2 {
+			t.Errorf("got sample description indices %v instead of [1 2]", descIdxs)
+		}
+	}
+}
+
+func TestConcatenateProgressive(t *testing.T) {
+	prog, err := mp4.ReadMP4File("testdata/prog_8s.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := mp4.Concatenate([]*mp4.File{prog, prog}, mp4.ConcatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := encodeAndDecode(t, out)
+	if dec.IsFragmented() {
+		t.Fatalf("output is fragmented")
+	}
+	for i, trak := range dec.Moov.Traks {
+		inTrak := prog.Moov.Traks[i]
+		inStbl, stbl := inTrak.Mdia.Minf.Stbl, trak.Mdia.Minf.Stbl
+		if stbl.Stsz.SampleNumber != 2*inStbl.Stsz.SampleNumber {
+			t.Errorf("track %d: got %d samples instead of %d", i+1, stbl.Stsz.SampleNumber, 2*inStbl.Stsz.SampleNumber)
+		}
+		if trak.Mdia.Mdhd.Duration != 2*inTrak.Mdia.Mdhd.Duration {
+			t.Errorf("track %d: got duration %d instead of %d", i+1, trak.Mdia.Mdhd.Duration, 2*inTrak.Mdia.Mdhd.Duration)
+		}
+		if (inStbl.Stss == nil) != (stbl.Stss == nil) {
+			t.Errorf("track %d: stss presence changed", i+1)
+		}
+	}
+	inReaders, err := mp4.NewSampleReaders(prog, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers, err := mp4.NewSampleReaders(dec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inData := prog.Mdat.Data
+	data := dec.Mdat.Data
+	for i, r := range readers {
+		inR := inReaders[i]
+		n := inR.NrSamples()
+		for nr := uint32(0); nr < 2*n; nr++ {
+			if nr == n {
+				if err := inR.SeekToSample(1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			inS, err := inR.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := r.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantTime := inS.DecodeTime
+			if nr >= n {
+				wantTime += prog.Moov.Traks[i].Mdia.Mdhd.Duration
+			}
+			if s.DecodeTime != wantTime || s.CompositionTimeOffset != inS.CompositionTimeOffset || s.IsSync() != inS.IsSync() {
+				t.Fatalf("track %d sample %d: got %+v instead of %+v", i+1, nr+1, s.Sample, inS.Sample)
+			}
+			inStart := inS.Offset - prog.Mdat.PayloadAbsoluteOffset()
+			start := s.Offset - dec.Mdat.PayloadAbsoluteOffset()
+			if !bytes.Equal(data[start:start+uint64(s.Size)], inData[inStart:inStart+uint64(inS.Size)]) {
+				t.Fatalf("track %d sample %d: data differs", i+1, nr+1)
+			}
+		}
+	}
+}
+
+func TestConcatenateMismatch(t *testing.T) {
+	prog, err := mp4.ReadMP4File("testdata/prog_8s.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frag := createConcatInput(t, 1, 48000)
+	if _, err := mp4.Concatenate([]*mp4.File{prog, frag}, mp4.ConcatOptions{}); err == nil {
+		t.Errorf("expected error for different tracks")
+	}
+	if _, err := mp4.Concatenate(nil, mp4.ConcatOptions{}); err == nil {
+		t.Errorf("expected error for no files")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/Eyevinn/mp4ff/av1"
 	"github.com/Eyevinn/mp4ff/avc"
@@ -345,6 +347,45 @@ func incrementIVInPlace(iv []byte, nrSteps int) {
 	}
 }
 
+// forEachParallel calls fn(i) for i in [0, n) on at most workers goroutines and returns the
+// error of the lowest failing index. workers <= 1 calls fn sequentially in index order.
+func forEachParallel(n, workers int, fn func(i int) error) error {
+	if workers <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if workers > n {
+		workers = n
+	}
+	errs := make([]error, n)
+	next := int64(-1)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // sampleProtector computes the common-encryption protection ranges for each sample of one
 // continuous decode sequence, fed in decode order. It may hold mutable state - AV1 accumulates
 // reference-frame sizes across samples - so a protector must be used by a single goroutine and
@@ -610,6 +651,7 @@ type FragmentEncryptor struct {
 	iv      []byte
 	iv8Mode bool
 	prot    sampleProtector
+	workers int
 }
 
 // NewFragmentEncryptor validates the key/iv against the scheme and builds a fresh sample protector
@@ -655,6 +697,13 @@ func (e *FragmentEncryptor) IV() []byte {
 	return e.iv
 }
 
+// SetWorkers sets the number of goroutines that encrypt the samples of a fragment in parallel.
+// Protection ranges and per-sample IVs are still computed in decode order, so the output is
+// byte-identical to sequential encryption. n <= 1 (the default) means sequential encryption.
+func (e *FragmentEncryptor) SetWorkers(n int) {
+	e.workers = n
+}
+
 // EncryptFragment encrypts one fragment in place and advances the internal IV. Call it once per
 // fragment of the sequence, in decode order.
 func (e *FragmentEncryptor) EncryptFragment(f *Fragment) error {
@@ -687,27 +736,24 @@ func (e *FragmentEncryptor) EncryptFragment(f *Fragment) error {
 		return fmt.Errorf("get full samples: %w", err)
 	}
 
-	for _, fs := range fss {
+	// Protection ranges and IVs are computed in decode order, since the sample protector may carry
+	// state across samples. Only the sample encryption itself is distributed over the workers.
+	subsamplePatterns := make([][]SubSamplePattern, len(fss))
+	ivs := make([][]byte, len(fss))
+	for i, fs := range fss {
 		sample := fs.Data
-		subsamplePatterns, err := e.prot.protectRanges(sample, ipd.Scheme)
+		subsamplePatterns[i], err = e.prot.protectRanges(sample, ipd.Scheme)
 		if err != nil {
 			return fmt.Errorf("get protect ranges: %w", err)
 		}
 		switch ipd.Scheme {
 		case "cenc":
-			ctrIV := iv
-			if e.iv8Mode {
-				ctrIV = make([]byte, 16)
-				copy(ctrIV, iv)
-			}
-			if err := CryptSampleCenc(sample, e.key, ctrIV, subsamplePatterns); err != nil {
-				return fmt.Errorf("crypt sample cenc: %w", err)
-			}
+			ivs[i] = iv
 			// Store IVs in the senc box and advance the IV for the next sample
-			if err := senc.AddSample(SencSample{IV: iv, SubSamples: subsamplePatterns}); err != nil {
+			if err := senc.AddSample(SencSample{IV: iv, SubSamples: subsamplePatterns[i]}); err != nil {
 				return fmt.Errorf("senc add sample: %w", err)
 			}
-			if err := saiz.AddSampleInfo(iv, subsamplePatterns); err != nil {
+			if err := saiz.AddSampleInfo(iv, subsamplePatterns[i]); err != nil {
 				return fmt.Errorf("saiz add sample info: %w", err)
 			}
 			if e.iv8Mode {
@@ -716,23 +762,42 @@ func (e *FragmentEncryptor) EncryptFragment(f *Fragment) error {
 				incrementIVInPlace(nextIV, 1)
 				iv = nextIV
 			} else {
-				iv = incrementIV(iv, subsamplePatterns, len(sample))
+				iv = incrementIV(iv, subsamplePatterns[i], len(sample))
 			}
 		case "cbcs":
-			if err := EncryptSampleCbcs(sample, e.key, iv, subsamplePatterns, ipd.Tenc); err != nil {
-				return fmt.Errorf("crypt sample cbcs: %w", err)
-			}
+			ivs[i] = iv
 			// iv is constant and not sent to senc
-			if err := senc.AddSample(SencSample{IV: nil, SubSamples: subsamplePatterns}); err != nil {
+			if err := senc.AddSample(SencSample{IV: nil, SubSamples: subsamplePatterns[i]}); err != nil {
 				return fmt.Errorf("senc add sample: %w", err)
 			}
-			if err := saiz.AddSampleInfo(nil, subsamplePatterns); err != nil {
+			if err := saiz.AddSampleInfo(nil, subsamplePatterns[i]); err != nil {
 				return fmt.Errorf("saiz add sample info: %w", err)
 			}
 		default:
 			return fmt.Errorf("unknown scheme %s", ipd.Scheme)
 		}
 	}
+	err = forEachParallel(len(fss), e.workers, func(i int) error {
+		switch ipd.Scheme {
+		case "cenc":
+			ctrIV := ivs[i]
+			if e.iv8Mode {
+				ctrIV = make([]byte, 16)
+				copy(ctrIV, ivs[i])
+			}
+			if err := CryptSampleCenc(fss[i].Data, e.key, ctrIV, subsamplePatterns[i]); err != nil {
+				return fmt.Errorf("crypt sample cenc: %w", err)
+			}
+		case "cbcs":
+			if err := EncryptSampleCbcs(fss[i].Data, e.key, ivs[i], subsamplePatterns[i], ipd.Tenc); err != nil {
+				return fmt.Errorf("crypt sample cbcs: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 	e.iv = iv
 	if len(senc.IVs) == 0 && len(senc.SubSamples) == 0 {
 		// No sample auxiliary information (full-sample encryption with a constant IV): CMAF
@@ -790,6 +855,9 @@ func EncryptFragment(f *Fragment, key, iv []byte, ipd *InitProtectData) ([]byte,
 type DecryptInfo struct {
 	Psshs      []*PsshBox
 	TrackInfos []DecryptTrackInfo
+	// Workers - number of goroutines decrypting the samples of a track in a fragment in parallel.
+	// 0 or 1 means sequential decryption
+	Workers int
 }
 
 type DecryptTrackInfo struct {
@@ -1019,7 +1087,7 @@ func DecryptFragmentWithKeys(frag *Fragment, di DecryptInfo, key []byte, keysByK
 				senc = traf.UUIDSenc.Senc
 			}
 
-			err = decryptSamplesInPlace(schemeType, samples, trackKey, tenc, senc)
+			err = decryptSamplesInPlace(schemeType, samples, trackKey, tenc, senc, di.Workers)
 			if err != nil {
 				return err
 			}
@@ -1040,30 +1108,25 @@ func DecryptFragmentWithKeys(frag *Fragment, di DecryptInfo, key []byte, keysByK
 	return nil
 }
 
-// decryptSample - decrypt samples inplace
-func decryptSamplesInPlace(schemeType string, samples []FullSample, key []byte, tenc *TencBox, senc *SencBox) error {
+// decryptSamplesInPlace - decrypt samples inplace using at most workers goroutines
+func decryptSamplesInPlace(schemeType string, samples []FullSample, key []byte, tenc *TencBox, senc *SencBox,
+	workers int) error {
 
 	// TODO. Interpret saio and saiz to get to the right place
 	// Saio tells where the IV starts relative to moof start
 	// It typically ends up inside senc (16 bytes after start)
 
-	iv := make([]byte, 16)
+	constIV := make([]byte, 16)
 	if tenc.DefaultConstantIV != nil {
-		copy(iv, tenc.DefaultConstantIV)
+		copy(constIV, tenc.DefaultConstantIV)
 	}
 
-	for i := range samples {
+	return forEachParallel(len(samples), workers, func(i int) error {
+		iv := constIV
 		if senc != nil && len(senc.IVs) == len(samples) {
-			if len(senc.IVs[i]) < 16 {
-				for i := 0; i < 16; i++ {
-					iv[i] = 0
-				}
-			}
+			iv = make([]byte, 16)
 			copy(iv, senc.IVs[i])
 		}
-		if len(iv) == 0 {
-			return fmt.Errorf("iv has length 0")
-		}
 
 		var subSamplePatterns []SubSamplePattern
 		if senc != nil && len(senc.SubSamples) != 0 {
@@ -1071,18 +1134,12 @@ func decryptSamplesInPlace(schemeType string, samples []FullSample, key []byte,
 		}
 		switch schemeType {
 		case "cenc":
-			err := CryptSampleCenc(samples[i].Data, key, iv, subSamplePatterns)
-			if err != nil {
-				return err
-			}
+			return CryptSampleCenc(samples[i].Data, key, iv, subSamplePatterns)
 		case "cbcs":
-			err := DecryptSampleCbcs(samples[i].Data, key, iv, subSamplePatterns, tenc)
-			if err != nil {
-				return err
-			}
+			return DecryptSampleCbcs(samples[i].Data, key, iv, subSamplePatterns, tenc)
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 // ExtractInitProtectData extracts protection data from init segment
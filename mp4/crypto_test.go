@@ -777,3 +777,163 @@ func TestEncryptFragmentNoAuxInfoOmitsBoxes(t *testing.T) {
 			traf.Senc != nil, traf.Saiz != nil, traf.Saio != nil)
 	}
 }
+
+// encryptSegmentFile encrypts all fragments of segFile with the given number of workers and
+// returns the encrypted init and media segments.
+func encryptSegmentFile(t testing.TB, initFile, segFile, scheme string, key, iv []byte, workers int) (*mp4.File, []byte) {
+	t.Helper()
+	kidUUID, _ := mp4.NewUUIDFromString("11112222333344445555666677778888")
+	init, err := mp4.ReadMP4File(initFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipd, err := mp4.InitProtect(init.Init, key, iv, scheme, kidUUID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seg, err := mp4.ReadMP4File(segFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := ipd.NewFragmentEncryptor(key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc.SetWorkers(workers)
+	for _, s := range seg.Segments {
+		for _, f := range s.Fragments {
+			if err := enc.EncryptFragment(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := seg.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return init, buf.Bytes()
+}
+
+func TestEncryptDecryptParallel(t *testing.T) {
+	key, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	iv8, _ := hex.DecodeString("7766554433221100")
+	iv16, _ := hex.DecodeString("ffeeddccbbaa99887766554433221100")
+	testCases := []struct {
+		desc   string
+		init   string
+		seg    string
+		scheme string
+		iv     []byte
+	}{
+		{desc: "AVC cenc iv8", init: "testdata/init.mp4", seg: "testdata/1.m4s", scheme: "cenc", iv: iv8},
+		{desc: "AVC cenc iv16", init: "testdata/init.mp4", seg: "testdata/1.m4s", scheme: "cenc", iv: iv16},
+		{desc: "HEVC cbcs", init: "testdata/hvc1_init.mp4", seg: "testdata/hvc1_seg_1.m4s", scheme: "cbcs", iv: iv16},
+		{desc: "AV1 cenc", init: "testdata/av1_multitile_init.mp4", seg: "testdata/av1_multitile_seg.m4s",
+			scheme: "cenc", iv: iv16},
+		{desc: "AAC cbcs", init: "testdata/aac_init.mp4", seg: "testdata/aac_1.m4s", scheme: "cbcs", iv: iv16},
+	}
+	for _, c := range testCases {
+		t.Run(c.desc, func(t *testing.T) {
+			_, seqSeg := encryptSegmentFile(t, c.init, c.seg, c.scheme, key, c.iv, 1)
+			encInit, parSeg := encryptSegmentFile(t, c.init, c.seg, c.scheme, key, c.iv, 4)
+			if !bytes.Equal(seqSeg, parSeg) {
+				t.Fatalf("parallel encryption differs from sequential")
+			}
+			di, err := mp4.DecryptInit(encInit.Init)
+			if err != nil {
+				t.Fatal(err)
+			}
+			di.Workers = 4
+			dec, err := mp4.DecodeFile(bytes.NewReader(parSeg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := mp4.DecryptSegment(dec.Segments[0], di, key); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := dec.Encode(&buf); err != nil {
+				t.Fatal(err)
+			}
+			rawSeg, err := os.ReadFile(c.seg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), rawSeg) {
+				t.Errorf("segment not equal after parallel encryption+decryption")
+			}
+		})
+	}
+}
+
+func BenchmarkEncryptFragment(b *testing.B) {
+	key, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	iv, _ := hex.DecodeString("7766554433221100")
+	kidUUID, _ := mp4.NewUUIDFromString("11112222333344445555666677778888")
+	init, err := mp4.ReadMP4File("testdata/hvc1_init.mp4")
+	if err != nil {
+		b.Fatal(err)
+	}
+	ipd, err := mp4.InitProtect(init.Init, key, iv, "cenc", kidUUID, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	rawSeg, err := os.ReadFile("testdata/hvc1_seg_1.m4s")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(rawSeg)))
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				seg, err := mp4.DecodeFile(bytes.NewReader(rawSeg))
+				if err != nil {
+					b.Fatal(err)
+				}
+				enc, err := ipd.NewFragmentEncryptor(key, iv)
+				if err != nil {
+					b.Fatal(err)
+				}
+				enc.SetWorkers(workers)
+				b.StartTimer()
+				for _, s := range seg.Segments {
+					for _, f := range s.Fragments {
+						if err := enc.EncryptFragment(f); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecryptFragment(b *testing.B) {
+	key, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	iv, _ := hex.DecodeString("7766554433221100")
+	encInit, encSeg := encryptSegmentFile(b, "testdata/hvc1_init.mp4", "testdata/hvc1_seg_1.m4s", "cenc", key, iv, 1)
+	di, err := mp4.DecryptInit(encInit.Init)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			di.Workers = workers
+			b.SetBytes(int64(len(encSeg)))
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				seg, err := mp4.DecodeFile(bytes.NewReader(encSeg))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				for _, s := range seg.Segments {
+					if err := mp4.DecryptSegment(s, di, key); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
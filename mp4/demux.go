@@ -0,0 +1,334 @@
+package mp4
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DemuxOptions - options for Demux
+type DemuxOptions struct {
+	// FragmentDurationMS - minimum fragment duration when fragmenting progressive input. 0 means 2000
+	FragmentDurationMS uint32
+	// AddSidx - add a sidx box to each output even if the input has none
+	AddSidx bool
+}
+
+// Demux splits a progressive or fragmented multi-track file into one fragmented single-track file
+// per track, in the order of the input traks. Each output has an init segment and media segments,
+// and can be written as one CMAF track file, or as separate init and media segment files.
+//
+// The track ID is changed to 1 and references to other tracks (tref) are removed.
+// pssh boxes are kept for encrypted tracks, unless they list key IDs not including the default KID
+// of the track. Fragmented input keeps segment and fragment structure, sequence numbers, and all
+// traf boxes including senc, saiz, saio, sgpd, sbgp and subs. emsg boxes go to the reference track
+// (video if present, otherwise audio) and prft boxes to the track they refer to.
+// Progressive input is fragmented at sync samples of the reference track, aligned between tracks.
+// A sidx box is generated per output if the input has one or AddSidx is set.
+// Sample data must be loaded, so the input must not be decoded with lazy mdat.
+func Demux(f *File, opts DemuxOptions) ([]*File, error) {
+	if opts.FragmentDurationMS == 0 {
+		opts.FragmentDurationMS = 2000
+	}
+	inMoov := f.Moov
+	ftyp := f.Ftyp
+	if f.IsFragmented() && f.Init != nil {
+		inMoov, ftyp = f.Init.Moov, f.Init.Ftyp
+	}
+	if inMoov == nil {
+		return nil, fmt.Errorf("no moov box")
+	}
+	if ftyp == nil {
+		ftyp = CreateFtyp()
+	}
+	var groups []concatGroup
+	if !f.IsFragmented() {
+		descMaps := make([][]uint32, len(inMoov.Traks))
+		for i, trak := range inMoov.Traks {
+			descMaps[i] = make([]uint32, len(trak.Mdia.Minf.Stbl.Stsd.Children)+1)
+			for j := range descMaps[i] {
+				descMaps[i][j] = uint32(j)
+			}
+		}
+		var err error
+		groups, err = progressiveGroups(f, descMaps, opts.FragmentDurationMS, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	refTrak, err := findReferenceTrak(&InitSegment{Moov: inMoov})
+	if err != nil {
+		return nil, err
+	}
+	outs := make([]*File, 0, len(inMoov.Traks))
+	for i, inTrak := range inMoov.Traks {
+		init, err := demuxInit(ftyp, inMoov, i)
+		if err != nil {
+			return nil, fmt.Errorf("track %d: %w", inTrak.Tkhd.TrackID, err)
+		}
+		out := NewFile()
+		out.isFragmented = true
+		out.Init = init
+		out.Children = append(out.Children, init.Ftyp, init.Moov)
+		if f.IsFragmented() {
+			err = demuxFragments(f, inMoov, inTrak, inTrak == refTrak, out)
+		} else {
+			err = demuxGroups(groups, i, out)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("track %d: %w", inTrak.Tkhd.TrackID, err)
+		}
+		if (f.Sidx != nil || opts.AddSidx) && len(out.Segments) > 0 {
+			if err := addNewSidx(out); err != nil {
+				return nil, fmt.Errorf("track %d: %w", inTrak.Tkhd.TrackID, err)
+			}
+		}
+		outs = append(outs, out)
+	}
+	return outs, nil
+}
+
+// demuxInit returns an init segment with trak number trakIdx of inMoov as track 1.
+func demuxInit(ftyp *FtypBox, inMoov *MoovBox, trakIdx int) (*InitSegment, error) {
+	inTrackID := inMoov.Traks[trakIdx].Tkhd.TrackID
+	moov, err := copyMoov(inMoov)
+	if err != nil {
+		return nil, err
+	}
+	trak := moov.Traks[trakIdx]
+	trak.Tkhd.TrackID = 1
+	for j := 0; j < len(trak.Children); j++ {
+		if trak.Children[j].Type() == "tref" {
+			trak.Children = append(trak.Children[:j], trak.Children[j+1:]...)
+			j--
+		}
+	}
+	moov.Mvhd.NextTrackID = 2
+	var kid UUID
+	encrypted := false
+	if sinf := moov.GetSinf(1); sinf != nil && sinf.Schi != nil && sinf.Schi.Tenc != nil {
+		kid, encrypted = sinf.Schi.Tenc.DefaultKID, true
+	}
+	trex := CreateTrex(1)
+	mvex := NewMvexBox()
+	if moov.Mvex != nil {
+		if moov.Mvex.Mehd != nil {
+			mvex.AddChild(moov.Mvex.Mehd)
+		}
+		if inTrex, ok := moov.Mvex.GetTrex(inTrackID); ok {
+			trex = inTrex
+			trex.TrackID = 1
+		}
+	}
+	mvex.AddChild(trex)
+
+	out := NewMoovBox()
+	for _, c := range moov.Children {
+		switch box := c.(type) {
+		case *TrakBox:
+			if box == trak {
+				out.AddChild(box)
+			}
+		case *MvexBox:
+			// Added last
+		case *PsshBox:
+			if psshForKID(box, encrypted, kid) {
+				out.AddChild(box)
+			}
+		default:
+			out.AddChild(c)
+		}
+	}
+	out.AddChild(mvex)
+	init := NewMP4Init()
+	init.AddChild(ftyp)
+	init.AddChild(out)
+	return init, nil
+}
+
+// psshForKID - true if pssh applies to an encrypted track with default key ID kid
+func psshForKID(pssh *PsshBox, encrypted bool, kid UUID) bool {
+	if !encrypted {
+		return false
+	}
+	if len(pssh.KIDs) == 0 {
+		return true
+	}
+	for _, k := range pssh.KIDs {
+		if bytes.Equal(k, kid) {
+			return true
+		}
+	}
+	return false
+}
+
+// demuxFragments adds the fragments of inTrak in f to out.
+func demuxFragments(f *File, inMoov *MoovBox, inTrak *TrakBox, isRef bool, out *File) error {
+	inTrackID := inTrak.Tkhd.TrackID
+	var inTrex *TrexBox
+	if inMoov.Mvex != nil {
+		inTrex, _ = inMoov.Mvex.GetTrex(inTrackID)
+	}
+	if inTrex == nil {
+		return fmt.Errorf("no trex")
+	}
+	var kid UUID
+	encrypted := false
+	if sinf := inMoov.GetSinf(inTrackID); sinf != nil && sinf.Schi != nil && sinf.Schi.Tenc != nil {
+		kid, encrypted = sinf.Schi.Tenc.DefaultKID, true
+	}
+	for _, seg := range f.Segments {
+		var outSeg *MediaSegment
+		for _, frag := range seg.Fragments {
+			var inTraf *TrafBox
+			for _, traf := range frag.Moof.Trafs {
+				if traf.Tfhd.TrackID == inTrackID {
+					inTraf = traf
+				}
+			}
+			if inTraf == nil {
+				continue
+			}
+			samples, err := frag.GetFullSamples(inTrex)
+			if err != nil {
+				return err
+			}
+			outFrag, err := demuxFragment(frag, inTraf, samples, isRef, encrypted, kid)
+			if err != nil {
+				return fmt.Errorf("fragment %d: %w", frag.Moof.Mfhd.SequenceNumber, err)
+			}
+			if outSeg == nil {
+				if seg.Styp != nil {
+					outSeg = NewMediaSegmentWithStyp(seg.Styp)
+				} else {
+					outSeg = NewMediaSegmentWithoutStyp()
+				}
+				out.AddMediaSegment(outSeg)
+			}
+			outSeg.AddFragment(outFrag)
+		}
+	}
+	return nil
+}
+
+// demuxFragment returns a single-track fragment with a copy of inTraf as track 1.
+func demuxFragment(frag *Fragment, inTraf *TrafBox, samples []FullSample, isRef, encrypted bool,
+	kid UUID) (*Fragment, error) {
+	data, err := encodeBox(inTraf)
+	if err != nil {
+		return nil, err
+	}
+	box, err := DecodeBox(0, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	traf := box.(*TrafBox)
+	traf.Tfhd.TrackID = 1
+	traf.Tfhd.Flags = traf.Tfhd.Flags&^TfhdBaseDataOffsetPresentFlag | TfhdDefaultBaseIsMoofFlag
+	traf.Tfhd.BaseDataOffset = 0
+
+	outFrag := NewFragment()
+	for _, c := range frag.Children {
+		switch box := c.(type) {
+		case *EmsgBox:
+			if isRef {
+				outFrag.AddChild(box)
+			}
+		case *PrftBox:
+			if box.ReferenceTrackID == inTraf.Tfhd.TrackID {
+				prft := *box
+				prft.ReferenceTrackID = 1
+				outFrag.AddChild(&prft)
+			}
+		}
+	}
+	moof := &MoofBox{}
+	_ = moof.AddChild(CreateMfhd(frag.Moof.Mfhd.SequenceNumber))
+	for _, pssh := range frag.Moof.Psshs {
+		if psshForKID(pssh, encrypted, kid) {
+			_ = moof.AddChild(pssh)
+		}
+	}
+	if err := moof.AddChild(traf); err != nil {
+		return nil, err
+	}
+	mdat := &MdatBox{}
+	for _, s := range samples {
+		mdat.AddSampleData(s.Data)
+	}
+	outFrag.AddChild(moof)
+	outFrag.AddChild(mdat)
+
+	if traf.Saio != nil {
+		offset, err := sencDataOffset(moof, traf)
+		if err != nil {
+			return nil, err
+		}
+		traf.Saio.Offset = []int64{int64(offset)}
+	}
+	dataOffset := moof.Size() + mdat.HeaderSize()
+	sampleNr := 0
+	for _, trun := range traf.Truns {
+		trun.Flags |= TrunDataOffsetPresentFlag
+		trun.DataOffset = int32(dataOffset)
+		for j := uint32(0); j < trun.SampleCount(); j++ {
+			if sampleNr >= len(samples) {
+				return nil, fmt.Errorf("more trun samples than data")
+			}
+			dataOffset += uint64(samples[sampleNr].Size)
+			sampleNr++
+		}
+	}
+	return outFrag, nil
+}
+
+// sencDataOffset returns the offset from moof start to the sample data in the senc box of traf.
+func sencDataOffset(moof *MoofBox, traf *TrafBox) (uint64, error) {
+	offset := uint64(boxHeaderSize)
+	for _, c := range moof.Children {
+		if c != traf {
+			offset += c.Size()
+			continue
+		}
+		offset += boxHeaderSize
+		for _, tc := range traf.Children {
+			switch box := tc.(type) {
+			case *SencBox:
+				return offset + boxHeaderSize + 8, nil
+			case *UUIDBox:
+				if box.SubType() == "senc" {
+					return offset + boxHeaderSize + 16 + 8, nil
+				}
+			}
+			offset += tc.Size()
+		}
+	}
+	return 0, fmt.Errorf("saio without senc box not supported")
+}
+
+// demuxGroups adds one fragment per group with samples of track number trakIdx to out.
+func demuxGroups(groups []concatGroup, trakIdx int, out *File) error {
+	var seqNr uint32 = 1
+	for _, g := range groups {
+		samples := g.samples[trakIdx]
+		if len(samples) == 0 {
+			continue
+		}
+		frag, err := CreateFragment(seqNr, 1)
+		if err != nil {
+			return err
+		}
+		seqNr++
+		for _, s := range samples {
+			frag.AddFullSample(s)
+		}
+		if g.descIdxs[trakIdx] > 1 {
+			tfhd := frag.Moof.Traf.Tfhd
+			tfhd.Flags |= TfhdSampleDescriptionIndexPresentFlag
+			tfhd.SampleDescriptionIndex = g.descIdxs[trakIdx]
+		}
+		seg := NewMediaSegment()
+		seg.AddFragment(frag)
+		out.AddMediaSegment(seg)
+	}
+	return nil
+}
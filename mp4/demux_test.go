@@ -0,0 +1,142 @@
+package mp4_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// trackSamples returns all samples of track trackID in a fragmented file.
+func trackSamples(t *testing.T, f *mp4.File, trackID uint32) []mp4.FullSample {
+	t.Helper()
+	trex, ok := f.Init.Moov.Mvex.GetTrex(trackID)
+	if !ok {
+		t.Fatalf("no trex for track %d", trackID)
+	}
+	var samples []mp4.FullSample
+	for _, seg := range f.Segments {
+		for _, frag := range seg.Fragments {
+			fs, err := frag.GetFullSamples(trex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			samples = append(samples, fs...)
+		}
+	}
+	return samples
+}
+
+func compareSamples(t *testing.T, got, want []mp4.FullSample) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d samples instead of %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i].DecodeTime != want[i].DecodeTime || got[i].Sample != want[i].Sample ||
+			!bytes.Equal(got[i].Data, want[i].Data) {
+			t.Fatalf("sample %d differs: got %+v instead of %+v", i+1, got[i].Sample, want[i].Sample)
+		}
+	}
+}
+
+func TestDemuxFragmented(t *testing.T) {
+	f := createTwoTrackFile(t, 3)
+	outs, err := mp4.Demux(f, mp4.DemuxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outs) != 2 {
+		t.Fatalf("got %d outputs instead of 2", len(outs))
+	}
+	for i, out := range outs {
+		dec := encodeAndDecode(t, out)
+		moov := dec.Init.Moov
+		if len(moov.Traks) != 1 || moov.Trak.Tkhd.TrackID != 1 || len(moov.Mvex.Trexs) != 1 {
+			t.Fatalf("output %d: bad init segment", i)
+		}
+		if len(dec.Segments) != 3 || dec.Sidx == nil || len(dec.Sidx.SidxRefs) != 3 {
+			t.Fatalf("output %d: got %d segments and sidx %+v", i, len(dec.Segments), dec.Sidx)
+		}
+		for j, seg := range dec.Segments {
+			if seqNr := seg.Fragments[0].Moof.Mfhd.SequenceNumber; seqNr != uint32(j+1) {
+				t.Errorf("output %d segment %d: sequence number %d", i, j, seqNr)
+			}
+		}
+		compareSamples(t, trackSamples(t, dec, 1), trackSamples(t, f, uint32(i+1)))
+	}
+}
+
+func TestDemuxEncrypted(t *testing.T) {
+	f, err := mp4.ReadMP4File("testdata/prog_8s_enc_dashinit.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clear, err := mp4.ReadMP4File("testdata/prog_8s_dec_dashinit.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := hex.DecodeString("63cb5f7184dd4b689a5c5ff11ee6a328")
+	outs, err := mp4.Demux(f, mp4.DemuxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, out := range outs {
+		inTrackID := f.Init.Moov.Traks[i].Tkhd.TrackID
+		dec := encodeAndDecode(t, out)
+		if len(dec.Init.Moov.Psshs) != 1 {
+			t.Errorf("output %d: got %d pssh boxes instead of 1", i, len(dec.Init.Moov.Psshs))
+		}
+		di, err := mp4.DecryptInit(dec.Init)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, seg := range dec.Segments {
+			if err := mp4.DecryptSegment(seg, di, key); err != nil {
+				t.Fatalf("output %d: %v", i, err)
+			}
+		}
+		compareSamples(t, trackSamples(t, dec, 1), trackSamples(t, clear, inTrackID))
+	}
+}
+
+func TestDemuxProgressive(t *testing.T) {
+	f, err := mp4.ReadMP4File("testdata/prog_8s.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs, err := mp4.Demux(f, mp4.DemuxOptions{AddSidx: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outs) != len(f.Moov.Traks) {
+		t.Fatalf("got %d outputs instead of %d", len(outs), len(f.Moov.Traks))
+	}
+	readers, err := mp4.NewSampleReaders(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, out := range outs {
+		dec := encodeAndDecode(t, out)
+		if dec.Sidx == nil {
+			t.Errorf("output %d: no sidx", i)
+		}
+		if hdlr := dec.Init.Moov.Trak.Mdia.Hdlr.HandlerType; hdlr != f.Moov.Traks[i].Mdia.Hdlr.HandlerType {
+			t.Errorf("output %d: got handler %s", i, hdlr)
+		}
+		samples := trackSamples(t, dec, 1)
+		if uint32(len(samples)) != readers[i].NrSamples() {
+			t.Fatalf("output %d: got %d samples instead of %d", i, len(samples), readers[i].NrSamples())
+		}
+		for j, s := range samples {
+			in, err := readers[i].Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.DecodeTime != in.DecodeTime || s.Size != in.Size || s.IsSync() != in.IsSync() {
+				t.Fatalf("output %d sample %d: got %+v instead of %+v", i, j+1, s.Sample, in.Sample)
+			}
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package mp4
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DiffKind - kind of box difference
+type DiffKind string
+
+const (
+	// DiffAdded - box only in the second file
+	DiffAdded DiffKind = "added"
+	// DiffRemoved - box only in the first file
+	DiffRemoved DiffKind = "removed"
+	// DiffChanged - box in both files with different fields
+	DiffChanged DiffKind = "changed"
+)
+
+// maxFieldDiffs - maximum number of field differences reported per box
+const maxFieldDiffs = 20
+
+// volatileFields - fields and boxes ignored by DiffOptions.IgnoreVolatile
+var volatileFields = []string{
+	"mvhd.CreationTime", "mvhd.ModificationTime",
+	"tkhd.CreationTime", "tkhd.ModificationTime",
+	"mdhd.CreationTime", "mdhd.ModificationTime",
+	"mfhd.SequenceNumber",
+	"prft",
+}
+
+// DiffOptions - options for Diff
+type DiffOptions struct {
+	// IgnoreVolatile - ignore creation and modification times in mvhd, tkhd and mdhd,
+	// mfhd sequence numbers, and prft boxes
+	IgnoreVolatile bool
+	// Ignore - box types like "prft" and box fields like "tfdt.BaseMediaDecodeTime" to ignore
+	Ignore []string
+	// CompareSamples - compare SHA-256 hashes of the sample data per track instead of mdat bytes.
+	// Tracks are matched in moov order.
+	CompareSamples bool
+}
+
+// FieldDiff - difference of a field value. A and B are nil if the field is missing.
+// Names of nested values include map keys and slice indices, like Entries[2].SampleCount.
+type FieldDiff struct {
+	Name string      `json:"name"`
+	A    interface{} `json:"a"`
+	B    interface{} `json:"b"`
+}
+
+// BoxDiff - an added, removed, or changed box
+type BoxDiff struct {
+	// Path - slash-separated box types from the top level. Boxes with siblings of the same
+	// type get a one-based index, like moov/trak[2]/tkhd
+	Path    string      `json:"path"`
+	Kind    DiffKind    `json:"kind"`
+	OffsetA uint64      `json:"offsetA"`
+	OffsetB uint64      `json:"offsetB"`
+	Fields  []FieldDiff `json:"fields,omitempty"`
+	// NrOmittedFields - number of field differences not listed in Fields
+	NrOmittedFields int `json:"nrOmittedFields,omitempty"`
+}
+
+// SampleDataDiff - difference in the sample data of a track
+type SampleDataDiff struct {
+	TrackID    uint32 `json:"trackID"`
+	NrSamplesA int    `json:"nrSamplesA"`
+	NrSamplesB int    `json:"nrSamplesB"`
+	// SampleNrs - one-based numbers of samples present in both files with different data
+	SampleNrs []uint32 `json:"sampleNrs,omitempty"`
+}
+
+// DiffResult - structural differences between two files
+type DiffResult struct {
+	Boxes   []BoxDiff        `json:"boxes,omitempty"`
+	Samples []SampleDataDiff `json:"samples,omitempty"`
+}
+
+// Equal - true if no differences were found
+func (r *DiffResult) Equal() bool {
+	return len(r.Boxes) == 0 && len(r.Samples) == 0
+}
+
+// Diff - compare the box trees of two decoded files.
+// Boxes are matched by type and order among their siblings, and compared field by field using
+// the same representation as BoxNode. Offsets are not compared, and box sizes only for boxes without
+// children, since changes inside a container are reported for the child boxes.
+// The mdat data is compared byte by byte, unless opts.CompareSamples is set. Both need mdat data,
+// so files decoded with DecModeLazyMdat can only be compared with mdat data ignored.
+func Diff(a, b *File, opts DiffOptions) (*DiffResult, error) {
+	ignore := make(map[string]bool)
+	for _, name := range opts.Ignore {
+		ignore[name] = true
+	}
+	if opts.IgnoreVolatile {
+		for _, name := range volatileFields {
+			ignore[name] = true
+		}
+	}
+	if opts.CompareSamples {
+		ignore["mdat.Data"] = true
+	}
+	d := differ{ignore: ignore}
+	if !ignore["mdat.Data"] || opts.CompareSamples {
+		if hasLazyMdat(a) || hasLazyMdat(b) {
+			return nil, fmt.Errorf("mdat data not loaded, ignore mdat.Data to compare lazily decoded files")
+		}
+	}
+	d.mdatsA, d.mdatsB = topMdats(a), topMdats(b)
+	d.diffNodes("", a.BoxTree(), b.BoxTree())
+	res := &DiffResult{Boxes: d.diffs}
+	if opts.CompareSamples {
+		samples, err := diffSamples(a, b)
+		if err != nil {
+			return nil, err
+		}
+		res.Samples = samples
+	}
+	return res, nil
+}
+
+type differ struct {
+	ignore         map[string]bool
+	mdatsA, mdatsB []*MdatBox
+	mdatIdx        int
+	diffs          []BoxDiff
+}
+
+// diffNodes compares children with the same type in order
+func (d *differ) diffNodes(parentPath string, as, bs []*BoxNode) {
+	as, bs = d.withoutIgnored(as), d.withoutIgnored(bs)
+	var types []string
+	byTypeA, byTypeB := nodesByType(as, &types), nodesByType(bs, &types)
+	for _, t := range types {
+		na, nb := byTypeA[t], byTypeB[t]
+		count := len(na)
+		if len(nb) > count {
+			count = len(nb)
+		}
+		for i := 0; i < count; i++ {
+			path := t
+			if count > 1 {
+				path = fmt.Sprintf("%s[%d]", t, i+1)
+			}
+			if parentPath != "" {
+				path = parentPath + "/" + path
+			}
+			switch {
+			case i >= len(nb):
+				d.diffs = append(d.diffs, BoxDiff{Path: path, Kind: DiffRemoved, OffsetA: na[i].Offset})
+			case i >= len(na):
+				d.diffs = append(d.diffs, BoxDiff{Path: path, Kind: DiffAdded, OffsetB: nb[i].Offset})
+			default:
+				d.diffNode(path, na[i], nb[i])
+			}
+		}
+	}
+}
+
+func (d *differ) withoutIgnored(nodes []*BoxNode) []*BoxNode {
+	kept := make([]*BoxNode, 0, len(nodes))
+	for _, n := range nodes {
+		if !d.ignore[n.Type] {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
+
+// nodesByType groups nodes by type, and adds new types to types in order of appearance
+func nodesByType(nodes []*BoxNode, types *[]string) map[string][]*BoxNode {
+	byType := make(map[string][]*BoxNode)
+	for _, n := range nodes {
+		if _, ok := byType[n.Type]; !ok {
+			found := false
+			for _, t := range *types {
+				found = found || t == n.Type
+			}
+			if !found {
+				*types = append(*types, n.Type)
+			}
+		}
+		byType[n.Type] = append(byType[n.Type], n)
+	}
+	return byType
+}
+
+func (d *differ) diffNode(path string, a, b *BoxNode) {
+	bd := BoxDiff{Path: path, Kind: DiffChanged, OffsetA: a.Offset, OffsetB: b.Offset}
+	add := func(name string, va, vb interface{}) {
+		if d.ignore[a.Type+"."+name] {
+			return
+		}
+		if len(bd.Fields) == maxFieldDiffs {
+			bd.NrOmittedFields++
+			return
+		}
+		bd.Fields = append(bd.Fields, FieldDiff{Name: name, A: va, B: vb})
+	}
+	if len(a.Children) == 0 && len(b.Children) == 0 && a.Size != b.Size {
+		add("size", a.Size, b.Size)
+	}
+	if !reflect.DeepEqual(a.Version, b.Version) {
+		add("version", nodeVersion(a), nodeVersion(b))
+	}
+	if !reflect.DeepEqual(a.Flags, b.Flags) {
+		add("flags", nodeFlags(a), nodeFlags(b))
+	}
+	names := make([]string, 0, len(a.Fields)+len(b.Fields))
+	for name := range a.Fields {
+		names = append(names, name)
+	}
+	for name := range b.Fields {
+		if _, ok := a.Fields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if d.ignore[a.Type+"."+name] {
+			continue
+		}
+		diffValues(name, a.Fields[name], b.Fields[name], add)
+	}
+	if a.Payload != b.Payload {
+		idx := firstDiffIdx([]byte(a.Payload), []byte(b.Payload)) / 2
+		add(fmt.Sprintf("payload[%d]", idx), hexByte(a.Payload, idx), hexByte(b.Payload, idx))
+	}
+	if a.Type == "mdat" && !d.ignore["mdat.Data"] {
+		d.diffMdatData(add)
+	}
+	if len(bd.Fields) > 0 {
+		d.diffs = append(d.diffs, bd)
+	}
+	d.diffNodes(path, a.Children, b.Children)
+}
+
+// diffMdatData compares the data of the next pair of top-level mdat boxes.
+// mdat boxes only appear at the top level, so they are visited in file order.
+func (d *differ) diffMdatData(add func(name string, va, vb interface{})) {
+	idx := d.mdatIdx
+	d.mdatIdx++
+	if idx >= len(d.mdatsA) || idx >= len(d.mdatsB) {
+		return
+	}
+	da, db := d.mdatsA[idx].Data, d.mdatsB[idx].Data
+	if bytes.Equal(da, db) {
+		return
+	}
+	i := firstDiffIdx(da, db)
+	add(fmt.Sprintf("Data[%d]", i), byteOrNil(da, i), byteOrNil(db, i))
+}
+
+// diffValues reports leaf differences between two field values, descending into maps and slices
+func diffValues(name string, a, b interface{}, add func(name string, va, vb interface{})) {
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(va)+len(vb))
+		for k := range va {
+			keys = append(keys, k)
+		}
+		for k := range vb {
+			if _, ok := va[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffValues(name+"."+k, va[k], vb[k], add)
+		}
+		return
+	}
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if ra.Kind() == reflect.Slice && rb.Kind() == reflect.Slice {
+		n := ra.Len()
+		if rb.Len() < n {
+			n = rb.Len()
+		}
+		for i := 0; i < n; i++ {
+			diffValues(fmt.Sprintf("%s[%d]", name, i), ra.Index(i).Interface(), rb.Index(i).Interface(), add)
+		}
+		if ra.Len() != rb.Len() {
+			add("len("+name+")", ra.Len(), rb.Len())
+		}
+		return
+	}
+	add(name, a, b)
+}
+
+func nodeVersion(n *BoxNode) interface{} {
+	if n.Version == nil {
+		return nil
+	}
+	return *n.Version
+}
+
+func nodeFlags(n *BoxNode) interface{} {
+	if n.Flags == nil {
+		return nil
+	}
+	return *n.Flags
+}
+
+func firstDiffIdx(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func byteOrNil(data []byte, i int) interface{} {
+	if i >= len(data) {
+		return nil
+	}
+	return data[i]
+}
+
+// hexByte returns the byte at idx of a hex string as hex, or nil outside the string
+func hexByte(hexStr string, idx int) interface{} {
+	if 2*idx+2 > len(hexStr) {
+		return nil
+	}
+	return hexStr[2*idx : 2*idx+2]
+}
+
+func topMdats(f *File) []*MdatBox {
+	var mdats []*MdatBox
+	for _, c := range f.Children {
+		if mdat, ok := c.(*MdatBox); ok {
+			mdats = append(mdats, mdat)
+		}
+	}
+	return mdats
+}
+
+func hasLazyMdat(f *File) bool {
+	for _, mdat := range topMdats(f) {
+		if mdat.IsLazy() {
+			return true
+		}
+	}
+	return false
+}
+
+// diffSamples compares sample data hashes of the tracks of two files, matched in moov order
+func diffSamples(a, b *File) ([]SampleDataDiff, error) {
+	if a.Moov == nil || b.Moov == nil {
+		return nil, fmt.Errorf("sample comparison needs moov boxes")
+	}
+	var diffs []SampleDataDiff
+	for i, trakA := range a.Moov.Traks {
+		if i >= len(b.Moov.Traks) {
+			break // reported as removed trak
+		}
+		hashesA, err := sampleHashes(a, trakA.Tkhd.TrackID)
+		if err != nil {
+			return nil, err
+		}
+		hashesB, err := sampleHashes(b, b.Moov.Traks[i].Tkhd.TrackID)
+		if err != nil {
+			return nil, err
+		}
+		sd := SampleDataDiff{TrackID: trakA.Tkhd.TrackID, NrSamplesA: len(hashesA), NrSamplesB: len(hashesB)}
+		for j := 0; j < len(hashesA) && j < len(hashesB); j++ {
+			if hashesA[j] != hashesB[j] {
+				sd.SampleNrs = append(sd.SampleNrs, uint32(j+1))
+			}
+		}
+		if len(sd.SampleNrs) > 0 || sd.NrSamplesA != sd.NrSamplesB {
+			diffs = append(diffs, sd)
+		}
+	}
+	return diffs, nil
+}
+
+// sampleHashes returns SHA-256 hashes of the data of all samples of a track in decode order
+func sampleHashes(f *File, trackID uint32) ([][sha256.Size]byte, error) {
+	infos, err := f.SampleInfos(trackID)
+	if err != nil {
+		return nil, err
+	}
+	mdats := topMdats(f)
+	hashes := make([][sha256.Size]byte, 0, len(infos))
+	for _, info := range infos {
+		data, err := sampleDataAt(mdats, info.Offset, info.Size)
+		if err != nil {
+			return nil, fmt.Errorf("track %d sample %d: %w", trackID, info.SampleNr, err)
+		}
+		hashes = append(hashes, sha256.Sum256(data))
+	}
+	return hashes, nil
+}
+
+func sampleDataAt(mdats []*MdatBox, offset uint64, size uint32) ([]byte, error) {
+	for _, mdat := range mdats {
+		start := mdat.PayloadAbsoluteOffset()
+		if offset >= start && offset+uint64(size) <= start+uint64(len(mdat.Data)) {
+			return mdat.Data[offset-start : offset-start+uint64(size)], nil
+		}
+	}
+	return nil, fmt.Errorf("data at offset %d not in any mdat", offset)
+}
+
+// String - text report with one line per box difference and per track with sample differences
+func (r *DiffResult) String() string {
+	var sb strings.Builder
+	for _, bd := range r.Boxes {
+		switch bd.Kind {
+		case DiffAdded:
+			fmt.Fprintf(&sb, "+ %s (offset %d)\n", bd.Path, bd.OffsetB)
+		case DiffRemoved:
+			fmt.Fprintf(&sb, "- %s (offset %d)\n", bd.Path, bd.OffsetA)
+		default:
+			fmt.Fprintf(&sb, "~ %s (offsets %d, %d)\n", bd.Path, bd.OffsetA, bd.OffsetB)
+			for _, fd := range bd.Fields {
+				fmt.Fprintf(&sb, "    %s: %v -> %v\n", fd.Name, fd.A, fd.B)
+			}
+			if bd.NrOmittedFields > 0 {
+				fmt.Fprintf(&sb, "    ... %d more fields\n", bd.NrOmittedFields)
+			}
+		}
+	}
+	for _, sd := range r.Samples {
+		fmt.Fprintf(&sb, "~ track %d samples: %d -> %d, %d with different data", sd.TrackID,
+			sd.NrSamplesA, sd.NrSamplesB, len(sd.SampleNrs))
+		if len(sd.SampleNrs) > 0 {
+			fmt.Fprintf(&sb, ", first %d", sd.SampleNrs[0])
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
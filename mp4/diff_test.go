@@ -0,0 +1,105 @@
+package mp4_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func decodeTestFile(t *testing.T, path string) *mp4.File {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.DecodeFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestDiffProgressive(t *testing.T) {
+	a := decodeTestFile(t, "testdata/prog_8s.mp4")
+	b := decodeTestFile(t, "testdata/prog_8s.mp4")
+	res, err := mp4.Diff(a, b, mp4.DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Equal() {
+		t.Errorf("expected no differences, got\n%s", res)
+	}
+
+	b.Moov.Mvhd.CreationTime++
+	b.Moov.Traks[1].Mdia.Minf.Stbl.Stsz.SampleSize[4]++
+	b.Moov.Traks[1].Mdia.Minf.Stbl.Stsz.SampleSize = append(b.Moov.Traks[1].Mdia.Minf.Stbl.Stsz.SampleSize, 7)
+	b.Moov.Traks[1].Mdia.Minf.Stbl.Stsz.SampleNumber++
+	b.Moov.AddChild(mp4.NewFreeBox([]byte{1}))
+	res, err = mp4.Diff(a, b, mp4.DiffOptions{IgnoreVolatile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Boxes) != 2 {
+		t.Fatalf("got %d box differences instead of 2:\n%s", len(res.Boxes), res)
+	}
+	stsz := res.Boxes[0]
+	if stsz.Path != "moov/trak[2]/mdia/minf/stbl/stsz" || stsz.Kind != mp4.DiffChanged {
+		t.Errorf("unexpected first difference %+v", stsz)
+	}
+	wantNames := []string{"size", "SampleNumber", "SampleSize[4]", "len(SampleSize)"}
+	if len(stsz.Fields) != len(wantNames) {
+		t.Fatalf("got fields %+v", stsz.Fields)
+	}
+	for i, name := range wantNames {
+		if stsz.Fields[i].Name != name {
+			t.Errorf("field %d: got %s instead of %s", i, stsz.Fields[i].Name, name)
+		}
+	}
+	if res.Boxes[1].Path != "moov/free" || res.Boxes[1].Kind != mp4.DiffAdded {
+		t.Errorf("unexpected second difference %+v", res.Boxes[1])
+	}
+	res, err = mp4.Diff(a, b, mp4.DiffOptions{Ignore: []string{"stsz", "free"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Boxes) != 1 || res.Boxes[0].Path != "moov/mvhd" || res.Boxes[0].Fields[0].Name != "CreationTime" {
+		t.Errorf("unexpected differences\n%s", res)
+	}
+}
+
+func TestDiffFragmented(t *testing.T) {
+	a := decodeTestFile(t, "testdata/prog_8s_enc_dashinit.mp4")
+	b := decodeTestFile(t, "testdata/prog_8s_enc_dashinit.mp4")
+	frag := b.Segments[1].Fragments[0]
+	frag.Moof.Mfhd.SequenceNumber = 100
+	trex, _ := b.Moov.Mvex.GetTrex(frag.Moof.Traf.Tfhd.TrackID)
+	samples, err := frag.GetFullSamples(trex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples[3].Data[0] ^= 0xff
+
+	res, err := mp4.Diff(a, b, mp4.DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Boxes) != 2 || res.Boxes[0].Fields[0].Name != "SequenceNumber" ||
+		!strings.HasPrefix(res.Boxes[1].Fields[0].Name, "Data[") {
+		t.Errorf("unexpected differences\n%s", res)
+	}
+
+	res, err = mp4.Diff(a, b, mp4.DiffOptions{IgnoreVolatile: true, CompareSamples: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Boxes) != 0 || len(res.Samples) != 1 {
+		t.Fatalf("unexpected differences\n%s", res)
+	}
+	sd := res.Samples[0]
+	if sd.TrackID != frag.Moof.Traf.Tfhd.TrackID || sd.NrSamplesA != sd.NrSamplesB || len(sd.SampleNrs) != 1 {
+		t.Errorf("unexpected sample differences %+v", sd)
+	}
+}
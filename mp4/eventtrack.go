@@ -0,0 +1,278 @@
+package mp4
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// EventDurationUnknown is the event duration of emsg and emib boxes for events of unknown duration.
+const EventDurationUnknown = 0xffffffff
+
+// Event is an event message with an absolute presentation time. It corresponds to an emsg box
+// or to the emib boxes of an ISO/IEC 23001-18 event message track. PresentationTime and
+// Duration are in the timescale of the track the event belongs to.
+type Event struct {
+	PresentationTime uint64
+	Duration         uint32 // EventDurationUnknown if unknown
+	ID               uint32
+	SchemeIDURI      string
+	Value            string
+	MessageData      []byte
+}
+
+// ActiveAt returns true if the event is active at presentation time t. An event with zero
+// duration is active at its presentation time, and one of unknown duration from its
+// presentation time on.
+func (e Event) ActiveAt(t uint64) bool {
+	if t < e.PresentationTime {
+		return false
+	}
+	switch e.Duration {
+	case EventDurationUnknown:
+		return true
+	case 0:
+		return t == e.PresentationTime
+	}
+	return t < e.PresentationTime+uint64(e.Duration)
+}
+
+// overlaps returns true if the event is active somewhere in [start, end). An event with zero
+// duration overlaps the range if its presentation time is inside it.
+func (e Event) overlaps(start, end uint64) bool {
+	if e.PresentationTime >= end {
+		return false
+	}
+	if e.PresentationTime >= start {
+		return true
+	}
+	return e.Duration == EventDurationUnknown || e.PresentationTime+uint64(e.Duration) > start
+}
+
+// sameEvent returns true if e and o are instances of the same event (same scheme, value and id).
+func (e Event) sameEvent(o Event) bool {
+	return e.ID == o.ID && e.SchemeIDURI == o.SchemeIDURI && e.Value == o.Value
+}
+
+// ActiveEvents returns the events active at presentation time t.
+func ActiveEvents(events []Event, t uint64) []Event {
+	var active []Event
+	for _, e := range events {
+		if e.ActiveAt(t) {
+			active = append(active, e)
+		}
+	}
+	return active
+}
+
+// EventFromEmsg returns the event of an emsg box in timescale. segmentStart is the earliest
+// presentation time of the segment in timescale, used for version 0 boxes.
+func EventFromEmsg(emsg *EmsgBox, timescale uint32, segmentStart uint64) Event {
+	e := Event{
+		ID:          emsg.ID,
+		SchemeIDURI: emsg.SchemeIDURI,
+		Value:       emsg.Value,
+		MessageData: emsg.MessageData,
+		Duration:    EventDurationUnknown,
+	}
+	if emsg.Version == 0 {
+		e.PresentationTime = segmentStart + RescaleTime(uint64(emsg.PresentationTimeDelta), emsg.TimeScale, timescale)
+	} else {
+		e.PresentationTime = RescaleTime(emsg.PresentationTime, emsg.TimeScale, timescale)
+	}
+	if emsg.EventDuration != EventDurationUnknown {
+		e.Duration = uint32(RescaleTime(uint64(emsg.EventDuration), emsg.TimeScale, timescale))
+	}
+	return e
+}
+
+// CreateEmsg returns an emsg box of version 0 or 1 for the event, with the event timescale.
+// segmentStart is the earliest presentation time of the segment, used for version 0 boxes.
+func CreateEmsg(e Event, version byte, timescale uint32, segmentStart uint64) (*EmsgBox, error) {
+	emsg := &EmsgBox{
+		Version:       version,
+		TimeScale:     timescale,
+		EventDuration: e.Duration,
+		ID:            e.ID,
+		SchemeIDURI:   e.SchemeIDURI,
+		Value:         e.Value,
+		MessageData:   e.MessageData,
+	}
+	switch version {
+	case 0:
+		if e.PresentationTime < segmentStart || e.PresentationTime-segmentStart > 0xffffffff {
+			return nil, fmt.Errorf("event time %d not expressible relative to segment start %d",
+				e.PresentationTime, segmentStart)
+		}
+		emsg.PresentationTimeDelta = uint32(e.PresentationTime - segmentStart)
+	case 1:
+		emsg.PresentationTime = e.PresentationTime
+	default:
+		return nil, fmt.Errorf("unknown emsg version %d", version)
+	}
+	return emsg, nil
+}
+
+// EmsgEvents returns the events of all emsg boxes of the fragment in timescale. segmentStart
+// is the earliest presentation time of the segment in timescale, used for version 0 boxes.
+func (f *Fragment) EmsgEvents(timescale uint32, segmentStart uint64) []Event {
+	var events []Event
+	for _, c := range f.Children {
+		if emsg, ok := c.(*EmsgBox); ok {
+			events = append(events, EventFromEmsg(emsg, timescale, segmentStart))
+		}
+	}
+	return events
+}
+
+// SetEvteDescriptor sets an ISO/IEC 23001-18 event message sample entry (evte) on the track.
+// If schemes is not empty or otherSchemes is true, a silb box announces the schemes used.
+// The track should be created with media type "meta".
+func (t *TrakBox) SetEvteDescriptor(schemes []SilbEntry, otherSchemes bool) error {
+	evte := &EvteBox{DataReferenceIndex: 1}
+	if len(schemes) > 0 || otherSchemes {
+		evte.AddChild(&SilbBox{Schemes: schemes, OtherSchemesFlag: otherSchemes})
+	}
+	t.Mdia.Minf.Stbl.Stsd.AddChild(evte)
+	return nil
+}
+
+// CreateEventSampleData returns the data of an event message track sample with the emib
+// boxes, or with an emeb box if emibs is empty.
+func CreateEventSampleData(emibs []*EmibBox) ([]byte, error) {
+	buf := bytes.Buffer{}
+	if len(emibs) == 0 {
+		if err := (&EmebBox{}).Encode(&buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	for _, emib := range emibs {
+		if err := emib.Encode(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// CreateEventSamples returns event message track samples covering [start, end) in the track
+// timescale. Samples are split at every event start and end, so that each sample carries an
+// emib box for every event active during it, with the presentation time relative to the
+// sample, and an emeb box if there are none. Events that started before start are repeated
+// in the first sample, so consecutive ranges can be written to consecutive fragments.
+func CreateEventSamples(events []Event, start, end uint64) ([]FullSample, error) {
+	if end <= start {
+		return nil, fmt.Errorf("empty time range [%d, %d)", start, end)
+	}
+	bounds := []uint64{start, end}
+	var inRange []Event
+	for _, e := range events {
+		if !e.overlaps(start, end) {
+			continue
+		}
+		inRange = append(inRange, e)
+		if e.PresentationTime > start {
+			bounds = append(bounds, e.PresentationTime)
+		}
+		if e.Duration != EventDurationUnknown {
+			if evEnd := e.PresentationTime + uint64(e.Duration); evEnd > start && evEnd < end {
+				bounds = append(bounds, evEnd)
+			}
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	samples := make([]FullSample, 0, len(bounds)-1)
+	for i := 0; i+1 < len(bounds); i++ {
+		sStart, sEnd := bounds[i], bounds[i+1]
+		if sStart == sEnd {
+			continue
+		}
+		if sEnd-sStart > 0xffffffff {
+			return nil, fmt.Errorf("sample duration %d too large", sEnd-sStart)
+		}
+		var emibs []*EmibBox
+		for _, e := range inRange {
+			if !e.overlaps(sStart, sEnd) {
+				continue
+			}
+			emibs = append(emibs, &EmibBox{
+				PresentationTimeDelta: int64(e.PresentationTime) - int64(sStart),
+				EventDuration:         e.Duration,
+				Id:                    e.ID,
+				SchemeIdURI:           e.SchemeIDURI,
+				Value:                 e.Value,
+				MessageData:           e.MessageData,
+			})
+		}
+		data, err := CreateEventSampleData(emibs)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, FullSample{
+			Sample:     NewSample(SyncSampleFlags, uint32(sEnd-sStart), uint32(len(data)), 0),
+			DecodeTime: sStart,
+			Data:       data,
+		})
+	}
+	return samples, nil
+}
+
+// CreateEventFragment returns a fragment of an event message track covering [start, end),
+// with the samples from CreateEventSamples.
+func CreateEventFragment(seqNumber, trackID uint32, events []Event, start, end uint64) (*Fragment, error) {
+	samples, err := CreateEventSamples(events, start, end)
+	if err != nil {
+		return nil, err
+	}
+	frag, err := CreateFragment(seqNumber, trackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range samples {
+		frag.AddFullSample(s)
+	}
+	return frag, nil
+}
+
+// EventsFromSamples returns the events of event message track samples, in order of first
+// appearance. The emib boxes of one event repeated in consecutive samples give one event.
+func EventsFromSamples(samples []FullSample) ([]Event, error) {
+	var events []Event
+	for i := range samples {
+		s := &samples[i]
+		sr := bytes.NewReader(s.Data)
+		var pos uint64
+		for sr.Len() > 0 {
+			box, err := DecodeBox(pos, sr)
+			if err != nil {
+				return nil, fmt.Errorf("event sample at %d: %w", s.DecodeTime, err)
+			}
+			pos += box.Size()
+			emib, ok := box.(*EmibBox)
+			if !ok {
+				continue
+			}
+			e := Event{
+				PresentationTime: uint64(s.PresentationTime() + emib.PresentationTimeDelta),
+				Duration:         emib.EventDuration,
+				ID:               emib.Id,
+				SchemeIDURI:      emib.SchemeIdURI,
+				Value:            emib.Value,
+				MessageData:      emib.MessageData,
+			}
+			if !containsEvent(events, e) {
+				events = append(events, e)
+			}
+		}
+	}
+	return events, nil
+}
+
+func containsEvent(events []Event, e Event) bool {
+	for _, o := range events {
+		if o.sameEvent(e) {
+			return true
+		}
+	}
+	return false
+}
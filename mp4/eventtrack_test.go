@@ -0,0 +1,141 @@
+package mp4_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/go-test/deep"
+)
+
+func TestEvteTrackInit(t *testing.T) {
+	init := mp4.CreateEmptyInit()
+	trak := init.AddEmptyTrack(1000, "evte", "und")
+	schemes := []mp4.SilbEntry{{SchemeIdURI: "urn:scte:scte35:2013:bin", AtLeastOneFlag: true}}
+	if err := trak.SetEvteDescriptor(schemes, false); err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.Buffer{}
+	if err := init.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotTrak := f.Init.Moov.Trak
+	if gotTrak.Mdia.Hdlr.HandlerType != "meta" {
+		t.Errorf("got handler %s", gotTrak.Mdia.Hdlr.HandlerType)
+	}
+	evte := gotTrak.Mdia.Minf.Stbl.Stsd.Evte
+	if evte == nil || evte.Silb == nil {
+		t.Fatal("no evte with silb")
+	}
+	if diff := deep.Equal(evte.Silb.Schemes, schemes); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestEmsgToEventTrack(t *testing.T) {
+	frag, err := mp4.CreateFragment(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A v0 emsg in 90kHz starting 2s into a segment starting at 10s, and a v1 emsg of
+	// unknown duration at 15s
+	frag.AddEmsg(&mp4.EmsgBox{Version: 0, TimeScale: 90000, PresentationTimeDelta: 180000,
+		EventDuration: 270000, ID: 1, SchemeIDURI: "urn:a", Value: "1", MessageData: []byte{1}})
+	frag.AddEmsg(&mp4.EmsgBox{Version: 1, TimeScale: 90000, PresentationTime: 1350000,
+		EventDuration: mp4.EventDurationUnknown, ID: 2, SchemeIDURI: "urn:b", MessageData: []byte{2}})
+	if len(frag.Emsgs) != 2 {
+		t.Errorf("got %d emsgs", len(frag.Emsgs))
+	}
+	events := frag.EmsgEvents(1000, 10000)
+	want := []mp4.Event{
+		{PresentationTime: 12000, Duration: 3000, ID: 1, SchemeIDURI: "urn:a", Value: "1", MessageData: []byte{1}},
+		{PresentationTime: 15000, Duration: mp4.EventDurationUnknown, ID: 2, SchemeIDURI: "urn:b", MessageData: []byte{2}},
+	}
+	if diff := deep.Equal(events, want); diff != nil {
+		t.Fatal(diff)
+	}
+
+	// Two fragments of the event track: [10s, 14s) and [14s, 18s)
+	var samples []mp4.FullSample
+	wantDurs := [][]uint32{{2000, 2000}, {1000, 3000}}
+	wantNrEvents := [][]int{{0, 1}, {1, 1}}
+	for i, start := range []uint64{10000, 14000} {
+		evFrag, err := mp4.CreateEventFragment(uint32(i+1), 2, events, start, start+4000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := bytes.Buffer{}
+		if err := evFrag.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		f, err := mp4.DecodeFile(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fss, err := f.Segments[0].Fragments[0].GetFullSamples(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fss) != len(wantDurs[i]) {
+			t.Fatalf("fragment %d: got %d samples", i, len(fss))
+		}
+		for j, fs := range fss {
+			got, err := mp4.EventsFromSamples([]mp4.FullSample{fs})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fs.Dur != wantDurs[i][j] || len(got) != wantNrEvents[i][j] {
+				t.Errorf("fragment %d sample %d: got dur %d with %d events", i, j, fs.Dur, len(got))
+			}
+		}
+		samples = append(samples, fss...)
+	}
+	got, err := mp4.EventsFromSamples(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+
+	if active := mp4.ActiveEvents(got, 14999); len(active) != 1 || active[0].ID != 1 {
+		t.Errorf("got active events %v at 14999", active)
+	}
+	if active := mp4.ActiveEvents(got, 15000); len(active) != 1 || active[0].ID != 2 {
+		t.Errorf("got active events %v at 15000", active)
+	}
+
+	// And back to emsg boxes
+	emsg, err := mp4.CreateEmsg(got[0], 0, 1000, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emsg.PresentationTimeDelta != 2000 || emsg.EventDuration != 3000 || emsg.SchemeIDURI != "urn:a" {
+		t.Errorf("got emsg %+v", emsg)
+	}
+	if _, err := mp4.CreateEmsg(got[0], 0, 1000, 13000); err == nil {
+		t.Error("expected error for event before segment start")
+	}
+}
+
+func TestZeroDurationEvent(t *testing.T) {
+	events := []mp4.Event{{PresentationTime: 500, Duration: 0, ID: 1, SchemeIDURI: "urn:a"}}
+	samples, err := mp4.CreateEventSamples(events, 0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || samples[1].DecodeTime != 500 {
+		t.Fatalf("got %d samples", len(samples))
+	}
+	got, err := mp4.EventsFromSamples(samples[1:])
+	if err != nil || len(got) != 1 {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if len(mp4.ActiveEvents(events, 500)) != 1 || len(mp4.ActiveEvents(events, 501)) != 0 {
+		t.Error("zero duration event active at wrong time")
+	}
+}
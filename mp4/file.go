@@ -31,6 +31,8 @@ type File struct {
 	Init         *InitSegment    // Init data (ftyp + moov for fragmented file)
 	Sidx         *SidxBox        // The first sidx box for a DASH OnDemand file
 	Sidxs        []*SidxBox      // All sidx boxes for a DASH OnDemand file
+	Ssix         *SsixBox        // ssix box directly after one of the sidx boxes for a DASH OnDemand file
+	ssixSidxIdx  int             // Index in Sidxs of the sidx box just before Ssix
 	tfra         *TfraBox        // Single tfra box read first if DecISMFlag set
 	Mfra         *MfraBox        // MfraBox for ISM files
 	Segments     []*MediaSegment // Media segments
@@ -40,6 +42,7 @@ type File struct {
 	fileDecFlags DecFileFlags    // Bit field with flags for decoding
 	isFragmented bool
 	fileDecMode  DecFileMode
+	DecodeErrors []DecodeError // Errors found when decoding with DecLenient
 }
 
 // EncFragFileMode - mode for writing file
@@ -74,6 +77,11 @@ const (
 	// This is provided no styp, or sidx/mfra box gives other information
 	DecStartOnMoof = (1 << 1)
 	// if no styp box, or sidx/mfra strudture
+
+	// DecLenient records decode errors in File.DecodeErrors instead of failing. Bad boxes are decoded
+	// child by child or skipped, unreadable bytes are skipped up to the next plausible top-level box,
+	// and truncated mdat boxes keep the data present. The input is read into memory unless it is an io.ReadSeeker.
+	DecLenient DecFileFlags = (1 << 2)
 )
 
 // EncOptimize - encoder optimization mode
@@ -153,6 +161,10 @@ func DecodeFile(r io.Reader, options ...Option) (*File, error) {
 	// apply options to change the default decode or encode mode
 	f.ApplyOptions(options...)
 
+	if (f.fileDecFlags & DecLenient) != 0 {
+		return f, f.decodeLenient(r)
+	}
+
 	var boxStartPos uint64 = 0
 	lastBoxType := ""
 
@@ -301,6 +313,13 @@ func (f *File) AddChild(child Box, boxStartPos uint64) {
 			currSeg := f.Segments[len(f.Segments)-1]
 			currSeg.AddSidx(box)
 		}
+	case *SsixBox:
+		// An ssix box describes the subsegments of the sidx box just before it.
+		// Its position is kept, so that it is encoded right after that sidx box.
+		if len(f.Segments) == 0 && lastChildType == "sidx" && f.Ssix == nil {
+			f.Ssix = box
+			f.ssixSidxIdx = len(f.Sidxs) - 1
+		}
 	case *StypBox:
 		// Starts a new segment
 		f.isFragmented = true
@@ -315,6 +334,15 @@ func (f *File) AddChild(child Box, boxStartPos uint64) {
 		}
 		frag := lastSeg.LastFragment()
 		frag.AddChild(box)
+	case *PrftBox:
+		// prft box comes before the moof of its fragment, possibly after emsg boxes.
+		// It is added to that fragment, so that it is encoded in place with the segment.
+		f.startSegmentIfNeeded(box, boxStartPos)
+		lastSeg := f.LastSegment()
+		if frag := lastSeg.LastFragment(); frag == nil || frag.Moof != nil {
+			lastSeg.AddFragment(&Fragment{StartPos: boxStartPos})
+		}
+		lastSeg.LastFragment().AddChild(box)
 	case *MoofBox:
 		f.isFragmented = true
 		moof := box
@@ -377,10 +405,9 @@ func (f *File) startSegmentIfNeeded(_ Box, boxStartPos uint64) {
 		}
 	case (f.fileDecFlags & DecStartOnMoof) != 0:
 		segStart = true
-	default:
-		segStart = (segIdx == 0)
 	}
-	if segStart {
+	// boxes of a fragmented file need a segment, even if they do not match the sidx or tfra
+	if segStart || segIdx == 0 {
 		f.isFragmented = true
 		ms := MediaSegment{
 			Styp:        nil,
@@ -462,9 +489,13 @@ func (f *File) Encode(w io.Writer) error {
 					return err
 				}
 			}
-			if len(f.Sidxs) > 0 {
-				for i := range f.Sidxs {
-					err := f.Sidxs[i].Encode(w)
+			for i := range f.Sidxs {
+				err := f.Sidxs[i].Encode(w)
+				if err != nil {
+					return err
+				}
+				if f.Ssix != nil && i == f.ssixSidxIdx {
+					err := f.Ssix.Encode(w)
 					if err != nil {
 						return err
 					}
@@ -519,9 +550,13 @@ func (f *File) EncodeSW(sw bits.SliceWriter) error {
 					return err
 				}
 			}
-			if len(f.Sidxs) > 0 {
-				for i := range f.Sidxs {
-					err := f.Sidxs[i].EncodeSW(sw)
+			for i := range f.Sidxs {
+				err := f.Sidxs[i].EncodeSW(sw)
+				if err != nil {
+					return err
+				}
+				if f.Ssix != nil && i == f.ssixSidxIdx {
+					err := f.Ssix.EncodeSW(sw)
 					if err != nil {
 						return err
 					}
@@ -782,6 +817,27 @@ func (f *File) UpdateSidx(addIfNotExists, nonZeroEPT bool) error {
 	return nil
 }
 
+// addNewSidx generates a sidx box for a fragmented file created in memory, where
+// box positions are not known. It is added before the media segments.
+func addNewSidx(f *File) error {
+	refTrak, err := findReferenceTrak(f.Init)
+	if err != nil {
+		return err
+	}
+	trex, ok := f.Init.Moov.Mvex.GetTrex(refTrak.Tkhd.TrackID)
+	if !ok {
+		return fmt.Errorf("no trex box found for track %d", refTrak.Tkhd.TrackID)
+	}
+	segDatas, err := findSegmentData(f.Segments, refTrak, trex)
+	if err != nil {
+		return err
+	}
+	sidx := &SidxBox{}
+	fillSidx(sidx, refTrak, segDatas, false)
+	f.AddSidx(sidx)
+	return nil
+}
+
 func findReferenceTrak(initSeg *InitSegment) (*TrakBox, error) {
 	if initSeg.Moov == nil || len(initSeg.Moov.Traks) == 0 {
 		return nil, fmt.Errorf("no traks in init segment moov")
@@ -3,6 +3,7 @@ package mp4_test
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"testing"
@@ -274,6 +275,44 @@ func TestSegmentWith2Fragments(t *testing.T) {
 	}
 }
 
+func TestPrftRoundTrip(t *testing.T) {
+	// File styp, emsg, prft, moof, mdat, prft, moof, mdat
+	var buf bytes.Buffer
+	styp := mp4.CreateStyp()
+	emsg := &mp4.EmsgBox{Version: 1, TimeScale: 1000, SchemeIDURI: "urn:test", Value: "1"}
+	parts := []interface{ Encode(w io.Writer) error }{styp,
+		emsg, mp4.CreatePrftBox(1, 0x18, 1, 0xe80000000000, 0), createFragment(t, 1, 1024, 0),
+		mp4.CreatePrftBox(1, 0x18, 1, 0xe80000010000, 1024), createFragment(t, 2, 1024, 1024)}
+	for _, p := range parts {
+		if err := p.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encData := buf.Bytes()
+	decFile, err := mp4.DecodeFile(bytes.NewReader(encData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decFile.Segments) != 1 || len(decFile.Segments[0].Fragments) != 2 {
+		t.Fatal("not 2 fragments in one segment")
+	}
+	for i, frag := range decFile.Segments[0].Fragments {
+		if frag.Prft == nil || frag.Children[len(frag.Children)-3] != frag.Prft {
+			t.Errorf("fragment %d: prft not right before moof", i+1)
+		}
+	}
+	if len(decFile.Children) != 8 {
+		t.Errorf("got %d top-level children instead of 8", len(decFile.Children))
+	}
+	var out bytes.Buffer
+	if err := decFile.Encode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), encData) {
+		t.Errorf("re-encoded bytes differ from encoded bytes")
+	}
+}
+
 func createFragment(t *testing.T, seqNr, dur uint32, decTime uint64) *mp4.Fragment {
 	frag, err := mp4.CreateFragment(seqNr, 1)
 	if err != nil {
@@ -124,6 +124,7 @@ func (f *Fragment) AddEmsg(emsg *EmsgBox) {
 	newIdx := prevEmsg + 1
 	f.Children = append(f.Children[:newIdx+1], f.Children[newIdx:]...)
 	f.Children[newIdx] = emsg
+	f.Emsgs = append(f.Emsgs, emsg)
 }
 
 // Size - return size of fragment including all boxes.
@@ -487,3 +488,48 @@ func (f *Fragment) CommonSampleDuration(trex *TrexBox) (uint32, error) {
 	}
 	return commonDur, nil
 }
+
+// ReplaceSampleData replaces the data of all samples in a fragment with one track.
+// transform is called with the zero-based sample number and the current data of each sample,
+// and returns the new data. Sample sizes in the truns, the mdat payload and the trun data
+// offsets are updated accordingly. Encrypted fragments are not supported, since changed
+// sample data would invalidate the subsample information in senc.
+func (f *Fragment) ReplaceSampleData(trex *TrexBox, transform func(nr int, data []byte) ([]byte, error)) error {
+	moof := f.Moof
+	if len(moof.Trafs) != 1 {
+		return fmt.Errorf("not exactly one track in fragment")
+	}
+	traf := moof.Traf
+	if traf.Senc != nil || traf.UUIDSenc != nil || traf.Saiz != nil {
+		return fmt.Errorf("cannot replace data of encrypted samples")
+	}
+	if traf.Tfhd.HasBaseDataOffset() {
+		return fmt.Errorf("explicit base data offset not supported")
+	}
+	fss, err := f.GetFullSamples(trex)
+	if err != nil {
+		return err
+	}
+	var newData []byte
+	nr := 0
+	for _, trun := range traf.Truns {
+		for i := range trun.Samples {
+			old := fss[nr].Data
+			data, err := transform(nr, old[:len(old):len(old)]) // appending must not overwrite mdat
+			if err != nil {
+				return fmt.Errorf("sample %d: %w", nr, err)
+			}
+			trun.Samples[i].Size = uint32(len(data))
+			newData = append(newData, data...)
+			nr++
+		}
+		trun.Flags |= TrunSampleSizePresentFlag | TrunDataOffsetPresentFlag
+	}
+	f.Mdat.SetData(newData)
+	dataOffset := moof.Size() + f.Mdat.HeaderSize()
+	for _, trun := range traf.Truns {
+		trun.DataOffset = int32(dataOffset)
+		dataOffset += trun.SizeOfData()
+	}
+	return nil
+}
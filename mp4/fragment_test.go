@@ -1,6 +1,7 @@
 package mp4_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/Eyevinn/mp4ff/mp4"
@@ -62,3 +63,44 @@ func TestFragmentSampleIntervals(t *testing.T) {
 	}
 	sampleItvl.Reset()
 }
+
+func TestReplaceSampleData(t *testing.T) {
+	frag, err := mp4.CreateFragment(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		data := []byte{byte(i), byte(i)}
+		frag.AddFullSample(mp4.FullSample{
+			Sample:     mp4.Sample{Flags: mp4.SyncSampleFlags, Dur: 10, Size: uint32(len(data))},
+			DecodeTime: uint64(10 * i),
+			Data:       data,
+		})
+	}
+	err = frag.ReplaceSampleData(nil, func(nr int, data []byte) ([]byte, error) {
+		return append(data, make([]byte, nr)...), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := frag.Moof.Traf.Trun.DataOffset, int32(frag.Moof.Size()+8); got != want {
+		t.Errorf("data offset %d, want %d", got, want)
+	}
+	var buf bytes.Buffer
+	if err := frag.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fss, err := f.Segments[0].Fragments[0].GetFullSamples(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, fs := range fss {
+		if int(fs.Size) != 2+i || len(fs.Data) != 2+i || fs.Data[0] != byte(i) {
+			t.Errorf("sample %d: size %d, data %x", i, fs.Size, fs.Data)
+		}
+	}
+}
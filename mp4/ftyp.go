@@ -2,6 +2,7 @@ package mp4
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 
 	"github.com/Eyevinn/mp4ff/bits"
@@ -21,11 +22,17 @@ func (b *FtypBox) Copy() *FtypBox {
 
 // MajorBrand - major brand (4 chars)
 func (b *FtypBox) MajorBrand() string {
+	if len(b.data) < 4 {
+		return ""
+	}
 	return string(b.data[:4])
 }
 
 // MinorVersion - minor version
 func (b *FtypBox) MinorVersion() uint32 {
+	if len(b.data) < 8 {
+		return 0
+	}
 	return binary.BigEndian.Uint32(b.data[4:8])
 }
 
@@ -38,6 +45,9 @@ func (b *FtypBox) AddCompatibleBrands(compatibleBrands []string) {
 
 // CompatibleBrands - slice of compatible brands (4 chars each)
 func (b *FtypBox) CompatibleBrands() []string {
+	if len(b.data) < 8 {
+		return nil
+	}
 	nrCompatibleBrands := (len(b.data) - 8) / 4
 	if nrCompatibleBrands == 0 {
 		return nil
@@ -79,6 +89,9 @@ func DecodeFtyp(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
 
 // DecodeFtypSR - box-specific decode
 func DecodeFtypSR(hdr BoxHeader, startPos uint64, sr bits.SliceReader) (Box, error) {
+	if hdr.payloadLen() < 8 {
+		return nil, fmt.Errorf("ftyp: payload size %d less than 8", hdr.payloadLen())
+	}
 	return &FtypBox{data: sr.ReadBytes(hdr.payloadLen())}, sr.AccError()
 }
 
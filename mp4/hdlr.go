@@ -39,7 +39,7 @@ func CreateHdlr(mediaOrHdlrType string) (*HdlrBox, error) {
 	case "text", "wvtt":
 		hdlr.HandlerType = "text"
 		hdlr.Name = "mp4ff text handler"
-	case "meta":
+	case "meta", "evte":
 		hdlr.HandlerType = "meta"
 		hdlr.Name = "mp4ff timed metadata handler"
 	case "clcp":
@@ -0,0 +1,451 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// DecodeError - a problem found and skipped when decoding a file with DecLenient
+type DecodeError struct {
+	Offset uint64 `json:"offset"`
+	Type   string `json:"type,omitempty"` // box type, if a box header could be read
+	Reason string `json:"reason"`
+}
+
+// Error - text description of the decode error
+func (e DecodeError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("offset %d: %s", e.Offset, e.Reason)
+	}
+	return fmt.Sprintf("%s box at offset %d: %s", e.Type, e.Offset, e.Reason)
+}
+
+// resyncBoxTypes - top-level box types searched for when resynchronizing after a bad box
+var resyncBoxTypes = map[string]bool{
+	"ftyp": true, "styp": true, "moov": true, "moof": true, "mdat": true, "sidx": true, "ssix": true,
+	"emsg": true, "prft": true, "free": true, "skip": true, "mfra": true, "meta": true,
+}
+
+// lenientContainerTypes - boxes consisting only of child boxes, which are decoded child by child
+// if the box as a whole cannot be decoded
+var lenientContainerTypes = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true, "dinf": true, "edts": true,
+	"mvex": true, "moof": true, "traf": true, "udta": true, "mfra": true, "sinf": true, "schi": true,
+}
+
+// lenientDecoder - state of a lenient file decode
+type lenientDecoder struct {
+	f    *File
+	rs   io.ReadSeeker
+	end  uint64
+	lazy bool
+}
+
+func (d *lenientDecoder) addError(offset uint64, boxType, format string, args ...interface{}) {
+	d.f.DecodeErrors = append(d.f.DecodeErrors, DecodeError{Offset: offset, Type: boxType, Reason: fmt.Sprintf(format, args...)})
+}
+
+// decodeLenient decodes top-level boxes, recording errors in f.DecodeErrors instead of failing.
+// Bad boxes are decoded child by child, skipped, or skipped together with the bytes up to the next
+// plausible top-level box header. A truncated mdat box keeps the data that is present.
+func (f *File) decodeLenient(r io.Reader) error {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		rs = bytes.NewReader(data)
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	d := &lenientDecoder{f: f, rs: rs, end: uint64(end), lazy: f.fileDecMode == DecModeLazyMdat}
+	if (f.fileDecFlags & DecISMFlag) != 0 {
+		if err := f.findAndReadMfra(rs); err != nil {
+			d.addError(0, "mfra", "%v", err)
+		}
+	}
+	lastBoxType := ""
+	pos := uint64(0)
+	for pos < d.end {
+		hdr, ok := d.readHeader(pos, d.end)
+		if ok && pos+hdr.Size > d.end && hdr.Name != "mdat" {
+			// an unregistered type beyond the end is more likely garbage than a truncated box
+			_, registered := decoders[hdr.Name]
+			ok = registered
+		}
+		if !ok {
+			next := d.resync(pos + 1)
+			d.addError(pos, "", "no valid box header, skipped %d bytes", next-pos)
+			pos = next
+			continue
+		}
+		box := d.decodeBox(hdr, pos, d.end)
+		if box == nil {
+			if pos+hdr.Size > d.end {
+				next := d.resync(pos + 1)
+				pos = next
+				continue
+			}
+			pos += hdr.Size
+			continue
+		}
+		switch b := box.(type) {
+		case *MdatBox:
+			if f.isFragmented && lastBoxType != "moof" {
+				d.addError(pos, "mdat", "mdat after %s instead of moof", lastBoxType)
+			}
+		case *MoovBox:
+			if !d.checkMoov(b, pos) {
+				pos = d.next(pos, hdr.Size)
+				continue
+			}
+		case *MoofBox:
+			if !d.checkMoof(b, pos) {
+				pos = d.next(pos, hdr.Size)
+				continue
+			}
+			for _, traf := range b.Trafs {
+				if ok, parsed := traf.ContainsSencBox(); ok && !parsed && f.Moov != nil {
+					var defaultIVSize byte
+					if sinf := f.Moov.GetSinf(traf.Tfhd.TrackID); sinf != nil && sinf.Schi != nil && sinf.Schi.Tenc != nil {
+						defaultIVSize = sinf.Schi.Tenc.DefaultPerSampleIVSize
+					}
+					if err := traf.ParseReadSenc(defaultIVSize, pos); err != nil {
+						d.addError(pos, "senc", "%v", err)
+					}
+				}
+			}
+		}
+		f.AddChild(box, pos)
+		lastBoxType = hdr.Name
+		pos = d.next(pos, hdr.Size)
+	}
+	f.tfra = nil
+	return nil
+}
+
+// next returns the position after the box at pos with size, or the end if the box is truncated
+func (d *lenientDecoder) next(pos, size uint64) uint64 {
+	if pos+size > d.end {
+		return d.end
+	}
+	return pos + size
+}
+
+// checkMoov drops the traks that miss a box needed to use them, since a moov box decoded child by child
+// may lack any of them. It returns false if the moov box has no mvhd box or no trak box left.
+func (d *lenientDecoder) checkMoov(moov *MoovBox, pos uint64) bool {
+	if moov.Mvhd == nil {
+		d.addError(pos, "moov", "no mvhd box, skipped box")
+		return false
+	}
+	var traks []*TrakBox
+	children := make([]Box, 0, len(moov.Children))
+	trakNr := 0
+	for _, c := range moov.Children {
+		if trak, ok := c.(*TrakBox); ok {
+			trakNr++
+			if missing := missingTrakBox(trak); missing != "" {
+				d.addError(pos, "trak", "no %s box, skipped trak %d", missing, trakNr)
+				continue
+			}
+			traks = append(traks, trak)
+		}
+		children = append(children, c)
+	}
+	if len(traks) == 0 {
+		d.addError(pos, "moov", "no complete trak box, skipped box")
+		return false
+	}
+	moov.Children = children
+	moov.Traks = traks
+	moov.Trak = traks[0]
+	return true
+}
+
+// missingTrakBox returns the type of the first box missing in trak among those needed to use it,
+// or "" if none is missing
+func missingTrakBox(trak *TrakBox) string {
+	switch {
+	case trak.Tkhd == nil:
+		return "tkhd"
+	case trak.Mdia == nil:
+		return "mdia"
+	case trak.Mdia.Mdhd == nil:
+		return "mdhd"
+	case trak.Mdia.Hdlr == nil:
+		return "hdlr"
+	case trak.Mdia.Minf == nil:
+		return "minf"
+	case trak.Mdia.Minf.Stbl == nil:
+		return "stbl"
+	case trak.Mdia.Minf.Stbl.Stsd == nil:
+		return "stsd"
+	}
+	return ""
+}
+
+// checkMoof drops the traf boxes without tfhd box. It returns false if the moof box has no mfhd box.
+func (d *lenientDecoder) checkMoof(moof *MoofBox, pos uint64) bool {
+	if moof.Mfhd == nil {
+		d.addError(pos, "moof", "no mfhd box, skipped box")
+		return false
+	}
+	var trafs []*TrafBox
+	children := make([]Box, 0, len(moof.Children))
+	trafNr := 0
+	for _, c := range moof.Children {
+		if traf, ok := c.(*TrafBox); ok {
+			trafNr++
+			if traf.Tfhd == nil {
+				d.addError(pos, "traf", "no tfhd box, skipped traf %d", trafNr)
+				continue
+			}
+			trafs = append(trafs, traf)
+		}
+		children = append(children, c)
+	}
+	moof.Children = children
+	moof.Trafs = trafs
+	moof.Traf = nil
+	if len(trafs) > 0 {
+		moof.Traf = trafs[0]
+	}
+	return true
+}
+
+// readHeader reads a box header at pos, and checks that the type is printable and the size at least
+// the header size. Size 0 means that the box extends to parentEnd.
+func (d *lenientDecoder) readHeader(pos, parentEnd uint64) (BoxHeader, bool) {
+	if parentEnd-pos < boxHeaderSize {
+		return BoxHeader{}, false
+	}
+	buf := make([]byte, boxHeaderSize+largeSizeLen)
+	n, err := d.readAt(buf, pos)
+	if err != nil || n < boxHeaderSize {
+		return BoxHeader{}, false
+	}
+	boxType := string(buf[4:8])
+	if !isPrintableBoxType(buf[4:8]) {
+		return BoxHeader{}, false
+	}
+	size := uint64(binary.BigEndian.Uint32(buf[0:4]))
+	hdrLen := boxHeaderSize
+	switch size {
+	case 0:
+		size = parentEnd - pos
+	case 1:
+		if n < boxHeaderSize+largeSizeLen {
+			return BoxHeader{}, false
+		}
+		size = binary.BigEndian.Uint64(buf[8:16])
+		hdrLen += largeSizeLen
+	}
+	if size < uint64(hdrLen) {
+		return BoxHeader{}, false
+	}
+	return BoxHeader{Name: boxType, Size: size, Hdrlen: hdrLen}, true
+}
+
+func (d *lenientDecoder) readAt(buf []byte, pos uint64) (int, error) {
+	if _, err := d.rs.Seek(int64(pos), io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(d.rs, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// isPrintableBoxType - all bytes are printable ASCII or ©
+func isPrintableBoxType(b []byte) bool {
+	for _, c := range b {
+		if (c < 0x20 || c > 0x7e) && c != 0xa9 {
+			return false
+		}
+	}
+	return true
+}
+
+// resync returns the position of the next plausible top-level box header at or after pos, or the end.
+// A plausible header has a known top-level type and a size within the file, except for mdat.
+func (d *lenientDecoder) resync(pos uint64) uint64 {
+	const chunkSize = 1 << 16
+	buf := make([]byte, chunkSize+8)
+	for start := pos; start+8 <= d.end; start += chunkSize {
+		n, err := d.readAt(buf, start)
+		if err != nil {
+			break
+		}
+		for i := 0; i+8 <= n; i++ {
+			if !resyncBoxTypes[string(buf[i+4:i+8])] {
+				continue
+			}
+			hdr, ok := d.readHeader(start+uint64(i), d.end)
+			if ok && (hdr.Name == "mdat" || start+uint64(i)+hdr.Size <= d.end) {
+				return start + uint64(i)
+			}
+		}
+	}
+	return d.end
+}
+
+// decodeBox decodes the box with header hdr at pos. Boxes extending beyond parentEnd are truncated.
+// Decode errors are recorded, and nil is returned for a box that could not be decoded at all.
+func (d *lenientDecoder) decodeBox(hdr BoxHeader, pos, parentEnd uint64) Box {
+	avail := hdr.Size
+	if pos+avail > parentEnd {
+		avail = parentEnd - pos
+		if hdr.Name == "mdat" {
+			d.addError(pos, hdr.Name, "truncated: %d of %d bytes present", avail, hdr.Size)
+		} else {
+			d.addError(pos, hdr.Name, "truncated: %d of %d bytes present, decoding what is there", avail, hdr.Size)
+		}
+		hdr.Size = avail
+	}
+	if hdr.Name == "mdat" {
+		return d.decodeMdat(hdr, pos)
+	}
+	data := make([]byte, hdr.Size)
+	if n, err := d.readAt(data, pos); err != nil || uint64(n) != hdr.Size {
+		d.addError(pos, hdr.Name, "could not read box")
+		return nil
+	}
+	return d.decodeBoxData(hdr, pos, data)
+}
+
+// decodeBoxData decodes a box from data, which starts with the box header
+func (d *lenientDecoder) decodeBoxData(hdr BoxHeader, pos uint64, data []byte) Box {
+	body := bytes.NewReader(data[hdr.Hdrlen:])
+	box, err := DecodeBoxBody(pos, hdr, body)
+	if err == nil {
+		return box
+	}
+	switch {
+	case lenientContainerTypes[hdr.Name]:
+		d.addError(pos, hdr.Name, "%v, decoding children one by one", err)
+		return d.decodeContainer(hdr, pos, data)
+	case hdr.Name == "trun":
+		if trun := salvageTrun(data, pos); trun != nil {
+			d.addError(pos, hdr.Name, "%v, kept %d of %d samples", err, trun.SampleCount(), binary.BigEndian.Uint32(data[12:16]))
+			return trun
+		}
+	}
+	d.addError(pos, hdr.Name, "%v, skipped box", err)
+	return nil
+}
+
+// decodeContainer decodes the children of a container box one by one, and keeps those that can be decoded
+func (d *lenientDecoder) decodeContainer(hdr BoxHeader, pos uint64, data []byte) Box {
+	parent, ok := newZeroBox(hdr.Name)
+	if !ok {
+		return nil
+	}
+	end := uint64(len(data))
+	for cpos := uint64(hdr.Hdrlen); cpos < end; {
+		chdr, ok := headerFromData(data[cpos:], end-cpos)
+		if !ok {
+			d.addError(pos+cpos, "", "no valid box header in %s, skipped %d bytes", hdr.Name, end-cpos)
+			break
+		}
+		if cpos+chdr.Size > end {
+			d.addError(pos+cpos, chdr.Name, "%d bytes beyond %s box, decoding what is there", cpos+chdr.Size-end, hdr.Name)
+			chdr.Size = end - cpos
+		}
+		child := d.decodeBoxData(chdr, pos+cpos, data[cpos:cpos+chdr.Size])
+		if child != nil {
+			if err := addChildBox(parent, child); err != nil {
+				d.addError(pos+cpos, chdr.Name, "%v", err)
+			}
+		}
+		cpos += chdr.Size
+	}
+	return parent
+}
+
+// headerFromData parses a box header at the start of data, like readHeader
+func headerFromData(data []byte, parentSize uint64) (BoxHeader, bool) {
+	if len(data) < boxHeaderSize || !isPrintableBoxType(data[4:8]) {
+		return BoxHeader{}, false
+	}
+	size := uint64(binary.BigEndian.Uint32(data[0:4]))
+	hdrLen := boxHeaderSize
+	switch size {
+	case 0:
+		size = parentSize
+	case 1:
+		if len(data) < boxHeaderSize+largeSizeLen {
+			return BoxHeader{}, false
+		}
+		size = binary.BigEndian.Uint64(data[8:16])
+		hdrLen += largeSizeLen
+	}
+	if size < uint64(hdrLen) {
+		return BoxHeader{}, false
+	}
+	return BoxHeader{Name: string(data[4:8]), Size: size, Hdrlen: hdrLen}, true
+}
+
+// salvageTrun decodes a trun box with the sample count reduced to the samples that fit in the box
+func salvageTrun(data []byte, pos uint64) *TrunBox {
+	if len(data) < 16 || binary.BigEndian.Uint32(data[0:4]) == 1 {
+		return nil
+	}
+	flags := binary.BigEndian.Uint32(data[8:12]) & 0xffffff
+	fixedSize := 16
+	if flags&TrunDataOffsetPresentFlag != 0 {
+		fixedSize += 4
+	}
+	if flags&TrunFirstSampleFlagsPresentFlag != 0 {
+		fixedSize += 4
+	}
+	sampleSize := 0
+	for _, flag := range []uint32{TrunSampleDurationPresentFlag, TrunSampleSizePresentFlag,
+		TrunSampleFlagsPresentFlag, TrunSampleCompositionTimeOffsetPresentFlag} {
+		if flags&flag != 0 {
+			sampleSize += 4
+		}
+	}
+	if len(data) < fixedSize {
+		return nil
+	}
+	sampleCount := binary.BigEndian.Uint32(data[12:16])
+	fits := sampleCount
+	if sampleSize > 0 && uint32(len(data)-fixedSize)/uint32(sampleSize) < fits {
+		fits = uint32(len(data)-fixedSize) / uint32(sampleSize)
+	}
+	fixed := make([]byte, fixedSize+int(fits)*sampleSize)
+	copy(fixed, data)
+	binary.BigEndian.PutUint32(fixed[0:4], uint32(len(fixed)))
+	binary.BigEndian.PutUint32(fixed[12:16], fits)
+	box, err := DecodeBox(pos, bytes.NewReader(fixed))
+	if err != nil {
+		return nil
+	}
+	return box.(*TrunBox)
+}
+
+// decodeMdat decodes an mdat box, keeping the data that is present if it is truncated
+func (d *lenientDecoder) decodeMdat(hdr BoxHeader, pos uint64) Box {
+	mdat := &MdatBox{StartPos: pos, LargeSize: hdr.Hdrlen > boxHeaderSize}
+	payloadSize := hdr.Size - uint64(hdr.Hdrlen)
+	if d.lazy {
+		mdat.SetLazyDataSize(payloadSize)
+		return mdat
+	}
+	mdat.Data = make([]byte, payloadSize)
+	if n, err := d.readAt(mdat.Data, pos+uint64(hdr.Hdrlen)); err != nil || uint64(n) != payloadSize {
+		d.addError(pos, hdr.Name, "could not read data")
+		mdat.Data = mdat.Data[:n]
+	}
+	return mdat
+}
@@ -0,0 +1,269 @@
+package mp4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestLenientDecodeFragmented(t *testing.T) {
+	data, err := os.ReadFile("testdata/v300_multiple_segments.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := mp4.DecodeFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondMoof := orig.Segments[1].Fragments[0].Moof.StartPos
+	lastMdat := orig.Segments[3].Fragments[0].Mdat
+
+	garbage := bytes.Repeat([]byte{0xab}, 333)
+	var corrupt []byte
+	corrupt = append(corrupt, data[:secondMoof]...)
+	corrupt = append(corrupt, garbage...)
+	corrupt = append(corrupt, data[secondMoof:lastMdat.PayloadAbsoluteOffset()+20000]...)
+
+	if _, err := mp4.DecodeFile(bytes.NewReader(corrupt)); err == nil {
+		t.Error("expected error from normal decode")
+	}
+	f, err := mp4.DecodeFile(bytes.NewReader(corrupt), mp4.WithDecodeFlags(mp4.DecLenient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.DecodeErrors) != 2 {
+		t.Fatalf("got %d decode errors instead of 2: %v", len(f.DecodeErrors), f.DecodeErrors)
+	}
+	if f.DecodeErrors[0].Offset != secondMoof || f.DecodeErrors[1].Type != "mdat" {
+		t.Errorf("unexpected decode errors %v", f.DecodeErrors)
+	}
+	if len(f.Segments) != 4 {
+		t.Fatalf("got %d segments instead of 4", len(f.Segments))
+	}
+	statuses, err := f.CheckSampleData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 4 {
+		t.Fatalf("got %d statuses instead of 4", len(statuses))
+	}
+	for i, st := range statuses {
+		if i < 3 && !st.Complete() {
+			t.Errorf("fragment %d: %d of %d samples usable", st.FragmentNr, st.NrUsable, st.NrSamples)
+		}
+	}
+	last := statuses[3]
+	if last.Complete() || last.NrUsable == 0 {
+		t.Fatalf("last fragment: %d of %d samples usable", last.NrUsable, last.NrSamples)
+	}
+
+	repaired, err := mp4.Repair(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := repaired.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.Segments) != 4 {
+		t.Fatalf("got %d repaired segments instead of 4", len(dec.Segments))
+	}
+	trex, _ := dec.Moov.Mvex.GetTrex(last.TrackID)
+	origTrex, _ := orig.Moov.Mvex.GetTrex(last.TrackID)
+	wantSamples, err := orig.Segments[3].Fragments[0].GetFullSamples(origTrex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotSamples, err := dec.Segments[3].Fragments[0].GetFullSamples(trex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotSamples) != last.NrUsable {
+		t.Fatalf("got %d samples in last fragment instead of %d", len(gotSamples), last.NrUsable)
+	}
+	for i, s := range gotSamples {
+		want := wantSamples[i]
+		if s.DecodeTime != want.DecodeTime || s.Flags != want.Flags || s.CompositionTimeOffset != want.CompositionTimeOffset ||
+			!bytes.Equal(s.Data, want.Data) {
+			t.Fatalf("sample %d differs", i+1)
+		}
+	}
+}
+
+func TestLenientDecodeBadTrun(t *testing.T) {
+	data, err := os.ReadFile("testdata/v300_multiple_segments.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := mp4.DecodeFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moof := orig.Segments[0].Fragments[0].Moof
+	trun := moof.Traf.Trun
+	trunPos := int(moof.StartPos) + bytes.Index(data[moof.StartPos:], []byte("trun")) - 4
+	corrupt := make([]byte, len(data))
+	copy(corrupt, data)
+	binary.BigEndian.PutUint32(corrupt[trunPos+12:], trun.SampleCount()+1000)
+
+	if _, err := mp4.DecodeFile(bytes.NewReader(corrupt)); err == nil {
+		t.Error("expected error from normal decode")
+	}
+	f, err := mp4.DecodeFile(bytes.NewReader(corrupt), mp4.WithDecodeFlags(mp4.DecLenient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.DecodeErrors) == 0 {
+		t.Fatal("no decode errors")
+	}
+	if len(f.Segments) != 4 {
+		t.Fatalf("got %d segments instead of 4", len(f.Segments))
+	}
+	gotTrun := f.Segments[0].Fragments[0].Moof.Traf.Trun
+	if gotTrun == nil || gotTrun.SampleCount() != trun.SampleCount() {
+		t.Fatalf("trun not salvaged")
+	}
+}
+
+func TestRepairProgressive(t *testing.T) {
+	data, err := os.ReadFile("testdata/prog_8s.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := data[:len(data)/2]
+	if _, err := mp4.DecodeFile(bytes.NewReader(truncated)); err == nil {
+		t.Error("expected error from normal decode")
+	}
+	f, err := mp4.DecodeFile(bytes.NewReader(truncated), mp4.WithDecodeFlags(mp4.DecLenient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.DecodeErrors) != 1 || f.DecodeErrors[0].Type != "mdat" {
+		t.Fatalf("unexpected decode errors %v", f.DecodeErrors)
+	}
+	statuses, err := f.CheckSampleData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("got %d statuses instead of 2", len(statuses))
+	}
+	for _, st := range statuses {
+		if st.Complete() || st.NrUsable == 0 {
+			t.Errorf("track %d: %d of %d samples usable", st.TrackID, st.NrUsable, st.NrSamples)
+		}
+	}
+	repaired, err := mp4.Repair(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := repaired.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err = dec.CheckSampleData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range statuses {
+		if !st.Complete() || st.NrSamples == 0 {
+			t.Errorf("repaired track %d: %d of %d samples usable", st.TrackID, st.NrUsable, st.NrSamples)
+		}
+	}
+}
+
+func TestRepairCorruptCopies(t *testing.T) {
+	cases := []struct {
+		file string
+		// truncation percentages, and number of copies with flipped bits
+		truncPcts []int
+		nrFlipped int
+	}{
+		{file: "init.mp4", truncPcts: []int{5, 30, 60, 90}, nrFlipped: 100},
+		{file: "init_prog.mp4", truncPcts: []int{5, 30, 60, 90}, nrFlipped: 100},
+		{file: "prog_8s.mp4", truncPcts: []int{1, 2, 50}, nrFlipped: 100},
+		{file: "v300_multiple_segments.mp4", truncPcts: []int{10, 50}, nrFlipped: 100},
+		{file: "bbb5s_aac_sidx.mp4", truncPcts: []int{10, 50}, nrFlipped: 100},
+		{file: "cbcs.mp4", truncPcts: []int{10, 50}, nrFlipped: 100},
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile("testdata/" + c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var copies [][]byte
+		for _, pct := range c.truncPcts {
+			copies = append(copies, data[:len(data)*pct/100])
+		}
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < c.nrFlipped; i++ {
+			flipped := append([]byte(nil), data...)
+			// most boxes other than mdat are in the first kilobytes
+			end := len(flipped)
+			if end > 8192 && i%2 == 0 {
+				end = 8192
+			}
+			for j := 0; j < 1+rng.Intn(16); j++ {
+				flipped[rng.Intn(end)] ^= 1 << rng.Intn(8)
+			}
+			copies = append(copies, flipped)
+		}
+		for i, corrupt := range copies {
+			f, err := mp4.DecodeFile(bytes.NewReader(corrupt), mp4.WithDecodeFlags(mp4.DecLenient))
+			if err != nil {
+				t.Fatalf("%s copy %d: %v", c.file, i, err)
+			}
+			// errors are expected for some copies, but no panics
+			_ = checkRepairAndEncode(f)
+		}
+	}
+}
+
+func checkRepairAndEncode(f *mp4.File) error {
+	if _, err := f.CheckSampleData(); err != nil {
+		return err
+	}
+	repaired, err := mp4.Repair(f)
+	if err != nil {
+		return err
+	}
+	return repaired.Encode(io.Discard)
+}
+
+func TestLenientDecodeIncompleteTrak(t *testing.T) {
+	data, err := os.ReadFile("testdata/init.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.DecodeFile(bytes.NewReader(data[:len(data)*30/100]), mp4.WithDecodeFlags(mp4.DecLenient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Moov != nil || f.Init != nil {
+		t.Fatalf("moov box without complete trak kept")
+	}
+	found := false
+	for _, decErr := range f.DecodeErrors {
+		found = found || (decErr.Type == "trak" && strings.HasPrefix(decErr.Reason, "no tkhd box"))
+	}
+	if !found {
+		t.Errorf("no decode error for skipped trak: %v", f.DecodeErrors)
+	}
+	if _, err := f.CheckSampleData(); err == nil {
+		t.Error("expected error for file without moov")
+	}
+}
@@ -0,0 +1,663 @@
+package mp4
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/Eyevinn/mp4ff/bits"
+)
+
+// decodeSampleEntryChildren decodes the child boxes that follow the fields of a sample entry.
+func decodeSampleEntryChildren(hdr BoxHeader, startPos uint64, sr bits.SliceReader, initPos int, addChild func(Box)) error {
+	payloadLen := hdr.payloadLen()
+	pos := startPos + uint64(hdr.Hdrlen+sr.GetPos()-initPos)
+	for payloadLen-(sr.GetPos()-initPos) > 0 {
+		box, err := DecodeBoxSR(pos, sr)
+		if err != nil {
+			return err
+		}
+		if box == nil {
+			return fmt.Errorf("no %s child", hdr.Name)
+		}
+		addChild(box)
+		pos += box.Size()
+	}
+	return sr.AccError()
+}
+
+// encodeSampleEntryChildren writes children to sw.
+func encodeSampleEntryChildren(children []Box, sw bits.SliceWriter) error {
+	for _, child := range children {
+		if err := child.EncodeSW(sw); err != nil {
+			return err
+		}
+	}
+	return sw.AccError()
+}
+
+// infoSampleEntryChildren writes the info of children to w.
+func infoSampleEntryChildren(children []Box, w io.Writer, specificBoxLevels, indent, indentStep string) error {
+	for _, child := range children {
+		if err := child.Info(w, specificBoxLevels, indent+indentStep, indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeViaSW encodes b to w via a SliceWriter.
+func encodeViaSW(b Box, w io.Writer) error {
+	sw := bits.NewFixedSliceWriter(int(b.Size()))
+	err := b.EncodeSW(sw)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(sw.Bytes())
+	return err
+}
+
+// ID3SampleEntryBox - ID3 timed metadata sample entry (id3 )
+// Defined in AOM "Carriage of ID3 Timed Metadata in the Common Media Application Format".
+// It is a plain MetaDataSampleEntry and each sample is a complete ID3v2 tag.
+type ID3SampleEntryBox struct {
+	Btrt               *BtrtBox
+	Children           []Box
+	DataReferenceIndex uint16
+}
+
+// AddChild - add a child box (normally only btrt)
+func (b *ID3SampleEntryBox) AddChild(child Box) {
+	if btrt, ok := child.(*BtrtBox); ok {
+		b.Btrt = btrt
+	}
+	b.Children = append(b.Children, child)
+}
+
+// DecodeID3SampleEntry - Decode ID3 timed metadata sample entry (id3 )
+func DecodeID3SampleEntry(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
+	data, err := readBoxBody(r, hdr)
+	if err != nil {
+		return nil, err
+	}
+	sr := bits.NewFixedSliceReader(data)
+	return DecodeID3SampleEntrySR(hdr, startPos, sr)
+}
+
+// DecodeID3SampleEntrySR - Decode ID3 timed metadata sample entry (id3 )
+func DecodeID3SampleEntrySR(hdr BoxHeader, startPos uint64, sr bits.SliceReader) (Box, error) {
+	b := &ID3SampleEntryBox{}
+	initPos := sr.GetPos()
+	sr.SkipBytes(6) // Skip 6 reserved bytes
+	b.DataReferenceIndex = sr.ReadUint16()
+	if err := decodeSampleEntryChildren(hdr, startPos, sr, initPos, b.AddChild); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Type - return box type
+func (b *ID3SampleEntryBox) Type() string {
+	return "id3 "
+}
+
+// Size - return calculated size
+func (b *ID3SampleEntryBox) Size() uint64 {
+	size := uint64(boxHeaderSize + 8)
+	for _, child := range b.Children {
+		size += child.Size()
+	}
+	return size
+}
+
+// Encode - write box to w via a SliceWriter
+func (b *ID3SampleEntryBox) Encode(w io.Writer) error {
+	return encodeViaSW(b, w)
+}
+
+// EncodeSW - write box to sw
+func (b *ID3SampleEntryBox) EncodeSW(sw bits.SliceWriter) error {
+	err := EncodeHeaderSW(b, sw)
+	if err != nil {
+		return err
+	}
+	sw.WriteZeroBytes(6)
+	sw.WriteUint16(b.DataReferenceIndex)
+	return encodeSampleEntryChildren(b.Children, sw)
+}
+
+// Info - write specific box info to w
+func (b *ID3SampleEntryBox) Info(w io.Writer, specificBoxLevels, indent, indentStep string) error {
+	bd := newInfoDumper(w, indent, b, -1, 0)
+	bd.write(" - dataReferenceIndex: %d", b.DataReferenceIndex)
+	if bd.err != nil {
+		return bd.err
+	}
+	return infoSampleEntryChildren(b.Children, w, specificBoxLevels, indent, indentStep)
+}
+
+// MetxBox - XMLMetaDataSampleEntry (metx)
+// Defined in ISO/IEC 14496-12 Sec. 12.3.3.
+type MetxBox struct {
+	ContentEncoding    string // Optional, empty if not encoded
+	Namespace          string
+	SchemaLocation     string // Optional
+	Btrt               *BtrtBox
+	Children           []Box
+	DataReferenceIndex uint16
+	noSchemaLocation   bool // schema_location string missing (not even a zero byte)
+}
+
+// AddChild - add a child box (normally only btrt)
+func (b *MetxBox) AddChild(child Box) {
+	if btrt, ok := child.(*BtrtBox); ok {
+		b.Btrt = btrt
+	}
+	b.Children = append(b.Children, child)
+}
+
+// DecodeMetx - Decode XMLMetaDataSampleEntry (metx)
+func DecodeMetx(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
+	data, err := readBoxBody(r, hdr)
+	if err != nil {
+		return nil, err
+	}
+	sr := bits.NewFixedSliceReader(data)
+	return DecodeMetxSR(hdr, startPos, sr)
+}
+
+// DecodeMetxSR - Decode XMLMetaDataSampleEntry (metx)
+func DecodeMetxSR(hdr BoxHeader, startPos uint64, sr bits.SliceReader) (Box, error) {
+	payloadLen := hdr.payloadLen()
+	b := &MetxBox{}
+	initPos := sr.GetPos()
+	sr.SkipBytes(6) // Skip 6 reserved bytes
+	b.DataReferenceIndex = sr.ReadUint16()
+	b.ContentEncoding = sr.ReadZeroTerminatedString(payloadLen - 8)
+	b.Namespace = sr.ReadZeroTerminatedString(payloadLen - (sr.GetPos() - initPos))
+	if maxLen := payloadLen - (sr.GetPos() - initPos); maxLen > 0 {
+		b.SchemaLocation = sr.ReadZeroTerminatedString(maxLen)
+	} else {
+		b.noSchemaLocation = true
+	}
+	if err := sr.AccError(); err != nil {
+		return nil, fmt.Errorf("DecodeMetx: %w", err)
+	}
+	if err := decodeSampleEntryChildren(hdr, startPos, sr, initPos, b.AddChild); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Type - return box type
+func (b *MetxBox) Type() string {
+	return "metx"
+}
+
+// Size - return calculated size
+func (b *MetxBox) Size() uint64 {
+	size := uint64(boxHeaderSize + 8 + len(b.ContentEncoding) + 1 + len(b.Namespace) + 1)
+	if !b.noSchemaLocation || b.SchemaLocation != "" {
+		size += uint64(len(b.SchemaLocation) + 1)
+	}
+	for _, child := range b.Children {
+		size += child.Size()
+	}
+	return size
+}
+
+// Encode - write box to w via a SliceWriter
+func (b *MetxBox) Encode(w io.Writer) error {
+	return encodeViaSW(b, w)
+}
+
+// EncodeSW - write box to sw
+func (b *MetxBox) EncodeSW(sw bits.SliceWriter) error {
+	err := EncodeHeaderSW(b, sw)
+	if err != nil {
+		return err
+	}
+	sw.WriteZeroBytes(6)
+	sw.WriteUint16(b.DataReferenceIndex)
+	sw.WriteString(b.ContentEncoding, true)
+	sw.WriteString(b.Namespace, true)
+	if !b.noSchemaLocation || b.SchemaLocation != "" {
+		sw.WriteString(b.SchemaLocation, true)
+	}
+	return encodeSampleEntryChildren(b.Children, sw)
+}
+
+// Info - write specific box info to w
+func (b *MetxBox) Info(w io.Writer, specificBoxLevels, indent, indentStep string) error {
+	bd := newInfoDumper(w, indent, b, -1, 0)
+	bd.write(" - dataReferenceIndex: %d", b.DataReferenceIndex)
+	bd.write(" - contentEncoding: %q", b.ContentEncoding)
+	bd.write(" - namespace: %q", b.Namespace)
+	bd.write(" - schemaLocation: %q", b.SchemaLocation)
+	if bd.err != nil {
+		return bd.err
+	}
+	return infoSampleEntryChildren(b.Children, w, specificBoxLevels, indent, indentStep)
+}
+
+// MettBox - TextMetaDataSampleEntry (mett)
+// Defined in ISO/IEC 14496-12 Sec. 12.3.3.
+type MettBox struct {
+	ContentEncoding    string // Optional, empty if not encoded
+	MimeFormat         string
+	Btrt               *BtrtBox
+	TxtC               *TxtCBox // Optional
+	Children           []Box
+	DataReferenceIndex uint16
+}
+
+// AddChild - add a child box (btrt and txtC)
+func (b *MettBox) AddChild(child Box) {
+	switch box := child.(type) {
+	case *BtrtBox:
+		b.Btrt = box
+	case *TxtCBox:
+		b.TxtC = box
+	}
+	b.Children = append(b.Children, child)
+}
+
+// DecodeMett - Decode TextMetaDataSampleEntry (mett)
+func DecodeMett(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
+	data, err := readBoxBody(r, hdr)
+	if err != nil {
+		return nil, err
+	}
+	sr := bits.NewFixedSliceReader(data)
+	return DecodeMettSR(hdr, startPos, sr)
+}
+
+// DecodeMettSR - Decode TextMetaDataSampleEntry (mett)
+func DecodeMettSR(hdr BoxHeader, startPos uint64, sr bits.SliceReader) (Box, error) {
+	payloadLen := hdr.payloadLen()
+	b := &MettBox{}
+	initPos := sr.GetPos()
+	sr.SkipBytes(6) // Skip 6 reserved bytes
+	b.DataReferenceIndex = sr.ReadUint16()
+	b.ContentEncoding = sr.ReadZeroTerminatedString(payloadLen - 8)
+	b.MimeFormat = sr.ReadZeroTerminatedString(payloadLen - (sr.GetPos() - initPos))
+	if err := sr.AccError(); err != nil {
+		return nil, fmt.Errorf("DecodeMett: %w", err)
+	}
+	if err := decodeSampleEntryChildren(hdr, startPos, sr, initPos, b.AddChild); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Type - return box type
+func (b *MettBox) Type() string {
+	return "mett"
+}
+
+// Size - return calculated size
+func (b *MettBox) Size() uint64 {
+	size := uint64(boxHeaderSize + 8 + len(b.ContentEncoding) + 1 + len(b.MimeFormat) + 1)
+	for _, child := range b.Children {
+		size += child.Size()
+	}
+	return size
+}
+
+// Encode - write box to w via a SliceWriter
+func (b *MettBox) Encode(w io.Writer) error {
+	return encodeViaSW(b, w)
+}
+
+// EncodeSW - write box to sw
+func (b *MettBox) EncodeSW(sw bits.SliceWriter) error {
+	err := EncodeHeaderSW(b, sw)
+	if err != nil {
+		return err
+	}
+	sw.WriteZeroBytes(6)
+	sw.WriteUint16(b.DataReferenceIndex)
+	sw.WriteString(b.ContentEncoding, true)
+	sw.WriteString(b.MimeFormat, true)
+	return encodeSampleEntryChildren(b.Children, sw)
+}
+
+// Info - write specific box info to w
+func (b *MettBox) Info(w io.Writer, specificBoxLevels, indent, indentStep string) error {
+	bd := newInfoDumper(w, indent, b, -1, 0)
+	bd.write(" - dataReferenceIndex: %d", b.DataReferenceIndex)
+	bd.write(" - contentEncoding: %q", b.ContentEncoding)
+	bd.write(" - mimeFormat: %q", b.MimeFormat)
+	if bd.err != nil {
+		return bd.err
+	}
+	return infoSampleEntryChildren(b.Children, w, specificBoxLevels, indent, indentStep)
+}
+
+// TxtCBox - TextConfigBox (txtC)
+// Defined in ISO/IEC 14496-12 Sec. 12.5.3.2. Holds the initial text of each document.
+type TxtCBox struct {
+	Version    byte
+	Flags      uint32
+	TextConfig string
+}
+
+// DecodeTxtC - box-specific decode
+func DecodeTxtC(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
+	data, err := readBoxBody(r, hdr)
+	if err != nil {
+		return nil, err
+	}
+	sr := bits.NewFixedSliceReader(data)
+	return DecodeTxtCSR(hdr, startPos, sr)
+}
+
+// DecodeTxtCSR - box-specific decode
+func DecodeTxtCSR(hdr BoxHeader, startPos uint64, sr bits.SliceReader) (Box, error) {
+	versionAndFlags := sr.ReadUint32()
+	b := &TxtCBox{
+		Version: byte(versionAndFlags >> 24),
+		Flags:   versionAndFlags & flagsMask,
+	}
+	b.TextConfig = sr.ReadZeroTerminatedString(hdr.payloadLen() - 4)
+	return b, sr.AccError()
+}
+
+// Type - return box type
+func (b *TxtCBox) Type() string {
+	return "txtC"
+}
+
+// Size - return calculated size
+func (b *TxtCBox) Size() uint64 {
+	return uint64(boxHeaderSize + 4 + len(b.TextConfig) + 1)
+}
+
+// Encode - write box to w
+func (b *TxtCBox) Encode(w io.Writer) error {
+	return encodeViaSW(b, w)
+}
+
+// EncodeSW - box-specific encode to slicewriter
+func (b *TxtCBox) EncodeSW(sw bits.SliceWriter) error {
+	err := EncodeHeaderSW(b, sw)
+	if err != nil {
+		return err
+	}
+	sw.WriteUint32(uint32(b.Version)<<24 | b.Flags)
+	sw.WriteString(b.TextConfig, true)
+	return sw.AccError()
+}
+
+// Info - write box-specific information
+func (b *TxtCBox) Info(w io.Writer, specificBoxLevels, indent, indentStep string) error {
+	bd := newInfoDumper(w, indent, b, int(b.Version), b.Flags)
+	bd.write(" - textConfig: %q", b.TextConfig)
+	return bd.err
+}
+
+// UrimBox - URIMetaSampleEntry (urim)
+// Defined in ISO/IEC 14496-12 Sec. 12.3.3. The uri box identifies the format of the samples.
+type UrimBox struct {
+	URI                *URIBox
+	URIInit            *URIInitBox // Optional
+	Btrt               *BtrtBox
+	Children           []Box
+	DataReferenceIndex uint16
+}
+
+// AddChild - add a child box (uri, uriI and btrt)
+func (b *UrimBox) AddChild(child Box) {
+	switch box := child.(type) {
+	case *URIBox:
+		b.URI = box
+	case *URIInitBox:
+		b.URIInit = box
+	case *BtrtBox:
+		b.Btrt = box
+	}
+	b.Children = append(b.Children, child)
+}
+
+// DecodeUrim - Decode URIMetaSampleEntry (urim)
+func DecodeUrim(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
+	data, err := readBoxBody(r, hdr)
+	if err != nil {
+		return nil, err
+	}
+	sr := bits.NewFixedSliceReader(data)
+	return DecodeUrimSR(hdr, startPos, sr)
+}
+
+// DecodeUrimSR - Decode URIMetaSampleEntry (urim)
+func DecodeUrimSR(hdr BoxHeader, startPos uint64, sr bits.SliceReader) (Box, error) {
+	b := &UrimBox{}
+	initPos := sr.GetPos()
+	sr.SkipBytes(6) // Skip 6 reserved bytes
+	b.DataReferenceIndex = sr.ReadUint16()
+	if err := decodeSampleEntryChildren(hdr, startPos, sr, initPos, b.AddChild); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Type - return box type
+func (b *UrimBox) Type() string {
+	return "urim"
+}
+
+// Size - return calculated size
+func (b *UrimBox) Size() uint64 {
+	size := uint64(boxHeaderSize + 8)
+	for _, child := range b.Children {
+		size += child.Size()
+	}
+	return size
+}
+
+// Encode - write box to w via a SliceWriter
+func (b *UrimBox) Encode(w io.Writer) error {
+	return encodeViaSW(b, w)
+}
+
+// EncodeSW - write box to sw
+func (b *UrimBox) EncodeSW(sw bits.SliceWriter) error {
+	err := EncodeHeaderSW(b, sw)
+	if err != nil {
+		return err
+	}
+	sw.WriteZeroBytes(6)
+	sw.WriteUint16(b.DataReferenceIndex)
+	return encodeSampleEntryChildren(b.Children, sw)
+}
+
+// Info - write specific box info to w
+func (b *UrimBox) Info(w io.Writer, specificBoxLevels, indent, indentStep string) error {
+	bd := newInfoDumper(w, indent, b, -1, 0)
+	bd.write(" - dataReferenceIndex: %d", b.DataReferenceIndex)
+	if bd.err != nil {
+		return bd.err
+	}
+	return infoSampleEntryChildren(b.Children, w, specificBoxLevels, indent, indentStep)
+}
+
+// URIBox - URIBox (uri )
+// Defined in ISO/IEC 14496-12 Sec. 12.3.3.
+type URIBox struct {
+	Version byte
+	Flags   uint32
+	URI     string
+}
+
+// DecodeURI - box-specific decode
+func DecodeURI(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
+	data, err := readBoxBody(r, hdr)
+	if err != nil {
+		return nil, err
+	}
+	sr := bits.NewFixedSliceReader(data)
+	return DecodeURISR(hdr, startPos, sr)
+}
+
+// DecodeURISR - box-specific decode
+func DecodeURISR(hdr BoxHeader, startPos uint64, sr bits.SliceReader) (Box, error) {
+	versionAndFlags := sr.ReadUint32()
+	b := &URIBox{
+		Version: byte(versionAndFlags >> 24),
+		Flags:   versionAndFlags & flagsMask,
+	}
+	b.URI = sr.ReadZeroTerminatedString(hdr.payloadLen() - 4)
+	return b, sr.AccError()
+}
+
+// Type - return box type
+func (b *URIBox) Type() string {
+	return "uri "
+}
+
+// Size - return calculated size
+func (b *URIBox) Size() uint64 {
+	return uint64(boxHeaderSize + 4 + len(b.URI) + 1)
+}
+
+// Encode - write box to w
+func (b *URIBox) Encode(w io.Writer) error {
+	return encodeViaSW(b, w)
+}
+
+// EncodeSW - box-specific encode to slicewriter
+func (b *URIBox) EncodeSW(sw bits.SliceWriter) error {
+	err := EncodeHeaderSW(b, sw)
+	if err != nil {
+		return err
+	}
+	sw.WriteUint32(uint32(b.Version)<<24 | b.Flags)
+	sw.WriteString(b.URI, true)
+	return sw.AccError()
+}
+
+// Info - write box-specific information
+func (b *URIBox) Info(w io.Writer, specificBoxLevels, indent, indentStep string) error {
+	bd := newInfoDumper(w, indent, b, int(b.Version), b.Flags)
+	bd.write(" - uri: %q", b.URI)
+	return bd.err
+}
+
+// URIInitBox - URIInitBox (uriI)
+// Defined in ISO/IEC 14496-12 Sec. 12.3.3. Holds format-specific initialization data.
+type URIInitBox struct {
+	Version  byte
+	Flags    uint32
+	InitData []byte
+}
+
+// DecodeURIInit - box-specific decode
+func DecodeURIInit(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
+	data, err := readBoxBody(r, hdr)
+	if err != nil {
+		return nil, err
+	}
+	sr := bits.NewFixedSliceReader(data)
+	return DecodeURIInitSR(hdr, startPos, sr)
+}
+
+// DecodeURIInitSR - box-specific decode
+func DecodeURIInitSR(hdr BoxHeader, startPos uint64, sr bits.SliceReader) (Box, error) {
+	versionAndFlags := sr.ReadUint32()
+	b := &URIInitBox{
+		Version: byte(versionAndFlags >> 24),
+		Flags:   versionAndFlags & flagsMask,
+	}
+	b.InitData = sr.ReadBytes(hdr.payloadLen() - 4)
+	return b, sr.AccError()
+}
+
+// Type - return box type
+func (b *URIInitBox) Type() string {
+	return "uriI"
+}
+
+// Size - return calculated size
+func (b *URIInitBox) Size() uint64 {
+	return uint64(boxHeaderSize + 4 + len(b.InitData))
+}
+
+// Encode - write box to w
+func (b *URIInitBox) Encode(w io.Writer) error {
+	return encodeViaSW(b, w)
+}
+
+// EncodeSW - box-specific encode to slicewriter
+func (b *URIInitBox) EncodeSW(sw bits.SliceWriter) error {
+	err := EncodeHeaderSW(b, sw)
+	if err != nil {
+		return err
+	}
+	sw.WriteUint32(uint32(b.Version)<<24 | b.Flags)
+	sw.WriteBytes(b.InitData)
+	return sw.AccError()
+}
+
+// Info - write box-specific information
+func (b *URIInitBox) Info(w io.Writer, specificBoxLevels, indent, indentStep string) error {
+	bd := newInfoDumper(w, indent, b, int(b.Version), b.Flags)
+	bd.write(" - initData: %s", hex.EncodeToString(b.InitData))
+	return bd.err
+}
+
+// SetID3Descriptor sets an ID3 timed metadata sample entry (id3 ) on a track created with
+// media type "meta".
+func (t *TrakBox) SetID3Descriptor() error {
+	t.Mdia.Minf.Stbl.Stsd.AddChild(&ID3SampleEntryBox{DataReferenceIndex: 1})
+	return nil
+}
+
+// SetMetxDescriptor sets an XML metadata sample entry (metx) on a track created with media
+// type "meta". contentEncoding and schemaLocation may be empty.
+func (t *TrakBox) SetMetxDescriptor(contentEncoding, namespace, schemaLocation string) error {
+	if namespace == "" {
+		return fmt.Errorf("metx namespace must not be empty")
+	}
+	metx := &MetxBox{
+		ContentEncoding:    contentEncoding,
+		Namespace:          namespace,
+		SchemaLocation:     schemaLocation,
+		DataReferenceIndex: 1,
+	}
+	t.Mdia.Minf.Stbl.Stsd.AddChild(metx)
+	return nil
+}
+
+// SetMettDescriptor sets a text metadata sample entry (mett) on a track created with media
+// type "meta". contentEncoding and textConfig may be empty, and a txtC box is only added
+// for a non-empty textConfig.
+func (t *TrakBox) SetMettDescriptor(contentEncoding, mimeFormat, textConfig string) error {
+	if mimeFormat == "" {
+		return fmt.Errorf("mett mime format must not be empty")
+	}
+	mett := &MettBox{
+		ContentEncoding:    contentEncoding,
+		MimeFormat:         mimeFormat,
+		DataReferenceIndex: 1,
+	}
+	if textConfig != "" {
+		mett.AddChild(&TxtCBox{TextConfig: textConfig})
+	}
+	t.Mdia.Minf.Stbl.Stsd.AddChild(mett)
+	return nil
+}
+
+// SetUrimDescriptor sets a URI metadata sample entry (urim) on a track created with media
+// type "meta". A uriI box is only added for non-empty initData.
+func (t *TrakBox) SetUrimDescriptor(uri string, initData []byte) error {
+	if uri == "" {
+		return fmt.Errorf("urim uri must not be empty")
+	}
+	urim := &UrimBox{DataReferenceIndex: 1}
+	urim.AddChild(&URIBox{URI: uri})
+	if len(initData) > 0 {
+		urim.AddChild(&URIInitBox{InitData: initData})
+	}
+	t.Mdia.Minf.Stbl.Stsd.AddChild(urim)
+	return nil
+}
@@ -0,0 +1,59 @@
+package mp4_test
+
+import (
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestMetadataSampleEntries(t *testing.T) {
+	id3 := &mp4.ID3SampleEntryBox{DataReferenceIndex: 1}
+	boxDiffAfterEncodeAndDecode(t, id3)
+
+	metx := &mp4.MetxBox{
+		ContentEncoding:    "",
+		Namespace:          "http://www.example.com/ns",
+		SchemaLocation:     "http://www.example.com/schema.xsd",
+		DataReferenceIndex: 1,
+	}
+	boxDiffAfterEncodeAndDecode(t, metx)
+
+	mett := &mp4.MettBox{MimeFormat: "text/plain", DataReferenceIndex: 1}
+	mett.AddChild(&mp4.TxtCBox{TextConfig: "config"})
+	boxDiffAfterEncodeAndDecode(t, mett)
+
+	urim := &mp4.UrimBox{DataReferenceIndex: 1}
+	urim.AddChild(&mp4.URIBox{URI: "urn:example:meta"})
+	urim.AddChild(&mp4.URIInitBox{InitData: []byte{1, 2, 3}})
+	boxDiffAfterEncodeAndDecode(t, urim)
+}
+
+func TestSetMetadataDescriptors(t *testing.T) {
+	init := mp4.CreateEmptyInit()
+	for _, set := range []func(trak *mp4.TrakBox) error{
+		func(trak *mp4.TrakBox) error { return trak.SetID3Descriptor() },
+		func(trak *mp4.TrakBox) error { return trak.SetMetxDescriptor("", "urn:ns", "") },
+		func(trak *mp4.TrakBox) error { return trak.SetMettDescriptor("", "text/plain", "cfg") },
+		func(trak *mp4.TrakBox) error { return trak.SetUrimDescriptor("urn:uri", []byte{7}) },
+	} {
+		trak := init.AddEmptyTrack(1000, "meta", "und")
+		if err := set(trak); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stsds := []*mp4.StsdBox{}
+	for _, trak := range init.Moov.Traks {
+		stsd := trak.Mdia.Minf.Stbl.Stsd
+		boxDiffAfterEncodeAndDecode(t, stsd)
+		stsds = append(stsds, stsd)
+	}
+	if stsds[0].ID3 == nil || stsds[1].Metx == nil || stsds[2].Mett == nil || stsds[3].Urim == nil {
+		t.Error("sample entry not set in stsd")
+	}
+	if stsds[3].Urim.URI == nil || stsds[3].Urim.URI.URI != "urn:uri" {
+		t.Error("urim uri not set")
+	}
+	if err := init.Moov.Traks[0].SetMetxDescriptor("", "", ""); err == nil {
+		t.Error("expected error for empty namespace")
+	}
+}
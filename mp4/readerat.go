@@ -0,0 +1,218 @@
+package mp4
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultCacheBlockSize = 4096
+	defaultCacheNrBlocks  = 256
+	// maxCoalescedRead - largest read made by ReadSampleData when joining samples
+	maxCoalescedRead = 4 << 20
+)
+
+// DecodeFileReaderAt decodes a file of size bytes from ra, with random access instead of a
+// sequential read. The mdat boxes are decoded lazily, so only box headers and the other boxes,
+// like moov, moof, sidx and mfra, are read. Sample data can then be read with ReadSampleData,
+// or with io.NewSectionReader(ra, 0, size) as io.ReadSeeker for MdatBox.ReadData and SampleReader.
+// For remote storage, ra should be a CachedReaderAt, so that small reads are joined into fewer
+// range requests.
+func DecodeFileReaderAt(ra io.ReaderAt, size int64, options ...Option) (*File, error) {
+	options = append(options, WithDecodeMode(DecModeLazyMdat))
+	return DecodeFile(io.NewSectionReader(ra, 0, size), options...)
+}
+
+// CachedReaderAt - io.ReaderAt that reads aligned blocks from an underlying io.ReaderAt and
+// keeps the most recently used ones. The missing blocks of a read are fetched with one read of
+// the underlying reader, so each read is one range request for an HTTP-backed reader.
+// Reads larger than the cache go directly to the underlying reader.
+// It is safe for concurrent use.
+type CachedReaderAt struct {
+	ra        io.ReaderAt
+	size      int64
+	blockSize int64
+	maxBlocks int
+	mu        sync.Mutex
+	blocks    map[int64]*list.Element
+	lru       *list.List
+	nrReads   int
+	nrBytes   int64
+}
+
+type cachedBlock struct {
+	idx  int64
+	data []byte
+}
+
+// NewCachedReaderAt - cache reads from ra of size bytes in up to maxBlocks blocks of blockSize bytes.
+// Values of 0 mean 4096 bytes and 256 blocks.
+func NewCachedReaderAt(ra io.ReaderAt, size, blockSize int64, maxBlocks int) *CachedReaderAt {
+	if blockSize <= 0 {
+		blockSize = defaultCacheBlockSize
+	}
+	if maxBlocks <= 0 {
+		maxBlocks = defaultCacheNrBlocks
+	}
+	return &CachedReaderAt{
+		ra:        ra,
+		size:      size,
+		blockSize: blockSize,
+		maxBlocks: maxBlocks,
+		blocks:    make(map[int64]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// Size - size of the underlying data
+func (c *CachedReaderAt) Size() int64 {
+	return c.size
+}
+
+// Stats - number of reads and bytes read from the underlying reader
+func (c *CachedReaderAt) Stats() (nrReads int, nrBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nrReads, c.nrBytes
+}
+
+// ReadAt - read len(p) bytes at offset off, via the cache
+func (c *CachedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= c.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	var eofErr error
+	if end > c.size {
+		end = c.size
+		eofErr = io.EOF
+	}
+	if end == off {
+		return 0, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	first, last := off/c.blockSize, (end-1)/c.blockSize
+	if last-first+1 > int64(c.maxBlocks) {
+		n, err := c.ra.ReadAt(p[:end-off], off)
+		c.nrReads++
+		c.nrBytes += int64(n)
+		if int64(n) < end-off {
+			return n, err
+		}
+		return n, eofErr
+	}
+	// Move the cached blocks of the range to the front, so that fetching does not evict them
+	for b := first; b <= last; b++ {
+		if elem, ok := c.blocks[b]; ok {
+			c.lru.MoveToFront(elem)
+		}
+	}
+	for b := first; b <= last; b++ {
+		if _, ok := c.blocks[b]; ok {
+			continue
+		}
+		runEnd := b
+		for runEnd < last {
+			if _, ok := c.blocks[runEnd+1]; ok {
+				break
+			}
+			runEnd++
+		}
+		if err := c.fetch(b, runEnd); err != nil {
+			return 0, err
+		}
+		b = runEnd
+	}
+	n := 0
+	for b := first; b <= last; b++ {
+		data := c.blocks[b].Value.(*cachedBlock).data
+		start := int64(0)
+		if b == first {
+			start = off - b*c.blockSize
+		}
+		n += copy(p[n:end-off], data[start:])
+	}
+	return n, eofErr
+}
+
+// fetch reads blocks first to last with one read and adds them to the cache
+func (c *CachedReaderAt) fetch(first, last int64) error {
+	start := first * c.blockSize
+	end := (last + 1) * c.blockSize
+	if end > c.size {
+		end = c.size
+	}
+	buf := make([]byte, end-start)
+	n, err := c.ra.ReadAt(buf, start)
+	c.nrReads++
+	c.nrBytes += int64(n)
+	if n < len(buf) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("read %d bytes at %d: %w", len(buf), start, err)
+	}
+	for b := first; b <= last; b++ {
+		blockStart := (b - first) * c.blockSize
+		blockEnd := blockStart + c.blockSize
+		if blockEnd > int64(len(buf)) {
+			blockEnd = int64(len(buf))
+		}
+		c.blocks[b] = c.lru.PushFront(&cachedBlock{idx: b, data: buf[blockStart:blockEnd]})
+	}
+	for c.lru.Len() > c.maxBlocks {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.blocks, elem.Value.(*cachedBlock).idx)
+	}
+	return nil
+}
+
+// ReadSampleData reads the data of samples from ra, typically for a file from DecodeFileReaderAt.
+// Samples that are at most maxGap bytes apart are read together, up to 4 MiB per read,
+// so that a remote reader gets few and large range requests.
+func ReadSampleData(ra io.ReaderAt, infos []SampleInfo, maxGap int64) ([][]byte, error) {
+	order := make([]int, len(infos))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return infos[order[i]].Offset < infos[order[j]].Offset })
+	data := make([][]byte, len(infos))
+	for i := 0; i < len(order); {
+		start := infos[order[i]].Offset
+		end := start + uint64(infos[order[i]].Size)
+		j := i + 1
+		for ; j < len(order); j++ {
+			info := infos[order[j]]
+			infoEnd := info.Offset + uint64(info.Size)
+			if info.Offset > end+uint64(maxGap) || (infoEnd > end && infoEnd-start > maxCoalescedRead) {
+				break
+			}
+			if infoEnd > end {
+				end = infoEnd
+			}
+		}
+		buf := make([]byte, end-start)
+		n, err := ra.ReadAt(buf, int64(start))
+		if n < len(buf) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("read sample data at %d: %w", start, err)
+		}
+		for _, idx := range order[i:j] {
+			offset := infos[idx].Offset - start
+			data[idx] = buf[offset : offset+uint64(infos[idx].Size)]
+		}
+		i = j
+	}
+	return data, nil
+}
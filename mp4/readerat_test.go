@@ -0,0 +1,120 @@
+package mp4_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// countingReaderAt counts the reads and bytes read from an io.ReaderAt
+type countingReaderAt struct {
+	ra      io.ReaderAt
+	nrReads int
+	nrBytes int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.ra.ReadAt(p, off)
+	c.nrReads++
+	c.nrBytes += n
+	return n, err
+}
+
+func TestDecodeFileReaderAt(t *testing.T) {
+	for _, fileName := range []string{"testdata/prog_8s.mp4", "testdata/v300_multiple_segments.mp4"} {
+		t.Run(fileName, func(t *testing.T) {
+			data, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref, err := mp4.DecodeFile(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			counter := &countingReaderAt{ra: bytes.NewReader(data)}
+			cra := mp4.NewCachedReaderAt(counter, int64(len(data)), 0, 0)
+			f, err := mp4.DecodeFileReaderAt(cra, cra.Size())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotInfo, wantInfo bytes.Buffer
+			if err := f.Info(&gotInfo, "all:1", "", "  "); err != nil {
+				t.Fatal(err)
+			}
+			if err := ref.Info(&wantInfo, "all:1", "", "  "); err != nil {
+				t.Fatal(err)
+			}
+			if gotInfo.String() != wantInfo.String() {
+				t.Error("info differs from sequential decode")
+			}
+			nrReads, nrBytes := cra.Stats()
+			if nrReads != counter.nrReads || nrBytes != int64(counter.nrBytes) {
+				t.Errorf("stats %d reads %d bytes, counted %d reads %d bytes", nrReads, nrBytes, counter.nrReads, counter.nrBytes)
+			}
+			if nrBytes > int64(len(data)/4) {
+				t.Errorf("read %d bytes of %d to decode", nrBytes, len(data))
+			}
+
+			trackID := f.Moov.Traks[0].Tkhd.TrackID
+			infos, err := f.SampleInfos(trackID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			readsBefore := counter.nrReads
+			samples, err := mp4.ReadSampleData(counter, infos, 1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counter.nrReads-readsBefore >= len(infos) {
+				t.Errorf("%d reads for %d samples", counter.nrReads-readsBefore, len(infos))
+			}
+			for i, info := range infos {
+				if !bytes.Equal(samples[i], data[info.Offset:info.Offset+uint64(info.Size)]) {
+					t.Fatalf("sample %d: data differs", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedReaderAt(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	counter := &countingReaderAt{ra: bytes.NewReader(data)}
+	cra := mp4.NewCachedReaderAt(counter, int64(len(data)), 100, 10)
+	cases := []struct {
+		off, size int
+		wantReads int
+		wantErr   error
+	}{
+		{off: 50, size: 100, wantReads: 1},
+		{off: 120, size: 10, wantReads: 0},
+		{off: 150, size: 200, wantReads: 1},
+		{off: 0, size: 2000, wantReads: 1},
+		{off: 9950, size: 100, wantReads: 1, wantErr: io.EOF},
+		{off: 10000, size: 1, wantReads: 0, wantErr: io.EOF},
+	}
+	for _, c := range cases {
+		before := counter.nrReads
+		p := make([]byte, c.size)
+		n, err := cra.ReadAt(p, int64(c.off))
+		if err != c.wantErr {
+			t.Errorf("read %d at %d: got error %v instead of %v", c.size, c.off, err, c.wantErr)
+		}
+		end := c.off + c.size
+		if end > len(data) {
+			end = len(data)
+		}
+		if n != end-c.off || !bytes.Equal(p[:n], data[c.off:end]) {
+			t.Errorf("read %d at %d: wrong data", c.size, c.off)
+		}
+		if counter.nrReads-before != c.wantReads {
+			t.Errorf("read %d at %d: %d underlying reads instead of %d", c.size, c.off, counter.nrReads-before, c.wantReads)
+		}
+	}
+}
@@ -0,0 +1,875 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Eyevinn/mp4ff/aac"
+	"github.com/Eyevinn/mp4ff/avc"
+	"github.com/Eyevinn/mp4ff/hevc"
+)
+
+// RecoveredTrack - samples found by RecoverMoov for a track of the reference file
+type RecoveredTrack struct {
+	TrackID   uint32 `json:"trackID"`
+	Format    string `json:"format"`
+	NrSamples int    `json:"nrSamples"`
+	NrChunks  int    `json:"nrChunks"`
+	// Duration - in the media timescale
+	Duration uint64 `json:"duration"`
+	// Reason - why the track could not be recovered
+	Reason string `json:"reason,omitempty"`
+}
+
+// RecoverReport - result of RecoverMoov
+type RecoverReport struct {
+	Tracks []RecoveredTrack `json:"tracks"`
+	// NrSkippedBytes - bytes before the last sample that are not part of any sample
+	NrSkippedBytes uint64 `json:"nrSkippedBytes"`
+	// NrTrailingBytes - bytes after the last sample, which are removed
+	NrTrailingBytes uint64 `json:"nrTrailingBytes"`
+}
+
+// RecoverMoov rebuilds the moov box of a file without one, like a recording from a crashed encoder
+// with only ftyp and mdat. The file is read from ra with the given size, and the tracks and sample
+// entries are taken from ref, which should be a file from the same encoder with the same settings.
+//
+// The mdat payload is scanned for samples of the reference tracks: AVC and HEVC samples made of
+// length-prefixed NAL units, AAC frames with ADTS headers, and audio with a constant sample size
+// in the reference. Bytes that do not start a sample are skipped. Samples of a track that follow each
+// other in the mdat box form a chunk, so the interleaving is kept. Sample durations are the most common
+// ones in the reference, and composition time offsets are derived from the picture order counts of
+// AVC and HEVC slices. Tracks that cannot be scanned, like raw AAC without ADTS headers, are left out
+// and reported. The mdat box ends after the last sample, and the new moov box is placed after it.
+//
+// The payload is scanned in windows of limited size, and is not kept in memory. The mdat box of the
+// returned file is therefore lazy, with its payload at the same position as in ra. Use EncodeRecovered
+// to write the file.
+func RecoverMoov(ra io.ReaderAt, size int64, ref *File) (*File, *RecoverReport, error) {
+	if ref.Moov == nil {
+		return nil, nil, fmt.Errorf("no moov box in reference")
+	}
+	fileSize := uint64(size)
+	out := NewFile()
+	var pos uint64
+	var mdatHdr BoxHeader
+	for {
+		if pos+boxHeaderSize > fileSize {
+			return nil, nil, fmt.Errorf("no mdat box")
+		}
+		hdr, err := orphanBoxHeader(ra, fileSize, pos)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr.Name == "mdat" {
+			mdatHdr = hdr
+			break
+		}
+		if hdr.Name == "moov" {
+			return nil, nil, fmt.Errorf("file has a moov box")
+		}
+		if pos+hdr.Size > fileSize {
+			return nil, nil, fmt.Errorf("%s box at offset %d extends beyond end of file", hdr.Name, pos)
+		}
+		box, err := DecodeBox(pos, io.NewSectionReader(ra, int64(pos), int64(hdr.Size)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("decode %s box at offset %d: %w", hdr.Name, pos, err)
+		}
+		out.AddChild(box, pos)
+		pos += hdr.Size
+	}
+
+	payloadStart := pos + uint64(mdatHdr.Hdrlen)
+	payloadEnd := fileSize
+	// a crashed encoder may leave a size of 0 or of the empty box, so the payload only ends before
+	// the end of the file if another box follows
+	if end := pos + mdatHdr.Size; mdatHdr.Size > uint64(mdatHdr.Hdrlen) && end+boxHeaderSize <= payloadEnd {
+		nextHdr := make([]byte, boxHeaderSize)
+		if _, err := ra.ReadAt(nextHdr, int64(end)); err == nil && isPrintableBoxType(nextHdr[4:8]) {
+			payloadEnd = end
+		}
+	}
+	payloadSize := payloadEnd - payloadStart
+
+	report := &RecoverReport{}
+	var tracks []*recoverTrack
+	for _, trak := range ref.Moov.Traks {
+		t, reason := newRecoverTrack(ref, trak)
+		if t == nil {
+			report.Tracks = append(report.Tracks, RecoveredTrack{TrackID: trak.Tkhd.TrackID,
+				Format: sampleEntryType(trak), Reason: reason})
+			continue
+		}
+		tracks = append(tracks, t)
+	}
+	if len(tracks) == 0 {
+		return nil, report, fmt.Errorf("no track in reference can be recovered")
+	}
+
+	win := &recoverWindow{ra: ra, start: payloadStart, end: payloadEnd, size: recoverWindowSize}
+	for _, t := range tracks {
+		if need := 4 * uint64(t.maxSize+t.sampleSize); need > win.size {
+			win.size = need
+		}
+	}
+	var nrSkipped, lastEnd uint64
+	var last *recoverTrack
+	var p uint64
+	for p < payloadSize {
+		data, dataPos, err := win.at(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		t, s, next := matchRecoverSample(tracks, last, data, int(p-dataPos))
+		if t == nil {
+			nrSkipped++
+			p++
+			continue
+		}
+		s.offset += dataPos
+		t.addSample(s, t == last)
+		last = t
+		lastEnd = dataPos + uint64(next)
+		p = lastEnd
+	}
+	report.NrTrailingBytes = payloadSize - lastEnd
+	report.NrSkippedBytes = nrSkipped - report.NrTrailingBytes
+
+	mdat := &MdatBox{StartPos: pos, LargeSize: mdatHdr.Hdrlen > boxHeaderSize}
+	mdat.SetLazyDataSize(lastEnd)
+	base := pos + mdat.HeaderSize()
+
+	moov, err := copyMoov(ref.Moov)
+	if err != nil {
+		return nil, nil, err
+	}
+	if moov.Mvex != nil {
+		for j, c := range moov.Children {
+			if c == moov.Mvex {
+				moov.Children = append(moov.Children[:j], moov.Children[j+1:]...)
+				break
+			}
+		}
+		moov.Mvex = nil
+	}
+	useCo64 := base+lastEnd > 1<<32-1
+	movieTS := moov.Mvhd.Timescale
+	var movieDur uint64
+	var keptTraks []*TrakBox
+	for _, trak := range moov.Traks {
+		var t *recoverTrack
+		for _, rt := range tracks {
+			if rt.trak.Tkhd.TrackID == trak.Tkhd.TrackID {
+				t = rt
+			}
+		}
+		if t == nil || len(t.samples) == 0 {
+			continue
+		}
+		keptTraks = append(keptTraks, trak)
+		delay := t.setCompositionTimeOffsets()
+		if err := t.fillStbl(trak.Mdia.Minf.Stbl, base, useCo64); err != nil {
+			return nil, nil, err
+		}
+		dur := uint64(len(t.samples)) * uint64(t.dur)
+		trak.Mdia.Mdhd.Duration = dur
+		trak.Tkhd.Duration = RescaleTime(dur, trak.Mdia.Mdhd.Timescale, movieTS)
+		if trak.Tkhd.Duration > movieDur {
+			movieDur = trak.Tkhd.Duration
+		}
+		var edits []TimelineEdit
+		if delay > 0 {
+			edits = []TimelineEdit{{Duration: dur, MediaTime: int64(delay), MediaRate: 0x10000}}
+		}
+		trak.SetEdits(movieTS, edits)
+	}
+	for _, t := range tracks {
+		rt := RecoveredTrack{TrackID: t.trak.Tkhd.TrackID, Format: sampleEntryType(t.trak),
+			NrSamples: len(t.samples), NrChunks: len(t.chunks), Duration: uint64(len(t.samples)) * uint64(t.dur)}
+		if len(t.samples) == 0 {
+			rt.Reason = "no samples found"
+		}
+		report.Tracks = append(report.Tracks, rt)
+	}
+	sort.Slice(report.Tracks, func(i, j int) bool { return report.Tracks[i].TrackID < report.Tracks[j].TrackID })
+	if len(keptTraks) == 0 {
+		return nil, report, fmt.Errorf("no samples found")
+	}
+	children := make([]Box, 0, len(moov.Children))
+	for _, c := range moov.Children {
+		if trak, ok := c.(*TrakBox); ok && !containsTrak(keptTraks, trak) {
+			continue
+		}
+		children = append(children, c)
+	}
+	moov.Children = children
+	moov.Traks = keptTraks
+	moov.Trak = keptTraks[0]
+	moov.Mvhd.Duration = movieDur
+
+	out.AddChild(mdat, pos)
+	out.AddChild(moov, base+lastEnd)
+	return out, report, nil
+}
+
+// EncodeRecovered writes a file returned by RecoverMoov to w, copying the lazy mdat payload from ra.
+func EncodeRecovered(w io.Writer, rec *File, ra io.ReaderAt) error {
+	for _, box := range rec.Children {
+		if err := box.Encode(w); err != nil {
+			return err
+		}
+		mdat, ok := box.(*MdatBox)
+		if !ok || !mdat.IsLazy() {
+			continue
+		}
+		size := int64(mdat.GetLazyDataSize())
+		n, err := io.Copy(w, io.NewSectionReader(ra, int64(mdat.PayloadAbsoluteOffset()), size))
+		if err != nil {
+			return err
+		}
+		if n != size {
+			return fmt.Errorf("copied %d instead of %d mdat bytes", n, size)
+		}
+	}
+	return nil
+}
+
+// recoverWindowSize - default size of the windows in which the mdat payload is scanned
+const recoverWindowSize = 16 << 20
+
+// recoverWindow reads the mdat payload between the file offsets start and end in windows of size bytes
+type recoverWindow struct {
+	ra         io.ReaderAt
+	start, end uint64
+	size       uint64
+	data       []byte
+	pos        uint64 // payload position of data
+}
+
+// at returns a window of the payload and its position. The window includes p and at least half a
+// window after it, or the rest of the payload. A new slice is read for each window, since parsed
+// parameter sets may refer to the previous one.
+func (w *recoverWindow) at(p uint64) ([]byte, uint64, error) {
+	payloadSize := w.end - w.start
+	if w.data != nil && p >= w.pos {
+		dataEnd := w.pos + uint64(len(w.data))
+		if dataEnd == payloadSize || p+w.size/2 <= dataEnd {
+			return w.data, w.pos, nil
+		}
+	}
+	n := w.size
+	if p+n > payloadSize {
+		n = payloadSize - p
+	}
+	data := make([]byte, n)
+	if m, err := w.ra.ReadAt(data, int64(w.start+p)); uint64(m) != n {
+		return nil, 0, fmt.Errorf("read mdat payload at offset %d: %w", w.start+p, err)
+	}
+	w.data, w.pos = data, p
+	return data, p, nil
+}
+
+// orphanBoxHeader reads the box header at pos. Size 0 means that the box extends to the end.
+func orphanBoxHeader(ra io.ReaderAt, fileSize, pos uint64) (BoxHeader, error) {
+	buf := make([]byte, boxHeaderSize+largeSizeLen)
+	n, err := ra.ReadAt(buf, int64(pos))
+	if n < boxHeaderSize {
+		return BoxHeader{}, fmt.Errorf("read box header at offset %d: %w", pos, err)
+	}
+	buf = buf[:n]
+	hdr := BoxHeader{Name: string(buf[4:8]), Size: uint64(binary.BigEndian.Uint32(buf)), Hdrlen: boxHeaderSize}
+	switch hdr.Size {
+	case 0:
+		hdr.Size = fileSize - pos
+	case 1:
+		if len(buf) < boxHeaderSize+largeSizeLen {
+			return hdr, fmt.Errorf("truncated box header at offset %d", pos)
+		}
+		hdr.Size = binary.BigEndian.Uint64(buf[boxHeaderSize:])
+		hdr.Hdrlen += largeSizeLen
+	}
+	if !isPrintableBoxType(buf[4:8]) || hdr.Size < uint64(hdr.Hdrlen) {
+		return hdr, fmt.Errorf("no valid box header at offset %d", pos)
+	}
+	return hdr, nil
+}
+
+func sampleEntryType(trak *TrakBox) string {
+	stsd := trak.Mdia.Minf.Stbl.Stsd
+	if stsd == nil || len(stsd.Children) == 0 {
+		return ""
+	}
+	return stsd.Children[0].Type()
+}
+
+func containsTrak(traks []*TrakBox, trak *TrakBox) bool {
+	for _, t := range traks {
+		if t == trak {
+			return true
+		}
+	}
+	return false
+}
+
+type recoverKind int
+
+const (
+	recoverAVC recoverKind = iota
+	recoverHEVC
+	recoverADTS
+	recoverConstSize
+)
+
+// recoverTrack - scanning state and samples found for a reference track
+type recoverTrack struct {
+	trak       *TrakBox
+	kind       recoverKind
+	dur        uint32
+	lengthSize int
+	sampleSize uint32 // constant sample size
+	maxSize    uint32 // maximum video sample size, twice the largest in the reference, or 0 if unknown
+	frequency  int    // ADTS sampling frequency
+	channels   byte   // ADTS channel configuration, 0 if not checked
+	avcSPS     map[uint32]*avc.SPS
+	avcPPS     map[uint32]*avc.PPS
+	hevcSPS    map[uint32]*hevc.SPS
+	hevcPPS    map[uint32]*hevc.PPS
+	prevPocMsb int
+	prevPocLsb int
+	samples    []recoveredSample
+	chunks     []recoveredChunk
+}
+
+type recoveredSample struct {
+	offset uint64 // relative to mdat payload
+	size   uint32
+	sync   bool
+	newSeq bool // picture order counts restart
+	poc    int
+	cto    int32
+}
+
+type recoveredChunk struct {
+	offset    uint64
+	nrSamples uint32
+}
+
+// newRecoverTrack returns a scanner for trak, or nil and the reason why it cannot be scanned
+func newRecoverTrack(ref *File, trak *TrakBox) (*recoverTrack, string) {
+	stbl := trak.Mdia.Minf.Stbl
+	if stbl.Stsd == nil || len(stbl.Stsd.Children) == 0 {
+		return nil, "no sample entry"
+	}
+	dur, maxSize, sameSize := refSampleStats(ref, trak.Tkhd.TrackID)
+	t := &recoverTrack{trak: trak, dur: dur}
+	switch entry := stbl.Stsd.Children[0].(type) {
+	case *VisualSampleEntryBox:
+		switch {
+		case entry.AvcC != nil:
+			t.kind = recoverAVC
+			t.lengthSize = 4
+			t.maxSize = 2 * maxSize
+			t.avcSPS = make(map[uint32]*avc.SPS)
+			t.avcPPS = make(map[uint32]*avc.PPS)
+			for _, nalu := range entry.AvcC.SPSnalus {
+				if sps, err := avc.ParseSPSNALUnit(nalu, false); err == nil {
+					t.avcSPS[sps.ParameterID] = sps
+				}
+			}
+			for _, nalu := range entry.AvcC.PPSnalus {
+				if pps, err := avc.ParsePPSNALUnit(nalu, t.avcSPS); err == nil {
+					t.avcPPS[pps.PicParameterSetID] = pps
+				}
+			}
+		case entry.HvcC != nil:
+			t.kind = recoverHEVC
+			t.lengthSize = int(entry.HvcC.LengthSizeMinusOne) + 1
+			t.maxSize = 2 * maxSize
+			t.hevcSPS = make(map[uint32]*hevc.SPS)
+			t.hevcPPS = make(map[uint32]*hevc.PPS)
+			for _, nalu := range entry.HvcC.GetNalusForType(hevc.NALU_SPS) {
+				if sps, err := hevc.ParseSPSNALUnit(nalu); err == nil {
+					t.hevcSPS[uint32(sps.SpsID)] = sps
+				}
+			}
+			for _, nalu := range entry.HvcC.GetNalusForType(hevc.NALU_PPS) {
+				if pps, err := hevc.ParsePPSNALUnit(nalu, t.hevcSPS); err == nil {
+					t.hevcPPS[pps.PicParameterSetID] = pps
+				}
+			}
+		default:
+			return nil, fmt.Sprintf("unsupported video sample entry %s", entry.Type())
+		}
+	case *AudioSampleEntryBox:
+		switch {
+		case sameSize:
+			t.kind = recoverConstSize
+			t.sampleSize = maxSize
+		case entry.Type() == "mp4a" && entry.Esds != nil && entry.Esds.DecConfigDescriptor != nil &&
+			entry.Esds.DecConfigDescriptor.DecSpecificInfo != nil:
+			asc, err := aac.DecodeAudioSpecificConfigHeader(
+				bytes.NewReader(entry.Esds.DecConfigDescriptor.DecSpecificInfo.DecConfig))
+			if err != nil {
+				return nil, fmt.Sprintf("bad AudioSpecificConfig: %v", err)
+			}
+			t.kind = recoverADTS
+			t.frequency = asc.SamplingFrequency
+			t.channels = asc.ChannelConfiguration
+			if t.dur == 0 {
+				t.dur = 1024
+			}
+		default:
+			return nil, "audio without ADTS headers or constant sample size"
+		}
+	default:
+		return nil, fmt.Sprintf("unsupported sample entry %s", entry.Type())
+	}
+	if t.dur == 0 {
+		return nil, "no sample duration in reference"
+	}
+	return t, ""
+}
+
+// refSampleStats returns the most common sample duration and the largest sample size of a track
+// in ref, and if all samples have the same size. The duration is the trex default if there are no samples.
+func refSampleStats(ref *File, trackID uint32) (dur, maxSize uint32, sameSize bool) {
+	infos, _ := ref.SampleInfos(trackID)
+	counts := make(map[uint32]int)
+	maxCount := 0
+	sameSize = len(infos) > 1
+	for _, info := range infos {
+		counts[info.Dur]++
+		if counts[info.Dur] > maxCount {
+			dur, maxCount = info.Dur, counts[info.Dur]
+		}
+		if info.Size > maxSize {
+			maxSize = info.Size
+		}
+		sameSize = sameSize && info.Size == infos[0].Size
+	}
+	if dur == 0 {
+		if trex := ref.trex(trackID); trex != nil {
+			dur = trex.DefaultSampleDuration
+		}
+	}
+	return dur, maxSize, sameSize
+}
+
+// matchRecoverSample returns the track and sample starting at pos, and the position after it.
+// ADTS frames and video samples are checked first, and a constant-size sample is only used if
+// nothing else matches, preferring the track of the last sample.
+func matchRecoverSample(tracks []*recoverTrack, last *recoverTrack, data []byte, pos int) (*recoverTrack, recoveredSample, int) {
+	for _, t := range tracks {
+		var s recoveredSample
+		var next int
+		var ok bool
+		switch t.kind {
+		case recoverADTS:
+			s, next, ok = t.matchADTS(data, pos)
+		case recoverAVC:
+			s, next, ok = t.matchAVC(data, pos)
+		case recoverHEVC:
+			s, next, ok = t.matchHEVC(data, pos)
+		}
+		if ok {
+			return t, s, next
+		}
+	}
+	var constTrack *recoverTrack
+	for _, t := range tracks {
+		if t.kind == recoverConstSize && (constTrack == nil || t == last) {
+			constTrack = t
+		}
+	}
+	if constTrack != nil && pos+int(constTrack.sampleSize) <= len(data) {
+		s := recoveredSample{offset: uint64(pos), size: constTrack.sampleSize, sync: true}
+		return constTrack, s, pos + int(constTrack.sampleSize)
+	}
+	return nil, recoveredSample{}, 0
+}
+
+// addSample adds s, continuing the last chunk if the previous sample in data was from this track
+// and ended at the start of s.
+func (t *recoverTrack) addSample(s recoveredSample, sameTrack bool) {
+	n := len(t.chunks)
+	if sameTrack && n > 0 {
+		prev := t.samples[len(t.samples)-1]
+		if prev.offset+uint64(prev.size) == s.offset {
+			t.chunks[n-1].nrSamples++
+			t.samples = append(t.samples, s)
+			return
+		}
+	}
+	t.chunks = append(t.chunks, recoveredChunk{offset: s.offset, nrSamples: 1})
+	t.samples = append(t.samples, s)
+}
+
+// matchADTS returns the payload of an ADTS frame at pos with the sampling frequency and channels of the track
+func (t *recoverTrack) matchADTS(data []byte, pos int) (recoveredSample, int, bool) {
+	if pos+7 > len(data) || data[pos] != 0xff || data[pos+1]&0xf6 != 0xf0 {
+		return recoveredSample{}, 0, false
+	}
+	hdr, offset, err := aac.DecodeADTSHeader(bytes.NewReader(data[pos:]))
+	if err != nil || offset != 0 || int(hdr.Frequency()) != t.frequency {
+		return recoveredSample{}, 0, false
+	}
+	if t.channels != 0 && hdr.ChannelConfig != t.channels {
+		return recoveredSample{}, 0, false
+	}
+	frameLen := int(data[pos+3]&0x03)<<11 | int(data[pos+4])<<3 | int(data[pos+5])>>5
+	if frameLen <= int(hdr.HeaderLength) || pos+frameLen > len(data) {
+		return recoveredSample{}, 0, false
+	}
+	s := recoveredSample{offset: uint64(pos) + uint64(hdr.HeaderLength), size: uint32(frameLen) - uint32(hdr.HeaderLength), sync: true}
+	return s, pos + frameLen, true
+}
+
+// nalu returns the length-prefixed NAL unit at pos, if the length fits in data
+func (t *recoverTrack) nalu(data []byte, pos, minSize int) ([]byte, bool) {
+	if pos+t.lengthSize >= len(data) {
+		return nil, false
+	}
+	var size uint64
+	for _, b := range data[pos : pos+t.lengthSize] {
+		size = size<<8 | uint64(b)
+	}
+	if size < uint64(minSize) || size > uint64(len(data)-pos-t.lengthSize) {
+		return nil, false
+	}
+	return data[pos+t.lengthSize : pos+t.lengthSize+int(size)], true
+}
+
+// validAVCNaluHeader checks forbidden_zero_bit and nal_ref_idc for the NAL unit types used in samples
+func validAVCNaluHeader(hdr byte) bool {
+	if hdr&0x80 != 0 {
+		return false
+	}
+	refIDC := hdr >> 5
+	switch avc.GetNaluType(hdr) {
+	case avc.NALU_NON_IDR:
+		return true
+	case avc.NALU_IDR, avc.NALU_SPS, avc.NALU_PPS:
+		return refIDC != 0
+	case avc.NALU_SEI, avc.NALU_AUD, avc.NALU_EO_SEQ, avc.NALU_EO_STREAM, avc.NALU_FILL:
+		return refIDC == 0
+	}
+	return false
+}
+
+// matchAVC returns the AVC sample starting at pos. The sample ends before the first NAL unit
+// that starts a new access unit or is not valid.
+func (t *recoverTrack) matchAVC(data []byte, pos int) (recoveredSample, int, bool) {
+	spsMap, ppsMap := t.avcSPS, t.avcPPS
+	newParamSets := false
+	var first *avc.SliceHeader
+	var firstHdr byte
+	p := pos
+naluLoop:
+	for {
+		nalu, ok := t.nalu(data, p, 2)
+		if !ok || !validAVCNaluHeader(nalu[0]) {
+			break
+		}
+		switch naluType := avc.GetNaluType(nalu[0]); naluType {
+		case avc.NALU_SPS, avc.NALU_PPS, avc.NALU_SEI, avc.NALU_AUD:
+			if first != nil || (naluType == avc.NALU_AUD && p != pos) {
+				break naluLoop
+			}
+			if naluType == avc.NALU_SEI || naluType == avc.NALU_AUD {
+				break
+			}
+			if !newParamSets {
+				spsMap, ppsMap = copyAVCParamSets(t.avcSPS, t.avcPPS)
+				newParamSets = true
+			}
+			if naluType == avc.NALU_SPS {
+				sps, err := avc.ParseSPSNALUnit(nalu, false)
+				if err != nil {
+					break naluLoop
+				}
+				spsMap[sps.ParameterID] = sps
+			} else {
+				pps, err := avc.ParsePPSNALUnit(nalu, spsMap)
+				if err != nil {
+					break naluLoop
+				}
+				ppsMap[pps.PicParameterSetID] = pps
+			}
+		case avc.NALU_NON_IDR, avc.NALU_IDR:
+			sh, err := avc.ParseSliceHeader(nalu, spsMap, ppsMap)
+			if err != nil || (naluType == avc.NALU_IDR && (sh.FrameNum != 0 || sh.SliceType%5 != avc.SLICE_I)) {
+				break naluLoop
+			}
+			if sh.FirstMBInSlice == 0 {
+				if first != nil {
+					break naluLoop
+				}
+				first, firstHdr = sh, nalu[0]
+			} else if first == nil {
+				break naluLoop
+			}
+		default:
+			if first == nil {
+				break naluLoop
+			}
+		}
+		p += t.lengthSize + len(nalu)
+	}
+	if first == nil || (t.maxSize > 0 && p-pos > int(t.maxSize)) {
+		return recoveredSample{}, 0, false
+	}
+	if newParamSets {
+		t.avcSPS, t.avcPPS = spsMap, ppsMap
+	}
+	isIDR := avc.GetNaluType(firstHdr) == avc.NALU_IDR
+	s := recoveredSample{offset: uint64(pos), size: uint32(p - pos), sync: isIDR}
+	sps := spsMap[uint32(ppsMap[first.PicParamID].SeqParameterSetID)]
+	if sps.PicOrderCntType == 0 {
+		reset := isIDR || len(t.samples) == 0
+		maxLsb := 1 << (sps.Log2MaxPicOrderCntLsbMinus4 + 4)
+		s.poc = t.picOrderCnt(int(first.PicOrderCntLsb), maxLsb, reset, firstHdr>>5 != 0)
+		s.newSeq = reset
+	} else {
+		s.poc = len(t.samples) // output order is decode order
+	}
+	return s, p, true
+}
+
+func copyAVCParamSets(spsMap map[uint32]*avc.SPS, ppsMap map[uint32]*avc.PPS) (map[uint32]*avc.SPS, map[uint32]*avc.PPS) {
+	spsCopy := make(map[uint32]*avc.SPS, len(spsMap))
+	for id, sps := range spsMap {
+		spsCopy[id] = sps
+	}
+	ppsCopy := make(map[uint32]*avc.PPS, len(ppsMap))
+	for id, pps := range ppsMap {
+		ppsCopy[id] = pps
+	}
+	return spsCopy, ppsCopy
+}
+
+// matchHEVC returns the HEVC sample starting at pos. The sample ends before the first NAL unit
+// that starts a new access unit or is not valid.
+func (t *recoverTrack) matchHEVC(data []byte, pos int) (recoveredSample, int, bool) {
+	spsMap, ppsMap := t.hevcSPS, t.hevcPPS
+	newParamSets := false
+	var first *hevc.SliceHeader
+	var firstHdr []byte
+	p := pos
+naluLoop:
+	for {
+		nalu, ok := t.nalu(data, p, 3)
+		// forbidden_zero_bit, nuh_layer_id 0, and nuh_temporal_id_plus1 not 0
+		if !ok || nalu[0]&0x81 != 0 || nalu[1]&0xf8 != 0 || nalu[1]&0x07 == 0 {
+			break
+		}
+		naluType := hevc.GetNaluType(nalu[0])
+		switch {
+		case naluType >= hevc.NALU_VPS && naluType <= hevc.NALU_AUD, naluType == hevc.NALU_SEI_PREFIX:
+			if first != nil || (naluType == hevc.NALU_AUD && p != pos) {
+				break naluLoop
+			}
+			if naluType != hevc.NALU_SPS && naluType != hevc.NALU_PPS {
+				break
+			}
+			if !newParamSets {
+				spsMap, ppsMap = copyHEVCParamSets(t.hevcSPS, t.hevcPPS)
+				newParamSets = true
+			}
+			if naluType == hevc.NALU_SPS {
+				sps, err := hevc.ParseSPSNALUnit(nalu)
+				if err != nil {
+					break naluLoop
+				}
+				spsMap[uint32(sps.SpsID)] = sps
+			} else {
+				pps, err := hevc.ParsePPSNALUnit(nalu, spsMap)
+				if err != nil {
+					break naluLoop
+				}
+				ppsMap[pps.PicParameterSetID] = pps
+			}
+		case naluType <= hevc.NALU_RASL_R, naluType >= hevc.NALU_BLA_W_LP && naluType <= hevc.NALU_CRA:
+			sh, err := hevc.ParseSliceHeader(nalu, spsMap, ppsMap)
+			if err != nil {
+				break naluLoop
+			}
+			if sh.FirstSliceSegmentInPicFlag {
+				if first != nil {
+					break naluLoop
+				}
+				first, firstHdr = sh, nalu[:2]
+			} else if first == nil {
+				break naluLoop
+			}
+		case naluType >= hevc.NALU_EOS && naluType <= hevc.NALU_FD, naluType == hevc.NALU_SEI_SUFFIX:
+			if first == nil {
+				break naluLoop
+			}
+		default:
+			break naluLoop
+		}
+		p += t.lengthSize + len(nalu)
+	}
+	if first == nil || (t.maxSize > 0 && p-pos > int(t.maxSize)) {
+		return recoveredSample{}, 0, false
+	}
+	if newParamSets {
+		t.hevcSPS, t.hevcPPS = spsMap, ppsMap
+	}
+	naluType := hevc.GetNaluType(firstHdr[0])
+	isIRAP := naluType >= hevc.NALU_BLA_W_LP && naluType <= hevc.NALU_CRA
+	s := recoveredSample{offset: uint64(pos), size: uint32(p - pos), sync: isIRAP}
+	sps := spsMap[ppsMap[first.PicParameterSetId].SeqParameterSetID]
+	reset := (isIRAP && naluType != hevc.NALU_CRA) || len(t.samples) == 0
+	// prevTid0Pic is a TemporalId 0 picture that is not RASL, RADL or a sub-layer non-reference picture
+	isPrevTid0 := firstHdr[1]&0x07 == 1 && !(naluType >= hevc.NALU_RADL_N && naluType <= hevc.NALU_RASL_R) &&
+		!(naluType <= 14 && naluType%2 == 0)
+	maxLsb := 1 << (sps.Log2MaxPicOrderCntLsbMinus4 + 4)
+	s.poc = t.picOrderCnt(int(first.PicOrderCntLsb), maxLsb, reset, isPrevTid0)
+	s.newSeq = reset
+	return s, p, true
+}
+
+func copyHEVCParamSets(spsMap map[uint32]*hevc.SPS, ppsMap map[uint32]*hevc.PPS) (map[uint32]*hevc.SPS, map[uint32]*hevc.PPS) {
+	spsCopy := make(map[uint32]*hevc.SPS, len(spsMap))
+	for id, sps := range spsMap {
+		spsCopy[id] = sps
+	}
+	ppsCopy := make(map[uint32]*hevc.PPS, len(ppsMap))
+	for id, pps := range ppsMap {
+		ppsCopy[id] = pps
+	}
+	return spsCopy, ppsCopy
+}
+
+// picOrderCnt derives the picture order count from its least significant bits, as in
+// ISO/IEC 14496-10 8.2.1.1 and ISO/IEC 23008-2 8.3.1. reset starts a new sequence, and
+// isRef marks a picture that later pictures are relative to.
+func (t *recoverTrack) picOrderCnt(lsb, maxLsb int, reset, isRef bool) int {
+	if reset {
+		t.prevPocMsb, t.prevPocLsb = 0, lsb
+		return lsb
+	}
+	msb := t.prevPocMsb
+	switch {
+	case lsb < t.prevPocLsb && t.prevPocLsb-lsb >= maxLsb/2:
+		msb += maxLsb
+	case lsb > t.prevPocLsb && lsb-t.prevPocLsb > maxLsb/2:
+		msb -= maxLsb
+	}
+	if isRef {
+		t.prevPocMsb, t.prevPocLsb = msb, lsb
+	}
+	return msb + lsb
+}
+
+// setCompositionTimeOffsets sets the composition time offsets of video samples from the output order
+// given by the picture order counts. The returned delay is the smallest composition time that is
+// reached, which is not negative since all offsets are, and should be removed by an edit list.
+func (t *recoverTrack) setCompositionTimeOffsets() uint64 {
+	if t.kind != recoverAVC && t.kind != recoverHEVC {
+		return 0
+	}
+	ranks := make([]int, len(t.samples))
+	maxReorder := 0
+	start := 0
+	for start < len(t.samples) {
+		end := start + 1
+		for end < len(t.samples) && !t.samples[end].newSeq {
+			end++
+		}
+		order := make([]int, end-start)
+		for i := range order {
+			order[i] = start + i
+		}
+		sort.SliceStable(order, func(i, j int) bool { return t.samples[order[i]].poc < t.samples[order[j]].poc })
+		for rank, idx := range order {
+			ranks[idx] = start + rank
+			if idx-ranks[idx] > maxReorder {
+				maxReorder = idx - ranks[idx]
+			}
+		}
+		start = end
+	}
+	for i := range t.samples {
+		t.samples[i].cto = int32((ranks[i] - i + maxReorder) * int(t.dur))
+	}
+	return uint64(maxReorder) * uint64(t.dur)
+}
+
+// fillStbl fills the empty sample tables of stbl with the samples and chunks found.
+// base is the offset of the mdat payload in the file.
+func (t *recoverTrack) fillStbl(stbl *StblBox, base uint64, useCo64 bool) error {
+	stbl.Stts.SampleCount = []uint32{uint32(len(t.samples))}
+	stbl.Stts.SampleTimeDelta = []uint32{t.dur}
+	var lastPerChunk uint32
+	for i, c := range t.chunks {
+		if c.nrSamples != lastPerChunk {
+			if err := stbl.Stsc.AddEntry(uint32(i+1), c.nrSamples, 1); err != nil {
+				return err
+			}
+			lastPerChunk = c.nrSamples
+		}
+	}
+	stbl.Stsz.SampleNumber = uint32(len(t.samples))
+	if t.kind == recoverConstSize {
+		stbl.Stsz.SampleUniformSize = t.sampleSize
+	} else {
+		stbl.Stsz.SampleSize = make([]uint32, len(t.samples))
+	}
+	var ctts *CttsBox
+	var syncNrs []uint32
+	hasNonSync := false
+	for i, s := range t.samples {
+		if stbl.Stsz.SampleUniformSize == 0 {
+			stbl.Stsz.SampleSize[i] = s.size
+		}
+		if s.sync {
+			syncNrs = append(syncNrs, uint32(i+1))
+		} else {
+			hasNonSync = true
+		}
+		if s.cto != 0 && ctts == nil {
+			ctts = &CttsBox{}
+			if i > 0 {
+				_ = ctts.AddSampleCountsAndOffset([]uint32{uint32(i)}, []int32{0})
+			}
+		}
+		if ctts != nil {
+			n := len(ctts.SampleOffset)
+			if n > 0 && ctts.SampleOffset[n-1] == s.cto {
+				ctts.EndSampleNr[n]++
+			} else {
+				_ = ctts.AddSampleCountsAndOffset([]uint32{1}, []int32{s.cto})
+			}
+		}
+	}
+	if hasNonSync {
+		insertStblChild(stbl, &StssBox{SampleNumber: syncNrs}, "stts")
+	}
+	if ctts != nil {
+		insertStblChild(stbl, ctts, "stts")
+	}
+	if useCo64 {
+		co64 := &Co64Box{ChunkOffset: make([]uint64, len(t.chunks))}
+		for i, c := range t.chunks {
+			co64.ChunkOffset[i] = base + c.offset
+		}
+		for j, c := range stbl.Children {
+			if c == stbl.Stco {
+				stbl.Children[j] = co64
+			}
+		}
+		stbl.Stco = nil
+		stbl.Co64 = co64
+		return nil
+	}
+	stbl.Stco.ChunkOffset = make([]uint32, len(t.chunks))
+	for i, c := range t.chunks {
+		stbl.Stco.ChunkOffset[i] = uint32(base + c.offset)
+	}
+	return nil
+}
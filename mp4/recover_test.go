@@ -0,0 +1,199 @@
+package mp4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/aac"
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// orphanFile returns ftyp followed by an mdat header with size field mdatSize and payload
+func orphanFile(t *testing.T, mdatSize uint32, payload []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := mp4.CreateFtyp().Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	hdr := make([]byte, 8)
+	binary.BigEndian.PutUint32(hdr, mdatSize)
+	copy(hdr[4:], "mdat")
+	buf.Write(hdr)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// checkRecovered checks that the samples of trackID in the recovered file, written with its mdat
+// payload from orphan, have the data, decode times and relative presentation times of want.
+func checkRecovered(t *testing.T, rec *mp4.File, orphan []byte, trackID uint32, wantInfos []mp4.SampleInfo, wantData [][]byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := mp4.EncodeRecovered(&buf, rec, bytes.NewReader(orphan)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	dec, err := mp4.DecodeFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := dec.SampleInfos(trackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != len(wantInfos) {
+		t.Fatalf("track %d: got %d samples instead of %d", trackID, len(infos), len(wantInfos))
+	}
+	for i, info := range infos {
+		want := wantInfos[i]
+		if !bytes.Equal(data[info.Offset:info.Offset+uint64(info.Size)], wantData[i]) {
+			t.Fatalf("track %d: sample %d: data differs", trackID, i+1)
+		}
+		if info.DTS != want.DTS || info.Sync != want.Sync || info.PTS-infos[0].PTS != want.PTS-wantInfos[0].PTS {
+			t.Fatalf("track %d: sample %d: got %+v instead of %+v", trackID, i+1, info, want)
+		}
+	}
+}
+
+func TestRecoverMoov(t *testing.T) {
+	data, err := os.ReadFile("testdata/prog_8s.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := mp4.DecodeFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const videoID, audioID = 2, 1
+	videoInfos, err := ref.SampleInfos(videoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audioInfos, err := ref.SampleInfos(audioID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampleData := func(infos []mp4.SampleInfo) [][]byte {
+		out := make([][]byte, len(infos))
+		for i, info := range infos {
+			out[i] = data[info.Offset : info.Offset+uint64(info.Size)]
+		}
+		return out
+	}
+	videoData, audioData := sampleData(videoInfos), sampleData(audioInfos)
+
+	t.Run("original mdat with raw AAC", func(t *testing.T) {
+		orphan := orphanFile(t, uint32(ref.Mdat.Size()), ref.Mdat.Data)
+		rec, report, err := mp4.RecoverMoov(bytes.NewReader(orphan), int64(len(orphan)), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Tracks) != 2 || report.Tracks[0].Reason == "" || report.Tracks[1].NrSamples != len(videoInfos) {
+			t.Fatalf("unexpected report %+v", report)
+		}
+		if len(rec.Moov.Traks) != 1 {
+			t.Fatalf("got %d tracks instead of 1", len(rec.Moov.Traks))
+		}
+		checkRecovered(t, rec, orphan, videoID, videoInfos, videoData)
+	})
+
+	t.Run("ADTS audio and truncated mdat", func(t *testing.T) {
+		asc, err := aac.DecodeAudioSpecificConfig(bytes.NewReader(
+			ref.Moov.Traks[0].Mdia.Minf.Stbl.Stsd.Mp4a.Esds.DecConfigDescriptor.DecSpecificInfo.DecConfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload []byte
+		a := 0
+		for v := 0; v < len(videoInfos); v += 10 {
+			for i := v; i < v+10 && i < len(videoInfos); i++ {
+				payload = append(payload, videoData[i]...)
+			}
+			videoEnd := videoInfos[v].DTS * 48000 / 90000
+			for ; a < len(audioInfos) && audioInfos[a].DTS < videoEnd; a++ {
+				hdr, err := aac.NewADTSHeader(asc.SamplingFrequency, asc.ChannelConfiguration, asc.ObjectType, uint16(len(audioData[a])))
+				if err != nil {
+					t.Fatal(err)
+				}
+				payload = append(payload, hdr.Encode()...)
+				payload = append(payload, audioData[a]...)
+			}
+		}
+		// the last audio frame is cut
+		payload = payload[:len(payload)-10]
+		orphan := orphanFile(t, 0, payload)
+		rec, report, err := mp4.RecoverMoov(bytes.NewReader(orphan), int64(len(orphan)), ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.NrSkippedBytes != 0 || report.NrTrailingBytes == 0 {
+			t.Errorf("unexpected report %+v", report)
+		}
+		checkRecovered(t, rec, orphan, videoID, videoInfos, videoData)
+		checkRecovered(t, rec, orphan, audioID, audioInfos[:a-1], audioData[:a-1])
+	})
+
+	t.Run("no mdat", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := mp4.CreateFtyp().Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := mp4.RecoverMoov(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ref); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestRecoverMoovHEVC(t *testing.T) {
+	initData, err := os.ReadFile("testdata/hvc1_init.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	segData, err := os.ReadFile("testdata/hvc1_seg_1.m4s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(initData, segData...)
+	ref, err := mp4.DecodeFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trackID := ref.Moov.Trak.Tkhd.TrackID
+	infos, err := ref.SampleInfos(trackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last pictures of the segment miss a picture that is displayed before them
+	infos = infos[:20]
+	var payload []byte
+	sampleData := make([][]byte, len(infos))
+	for i, info := range infos {
+		sampleData[i] = data[info.Offset : info.Offset+uint64(info.Size)]
+		payload = append(payload, sampleData[i]...)
+	}
+	// garbage between samples is skipped
+	payload = append(payload[:len(payload)-len(sampleData[len(infos)-1])], bytes.Repeat([]byte{0x5a}, 100)...)
+	payload = append(payload, sampleData[len(infos)-1]...)
+	orphan := orphanFile(t, 8, payload)
+	rec, report, err := mp4.RecoverMoov(bytes.NewReader(orphan), int64(len(orphan)), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NrSkippedBytes != 100 || report.NrTrailingBytes != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	checkRecovered(t, rec, orphan, trackID, infos, sampleData)
+
+	// the payload is scanned in windows, so samples after a lot of garbage are still found
+	garbageSize := 20 << 20
+	orphan = orphanFile(t, 8, append(bytes.Repeat([]byte{0x5a}, garbageSize), payload...))
+	rec, report, err = mp4.RecoverMoov(bytes.NewReader(orphan), int64(len(orphan)), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NrSkippedBytes != uint64(garbageSize)+100 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	checkRecovered(t, rec, orphan, trackID, infos, sampleData)
+}
@@ -0,0 +1,206 @@
+package mp4
+
+import (
+	"fmt"
+)
+
+// SampleDataStatus - number of samples of a track that have their data in an mdat box,
+// for a fragment or for a progressive file
+type SampleDataStatus struct {
+	TrackID uint32 `json:"trackID"`
+	// FragmentNr - sequence number of the moof, 0 for progressive files
+	FragmentNr uint32 `json:"fragmentNr,omitempty"`
+	// Offset - offset of the moof, 0 for progressive files
+	Offset    uint64 `json:"offset,omitempty"`
+	NrSamples int    `json:"nrSamples"`
+	// NrUsable - number of samples from the first one with all data in an mdat box
+	NrUsable int `json:"nrUsable"`
+}
+
+// Complete - all samples are usable
+func (s SampleDataStatus) Complete() bool {
+	return s.NrUsable == s.NrSamples
+}
+
+// CheckSampleData - report which samples have their data in the file, per track and fragment.
+// This shows what can be used from a file decoded with DecLenient.
+func (f *File) CheckSampleData() ([]SampleDataStatus, error) {
+	mdats := topMdats(f)
+	if !f.IsFragmented() {
+		if f.Moov == nil {
+			return nil, fmt.Errorf("no moov box")
+		}
+		statuses := make([]SampleDataStatus, 0, len(f.Moov.Traks))
+		for _, trak := range f.Moov.Traks {
+			infos, err := f.SampleInfos(trak.Tkhd.TrackID)
+			if err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, SampleDataStatus{TrackID: trak.Tkhd.TrackID, NrSamples: len(infos),
+				NrUsable: nrUsableSamples(mdats, infos)})
+		}
+		return statuses, nil
+	}
+	var statuses []SampleDataStatus
+	for _, seg := range f.Segments {
+		for _, frag := range seg.Fragments {
+			if frag.Moof == nil {
+				continue
+			}
+			for _, traf := range frag.Moof.Trafs {
+				infos, err := appendFragmentSampleInfos(nil, frag, traf.Tfhd.TrackID, f.trex(traf.Tfhd.TrackID))
+				if err != nil {
+					return nil, err
+				}
+				statuses = append(statuses, SampleDataStatus{
+					TrackID:    traf.Tfhd.TrackID,
+					FragmentNr: frag.Moof.Mfhd.SequenceNumber,
+					Offset:     frag.Moof.StartPos,
+					NrSamples:  len(infos),
+					NrUsable:   nrUsableSamples(mdats, infos),
+				})
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// trex returns the trex box for trackID, or nil if there is none
+func (f *File) trex(trackID uint32) *TrexBox {
+	if f.Moov == nil || f.Moov.Mvex == nil {
+		return nil
+	}
+	trex, _ := f.Moov.Mvex.GetTrex(trackID)
+	return trex
+}
+
+// nrUsableSamples returns the number of samples from the start with all data in one of mdats
+func nrUsableSamples(mdats []*MdatBox, infos []SampleInfo) int {
+	for i, info := range infos {
+		if !mdatsContain(mdats, info.Offset, info.Size) {
+			return i
+		}
+	}
+	return len(infos)
+}
+
+func mdatsContain(mdats []*MdatBox, offset uint64, size uint32) bool {
+	for _, mdat := range mdats {
+		start := mdat.PayloadAbsoluteOffset()
+		if offset >= start && offset+uint64(size) <= start+mdat.payloadSize() {
+			return true
+		}
+	}
+	return false
+}
+
+// Repair - a valid file made of the usable parts of f, which is typically decoded with DecLenient.
+//
+// A progressive file is rewritten with the samples that have their data, like Concatenate with
+// DropIncompleteSamples. A fragmented file keeps its init segment and the complete fragments.
+// Fragments with missing sample data are rebuilt with the usable samples, unless they are encrypted,
+// in which case they are dropped. sidx boxes are not kept. Sample data must be loaded.
+func Repair(f *File) (*File, error) {
+	if !f.IsFragmented() {
+		return Concatenate([]*File{f}, ConcatOptions{DropIncompleteSamples: true})
+	}
+	if f.Init == nil {
+		return nil, fmt.Errorf("no init segment")
+	}
+	if hasLazyMdat(f) {
+		return nil, fmt.Errorf("sample data not loaded")
+	}
+	mdats := topMdats(f)
+	out := NewFile()
+	out.isFragmented = true
+	out.Init = f.Init
+	out.Children = append(out.Children, f.Init.Children...)
+	for _, seg := range f.Segments {
+		var outSeg *MediaSegment
+		for _, frag := range seg.Fragments {
+			outFrag, err := repairFragment(f, frag, mdats)
+			if err != nil {
+				return nil, err
+			}
+			if outFrag == nil {
+				continue
+			}
+			if outSeg == nil {
+				outSeg = NewMediaSegment()
+				if seg.Styp != nil {
+					outSeg = NewMediaSegmentWithStyp(seg.Styp)
+				}
+				out.AddMediaSegment(outSeg)
+			}
+			outSeg.AddFragment(outFrag)
+		}
+	}
+	return out, nil
+}
+
+// repairFragment returns frag if it is complete, a fragment with the usable samples if not,
+// or nil if nothing can be kept
+func repairFragment(f *File, frag *Fragment, mdats []*MdatBox) (*Fragment, error) {
+	if frag.Moof == nil || frag.Mdat == nil || len(frag.Moof.Trafs) == 0 {
+		return nil, nil
+	}
+	complete := true
+	encrypted := false
+	trackIDs := make([]uint32, 0, len(frag.Moof.Trafs))
+	samples := make([][]FullSample, 0, len(frag.Moof.Trafs))
+	for _, traf := range frag.Moof.Trafs {
+		trackID := traf.Tfhd.TrackID
+		infos, err := appendFragmentSampleInfos(nil, frag, trackID, f.trex(trackID))
+		if err != nil {
+			return nil, err
+		}
+		nrUsable := nrUsableSamples(mdats, infos)
+		complete = complete && nrUsable == len(infos)
+		encrypted = encrypted || traf.Senc != nil || traf.UUIDSenc != nil
+		if nrUsable == 0 {
+			continue
+		}
+		trackSamples := make([]FullSample, 0, nrUsable)
+		for _, info := range infos[:nrUsable] {
+			data, err := sampleDataAt(mdats, info.Offset, info.Size)
+			if err != nil {
+				return nil, err
+			}
+			trackSamples = append(trackSamples, FullSample{
+				Sample:     Sample{Flags: sampleFlagsFromInfo(info), Dur: info.Dur, Size: info.Size, CompositionTimeOffset: int32(info.PTS - int64(info.DTS))},
+				DecodeTime: info.DTS,
+				Data:       data,
+			})
+		}
+		trackIDs = append(trackIDs, trackID)
+		samples = append(samples, trackSamples)
+	}
+	if complete {
+		return frag, nil
+	}
+	if encrypted || len(trackIDs) == 0 {
+		return nil, nil
+	}
+	outFrag, err := CreateMultiTrackFragment(frag.Moof.Mfhd.SequenceNumber, trackIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i, trackID := range trackIDs {
+		for _, s := range samples[i] {
+			if err := outFrag.AddFullSampleToTrack(s, trackID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return outFrag, nil
+}
+
+func sampleFlagsFromInfo(info SampleInfo) uint32 {
+	return SampleFlags{
+		IsLeading:           info.IsLeading,
+		SampleDependsOn:     info.DependsOn,
+		SampleIsDependedOn:  info.IsDependedOn,
+		SampleHasRedundancy: info.HasRedundancy,
+		SampleIsNonSync:     !info.Sync,
+	}.Encode()
+}
@@ -0,0 +1,452 @@
+package mp4
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// TrackSample - sample of a progressive track with its position in the file.
+// Times are in the track (mdhd) timescale.
+type TrackSample struct {
+	FullSample
+	TrackID  uint32
+	SampleNr uint32 // One-based sample number in the track
+	// SampleDescriptionIndex - one-based index of the sample entry in stsd
+	SampleDescriptionIndex uint32
+	// Offset - byte offset of the sample data in the file
+	Offset uint64
+	// EditedPresentationTime - presentation time shifted by the edit list
+	EditedPresentationTime int64
+}
+
+// SampleReader - iterator over the samples of a progressive track in decode order.
+//
+// Sample flags are derived from stss and sdtp, times from stts and ctts, and data
+// positions from stsc, stsz and stco/co64. If LoadData is set, sample data is read
+// from the io.ReadSeeker, otherwise it can be read lazily with ReadData.
+type SampleReader struct {
+	LoadData   bool
+	trackID    uint32
+	timescale  uint32
+	stbl       *StblBox
+	rs         io.ReadSeeker
+	nrSamples  uint32
+	editOffset int64
+	minCTO     int32
+	// state for the next sample
+	nextNr     uint32
+	decodeTime uint64
+	sttsIdx    int
+	sttsUsed   uint32
+	chunkNr    uint32
+	chunkEnd   uint32 // last sample number in chunk
+	offset     uint64
+}
+
+// NewSampleReader - create a reader for a progressive track. movieTimescale is the mvhd timescale
+// used by the edit list. rs may be nil if no sample data is needed.
+func NewSampleReader(trak *TrakBox, movieTimescale uint32, rs io.ReadSeeker) (*SampleReader, error) {
+	if trak.Mdia == nil || trak.Mdia.Minf == nil || trak.Mdia.Minf.Stbl == nil {
+		return nil, fmt.Errorf("track has no sample table")
+	}
+	stbl := trak.Mdia.Minf.Stbl
+	if stbl.Stts == nil || stbl.Stsc == nil || stbl.Stsz == nil || (stbl.Stco == nil && stbl.Co64 == nil) {
+		return nil, fmt.Errorf("track %d: incomplete sample table", trak.Tkhd.TrackID)
+	}
+	r := &SampleReader{
+		trackID:   trak.Tkhd.TrackID,
+		timescale: trak.Mdia.Mdhd.Timescale,
+		stbl:      stbl,
+		rs:        rs,
+		nrSamples: stbl.Stsz.GetNrSamples(),
+	}
+	if stbl.Ctts != nil {
+		for i, o := range stbl.Ctts.SampleOffset {
+			if i == 0 || o < r.minCTO {
+				r.minCTO = o
+			}
+		}
+	}
+	r.editOffset = trak.Timeline(movieTimescale).Offset()
+	if r.nrSamples > 0 {
+		if err := r.SeekToSample(1); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// NewSampleReaders - create sample readers for all tracks of a progressive file
+func NewSampleReaders(f *File, rs io.ReadSeeker) ([]*SampleReader, error) {
+	if f.Moov == nil || f.isFragmented {
+		return nil, fmt.Errorf("not a progressive file")
+	}
+	readers := make([]*SampleReader, 0, len(f.Moov.Traks))
+	for _, trak := range f.Moov.Traks {
+		r, err := NewSampleReader(trak, f.Moov.Mvhd.Timescale, rs)
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, r)
+	}
+	return readers, nil
+}
+
+// TrackID - ID of the track
+func (r *SampleReader) TrackID() uint32 {
+	return r.trackID
+}
+
+// Timescale - media timescale of the track
+func (r *SampleReader) Timescale() uint32 {
+	return r.timescale
+}
+
+// NrSamples - number of samples in the track
+func (r *SampleReader) NrSamples() uint32 {
+	return r.nrSamples
+}
+
+// EditOffset - shift from media time to presentation time given by the edit list
+func (r *SampleReader) EditOffset() int64 {
+	return r.editOffset
+}
+
+// SeekToSample - set the one-based sample number of the next sample
+func (r *SampleReader) SeekToSample(sampleNr uint32) error {
+	if sampleNr == 0 || sampleNr > r.nrSamples+1 {
+		return fmt.Errorf("sample number %d outside 1-%d", sampleNr, r.nrSamples)
+	}
+	r.nextNr = sampleNr
+	if sampleNr > r.nrSamples {
+		return nil
+	}
+	stts := r.stbl.Stts
+	r.decodeTime, _ = stts.GetDecodeTime(sampleNr)
+	remaining := sampleNr - 1
+	r.sttsIdx = 0
+	for r.sttsIdx < len(stts.SampleCount) && remaining >= stts.SampleCount[r.sttsIdx] {
+		remaining -= stts.SampleCount[r.sttsIdx]
+		r.sttsIdx++
+	}
+	r.sttsUsed = remaining
+	chunkNr, firstInChunk, err := r.stbl.Stsc.ChunkNrFromSampleNr(int(sampleNr))
+	if err != nil {
+		return err
+	}
+	if err := r.setChunk(uint32(chunkNr)); err != nil {
+		return err
+	}
+	if uint32(firstInChunk) < sampleNr {
+		size, err := r.stbl.Stsz.GetTotalSampleSize(uint32(firstInChunk), sampleNr-1)
+		if err != nil {
+			return err
+		}
+		r.offset += size
+	}
+	return nil
+}
+
+func (r *SampleReader) setChunk(chunkNr uint32) error {
+	var err error
+	if r.stbl.Stco != nil {
+		r.offset, err = r.stbl.Stco.GetOffset(int(chunkNr))
+	} else {
+		r.offset, err = r.stbl.Co64.GetOffset(int(chunkNr))
+	}
+	if err != nil {
+		return err
+	}
+	chunk := r.stbl.Stsc.GetChunk(chunkNr)
+	r.chunkNr = chunkNr
+	r.chunkEnd = chunk.StartSampleNr + chunk.NrSamples - 1
+	return nil
+}
+
+// SeekToTime - set the next sample to the last sync sample with decode time at or before
+// decodeTime (in track timescale), or to the first sample. The sample number is returned.
+func (r *SampleReader) SeekToTime(decodeTime uint64) (uint32, error) {
+	if r.nrSamples == 0 {
+		return 0, fmt.Errorf("track %d has no samples", r.trackID)
+	}
+	stts := r.stbl.Stts
+	nr := uint32(sort.Search(int(r.nrSamples), func(i int) bool {
+		t, _ := stts.GetDecodeTime(uint32(i + 1))
+		return t > decodeTime
+	}))
+	if nr == 0 {
+		nr = 1
+	}
+	if stss := r.stbl.Stss; stss != nil {
+		i := sort.Search(len(stss.SampleNumber), func(i int) bool { return stss.SampleNumber[i] > nr })
+		if i > 0 {
+			nr = stss.SampleNumber[i-1]
+		} else if len(stss.SampleNumber) > 0 {
+			nr = stss.SampleNumber[0]
+		}
+	}
+	return nr, r.SeekToSample(nr)
+}
+
+// Next - return the next sample in decode order, or io.EOF after the last sample
+func (r *SampleReader) Next() (*TrackSample, error) {
+	if r.nextNr == 0 || r.nextNr > r.nrSamples {
+		return nil, io.EOF
+	}
+	nr := r.nextNr
+	stbl := r.stbl
+	for nr > r.chunkEnd {
+		if err := r.setChunk(r.chunkNr + 1); err != nil {
+			return nil, err
+		}
+	}
+	if r.sttsIdx >= len(stbl.Stts.SampleCount) {
+		return nil, fmt.Errorf("track %d: stts has fewer than %d samples", r.trackID, nr)
+	}
+	dur := stbl.Stts.SampleTimeDelta[r.sttsIdx]
+	var cto int32
+	if ctts := stbl.Ctts; ctts != nil {
+		if len(ctts.EndSampleNr) == 0 || ctts.EndSampleNr[len(ctts.EndSampleNr)-1] < nr {
+			return nil, fmt.Errorf("track %d: ctts has fewer than %d samples", r.trackID, nr)
+		}
+		cto = ctts.GetCompositionTimeOffset(nr)
+	}
+	size := stbl.Stsz.GetSampleSize(int(nr))
+	entryNr := stbl.Stsc.FindEntryNrForSampleNr(nr, 0)
+	s := &TrackSample{
+		FullSample: FullSample{
+			Sample:     NewSample(stbl.SampleFlags(nr), dur, size, cto),
+			DecodeTime: r.decodeTime,
+		},
+		TrackID:                r.trackID,
+		SampleNr:               nr,
+		SampleDescriptionIndex: stbl.Stsc.GetSampleDescriptionID(int(entryNr) + 1),
+		Offset:                 r.offset,
+	}
+	s.EditedPresentationTime = s.PresentationTime() + r.editOffset
+	if r.LoadData {
+		if err := r.ReadData(s); err != nil {
+			return nil, err
+		}
+	}
+	r.nextNr++
+	r.offset += uint64(size)
+	r.decodeTime += uint64(dur)
+	r.sttsUsed++
+	if r.sttsUsed == stbl.Stts.SampleCount[r.sttsIdx] {
+		r.sttsIdx++
+		r.sttsUsed = 0
+	}
+	return s, nil
+}
+
+// ReadData - read the data of a sample into s.Data
+func (r *SampleReader) ReadData(s *TrackSample) error {
+	if r.rs == nil {
+		return fmt.Errorf("no reader for sample data")
+	}
+	if _, err := r.rs.Seek(int64(s.Offset), io.SeekStart); err != nil {
+		return err
+	}
+	s.Data = make([]byte, s.Size)
+	_, err := io.ReadFull(r.rs, s.Data)
+	return err
+}
+
+// SampleFlags - sample flags for (one-based) sampleNr derived from stss and sdtp, as used in trun.
+// Without stss, all samples are sync samples.
+func (s *StblBox) SampleFlags(sampleNr uint32) uint32 {
+	var sf SampleFlags
+	isSync := s.Stss == nil || s.Stss.IsSyncSample(sampleNr)
+	sf.SampleIsNonSync = !isSync
+	if isSync {
+		sf.SampleDependsOn = 2
+	}
+	if s.Sdtp != nil && int(sampleNr) <= len(s.Sdtp.Entries) {
+		entry := s.Sdtp.Entries[sampleNr-1]
+		sf.IsLeading = entry.IsLeading()
+		sf.SampleDependsOn = entry.SampleDependsOn()
+		sf.SampleHasRedundancy = entry.SampleHasRedundancy()
+		sf.SampleIsDependedOn = entry.SampleIsDependedOn()
+	}
+	return sf.Encode()
+}
+
+// SampleOrder - order of samples from a MergedSampleReader
+type SampleOrder int
+
+const (
+	// DecodeOrder - samples ordered by decode time shifted by the edit list
+	DecodeOrder SampleOrder = iota
+	// PresentationOrder - samples ordered by presentation time shifted by the edit list
+	PresentationOrder
+)
+
+// MergedSampleReader - iterator over samples of several tracks, ordered by time across tracks.
+// Ties are resolved in the order of the readers.
+type MergedSampleReader struct {
+	order   SampleOrder
+	readers []*SampleReader
+	heads   sampleHeap
+	pending [][]*TrackSample // samples read ahead for presentation order, per reader
+	started bool
+}
+
+// NewMergedSampleReader - merge the samples of readers in the given order
+func NewMergedSampleReader(order SampleOrder, readers ...*SampleReader) *MergedSampleReader {
+	return &MergedSampleReader{
+		order:   order,
+		readers: readers,
+		pending: make([][]*TrackSample, len(readers)),
+	}
+}
+
+// SeekToTime - seek each track to its last sync sample at or before t after the edit list shift
+func (m *MergedSampleReader) SeekToTime(t time.Duration) error {
+	for i, r := range m.readers {
+		m.pending[i] = nil
+		if r.nrSamples == 0 {
+			continue
+		}
+		mediaTime := int64(t/time.Second)*int64(r.timescale) +
+			int64(t%time.Second)*int64(r.timescale)/int64(time.Second) - r.editOffset
+		if mediaTime < 0 {
+			mediaTime = 0
+		}
+		if _, err := r.SeekToTime(uint64(mediaTime)); err != nil {
+			return err
+		}
+	}
+	m.heads = nil
+	m.started = false
+	return nil
+}
+
+// Next - return the next sample across all tracks, or io.EOF when all tracks are done
+func (m *MergedSampleReader) Next() (*TrackSample, error) {
+	if !m.started {
+		m.started = true
+		for i := range m.readers {
+			if err := m.fill(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(m.heads) == 0 {
+		return nil, io.EOF
+	}
+	h := heap.Pop(&m.heads).(sampleHead)
+	if err := m.fill(h.idx); err != nil {
+		return nil, err
+	}
+	return h.sample, nil
+}
+
+// fill pushes the next sample of reader idx onto the heap.
+func (m *MergedSampleReader) fill(idx int) error {
+	r := m.readers[idx]
+	var s *TrackSample
+	var err error
+	if m.order == PresentationOrder {
+		s, err = m.nextInPresentationOrder(idx)
+	} else {
+		s, err = r.Next()
+	}
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	key := int64(s.DecodeTime) + r.editOffset
+	if m.order == PresentationOrder {
+		key = s.EditedPresentationTime
+	}
+	heap.Push(&m.heads, sampleHead{sample: s, idx: idx, key: key, timescale: r.timescale})
+	return nil
+}
+
+// nextInPresentationOrder reads ahead until no later sample in decode order can have an
+// earlier presentation time than the earliest pending sample.
+func (m *MergedSampleReader) nextInPresentationOrder(idx int) (*TrackSample, error) {
+	r := m.readers[idx]
+	for {
+		p := m.pending[idx]
+		if len(p) > 0 {
+			earliest := 0
+			for i := range p {
+				if p[i].PresentationTime() < p[earliest].PresentationTime() {
+					earliest = i
+				}
+			}
+			done := r.nextNr > r.nrSamples
+			if done || p[earliest].PresentationTime() <= int64(r.decodeTime)+int64(r.minCTO) {
+				s := p[earliest]
+				m.pending[idx] = append(p[:earliest], p[earliest+1:]...)
+				return s, nil
+			}
+		}
+		s, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		m.pending[idx] = append(m.pending[idx], s)
+	}
+}
+
+type sampleHead struct {
+	sample    *TrackSample
+	idx       int
+	key       int64
+	timescale uint32
+}
+
+// sampleHeap is a min-heap of samples by time, compared across timescales.
+type sampleHeap []sampleHead
+
+func (h sampleHeap) Len() int { return len(h) }
+
+func (h sampleHeap) Less(i, j int) bool {
+	c := compareTimes(h[i].key, h[i].timescale, h[j].key, h[j].timescale)
+	if c != 0 {
+		return c < 0
+	}
+	return h[i].idx < h[j].idx
+}
+
+func (h sampleHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *sampleHeap) Push(x interface{}) { *h = append(*h, x.(sampleHead)) }
+
+func (h *sampleHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// compareTimes compares t1/ts1 with t2/ts2 without overflow and returns -1, 0 or 1.
+func compareTimes(t1 int64, ts1 uint32, t2 int64, ts2 uint32) int {
+	switch {
+	case t1 < 0 && t2 >= 0:
+		return -1
+	case t1 >= 0 && t2 < 0:
+		return 1
+	case t1 < 0 && t2 < 0:
+		return compareTimes(-t2, ts2, -t1, ts1)
+	}
+	hi1, lo1 := bits.Mul64(uint64(t1), uint64(ts2))
+	hi2, lo2 := bits.Mul64(uint64(t2), uint64(ts1))
+	switch {
+	case hi1 < hi2 || (hi1 == hi2 && lo1 < lo2):
+		return -1
+	case hi1 == hi2 && lo1 == lo2:
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,170 @@
+package mp4_test
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestSampleReader(t *testing.T) {
+	fh, err := os.Open("testdata/prog_8s.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	f, err := mp4.DecodeFile(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers, err := mp4.NewSampleReaders(f, fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range readers {
+		trak := f.Moov.Traks[i]
+		stbl := trak.Mdia.Minf.Stbl
+		r.LoadData = true
+		var nr uint32
+		var lastEnd uint64
+		for {
+			s, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			nr++
+			if s.SampleNr != nr {
+				t.Fatalf("track %d: got sample nr %d instead of %d", r.TrackID(), s.SampleNr, nr)
+			}
+			decTime, dur := stbl.Stts.GetDecodeTime(nr)
+			if s.DecodeTime != decTime || s.Dur != dur {
+				t.Errorf("track %d sample %d: got time %d/%d instead of %d/%d",
+					r.TrackID(), nr, s.DecodeTime, s.Dur, decTime, dur)
+			}
+			if stbl.Ctts != nil && s.CompositionTimeOffset != stbl.Ctts.GetCompositionTimeOffset(nr) {
+				t.Errorf("track %d sample %d: wrong cto", r.TrackID(), nr)
+			}
+			if stbl.Stss != nil && s.IsSync() != stbl.Stss.IsSyncSample(nr) {
+				t.Errorf("track %d sample %d: wrong sync flag", r.TrackID(), nr)
+			}
+			if s.SampleDescriptionIndex != 1 {
+				t.Errorf("track %d sample %d: sample description index %d", r.TrackID(), nr, s.SampleDescriptionIndex)
+			}
+			if s.Offset < lastEnd {
+				t.Errorf("track %d sample %d: offset %d before previous end %d", r.TrackID(), nr, s.Offset, lastEnd)
+			}
+			lastEnd = s.Offset + uint64(s.Size)
+			if len(s.Data) != int(s.Size) {
+				t.Fatalf("track %d sample %d: got %d bytes", r.TrackID(), nr, len(s.Data))
+			}
+			if trak.Mdia.Hdlr.HandlerType == "vide" {
+				// Length-prefixed NAL units must exactly fill the sample
+				pos := 0
+				for pos+4 <= len(s.Data) {
+					pos += 4 + int(binary.BigEndian.Uint32(s.Data[pos:]))
+				}
+				if pos != len(s.Data) {
+					t.Errorf("sample %d: NAL units do not fill sample data", nr)
+				}
+			}
+		}
+		if nr != r.NrSamples() {
+			t.Errorf("track %d: got %d samples instead of %d", r.TrackID(), nr, r.NrSamples())
+		}
+	}
+
+	video := readers[1]
+	nr, err := video.SeekToTime(uint64(3 * video.Timescale()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := video.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SampleNr != nr || !s.IsSync() || s.DecodeTime > uint64(3*video.Timescale()) {
+		t.Errorf("seek got sample %d at %d, sync=%t", s.SampleNr, s.DecodeTime, s.IsSync())
+	}
+}
+
+func TestMergedSampleReader(t *testing.T) {
+	fh, err := os.Open("testdata/prog_8s.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	f, err := mp4.DecodeFile(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, order := range []mp4.SampleOrder{mp4.DecodeOrder, mp4.PresentationOrder} {
+		readers, err := mp4.NewSampleReaders(f, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, r := range readers {
+			total += int(r.NrSamples())
+		}
+		m := mp4.NewMergedSampleReader(order, readers...)
+		if err := m.SeekToTime(0); err != nil {
+			t.Fatal(err)
+		}
+		var lastSec float64
+		lastPerTrack := map[uint32]int64{}
+		count := 0
+		for {
+			s, err := m.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			count++
+			ts := readers[0].Timescale()
+			if s.TrackID == readers[1].TrackID() {
+				ts = readers[1].Timescale()
+			}
+			tm := int64(s.DecodeTime)
+			if order == mp4.PresentationOrder {
+				tm = s.EditedPresentationTime
+			} else {
+				tm += int64(s.EditedPresentationTime - s.PresentationTime())
+			}
+			sec := float64(tm) / float64(ts)
+			if sec < lastSec {
+				t.Errorf("order %d: sample at %.3fs after %.3fs", order, sec, lastSec)
+			}
+			if last, ok := lastPerTrack[s.TrackID]; ok && tm < last {
+				t.Errorf("order %d: track %d not in order", order, s.TrackID)
+			}
+			lastSec, lastPerTrack[s.TrackID] = sec, tm
+		}
+		if count != total {
+			t.Errorf("order %d: got %d samples instead of %d", order, count, total)
+		}
+	}
+
+	readers, err := mp4.NewSampleReaders(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mp4.NewMergedSampleReader(mp4.DecodeOrder, readers...)
+	if err := m.SeekToTime(4 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.DecodeTime == 0 {
+		t.Errorf("seek did not move reader")
+	}
+}
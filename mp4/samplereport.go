@@ -0,0 +1,351 @@
+package mp4
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// SampleInfo - timing, flags, position, and encryption info of a sample.
+// Times are in the track (mdhd) timescale.
+type SampleInfo struct {
+	TrackID  uint32 `json:"trackID"`
+	SampleNr uint32 `json:"sampleNr"` // one-based sample number in track
+	// FragmentNr - sequence number of the moof containing the sample, 0 for progressive files
+	FragmentNr uint32 `json:"fragmentNr,omitempty"`
+	DTS        uint64 `json:"dts"`
+	PTS        int64  `json:"pts"`
+	Dur        uint32 `json:"dur"`
+	Size       uint32 `json:"size"`
+	// Offset - byte offset of the sample data in the file
+	Offset        uint64 `json:"offset"`
+	Sync          bool   `json:"sync"`
+	IsLeading     byte   `json:"isLeading"`
+	DependsOn     byte   `json:"dependsOn"`
+	IsDependedOn  byte   `json:"isDependedOn"`
+	HasRedundancy byte   `json:"hasRedundancy"`
+	// IV - hex per-sample initialization vector from senc, if any
+	IV string `json:"iv,omitempty"`
+	// SubSamples - subsample encryption pattern from senc, if any
+	SubSamples []SubSamplePattern `json:"subSamples,omitempty"`
+}
+
+func newSampleInfo(trackID, sampleNr uint32, s FullSample, offset uint64) SampleInfo {
+	sf := DecodeSampleFlags(s.Flags)
+	return SampleInfo{
+		TrackID:       trackID,
+		SampleNr:      sampleNr,
+		DTS:           s.DecodeTime,
+		PTS:           s.PresentationTime(),
+		Dur:           s.Dur,
+		Size:          s.Size,
+		Offset:        offset,
+		Sync:          !sf.SampleIsNonSync,
+		IsLeading:     sf.IsLeading,
+		DependsOn:     sf.SampleDependsOn,
+		IsDependedOn:  sf.SampleIsDependedOn,
+		HasRedundancy: sf.SampleHasRedundancy,
+	}
+}
+
+// SampleInfos - info about all samples of a track in decode order.
+// Progressive tracks are described by the sample table, and fragmented tracks by the fragments
+// of all segments. No sample data is needed, so the file may be decoded with DecModeLazyMdat.
+func (f *File) SampleInfos(trackID uint32) ([]SampleInfo, error) {
+	if !f.IsFragmented() {
+		if f.Moov == nil {
+			return nil, fmt.Errorf("no moov box")
+		}
+		for _, trak := range f.Moov.Traks {
+			if trak.Tkhd.TrackID == trackID {
+				return progressiveSampleInfos(trak, f.Moov.Mvhd.Timescale)
+			}
+		}
+		return nil, fmt.Errorf("no track with ID %d", trackID)
+	}
+	var trex *TrexBox
+	if f.Moov != nil && f.Moov.Mvex != nil {
+		var ok bool
+		if trex, ok = f.Moov.Mvex.GetTrex(trackID); !ok {
+			return nil, fmt.Errorf("no trex for track with ID %d", trackID)
+		}
+	}
+	var infos []SampleInfo
+	for _, seg := range f.Segments {
+		for _, frag := range seg.Fragments {
+			var err error
+			infos, err = appendFragmentSampleInfos(infos, frag, trackID, trex)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return infos, nil
+}
+
+func progressiveSampleInfos(trak *TrakBox, movieTimescale uint32) ([]SampleInfo, error) {
+	sr, err := NewSampleReader(trak, movieTimescale, nil)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SampleInfo, 0, sr.NrSamples())
+	for {
+		s, err := sr.Next()
+		if err == io.EOF {
+			return infos, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, newSampleInfo(s.TrackID, s.SampleNr, s.FullSample, s.Offset))
+	}
+}
+
+// appendFragmentSampleInfos appends the samples of trackID in frag to infos.
+// Without base data offset in tfhd and without default-base-is-moof, the data of a traf starts after
+// that of the previous traf, and a trun without data offset continues after the previous trun
+// (Section 8.8.7.1 and 8.8.8.1).
+func appendFragmentSampleInfos(infos []SampleInfo, frag *Fragment, trackID uint32, trex *TrexBox) ([]SampleInfo, error) {
+	moof := frag.Moof
+	if moof == nil {
+		return infos, nil
+	}
+	offset := moof.StartPos
+	for _, traf := range moof.Trafs {
+		tfhd := traf.Tfhd
+		base := offset
+		switch {
+		case tfhd.HasBaseDataOffset():
+			base = tfhd.BaseDataOffset
+		case tfhd.DefaultBaseIfMoof():
+			base = moof.StartPos
+		}
+		offset = base
+		if tfhd.TrackID != trackID {
+			for _, trun := range traf.Truns {
+				trun.AddSampleDefaultValues(tfhd, trex)
+				if trun.HasDataOffset() {
+					offset = uint64(int64(base) + int64(trun.DataOffset))
+				}
+				for _, s := range trun.Samples {
+					offset += uint64(s.Size)
+				}
+			}
+			continue
+		}
+		var decodeTime uint64
+		if traf.Tfdt != nil {
+			decodeTime = traf.Tfdt.BaseMediaDecodeTime()
+		} else if len(infos) > 0 {
+			last := infos[len(infos)-1]
+			decodeTime = last.DTS + uint64(last.Dur)
+		}
+		senc := traf.Senc
+		if senc == nil && traf.UUIDSenc != nil {
+			senc = traf.UUIDSenc.Senc
+		}
+		if senc != nil && senc.ReadButNotParsed() {
+			return nil, fmt.Errorf("fragment %d: senc not parsed", moof.Mfhd.SequenceNumber)
+		}
+		sampleIdx := 0
+		for _, trun := range traf.Truns {
+			trun.AddSampleDefaultValues(tfhd, trex)
+			if trun.HasDataOffset() {
+				offset = uint64(int64(base) + int64(trun.DataOffset))
+			}
+			for _, s := range trun.Samples {
+				info := newSampleInfo(trackID, uint32(len(infos))+1, FullSample{Sample: s, DecodeTime: decodeTime}, offset)
+				info.FragmentNr = moof.Mfhd.SequenceNumber
+				if senc != nil {
+					if sampleIdx < len(senc.IVs) && len(senc.IVs[sampleIdx]) > 0 {
+						info.IV = hex.EncodeToString(senc.IVs[sampleIdx])
+					}
+					if sampleIdx < len(senc.SubSamples) {
+						info.SubSamples = senc.SubSamples[sampleIdx]
+					}
+				}
+				infos = append(infos, info)
+				decodeTime += uint64(s.Dur)
+				offset += uint64(s.Size)
+				sampleIdx++
+			}
+		}
+	}
+	return infos, nil
+}
+
+// Discontinuity - a decode time gap or overlap between consecutive samples
+type Discontinuity struct {
+	SampleNr    uint32 `json:"sampleNr"` // sample after the discontinuity
+	FragmentNr  uint32 `json:"fragmentNr,omitempty"`
+	ExpectedDTS uint64 `json:"expectedDTS"` // DTS + duration of the previous sample
+	DTS         uint64 `json:"dts"`
+}
+
+// Gap - positive for a gap and negative for an overlap
+func (d Discontinuity) Gap() int64 {
+	return int64(d.DTS) - int64(d.ExpectedDTS)
+}
+
+// TrackStats - summary statistics of the samples of a track. Times are in the track timescale.
+type TrackStats struct {
+	TrackID   uint32 `json:"trackID"`
+	Timescale uint32 `json:"timescale"`
+	NrSamples int    `json:"nrSamples"`
+	// Duration - sum of sample durations
+	Duration  uint64 `json:"duration"`
+	TotalSize uint64 `json:"totalSize"`
+	// AvgBitrate - average bitrate in bits per second
+	AvgBitrate float64 `json:"avgBitrate"`
+	// Bitrates - bits of the samples with DTS in each second counted from the first DTS.
+	// The last value covers a partial second if the duration is not a whole number of seconds.
+	Bitrates      []uint64 `json:"bitrates"`
+	NrSyncSamples int      `json:"nrSyncSamples"`
+	// MaxGOPLength and AvgGOPLength - number of samples from a sync sample up to the next one.
+	// Samples before the first sync sample are not counted.
+	MaxGOPLength int     `json:"maxGOPLength"`
+	AvgGOPLength float64 `json:"avgGOPLength"`
+	MinSampleDur uint32  `json:"minSampleDur"`
+	MaxSampleDur uint32  `json:"maxSampleDur"`
+	// ConstantFrameRate - all sample durations, except possibly the last, are equal
+	ConstantFrameRate bool    `json:"constantFrameRate"`
+	AvgFrameRate      float64 `json:"avgFrameRate"`
+	MinCTO            int32   `json:"minCTO"`
+	MaxCTO            int32   `json:"maxCTO"`
+	// Cslg - composition to decode box of the track, if any
+	Cslg *CslgBox `json:"cslg,omitempty"`
+	// CslgMatchesCTO - the cslg least and greatest decode-to-display deltas equal MinCTO and MaxCTO
+	CslgMatchesCTO  bool            `json:"cslgMatchesCTO,omitempty"`
+	Discontinuities []Discontinuity `json:"discontinuities,omitempty"`
+}
+
+// CalcTrackStats - calculate statistics for the samples of a track in decode order.
+// cslg may be nil.
+func CalcTrackStats(samples []SampleInfo, timescale uint32, cslg *CslgBox) *TrackStats {
+	st := &TrackStats{Timescale: timescale, NrSamples: len(samples), Cslg: cslg, ConstantFrameRate: true}
+	if len(samples) == 0 {
+		return st
+	}
+	st.TrackID = samples[0].TrackID
+	firstDTS := samples[0].DTS
+	st.MinSampleDur, st.MaxSampleDur = samples[0].Dur, samples[0].Dur
+	st.MinCTO, st.MaxCTO = int32(samples[0].PTS-int64(firstDTS)), int32(samples[0].PTS-int64(firstDTS))
+	gopLen := 0 // samples in current GOP, 0 before the first sync sample
+	for i, s := range samples {
+		st.Duration += uint64(s.Dur)
+		st.TotalSize += uint64(s.Size)
+		if timescale > 0 && s.DTS >= firstDTS {
+			sec := int((s.DTS - firstDTS) / uint64(timescale))
+			for len(st.Bitrates) <= sec {
+				st.Bitrates = append(st.Bitrates, 0)
+			}
+			st.Bitrates[sec] += 8 * uint64(s.Size)
+		}
+		if s.Sync {
+			st.NrSyncSamples++
+			gopLen = 0
+		}
+		if st.NrSyncSamples > 0 {
+			gopLen++
+			if gopLen > st.MaxGOPLength {
+				st.MaxGOPLength = gopLen
+			}
+		}
+		if s.Dur < st.MinSampleDur {
+			st.MinSampleDur = s.Dur
+		}
+		if s.Dur > st.MaxSampleDur {
+			st.MaxSampleDur = s.Dur
+		}
+		if i > 0 && i < len(samples)-1 && s.Dur != samples[0].Dur {
+			st.ConstantFrameRate = false
+		}
+		cto := int32(s.PTS - int64(s.DTS))
+		if cto < st.MinCTO {
+			st.MinCTO = cto
+		}
+		if cto > st.MaxCTO {
+			st.MaxCTO = cto
+		}
+		if i > 0 {
+			prev := samples[i-1]
+			if expected := prev.DTS + uint64(prev.Dur); s.DTS != expected {
+				st.Discontinuities = append(st.Discontinuities, Discontinuity{
+					SampleNr:    s.SampleNr,
+					FragmentNr:  s.FragmentNr,
+					ExpectedDTS: expected,
+					DTS:         s.DTS,
+				})
+			}
+		}
+	}
+	if st.NrSyncSamples > 0 {
+		// samples before the first sync sample are not part of a GOP
+		st.AvgGOPLength = float64(len(samples)-firstSyncIdx(samples)) / float64(st.NrSyncSamples)
+	}
+	if st.Duration > 0 {
+		seconds := float64(st.Duration) / float64(timescale)
+		st.AvgBitrate = float64(8*st.TotalSize) / seconds
+		st.AvgFrameRate = float64(len(samples)) / seconds
+	}
+	if cslg != nil {
+		st.CslgMatchesCTO = cslg.LeastDecodeToDisplayDelta == int64(st.MinCTO) &&
+			cslg.GreatestDecodeToDisplayDelta == int64(st.MaxCTO)
+	}
+	return st
+}
+
+func firstSyncIdx(samples []SampleInfo) int {
+	for i, s := range samples {
+		if s.Sync {
+			return i
+		}
+	}
+	return len(samples)
+}
+
+// TrackStats - statistics for the samples of a track, including a check against its cslg box
+func (f *File) TrackStats(trackID uint32) (*TrackStats, error) {
+	samples, err := f.SampleInfos(trackID)
+	if err != nil {
+		return nil, err
+	}
+	var timescale uint32
+	var cslg *CslgBox
+	if f.Moov != nil {
+		for _, trak := range f.Moov.Traks {
+			if trak.Tkhd.TrackID == trackID {
+				timescale = trak.Mdia.Mdhd.Timescale
+				cslg = trackCslg(f.Moov, trak)
+			}
+		}
+	}
+	if timescale == 0 {
+		return nil, fmt.Errorf("no timescale for track %d", trackID)
+	}
+	return CalcTrackStats(samples, timescale, cslg), nil
+}
+
+// trackCslg returns the cslg box of the track from stbl, or from a trep box in mvex.
+func trackCslg(moov *MoovBox, trak *TrakBox) *CslgBox {
+	if stbl := trak.Mdia.Minf.Stbl; stbl != nil {
+		for _, c := range stbl.Children {
+			if cslg, ok := c.(*CslgBox); ok {
+				return cslg
+			}
+		}
+	}
+	if moov.Mvex == nil {
+		return nil
+	}
+	for _, c := range moov.Mvex.Children {
+		if trep, ok := c.(*TrepBox); ok && trep.TrackID == trak.Tkhd.TrackID {
+			for _, tc := range trep.Children {
+				if cslg, ok := tc.(*CslgBox); ok {
+					return cslg
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package mp4_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestSampleInfos(t *testing.T) {
+	testCases := []struct {
+		file      string
+		trackID   uint32
+		encrypted bool
+	}{
+		{file: "testdata/prog_8s.mp4", trackID: 1},
+		{file: "testdata/prog_8s.mp4", trackID: 2},
+		{file: "testdata/prog_8s_enc_dashinit.mp4", trackID: 1, encrypted: true},
+		{file: "testdata/cbcs.mp4", trackID: 1, encrypted: true},
+		{file: "testdata/bbb5s_aac_sidx.mp4", trackID: 3},
+		{file: "testdata/v300_multiple_segments.mp4", trackID: 2},
+	}
+	for _, tc := range testCases {
+		data, err := os.ReadFile(tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := mp4.DecodeFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos, err := f.SampleInfos(tc.trackID)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.file, err)
+		}
+		if len(infos) == 0 {
+			t.Fatalf("%s: no samples", tc.file)
+		}
+		var wantData [][]byte
+		if f.IsFragmented() {
+			trex, _ := f.Moov.Mvex.GetTrex(tc.trackID)
+			for _, seg := range f.Segments {
+				for _, frag := range seg.Fragments {
+					fss, err := frag.GetFullSamples(trex)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, fs := range fss {
+						wantData = append(wantData, fs.Data)
+					}
+				}
+			}
+		} else {
+			for _, trak := range f.Moov.Traks {
+				if trak.Tkhd.TrackID != tc.trackID {
+					continue
+				}
+				sr, err := mp4.NewSampleReader(trak, f.Moov.Mvhd.Timescale, bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				sr.LoadData = true
+				for {
+					s, err := sr.Next()
+					if err != nil {
+						break
+					}
+					wantData = append(wantData, s.Data)
+				}
+			}
+		}
+		if len(wantData) != len(infos) {
+			t.Fatalf("%s: got %d samples instead of %d", tc.file, len(infos), len(wantData))
+		}
+		for i, info := range infos {
+			got := data[info.Offset : info.Offset+uint64(info.Size)]
+			if !bytes.Equal(got, wantData[i]) {
+				t.Fatalf("%s: sample %d: data at offset %d differs", tc.file, info.SampleNr, info.Offset)
+			}
+			if i > 0 && info.DTS != infos[i-1].DTS+uint64(infos[i-1].Dur) {
+				t.Errorf("%s: sample %d: non-continuous DTS %d", tc.file, info.SampleNr, info.DTS)
+			}
+			if tc.encrypted && info.SubSamples == nil && info.IV == "" {
+				t.Errorf("%s: sample %d: no encryption info", tc.file, info.SampleNr)
+			}
+		}
+		if _, err := f.SampleInfos(17); err == nil {
+			t.Errorf("%s: expected error for unknown track", tc.file)
+		}
+		if !infos[0].Sync {
+			t.Errorf("%s: first sample is not sync", tc.file)
+		}
+	}
+}
+
+func TestCalcTrackStats(t *testing.T) {
+	var samples []mp4.SampleInfo
+	var dts uint64
+	for i := 0; i < 100; i++ {
+		if i == 60 {
+			dts += 500 // gap
+		}
+		if i == 80 {
+			dts -= 200 // overlap
+		}
+		samples = append(samples, mp4.SampleInfo{
+			TrackID:  1,
+			SampleNr: uint32(i + 1),
+			DTS:      dts,
+			PTS:      int64(dts) + int64(i%3)*1000,
+			Dur:      1000,
+			Size:     125,
+			Sync:     i%30 == 0,
+		})
+		dts += 1000
+	}
+	cslg := &mp4.CslgBox{LeastDecodeToDisplayDelta: 0, GreatestDecodeToDisplayDelta: 2000}
+	st := mp4.CalcTrackStats(samples, 10000, cslg)
+	if st.NrSamples != 100 || st.Duration != 100000 || st.TotalSize != 12500 {
+		t.Errorf("bad totals %+v", st)
+	}
+	if st.AvgBitrate != 10000 || st.AvgFrameRate != 10 {
+		t.Errorf("got bitrate %f and frame rate %f", st.AvgBitrate, st.AvgFrameRate)
+	}
+	if len(st.Bitrates) != 10 || st.Bitrates[0] != 10000 {
+		t.Errorf("got bitrates %v", st.Bitrates)
+	}
+	if st.NrSyncSamples != 4 || st.MaxGOPLength != 30 || st.AvgGOPLength != 25 {
+		t.Errorf("got %d sync samples, max GOP %d, avg GOP %f", st.NrSyncSamples, st.MaxGOPLength, st.AvgGOPLength)
+	}
+	if !st.ConstantFrameRate || st.MinCTO != 0 || st.MaxCTO != 2000 || !st.CslgMatchesCTO {
+		t.Errorf("bad frame rate or CTO stats %+v", st)
+	}
+	if len(st.Discontinuities) != 2 || st.Discontinuities[0].Gap() != 500 || st.Discontinuities[1].Gap() != -200 {
+		t.Errorf("got discontinuities %+v", st.Discontinuities)
+	}
+}
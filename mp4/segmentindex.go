@@ -0,0 +1,450 @@
+package mp4
+
+import (
+	"fmt"
+	"io"
+)
+
+// SegmentIndex - time to byte range index of a track in a fragmented file.
+// It is built by ReadSegmentIndex from sidx boxes, from an mfra box, or from the moof boxes.
+type SegmentIndex struct {
+	// TrackID - track (sidx reference_ID) that is indexed
+	TrackID   uint32
+	Timescale uint32
+	// Source - "sidx", "mfra" or "moof", depending on what the index is built from
+	Source  string
+	Entries []SegmentIndexEntry
+	// Leva - level assignment box from the init segment, if any, describing the ssix levels
+	Leva *LevaBox
+}
+
+// SegmentIndexEntry - a subsegment, i.e. one or more fragments, and its byte range
+type SegmentIndexEntry struct {
+	// StartTime - earliest presentation time for sidx, and decode time of the first sample otherwise
+	StartTime uint64
+	Duration  uint64
+	// Offset - start of the first box (styp, moof, ...) of the subsegment
+	Offset        uint64
+	Size          uint64
+	StartsWithSAP bool
+	SAPType       uint8
+	// Levels - byte ranges of the levels from an ssix box, in file order
+	Levels []SegmentIndexLevel
+}
+
+// SegmentIndexLevel - byte range of one level in a subsegment
+type SegmentIndexLevel struct {
+	Level  uint8
+	Offset uint64
+	Size   uint64
+}
+
+// End - end time of the subsegment
+func (e *SegmentIndexEntry) End() uint64 {
+	return e.StartTime + e.Duration
+}
+
+// LevelRange - byte range with all data of level and lower levels, like an I-frame-only range
+// for level 0. The ssix ranges are in increasing level order, so this is a prefix of the subsegment.
+// ok is false if there is no level information or no data for level.
+func (e *SegmentIndexEntry) LevelRange(level uint8) (offset, size uint64, ok bool) {
+	end := uint64(0)
+	for _, l := range e.Levels {
+		if l.Level <= level {
+			end = l.Offset + l.Size
+		}
+	}
+	if end == 0 {
+		return 0, 0, false
+	}
+	return e.Offset, end - e.Offset, true
+}
+
+// FindEntry - entry for the subsegment that holds time (in Timescale).
+// Times before the first entry give the first entry, and times after the last entry give nil.
+func (si *SegmentIndex) FindEntry(time uint64) *SegmentIndexEntry {
+	if len(si.Entries) == 0 {
+		return nil
+	}
+	lo, hi := 0, len(si.Entries)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if si.Entries[mid].StartTime <= time {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return &si.Entries[0]
+	}
+	e := &si.Entries[lo-1]
+	if time >= e.End() {
+		return nil
+	}
+	return e
+}
+
+// Duration - total duration of the entries
+func (si *SegmentIndex) Duration() uint64 {
+	if len(si.Entries) == 0 {
+		return 0
+	}
+	return si.Entries[len(si.Entries)-1].End() - si.Entries[0].StartTime
+}
+
+// ReadSegmentIndex - build the SegmentIndex of track trackID (0 for the first one) of a fragmented file.
+//
+// Only box headers and the needed boxes are read. If there are sidx boxes, hierarchical and
+// daisy-chained sidx boxes are followed, and an ssix box directly after a sidx box gives the levels
+// of its subsegments. Otherwise, the tfra box of an mfra box is used, and as a last resort,
+// all moof boxes found by GetTopBoxInfoList are read. The last two need a moov box for the timescale.
+func ReadSegmentIndex(rs io.ReadSeeker, trackID uint32) (*SegmentIndex, error) {
+	boxes, err := GetTopBoxInfoList(rs, "")
+	if err != nil {
+		return nil, fmt.Errorf("top boxes: %w", err)
+	}
+	var moov *MoovBox
+	var mfra *MfraBox
+	hasSidx := false
+	for _, b := range boxes {
+		switch b.Type {
+		case "moov", "mfra":
+			box, err := readBoxAt(rs, b.StartPos)
+			if err != nil {
+				return nil, err
+			}
+			if b.Type == "moov" {
+				moov = box.(*MoovBox)
+			} else {
+				mfra = box.(*MfraBox)
+			}
+		case "sidx":
+			hasSidx = true
+		}
+	}
+	si := &SegmentIndex{TrackID: trackID}
+	if moov != nil && moov.Mvex != nil {
+		for _, c := range moov.Mvex.Children {
+			if leva, ok := c.(*LevaBox); ok {
+				si.Leva = leva
+			}
+		}
+	}
+	if hasSidx {
+		err = si.readSidxs(rs, boxes)
+		return si, err
+	}
+	if moov == nil {
+		return nil, fmt.Errorf("no sidx and no moov box")
+	}
+	if si.TrackID == 0 {
+		si.TrackID = moov.Trak.Tkhd.TrackID
+	}
+	for _, trak := range moov.Traks {
+		if trak.Tkhd.TrackID == si.TrackID {
+			si.Timescale = trak.Mdia.Mdhd.Timescale
+		}
+	}
+	if si.Timescale == 0 {
+		return nil, fmt.Errorf("no track with ID %d", si.TrackID)
+	}
+	var trex *TrexBox
+	if moov.Mvex != nil {
+		trex, _ = moov.Mvex.GetTrex(si.TrackID)
+	}
+	if mfra != nil {
+		for _, tfra := range mfra.Tfras {
+			if tfra.TrackID == si.TrackID {
+				err = si.readTfra(rs, boxes, tfra, trex)
+				return si, err
+			}
+		}
+	}
+	err = si.readMoofs(rs, boxes, trex)
+	return si, err
+}
+
+// readSidxs adds the entries of the sidx boxes of the track. All sidx boxes that are not
+// referenced by another sidx box are roots that are followed in file order.
+func (si *SegmentIndex) readSidxs(rs io.ReadSeeker, boxes []TopBoxInfo) error {
+	si.Source = "sidx"
+	visited := make(map[uint64]bool)
+	for i, b := range boxes {
+		if b.Type != "sidx" || visited[b.StartPos] {
+			continue
+		}
+		box, err := readBoxAt(rs, b.StartPos)
+		if err != nil {
+			return err
+		}
+		sidx := box.(*SidxBox)
+		if si.TrackID == 0 {
+			si.TrackID = sidx.ReferenceID
+		}
+		if sidx.ReferenceID != si.TrackID {
+			continue
+		}
+		if si.Timescale == 0 {
+			si.Timescale = sidx.Timescale
+		}
+		if err := si.addSidx(rs, boxes, i, sidx, visited); err != nil {
+			return err
+		}
+	}
+	if len(si.Entries) == 0 {
+		return fmt.Errorf("no sidx box for track %d", si.TrackID)
+	}
+	return nil
+}
+
+// addSidx adds the entries of sidx, which is the top box boxIdx, and of the sidx boxes it references
+func (si *SegmentIndex) addSidx(rs io.ReadSeeker, boxes []TopBoxInfo, boxIdx int, sidx *SidxBox, visited map[uint64]bool) error {
+	visited[boxes[boxIdx].StartPos] = true
+	var ssix *SsixBox
+	if boxIdx+1 < len(boxes) && boxes[boxIdx+1].Type == "ssix" {
+		box, err := readBoxAt(rs, boxes[boxIdx+1].StartPos)
+		if err != nil {
+			return err
+		}
+		ssix = box.(*SsixBox)
+		if len(ssix.SubSegments) != len(sidx.SidxRefs) {
+			return fmt.Errorf("ssix at %d: %d subsegments for %d sidx references",
+				boxes[boxIdx+1].StartPos, len(ssix.SubSegments), len(sidx.SidxRefs))
+		}
+	}
+	time := sidx.EarliestPresentationTime
+	if sidx.Timescale != si.Timescale {
+		time = RescaleTime(time, sidx.Timescale, si.Timescale)
+	}
+	offset := sidx.AnchorPoint
+	for i, ref := range sidx.SidxRefs {
+		dur := uint64(ref.SubSegmentDuration)
+		if sidx.Timescale != si.Timescale {
+			dur = RescaleTime(dur, sidx.Timescale, si.Timescale)
+		}
+		if ref.ReferenceType == 1 {
+			idx := topBoxIndex(boxes, offset)
+			if idx < 0 || boxes[idx].Type != "sidx" {
+				return fmt.Errorf("no sidx box at referenced offset %d", offset)
+			}
+			if visited[offset] {
+				return fmt.Errorf("sidx box at %d referenced twice", offset)
+			}
+			box, err := readBoxAt(rs, offset)
+			if err != nil {
+				return err
+			}
+			if err := si.addSidx(rs, boxes, idx, box.(*SidxBox), visited); err != nil {
+				return err
+			}
+		} else {
+			e := SegmentIndexEntry{
+				StartTime:     time,
+				Duration:      dur,
+				Offset:        offset,
+				Size:          uint64(ref.ReferencedSize),
+				StartsWithSAP: ref.StartsWithSAP == 1,
+				SAPType:       ref.SAPType,
+			}
+			if ssix != nil {
+				e.Levels = subSegmentLevels(ssix.SubSegments[i], offset, e.Size)
+			}
+			si.Entries = append(si.Entries, e)
+		}
+		time += dur
+		offset += uint64(ref.ReferencedSize)
+	}
+	return nil
+}
+
+// subSegmentLevels returns the byte ranges of the levels of a subsegment.
+// A range size 0 for the last range means the rest of the subsegment.
+func subSegmentLevels(subSeg SubSegment, offset, size uint64) []SegmentIndexLevel {
+	levels := make([]SegmentIndexLevel, 0, len(subSeg.Ranges))
+	end := offset + size
+	for i, r := range subSeg.Ranges {
+		rangeSize := uint64(r.RangeSize())
+		if rangeSize == 0 && i == len(subSeg.Ranges)-1 && offset < end {
+			rangeSize = end - offset
+		}
+		levels = append(levels, SegmentIndexLevel{Level: r.Level(), Offset: offset, Size: rangeSize})
+		offset += rangeSize
+	}
+	return levels
+}
+
+// readTfra adds an entry for every moof box with a tfra entry. The duration of the last one
+// is found by reading its moof box.
+func (si *SegmentIndex) readTfra(rs io.ReadSeeker, boxes []TopBoxInfo, tfra *TfraBox, trex *TrexBox) error {
+	si.Source = "mfra"
+	var lastMoofOffset uint64
+	for i, te := range tfra.Entries {
+		// Only the first sync sample of a fragment is used
+		if i > 0 && te.MoofOffset == lastMoofOffset {
+			continue
+		}
+		lastMoofOffset = te.MoofOffset
+		idx := topBoxIndex(boxes, te.MoofOffset)
+		if idx < 0 || boxes[idx].Type != "moof" {
+			return fmt.Errorf("no moof box at tfra offset %d", te.MoofOffset)
+		}
+		si.Entries = append(si.Entries, SegmentIndexEntry{
+			StartTime:     te.Time,
+			Offset:        boxes[fragmentStartIndex(boxes, idx)].StartPos,
+			StartsWithSAP: te.TrafNumber == 1 && te.TrunNumber == 1 && te.SampleNumber == 1,
+		})
+	}
+	if len(si.Entries) == 0 {
+		return fmt.Errorf("no tfra entries for track %d", si.TrackID)
+	}
+	for i := 0; i < len(si.Entries)-1; i++ {
+		si.Entries[i].Duration = si.Entries[i+1].StartTime - si.Entries[i].StartTime
+	}
+	last := &si.Entries[len(si.Entries)-1]
+	mt, err := readMoofTiming(rs, lastMoofOffset, si.TrackID, trex)
+	if err != nil {
+		return err
+	}
+	if mt == nil {
+		return fmt.Errorf("no traf for track %d in moof at %d", si.TrackID, lastMoofOffset)
+	}
+	last.Duration = mt.dur
+	si.setSizes(boxes)
+	return nil
+}
+
+// readMoofs adds an entry for every moof box with a traf box for the track
+func (si *SegmentIndex) readMoofs(rs io.ReadSeeker, boxes []TopBoxInfo, trex *TrexBox) error {
+	si.Source = "moof"
+	for i, b := range boxes {
+		if b.Type != "moof" {
+			continue
+		}
+		mt, err := readMoofTiming(rs, b.StartPos, si.TrackID, trex)
+		if err != nil {
+			return err
+		}
+		if mt == nil {
+			continue
+		}
+		startTime := mt.baseTime
+		if !mt.hasTfdt && len(si.Entries) > 0 {
+			startTime = si.Entries[len(si.Entries)-1].End()
+		}
+		si.Entries = append(si.Entries, SegmentIndexEntry{
+			StartTime:     startTime,
+			Duration:      mt.dur,
+			Offset:        boxes[fragmentStartIndex(boxes, i)].StartPos,
+			StartsWithSAP: mt.sync,
+		})
+	}
+	if len(si.Entries) == 0 {
+		return fmt.Errorf("no fragments for track %d", si.TrackID)
+	}
+	si.setSizes(boxes)
+	return nil
+}
+
+// setSizes sets the entry sizes to the distance to the next entry, and for the last entry,
+// up to the end of the last box before any mfra box
+func (si *SegmentIndex) setSizes(boxes []TopBoxInfo) {
+	end := uint64(0)
+	for _, b := range boxes {
+		if b.Type == "mfra" {
+			break
+		}
+		end = b.StartPos + b.Size
+	}
+	for i := range si.Entries {
+		next := end
+		if i+1 < len(si.Entries) {
+			next = si.Entries[i+1].Offset
+		}
+		si.Entries[i].Size = next - si.Entries[i].Offset
+	}
+}
+
+// moofTiming - timing of the samples of a track in a moof box
+type moofTiming struct {
+	baseTime uint64
+	dur      uint64
+	hasTfdt  bool
+	// sync - the first sample is a sync sample
+	sync bool
+}
+
+// readMoofTiming reads the moof box at pos and returns the timing of trackID, or nil if there
+// is no traf box for the track
+func readMoofTiming(rs io.ReadSeeker, pos uint64, trackID uint32, trex *TrexBox) (*moofTiming, error) {
+	box, err := readBoxAt(rs, pos)
+	if err != nil {
+		return nil, err
+	}
+	moof, ok := box.(*MoofBox)
+	if !ok {
+		return nil, fmt.Errorf("no moof box at %d", pos)
+	}
+	for _, traf := range moof.Trafs {
+		if traf.Tfhd.TrackID != trackID {
+			continue
+		}
+		mt := &moofTiming{}
+		if traf.Tfdt != nil {
+			mt.baseTime = traf.Tfdt.BaseMediaDecodeTime()
+			mt.hasTfdt = true
+		}
+		for i, trun := range traf.Truns {
+			mt.dur += trun.AddSampleDefaultValues(traf.Tfhd, trex)
+			if i == 0 && len(trun.Samples) > 0 {
+				mt.sync = IsSyncSampleFlags(trun.Samples[0].Flags)
+			}
+		}
+		return mt, nil
+	}
+	return nil, nil
+}
+
+// fragmentStartIndex returns the index of the first of the styp, emsg and prft boxes
+// directly before the moof box at moofIdx, or moofIdx if there are none
+func fragmentStartIndex(boxes []TopBoxInfo, moofIdx int) int {
+	idx := moofIdx
+	for idx > 0 {
+		switch boxes[idx-1].Type {
+		case "styp", "emsg", "prft":
+			idx--
+			continue
+		}
+		break
+	}
+	return idx
+}
+
+// topBoxIndex returns the index of the top box starting at pos, or -1
+func topBoxIndex(boxes []TopBoxInfo, pos uint64) int {
+	lo, hi := 0, len(boxes)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if boxes[mid].StartPos < pos {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < len(boxes) && boxes[lo].StartPos == pos {
+		return lo
+	}
+	return -1
+}
+
+// readBoxAt decodes the box at pos
+func readBoxAt(rs io.ReadSeeker, pos uint64) (Box, error) {
+	if _, err := rs.Seek(int64(pos), io.SeekStart); err != nil {
+		return nil, err
+	}
+	box, err := DecodeBox(pos, rs)
+	if err != nil {
+		return nil, fmt.Errorf("box at %d: %w", pos, err)
+	}
+	return box, nil
+}
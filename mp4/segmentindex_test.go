@@ -0,0 +1,239 @@
+package mp4_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestSegmentIndexSidx(t *testing.T) {
+	data, err := os.ReadFile("testdata/bbb5s_aac_sidx.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.DecodeFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	si, err := mp4.ReadSegmentIndex(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidx := f.Sidx
+	if si.Source != "sidx" || si.TrackID != sidx.ReferenceID || si.Timescale != sidx.Timescale {
+		t.Fatalf("unexpected index %+v", si)
+	}
+	if len(si.Entries) != len(f.Segments) {
+		t.Fatalf("got %d entries instead of %d", len(si.Entries), len(f.Segments))
+	}
+	for i, seg := range f.Segments {
+		e := si.Entries[i]
+		if e.Offset != seg.StartPos || e.Size != seg.Size() || !e.StartsWithSAP {
+			t.Errorf("entry %d: got %+v for segment at %d with size %d", i, e, seg.StartPos, seg.Size())
+		}
+	}
+	if si.FindEntry(0) != &si.Entries[0] || si.FindEntry(si.Entries[1].StartTime+1) != &si.Entries[1] ||
+		si.FindEntry(si.Entries[2].End()-1) != &si.Entries[2] || si.FindEntry(si.Entries[2].End()) != nil {
+		t.Error("FindEntry gave wrong entry")
+	}
+
+	// Rewrite the sidx as a hierarchy: a root sidx referencing sidxA, which references the first two
+	// segments and is daisy-chained to sidxB with an ssix box for the last segment.
+	segs := make([][]byte, len(sidx.SidxRefs))
+	pos := sidx.AnchorPoint
+	for i, ref := range sidx.SidxRefs {
+		segs[i] = data[pos : pos+uint64(ref.ReferencedSize)]
+		pos += uint64(ref.ReferencedSize)
+	}
+	refs := sidx.SidxRefs
+	ssix := &mp4.SsixBox{SubSegments: []mp4.SubSegment{{Ranges: []mp4.SubSegmentRange{
+		mp4.NewSubSegmentRange(0, 1000), mp4.NewSubSegmentRange(1, 0)}}}}
+	sidxB := &mp4.SidxBox{ReferenceID: sidx.ReferenceID, Timescale: sidx.Timescale,
+		EarliestPresentationTime: uint64(refs[0].SubSegmentDuration + refs[1].SubSegmentDuration),
+		FirstOffset:              ssix.Size(), SidxRefs: refs[2:]}
+	sizeB := sidxB.Size() + ssix.Size() + uint64(len(segs[2]))
+	sidxA := &mp4.SidxBox{ReferenceID: sidx.ReferenceID, Timescale: sidx.Timescale,
+		SidxRefs: []mp4.SidxRef{refs[0], refs[1], {ReferenceType: 1, ReferencedSize: uint32(sizeB), SubSegmentDuration: refs[2].SubSegmentDuration}}}
+	sizeA := sidxA.Size() + uint64(len(segs[0])+len(segs[1])) + sizeB
+	root := &mp4.SidxBox{ReferenceID: sidx.ReferenceID, Timescale: sidx.Timescale,
+		SidxRefs: []mp4.SidxRef{{ReferenceType: 1, ReferencedSize: uint32(sizeA),
+			SubSegmentDuration: refs[0].SubSegmentDuration + refs[1].SubSegmentDuration + refs[2].SubSegmentDuration}}}
+	var buf bytes.Buffer
+	sidxStart := sidx.AnchorPoint - sidx.FirstOffset - sidx.Size()
+	buf.Write(data[:sidxStart])
+	for _, b := range []mp4.Box{root, sidxA} {
+		if err := b.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.Write(segs[0])
+	buf.Write(segs[1])
+	for _, b := range []mp4.Box{sidxB, ssix} {
+		if err := b.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.Write(segs[2])
+	hier, err := mp4.ReadSegmentIndex(bytes.NewReader(buf.Bytes()), sidx.ReferenceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hier.Entries) != 3 {
+		t.Fatalf("got %d entries instead of 3", len(hier.Entries))
+	}
+	shift := root.Size() + sidxA.Size() - sidx.Size()
+	for i, e := range hier.Entries {
+		want := si.Entries[i]
+		want.Offset += shift
+		if i == 2 {
+			want.Offset += sidxB.Size() + ssix.Size()
+		}
+		if e.StartTime != want.StartTime || e.Duration != want.Duration || e.Offset != want.Offset || e.Size != want.Size {
+			t.Errorf("entry %d: got %+v instead of %+v", i, e, want)
+		}
+		if !bytes.Equal(buf.Bytes()[e.Offset:e.Offset+e.Size], segs[i]) {
+			t.Errorf("entry %d: wrong byte range", i)
+		}
+	}
+	if _, _, ok := hier.Entries[0].LevelRange(0); ok {
+		t.Error("level range without ssix")
+	}
+	last := hier.Entries[2]
+	if offset, size, ok := last.LevelRange(0); !ok || offset != last.Offset || size != 1000 {
+		t.Errorf("level 0 range: got %d %d %t", offset, size, ok)
+	}
+	if offset, size, ok := last.LevelRange(1); !ok || offset != last.Offset || size != last.Size {
+		t.Errorf("level 1 range: got %d %d %t", offset, size, ok)
+	}
+}
+
+func TestSegmentIndexMfraAndMoofs(t *testing.T) {
+	cases := []struct {
+		file       string
+		wantSource string
+	}{
+		{file: "testdata/bbb5s_aac.isma", wantSource: "mfra"},
+		{file: "testdata/v300_multiple_segments.mp4", wantSource: "moof"},
+	}
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			data, err := os.ReadFile(c.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := mp4.DecodeFile(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			si, err := mp4.ReadSegmentIndex(bytes.NewReader(data), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if si.Source != c.wantSource || si.Timescale != f.Moov.Trak.Mdia.Mdhd.Timescale {
+				t.Fatalf("unexpected index %+v", si)
+			}
+			trex := f.Moov.Mvex.Trex
+			var frags []*mp4.Fragment
+			for _, seg := range f.Segments {
+				// The entry of the first fragment in a segment starts with the styp box
+				seg.Fragments[0].StartPos = seg.StartPos
+				frags = append(frags, seg.Fragments...)
+			}
+			if len(si.Entries) != len(frags) {
+				t.Fatalf("got %d entries instead of %d", len(si.Entries), len(frags))
+			}
+			end := uint64(0)
+			for i, frag := range frags {
+				e := si.Entries[i]
+				samples, err := frag.GetFullSamples(trex)
+				if err != nil {
+					t.Fatal(err)
+				}
+				dur := uint64(0)
+				for _, s := range samples {
+					dur += uint64(s.Dur)
+				}
+				// The fragments of the mfra file have no tfdt, and the tfra times are rounded
+				wantStart := samples[0].DecodeTime
+				if f.Mfra != nil {
+					wantStart = f.Mfra.Tfra.Entries[i].Time
+				}
+				if e.Offset != frag.StartPos || e.StartTime != wantStart || e.Duration+1 < dur || e.Duration > dur+1 || !e.StartsWithSAP {
+					t.Errorf("entry %d: got %+v for fragment at %d", i, e, frag.StartPos)
+				}
+				end = frag.Mdat.StartPos + frag.Mdat.Size()
+			}
+			if last := si.Entries[len(si.Entries)-1]; last.Offset+last.Size != end {
+				t.Errorf("last entry ends at %d instead of %d", last.Offset+last.Size, end)
+			}
+		})
+	}
+}
+
+func TestProcessFragmentsFrom(t *testing.T) {
+	data, err := os.ReadFile("testdata/v300_multiple_segments.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	si, err := mp4.ReadSegmentIndex(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers := map[string]func() io.Reader{
+		"seeker": func() io.Reader { return bytes.NewReader(data) },
+		"stream": func() io.Reader { return struct{ io.Reader }{bytes.NewReader(data)} },
+	}
+	for name, newReader := range readers {
+		t.Run(name, func(t *testing.T) {
+			var seqNrs []uint32
+			sf, err := mp4.InitDecodeStream(newReader(),
+				mp4.WithFragmentCallback(func(f *mp4.Fragment, sa mp4.SampleAccessor) error {
+					seqNrs = append(seqNrs, f.Moof.Mfhd.SequenceNumber)
+					_, err := sa.GetSample(f.Moof.Traf.Tfhd.TrackID, 1)
+					return err
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sf.ProcessFragmentsFrom(si, si.Entries[2].StartTime+1); err != nil {
+				t.Fatal(err)
+			}
+			if len(seqNrs) != 2 || seqNrs[0] != 3 || seqNrs[1] != 4 {
+				t.Errorf("got fragments %v instead of [3 4]", seqNrs)
+			}
+		})
+	}
+}
+
+func TestSegmentIndexSeveralSidxs(t *testing.T) {
+	cases := []struct {
+		file          string
+		trackID       uint32
+		wantTimescale uint32
+		wantEntries   int
+	}{
+		{file: "testdata/multi_sidx_segment.m4s", trackID: 2, wantTimescale: 44100, wantEntries: 1},
+		{file: "testdata/interleaved_sidxs_segment.m4s", trackID: 0, wantTimescale: 30000, wantEntries: 3},
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		si, err := mp4.ReadSegmentIndex(bytes.NewReader(data), c.trackID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if si.Timescale != c.wantTimescale || len(si.Entries) != c.wantEntries {
+			t.Errorf("%s: got timescale %d and %d entries", c.file, si.Timescale, len(si.Entries))
+		}
+		for i := 1; i < len(si.Entries); i++ {
+			if si.Entries[i].StartTime != si.Entries[i-1].End() {
+				t.Errorf("%s: entry %d does not follow entry %d", c.file, i, i-1)
+			}
+		}
+	}
+}
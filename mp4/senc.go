@@ -201,8 +201,15 @@ func (s *SencBox) ParseReadBox(perSampleIVSize byte, saiz *SaizBox) error {
 			perSampleIVSize = byte(nrBytesLeft / s.SampleCount)
 			s.perSampleIVSize = perSampleIVSize
 		}
+		if uint64(s.SampleCount)*uint64(perSampleIVSize) > uint64(nrBytesLeft) {
+			return fmt.Errorf("senc: %d bytes too few for %d IVs of size %d", nrBytesLeft, s.SampleCount, perSampleIVSize)
+		}
 
-		s.IVs = make([]InitializationVector, 0, s.SampleCount)
+		nrIVs := s.SampleCount
+		if perSampleIVSize == 0 {
+			nrIVs = 0
+		}
+		s.IVs = make([]InitializationVector, 0, nrIVs)
 		switch perSampleIVSize {
 		case 0:
 			// Nothing to do
@@ -508,6 +508,22 @@ func (sf *StreamFile) ProcessFragments() error {
 	return nil
 }
 
+// ProcessFragmentsFrom processes fragments like ProcessFragments, but starts with the
+// subsegment of idx that holds time (in idx.Timescale), e.g. from ReadSegmentIndex on the same file.
+// If the reader is not an io.Seeker, the data up to the subsegment is read and discarded,
+// so it must not be before the current stream position.
+func (sf *StreamFile) ProcessFragmentsFrom(idx *SegmentIndex, time uint64) error {
+	entry := idx.FindEntry(time)
+	if entry == nil {
+		return fmt.Errorf("time %d is after the end of the segment index", time)
+	}
+	if err := sf.boxSeekReader.SkipTo(entry.Offset); err != nil {
+		return fmt.Errorf("skip to subsegment at %d: %w", entry.Offset, err)
+	}
+	sf.streamPos = entry.Offset
+	return sf.ProcessFragments()
+}
+
 // processFragment handles a complete fragment (moof + mdat).
 // moofStartPos is the start position of the moof box.
 // preFragmentBoxes are boxes that appeared before the moof (sidx, emsg, styp, etc.)
@@ -65,7 +65,15 @@ type StsdBox struct {
 	// Stpp is a pointer to a StppBox
 	Stpp *StppBox
 	// Evte is a pointer to an EvteBox
-	Evte     *EvteBox
+	Evte *EvteBox
+	// ID3 is a pointer to an ID3SampleEntryBox (id3 )
+	ID3 *ID3SampleEntryBox
+	// Metx is a pointer to a MetxBox
+	Metx *MetxBox
+	// Mett is a pointer to a MettBox
+	Mett *MettBox
+	// Urim is a pointer to a UrimBox
+	Urim     *UrimBox
 	Children []Box
 }
 
@@ -129,6 +137,14 @@ func (s *StsdBox) AddChild(box Box) {
 		s.Stpp = box.(*StppBox)
 	case "evte":
 		s.Evte = box.(*EvteBox)
+	case "id3 ":
+		s.ID3 = box.(*ID3SampleEntryBox)
+	case "metx":
+		s.Metx = box.(*MetxBox)
+	case "mett":
+		s.Mett = box.(*MettBox)
+	case "urim":
+		s.Urim = box.(*UrimBox)
 	}
 	s.Children = append(s.Children, box)
 	s.SampleCount++
@@ -284,6 +300,14 @@ func (s *StsdBox) GetBtrt() *BtrtBox {
 			return child.Btrt
 		case *EvteBox:
 			return child.Btrt
+		case *ID3SampleEntryBox:
+			return child.Btrt
+		case *MetxBox:
+			return child.Btrt
+		case *MettBox:
+			return child.Btrt
+		case *UrimBox:
+			return child.Btrt
 		}
 	}
 	return nil
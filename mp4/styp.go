@@ -2,6 +2,7 @@ package mp4
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 
 	"github.com/Eyevinn/mp4ff/bits"
@@ -21,11 +22,17 @@ func (b *StypBox) Copy() *StypBox {
 
 // MajorBrand - major brand (4 chars)
 func (b *StypBox) MajorBrand() string {
+	if len(b.data) < 4 {
+		return ""
+	}
 	return string(b.data[:4])
 }
 
 // MinorVersion - minor version
 func (b *StypBox) MinorVersion() uint32 {
+	if len(b.data) < 8 {
+		return 0
+	}
 	return binary.BigEndian.Uint32(b.data[4:8])
 }
 
@@ -38,6 +45,9 @@ func (b *StypBox) AddCompatibleBrands(compatibleBrands []string) {
 
 // CompatibleBrands - slice of compatible brands (4 chars each)
 func (b *StypBox) CompatibleBrands() []string {
+	if len(b.data) < 8 {
+		return nil
+	}
 	nrCompatibleBrands := (len(b.data) - 8) / 4
 	if nrCompatibleBrands == 0 {
 		return nil
@@ -73,12 +83,15 @@ func DecodeStyp(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
 	if err != nil {
 		return nil, err
 	}
-	b := StypBox{data: data}
-	return &b, nil
+	sr := bits.NewFixedSliceReader(data)
+	return DecodeStypSR(hdr, startPos, sr)
 }
 
 // DecodeStypSR - box-specific decode
 func DecodeStypSR(hdr BoxHeader, startPos uint64, sr bits.SliceReader) (Box, error) {
+	if hdr.payloadLen() < 8 {
+		return nil, fmt.Errorf("styp: payload size %d less than 8", hdr.payloadLen())
+	}
 	b := StypBox{data: sr.ReadBytes(int(hdr.Size) - hdr.Hdrlen)}
 	return &b, sr.AccError()
 }
@@ -0,0 +1,270 @@
+package mp4
+
+// TimelineEdit - an edit list entry with all times in the media (mdhd) timescale
+type TimelineEdit struct {
+	// PresentationStart - start of the edit on the presentation timeline
+	PresentationStart int64
+	// Duration - duration on the presentation timeline. 0 for the last edit means until the end of the media
+	Duration uint64
+	// MediaTime - first media time of the edit, or -1 for an empty edit
+	MediaTime int64
+	// MediaRate - 16.16 fixed-point rate (65536 is normal rate). 0 is a dwell on MediaTime
+	MediaRate int32
+}
+
+// IsEmpty - true for an empty edit, which presents nothing
+func (e TimelineEdit) IsEmpty() bool {
+	return e.MediaTime == -1
+}
+
+// mediaEnd returns the media time after the edit, or -1 if the edit is unbounded
+func (e TimelineEdit) mediaEnd() int64 {
+	if e.Duration == 0 {
+		return -1
+	}
+	return e.MediaTime + int64(e.Duration)*int64(e.MediaRate)/0x10000
+}
+
+// Timeline - presentation timeline of a track given by its edit list.
+// Presentation times are in the media timescale and start at 0 at the start of the movie.
+type Timeline struct {
+	Timescale      uint32 // media timescale
+	MovieTimescale uint32 // timescale of elst segment durations
+	// Edits - edits in presentation order. Without edits, media time is presentation time
+	Edits []TimelineEdit
+}
+
+// Timeline - presentation timeline of the track given by all elst entries.
+// movieTimescale is the mvhd timescale.
+func (t *TrakBox) Timeline(movieTimescale uint32) *Timeline {
+	tl := &Timeline{Timescale: t.Mdia.Mdhd.Timescale, MovieTimescale: movieTimescale}
+	if t.Edts == nil || movieTimescale == 0 {
+		return tl
+	}
+	var start int64
+	for _, elst := range t.Edts.Elst {
+		for _, e := range elst.Entries {
+			dur := RescaleTime(e.SegmentDuration, movieTimescale, tl.Timescale)
+			tl.Edits = append(tl.Edits, TimelineEdit{
+				PresentationStart: start,
+				Duration:          dur,
+				MediaTime:         e.MediaTime,
+				MediaRate:         e.MediaRateFixed32(),
+			})
+			start += int64(dur)
+		}
+	}
+	return tl
+}
+
+// Offset - presentation time minus media time for the first media edit at normal rate,
+// including any initial empty edits. Dwells and edits at other rates are skipped, unless
+// there is no media edit at normal rate, in which case the first media edit is used.
+// It is 0 without edits.
+func (tl *Timeline) Offset() int64 {
+	firstMedia := -1
+	for i, e := range tl.Edits {
+		if e.IsEmpty() {
+			continue
+		}
+		if e.MediaRate == 0x10000 {
+			return e.PresentationStart - e.MediaTime
+		}
+		if firstMedia < 0 {
+			firstMedia = i
+		}
+	}
+	if firstMedia >= 0 {
+		return tl.Edits[firstMedia].PresentationStart - tl.Edits[firstMedia].MediaTime
+	}
+	if len(tl.Edits) > 0 {
+		last := tl.Edits[len(tl.Edits)-1]
+		return last.PresentationStart + int64(last.Duration)
+	}
+	return 0
+}
+
+// PresentationTime - map a media time to the presentation timeline. The first edit that
+// presents the media time is used. ok is false if the media time is not presented.
+// For a dwell, the start of the edit is returned for its media time.
+func (tl *Timeline) PresentationTime(mediaTime int64) (presentationTime int64, ok bool) {
+	if len(tl.Edits) == 0 {
+		return mediaTime, true
+	}
+	for _, e := range tl.Edits {
+		switch {
+		case e.IsEmpty():
+			continue
+		case e.MediaRate == 0:
+			if mediaTime == e.MediaTime {
+				return e.PresentationStart, true
+			}
+		case mediaTime >= e.MediaTime:
+			end := e.mediaEnd()
+			if end >= 0 && mediaTime >= end {
+				continue
+			}
+			return e.PresentationStart + (mediaTime-e.MediaTime)*0x10000/int64(e.MediaRate), true
+		}
+	}
+	return 0, false
+}
+
+// MediaTime - map a presentation time to the media time shown at that time.
+// ok is false during empty edits and outside the edits.
+func (tl *Timeline) MediaTime(presentationTime int64) (mediaTime int64, ok bool) {
+	if len(tl.Edits) == 0 {
+		return presentationTime, true
+	}
+	for i, e := range tl.Edits {
+		if presentationTime < e.PresentationStart {
+			break
+		}
+		last := i == len(tl.Edits)-1
+		if e.Duration == 0 && !last {
+			continue
+		}
+		if e.Duration > 0 && presentationTime >= e.PresentationStart+int64(e.Duration) {
+			continue
+		}
+		if e.IsEmpty() {
+			return 0, false
+		}
+		return e.MediaTime + (presentationTime-e.PresentationStart)*int64(e.MediaRate)/0x10000, true
+	}
+	return 0, false
+}
+
+// Duration - total duration of the presentation timeline, or 0 if it is unbounded or there are no edits
+func (tl *Timeline) Duration() uint64 {
+	var dur uint64
+	for _, e := range tl.Edits {
+		if e.Duration == 0 {
+			return 0
+		}
+		dur += e.Duration
+	}
+	return dur
+}
+
+// Clip - return the edits presenting [start, end) of the timeline, with presentation starting at 0.
+// Without edits, the result is a single normal-rate edit of the media range [start, end).
+func (tl *Timeline) Clip(start, end int64) []TimelineEdit {
+	if end <= start {
+		return nil
+	}
+	if len(tl.Edits) == 0 {
+		return []TimelineEdit{{Duration: uint64(end - start), MediaTime: start, MediaRate: 0x10000}}
+	}
+	var out []TimelineEdit
+	for i, e := range tl.Edits {
+		eStart := e.PresentationStart
+		eEnd := end
+		if e.Duration > 0 || i < len(tl.Edits)-1 {
+			eEnd = eStart + int64(e.Duration)
+		}
+		if eEnd <= start || eStart >= end {
+			continue
+		}
+		c := e
+		if eStart < start {
+			if !c.IsEmpty() {
+				c.MediaTime += (start - eStart) * int64(e.MediaRate) / 0x10000
+			}
+			eStart = start
+		}
+		if eEnd > end {
+			eEnd = end
+		}
+		c.PresentationStart = eStart - start
+		c.Duration = uint64(eEnd - eStart)
+		out = append(out, c)
+	}
+	return out
+}
+
+// SetEdits - replace the edit list of the track by edits with times in the media timescale.
+// movieTimescale is the mvhd timescale used for segment durations. PresentationStart is not used,
+// since edits follow each other. An empty slice removes the edit list.
+func (t *TrakBox) SetEdits(movieTimescale uint32, edits []TimelineEdit) {
+	if len(edits) == 0 {
+		t.removeEdts()
+		return
+	}
+	elst := &ElstBox{}
+	version := byte(0)
+	for _, e := range edits {
+		entry := ElstEntry{
+			SegmentDuration: RescaleTime(e.Duration, t.Mdia.Mdhd.Timescale, movieTimescale),
+			MediaTime:       e.MediaTime,
+		}
+		entry.SetMediaRateFixed32(e.MediaRate)
+		if entry.SegmentDuration > 0xffffffff || entry.MediaTime > 0x7fffffff || entry.MediaTime < -1 {
+			version = 1
+		}
+		elst.Entries = append(elst.Entries, entry)
+	}
+	elst.Version = version
+	if t.Edts == nil {
+		edts := &EdtsBox{}
+		t.Edts = edts
+		t.Children = insertAfterTkhd(t.Children, edts)
+	}
+	t.Edts.Elst = []*ElstBox{elst}
+	t.Edts.Children = []Box{elst}
+}
+
+func (t *TrakBox) removeEdts() {
+	if t.Edts == nil {
+		return
+	}
+	for i, c := range t.Children {
+		if c == t.Edts {
+			t.Children = append(t.Children[:i], t.Children[i+1:]...)
+			break
+		}
+	}
+	t.Edts = nil
+}
+
+// insertAfterTkhd inserts box after tkhd, where edts belongs, or first.
+func insertAfterTkhd(children []Box, box Box) []Box {
+	pos := 0
+	for i, c := range children {
+		if c.Type() == "tkhd" {
+			pos = i + 1
+			break
+		}
+	}
+	children = append(children, nil)
+	copy(children[pos+1:], children[pos:])
+	children[pos] = box
+	return children
+}
+
+// opusPreSkipRate - PreSkip in dOps is given at 48kHz
+const opusPreSkipRate = 48000
+
+// Priming - encoder delay at the start of an audio track in the media timescale.
+// For Opus, it is PreSkip of dOps. Otherwise, it is the media time of the first media edit,
+// which is how AAC priming (typically 1024 or 2112 samples) is signaled.
+func (t *TrakBox) Priming() uint64 {
+	if stsd := t.Mdia.Minf.Stbl.Stsd; stsd != nil {
+		for _, c := range stsd.Children {
+			if ase, ok := c.(*AudioSampleEntryBox); ok && ase.Dops != nil {
+				return RescaleTime(uint64(ase.Dops.PreSkip), opusPreSkipRate, t.Mdia.Mdhd.Timescale)
+			}
+		}
+	}
+	if t.Edts == nil {
+		return 0
+	}
+	for _, elst := range t.Edts.Elst {
+		for _, e := range elst.Entries {
+			if e.MediaTime >= 0 {
+				return uint64(e.MediaTime)
+			}
+		}
+	}
+	return 0
+}
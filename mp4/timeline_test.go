@@ -0,0 +1,146 @@
+package mp4_test
+
+import (
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/go-test/deep"
+)
+
+func TestTimeline(t *testing.T) {
+	init := mp4.CreateEmptyInit()
+	init.Moov.Mvhd.Timescale = 1000
+	trak := init.AddEmptyTrack(48000, "audio", "und")
+	tl := trak.Timeline(1000)
+	if pt, ok := tl.PresentationTime(4800); !ok || pt != 4800 {
+		t.Errorf("identity mapping got %d %t", pt, ok)
+	}
+
+	// 100ms empty edit, 1s from media time 2112, 0.5s dwell on 48000, 1s at double rate from 96000
+	trak.SetEdits(1000, []mp4.TimelineEdit{
+		{Duration: 4800, MediaTime: -1, MediaRate: 0x10000},
+		{Duration: 48000, MediaTime: 2112, MediaRate: 0x10000},
+		{Duration: 24000, MediaTime: 48000, MediaRate: 0},
+		{Duration: 48000, MediaTime: 96000, MediaRate: 0x20000},
+	})
+	if len(trak.Edts.Elst[0].Entries) != 4 || trak.Edts.Elst[0].Entries[1].SegmentDuration != 1000 {
+		t.Fatalf("bad elst %+v", trak.Edts.Elst[0].Entries)
+	}
+	if trak.Children[1] != trak.Edts {
+		t.Errorf("edts not after tkhd")
+	}
+	boxDiffAfterEncodeAndDecode(t, trak.Edts)
+	if p := trak.Priming(); p != 2112 {
+		t.Errorf("priming %d instead of 2112", p)
+	}
+
+	tl = trak.Timeline(1000)
+	if tl.Offset() != 4800-2112 {
+		t.Errorf("offset %d", tl.Offset())
+	}
+	if tl.Duration() != 124800 {
+		t.Errorf("duration %d", tl.Duration())
+	}
+	presCases := []struct {
+		media, pres int64
+		ok          bool
+	}{
+		{0, 0, false},
+		{2112, 4800, true},
+		{48000, 4800 + 48000 - 2112, true},
+		{50112, 0, false},
+		{96000, 76800, true},
+		{96002, 76801, true},
+		{192000, 0, false},
+	}
+	for _, c := range presCases {
+		pt, ok := tl.PresentationTime(c.media)
+		if ok != c.ok || (ok && pt != c.pres) {
+			t.Errorf("media %d: got %d %t instead of %d %t", c.media, pt, ok, c.pres, c.ok)
+		}
+	}
+	mediaCases := []struct {
+		pres, media int64
+		ok          bool
+	}{
+		{0, 0, false},
+		{4800, 2112, true},
+		{60000, 48000, true},
+		{76800, 96000, true},
+		{76801, 96002, true},
+		{124800, 0, false},
+	}
+	for _, c := range mediaCases {
+		mt, ok := tl.MediaTime(c.pres)
+		if ok != c.ok || (ok && mt != c.media) {
+			t.Errorf("pres %d: got %d %t instead of %d %t", c.pres, mt, ok, c.media, c.ok)
+		}
+	}
+
+	clipped := tl.Clip(2400, 28800)
+	wantClip := []mp4.TimelineEdit{
+		{PresentationStart: 0, Duration: 2400, MediaTime: -1, MediaRate: 0x10000},
+		{PresentationStart: 2400, Duration: 24000, MediaTime: 2112, MediaRate: 0x10000},
+	}
+	if diff := deep.Equal(clipped, wantClip); diff != nil {
+		t.Errorf("clip: %v", diff)
+	}
+	clipped = tl.Clip(24000, 96000)
+	if len(clipped) != 3 || clipped[0].MediaTime != 2112+24000-4800 || clipped[2].Duration != 96000-76800 {
+		t.Errorf("clip got %+v", clipped)
+	}
+
+	trak.SetEdits(1000, nil)
+	if trak.Edts != nil || len(trak.Children) != 2 {
+		t.Errorf("edts not removed")
+	}
+}
+
+func TestTimelineOffsetSkipsDwell(t *testing.T) {
+	init := mp4.CreateEmptyInit()
+	trak := init.AddEmptyTrack(48000, "video", "und")
+	cases := []struct {
+		desc  string
+		edits []mp4.TimelineEdit
+		want  int64
+	}{
+		{desc: "leading dwell", edits: []mp4.TimelineEdit{
+			{Duration: 4800, MediaTime: 0, MediaRate: 0},
+			{Duration: 48000, MediaTime: 1024, MediaRate: 0x10000},
+		}, want: 4800 - 1024},
+		{desc: "empty edit, dwell and double rate", edits: []mp4.TimelineEdit{
+			{Duration: 2400, MediaTime: -1, MediaRate: 0x10000},
+			{Duration: 4800, MediaTime: 0, MediaRate: 0},
+			{Duration: 4800, MediaTime: 0, MediaRate: 0x20000},
+			{Duration: 48000, MediaTime: 9600, MediaRate: 0x10000},
+		}, want: 2400 + 4800 + 4800 - 9600},
+		{desc: "only dwell", edits: []mp4.TimelineEdit{
+			{Duration: 2400, MediaTime: -1, MediaRate: 0x10000},
+			{Duration: 4800, MediaTime: 1000, MediaRate: 0},
+		}, want: 2400 - 1000},
+	}
+	for _, c := range cases {
+		trak.SetEdits(48000, c.edits)
+		if got := trak.Timeline(48000).Offset(); got != c.want {
+			t.Errorf("%s: offset %d instead of %d", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestOpusPriming(t *testing.T) {
+	f, err := mp4.ReadMP4File("testdata/opus.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trak *mp4.TrakBox
+	if f.Moov != nil {
+		trak = f.Moov.Trak
+	} else {
+		trak = f.Init.Moov.Trak
+	}
+	dops := trak.Mdia.Minf.Stbl.Stsd.Children[0].(*mp4.AudioSampleEntryBox).Dops
+	want := uint64(dops.PreSkip) * uint64(trak.Mdia.Mdhd.Timescale) / 48000
+	if p := trak.Priming(); p != want || p == 0 {
+		t.Errorf("priming %d instead of %d", p, want)
+	}
+}
@@ -0,0 +1,10 @@
+package mp4
+
+// RescaleTime converts t from timescale from to timescale to without overflow.
+// t is returned as is if from is 0.
+func RescaleTime(t uint64, from, to uint32) uint64 {
+	if from == to || from == 0 {
+		return t
+	}
+	return t/uint64(from)*uint64(to) + t%uint64(from)*uint64(to)/uint64(from)
+}
@@ -0,0 +1,28 @@
+package mp4_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestRescaleTime(t *testing.T) {
+	cases := []struct {
+		t        uint64
+		from, to uint32
+		want     uint64
+	}{
+		{t: 90000, from: 90000, to: 1000, want: 1000},
+		{t: 1001, from: 30000, to: 90000, want: 3003},
+		{t: 12345, from: 0, to: 1000, want: 12345},
+		{t: 12345, from: 1000, to: 1000, want: 12345},
+		{t: math.MaxUint64 / 2, from: 1 << 30, to: 1 << 30, want: math.MaxUint64 / 2},
+		{t: 1 << 60, from: 1 << 20, to: 1 << 10, want: 1 << 50},
+	}
+	for _, c := range cases {
+		if got := mp4.RescaleTime(c.t, c.from, c.to); got != c.want {
+			t.Errorf("RescaleTime(%d, %d, %d) = %d, want %d", c.t, c.from, c.to, got, c.want)
+		}
+	}
+}
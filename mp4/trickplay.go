@@ -0,0 +1,362 @@
+package mp4
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/av1"
+	"github.com/Eyevinn/mp4ff/avc"
+	"github.com/Eyevinn/mp4ff/hevc"
+)
+
+// SyncDetection - how the sync samples of a video track are found
+type SyncDetection int
+
+const (
+	// SyncFromFlags - sync samples are marked in stss or in the sample flags of trun
+	SyncFromFlags SyncDetection = iota
+	// SyncFromData - sync samples are found from the sample data with avc.IsIDRSample,
+	// hevc.IsRAPSample or av1.IsRAPSample. Useful if the flags are missing or wrong.
+	SyncFromData
+)
+
+// IFrameRange - byte range and timing of a sync sample for an HLS I-frame playlist
+// (EXT-X-I-FRAME-STREAM-INF with EXT-X-BYTERANGE) or another trick-play index
+type IFrameRange struct {
+	TrackID  uint32
+	SampleNr uint32
+	DTS      uint64
+	PTS      int64
+	// Dur - time to the next sync sample, or to the end of the track for the last one
+	Dur uint64
+	// Offset - start of the moof box for fragmented files, and of the sample data for progressive files
+	Offset uint64
+	// Size - size up to and including the sample data
+	Size uint64
+}
+
+// syncSample - a sync sample and the start of the fragment it is in
+type syncSample struct {
+	info SampleInfo
+	// fragStart - start of the moof box, 0 for progressive files
+	fragStart uint64
+	// segIdx - index of the media segment, 0 for progressive files
+	segIdx int
+}
+
+// SyncSampleInfos - info about the sync samples of a video track, found as given by detection.
+// SyncFromData needs the sample data to be loaded.
+func (f *File) SyncSampleInfos(trackID uint32, detection SyncDetection) ([]SampleInfo, error) {
+	syncs, _, err := f.findSyncSamples(trackID, detection)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SampleInfo, 0, len(syncs))
+	for _, s := range syncs {
+		infos = append(infos, s.info)
+	}
+	return infos, nil
+}
+
+// IFrameRanges - byte ranges and durations of the sync samples of a video track.
+// For fragmented files, each range goes from the moof box to the end of the sync sample data,
+// as needed for an HLS I-frame playlist. For progressive files, the ranges are the sample data.
+func (f *File) IFrameRanges(trackID uint32, detection SyncDetection) ([]IFrameRange, error) {
+	syncs, trackEnd, err := f.findSyncSamples(trackID, detection)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]IFrameRange, 0, len(syncs))
+	for i, s := range syncs {
+		end := trackEnd
+		if i+1 < len(syncs) {
+			end = syncs[i+1].info.DTS
+		}
+		offset := s.info.Offset
+		if f.IsFragmented() {
+			offset = s.fragStart
+		}
+		ranges = append(ranges, IFrameRange{
+			TrackID:  trackID,
+			SampleNr: s.info.SampleNr,
+			DTS:      s.info.DTS,
+			PTS:      s.info.PTS,
+			Dur:      end - s.info.DTS,
+			Offset:   offset,
+			Size:     s.info.Offset + uint64(s.info.Size) - offset,
+		})
+	}
+	return ranges, nil
+}
+
+// CreateTrickModeFile - a fragmented file with only the sync samples of a video track, for a
+// DASH trick-mode adaptation set. Each sample lasts until the next sync sample, so the timeline
+// is the same as for the full track, and is marked as not depending on other samples.
+// Fragmented input gives one segment per input segment with sync samples, and progressive input
+// one segment per sync sample. The track ID is changed to 1 as for Demux.
+// Sample data must be loaded, and the track must not be encrypted.
+func CreateTrickModeFile(f *File, trackID uint32, detection SyncDetection) (*File, error) {
+	inMoov, ftyp := f.Moov, f.Ftyp
+	if f.IsFragmented() && f.Init != nil {
+		inMoov, ftyp = f.Init.Moov, f.Init.Ftyp
+	}
+	if inMoov == nil {
+		return nil, fmt.Errorf("no moov box")
+	}
+	if ftyp == nil {
+		ftyp = CreateFtyp()
+	}
+	if hasLazyMdat(f) {
+		return nil, fmt.Errorf("sample data not loaded")
+	}
+	trakIdx := -1
+	for i, trak := range inMoov.Traks {
+		if trak.Tkhd.TrackID == trackID {
+			trakIdx = i
+		}
+	}
+	if trakIdx < 0 {
+		return nil, fmt.Errorf("no track with ID %d", trackID)
+	}
+	if inMoov.IsEncrypted(trackID) {
+		return nil, fmt.Errorf("track %d is encrypted", trackID)
+	}
+	syncs, trackEnd, err := f.findSyncSamples(trackID, detection)
+	if err != nil {
+		return nil, err
+	}
+	init, err := demuxInit(ftyp, inMoov, trakIdx)
+	if err != nil {
+		return nil, err
+	}
+	out := NewFile()
+	out.isFragmented = true
+	out.Init = init
+	out.Children = append(out.Children, init.Ftyp, init.Moov)
+	mdats := topMdats(f)
+	flags := SampleFlags{SampleDependsOn: 2}.Encode()
+	var frag *Fragment
+	for i, s := range syncs {
+		if i == 0 || !f.IsFragmented() || s.segIdx != syncs[i-1].segIdx {
+			seg := NewMediaSegment()
+			if f.IsFragmented() && f.Segments[s.segIdx].Styp != nil {
+				seg = NewMediaSegmentWithStyp(f.Segments[s.segIdx].Styp)
+			}
+			out.AddMediaSegment(seg)
+			frag, err = CreateFragment(uint32(len(out.Segments)), 1)
+			if err != nil {
+				return nil, err
+			}
+			seg.AddFragment(frag)
+		}
+		end := trackEnd
+		if i+1 < len(syncs) {
+			end = syncs[i+1].info.DTS
+		}
+		data, err := sampleDataAt(mdats, s.info.Offset, s.info.Size)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", s.info.SampleNr, err)
+		}
+		frag.AddFullSample(FullSample{
+			Sample: Sample{
+				Flags:                 flags,
+				Dur:                   uint32(end - s.info.DTS),
+				Size:                  s.info.Size,
+				CompositionTimeOffset: int32(s.info.PTS - int64(s.info.DTS)),
+			},
+			DecodeTime: s.info.DTS,
+			Data:       data,
+		})
+	}
+	return out, nil
+}
+
+// AddIFrameSsix - add an ssix box with I-frame levels after the sidx box of a fragmented file
+// with one media segment per sidx reference. A sidx box is added if there is none.
+// Level 0 of a segment is the prefix up to the end of its first sample of trackID, if that is a
+// sync sample, and level 1 is the rest. A level 0 byte range thus gives the I-frame for trick play.
+// No leva box is added, since the levels are byte ranges and not sample groups or tracks.
+// The file must have been decoded, so that box positions are known.
+func (f *File) AddIFrameSsix(trackID uint32, detection SyncDetection) error {
+	if !f.IsFragmented() {
+		return fmt.Errorf("file is not fragmented")
+	}
+	if f.Sidx == nil {
+		if err := f.UpdateSidx(true, false); err != nil {
+			return err
+		}
+	}
+	if len(f.Sidxs) != 1 || len(f.Sidx.SidxRefs) != len(f.Segments) {
+		return fmt.Errorf("need one sidx box with one reference per segment")
+	}
+	syncs, _, err := f.findSyncSamples(trackID, detection)
+	if err != nil {
+		return err
+	}
+	firstSync := make(map[int]SampleInfo)
+	for _, s := range syncs {
+		if _, ok := firstSync[s.segIdx]; !ok {
+			firstSync[s.segIdx] = s.info
+		}
+	}
+	ssix := &SsixBox{}
+	for i, seg := range f.Segments {
+		refSize := uint64(f.Sidx.SidxRefs[i].ReferencedSize)
+		var level0 uint64
+		if info, ok := firstSync[i]; ok && f.isFirstSampleOfSegment(seg, info) {
+			if info.Offset < seg.StartPos || info.Offset+uint64(info.Size) > seg.StartPos+refSize {
+				return fmt.Errorf("segment %d: sample positions not known", i+1)
+			}
+			level0 = info.Offset + uint64(info.Size) - seg.StartPos
+		}
+		var subSeg SubSegment
+		if level0 > 0 {
+			subSeg.Ranges = append(subSeg.Ranges, NewSubSegmentRange(0, uint32(level0)))
+		}
+		if level0 < refSize {
+			subSeg.Ranges = append(subSeg.Ranges, NewSubSegmentRange(1, uint32(refSize-level0)))
+		}
+		ssix.SubSegments = append(ssix.SubSegments, subSeg)
+	}
+	if f.Ssix != nil {
+		for i, c := range f.Children {
+			if c == f.Ssix {
+				f.Children = append(f.Children[:i], f.Children[i+1:]...)
+				break
+			}
+		}
+	}
+	f.Ssix = ssix
+	f.ssixSidxIdx = 0
+	f.Sidx.FirstOffset = ssix.Size()
+	for i, c := range f.Children {
+		if c == f.Sidx {
+			f.Children = append(f.Children[:i+1], append([]Box{ssix}, f.Children[i+1:]...)...)
+			break
+		}
+	}
+	return nil
+}
+
+// isFirstSampleOfSegment - is info the first sample of the track in seg
+func (f *File) isFirstSampleOfSegment(seg *MediaSegment, info SampleInfo) bool {
+	for _, frag := range seg.Fragments {
+		if frag.Moof == nil {
+			continue
+		}
+		for _, traf := range frag.Moof.Trafs {
+			if traf.Tfhd.TrackID == info.TrackID {
+				return frag.Moof.Mfhd.SequenceNumber == info.FragmentNr && traf.Tfdt != nil &&
+					traf.Tfdt.BaseMediaDecodeTime() == info.DTS
+			}
+		}
+	}
+	return false
+}
+
+// findSyncSamples returns the sync samples of trackID, and the end time of the track
+func (f *File) findSyncSamples(trackID uint32, detection SyncDetection) ([]syncSample, uint64, error) {
+	if f.Moov == nil {
+		return nil, 0, fmt.Errorf("no moov box")
+	}
+	var trak *TrakBox
+	for _, t := range f.Moov.Traks {
+		if t.Tkhd.TrackID == trackID {
+			trak = t
+		}
+	}
+	if trak == nil {
+		return nil, 0, fmt.Errorf("no track with ID %d", trackID)
+	}
+	var isSync func(data []byte) (bool, error)
+	var mdats []*MdatBox
+	if detection == SyncFromData {
+		if hasLazyMdat(f) {
+			return nil, 0, fmt.Errorf("sample data not loaded")
+		}
+		var err error
+		isSync, err = syncSampleCheck(trak)
+		if err != nil {
+			return nil, 0, err
+		}
+		mdats = topMdats(f)
+	}
+	var syncs []syncSample
+	var trackEnd uint64
+	add := func(infos []SampleInfo, fragStart uint64, segIdx int) error {
+		for _, info := range infos {
+			trackEnd = info.DTS + uint64(info.Dur)
+			if isSync != nil {
+				data, err := sampleDataAt(mdats, info.Offset, info.Size)
+				if err != nil {
+					return fmt.Errorf("sample %d: %w", info.SampleNr, err)
+				}
+				if info.Sync, err = isSync(data); err != nil {
+					return fmt.Errorf("sample %d: %w", info.SampleNr, err)
+				}
+			}
+			if info.Sync {
+				syncs = append(syncs, syncSample{info: info, fragStart: fragStart, segIdx: segIdx})
+			}
+		}
+		return nil
+	}
+	if !f.IsFragmented() {
+		infos, err := f.SampleInfos(trackID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := add(infos, 0, 0); err != nil {
+			return nil, 0, err
+		}
+		return syncs, trackEnd, nil
+	}
+	trex := f.trex(trackID)
+	sampleNr := uint32(0)
+	for segIdx, seg := range f.Segments {
+		for _, frag := range seg.Fragments {
+			if frag.Moof == nil {
+				continue
+			}
+			infos, err := appendFragmentSampleInfos(nil, frag, trackID, trex)
+			if err != nil {
+				return nil, 0, err
+			}
+			for i := range infos {
+				sampleNr++
+				infos[i].SampleNr = sampleNr
+			}
+			if err := add(infos, frag.Moof.StartPos, segIdx); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return syncs, trackEnd, nil
+}
+
+// syncSampleCheck returns a function that checks if the sample data is a sync sample
+func syncSampleCheck(trak *TrakBox) (func(data []byte) (bool, error), error) {
+	stsd := trak.Mdia.Minf.Stbl.Stsd
+	switch {
+	case stsd.AvcX != nil:
+		return func(data []byte) (bool, error) { return avc.IsIDRSample(data), nil }, nil
+	case stsd.HvcX != nil:
+		return func(data []byte) (bool, error) { return hevc.IsRAPSample(data), nil }, nil
+	case stsd.Av01 != nil:
+		var sh *av1.SequenceHeader
+		if av1C := stsd.Av01.Av1C; av1C != nil && len(av1C.ConfigOBUs) > 0 {
+			obus, err := av1.SplitOBUs(av1C.ConfigOBUs)
+			if err != nil {
+				return nil, fmt.Errorf("av1C config OBUs: %w", err)
+			}
+			for _, o := range obus {
+				if o.Header.Type == av1.OBUSequenceHeader {
+					if sh, err = av1.ParseSequenceHeader(o.Payload); err != nil {
+						return nil, fmt.Errorf("av1C sequence header: %w", err)
+					}
+				}
+			}
+		}
+		return func(data []byte) (bool, error) { return av1.IsRAPSample(data, sh) }, nil
+	}
+	return nil, fmt.Errorf("no sync sample check for track %d", trak.Tkhd.TrackID)
+}
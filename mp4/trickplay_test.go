@@ -0,0 +1,231 @@
+package mp4_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+func TestSyncSampleInfosAndIFrameRanges(t *testing.T) {
+	cases := []struct {
+		file    string
+		trackID uint32
+	}{
+		{file: "testdata/prog_8s.mp4", trackID: 2},
+		{file: "testdata/v300_multiple_segments.mp4", trackID: 2},
+	}
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			f := decodeTestFile(t, c.file)
+			fromFlags, err := f.SyncSampleInfos(c.trackID, mp4.SyncFromFlags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fromData, err := f.SyncSampleInfos(c.trackID, mp4.SyncFromData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fromFlags) == 0 || len(fromFlags) != len(fromData) {
+				t.Fatalf("got %d sync samples from flags and %d from data", len(fromFlags), len(fromData))
+			}
+			for i := range fromFlags {
+				if fromFlags[i].SampleNr != fromData[i].SampleNr || fromFlags[i].DTS != fromData[i].DTS {
+					t.Errorf("sync sample %d: flags %+v data %+v", i, fromFlags[i], fromData[i])
+				}
+			}
+			ranges, err := f.IFrameRanges(c.trackID, mp4.SyncFromFlags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ranges) != len(fromFlags) {
+				t.Fatalf("got %d ranges for %d sync samples", len(ranges), len(fromFlags))
+			}
+			for i, r := range ranges {
+				info := fromFlags[i]
+				if r.SampleNr != info.SampleNr || r.Offset > info.Offset || r.Offset+r.Size != info.Offset+uint64(info.Size) {
+					t.Errorf("range %d: %+v does not cover sample %+v", i, r, info)
+				}
+				if i+1 < len(ranges) && r.DTS+r.Dur != ranges[i+1].DTS {
+					t.Errorf("range %d: duration %d does not reach next range", i, r.Dur)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateTrickModeFile(t *testing.T) {
+	cases := []struct {
+		file    string
+		trackID uint32
+	}{
+		{file: "testdata/prog_8s.mp4", trackID: 2},
+		{file: "testdata/v300_multiple_segments.mp4", trackID: 2},
+	}
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			f := decodeTestFile(t, c.file)
+			all, err := f.SampleInfos(c.trackID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			syncs, err := f.SyncSampleInfos(c.trackID, mp4.SyncFromFlags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trick, err := mp4.CreateTrickModeFile(f, c.trackID, mp4.SyncFromFlags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := trick.Encode(&buf); err != nil {
+				t.Fatal(err)
+			}
+			dec, err := mp4.DecodeFile(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			infos, err := dec.SampleInfos(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(infos) != len(syncs) {
+				t.Fatalf("got %d samples instead of %d", len(infos), len(syncs))
+			}
+			last := all[len(all)-1]
+			lastOut := infos[len(infos)-1]
+			if lastOut.DTS+uint64(lastOut.Dur) != last.DTS+uint64(last.Dur) {
+				t.Errorf("trick-mode track ends at %d instead of %d", lastOut.DTS+uint64(lastOut.Dur), last.DTS+uint64(last.Dur))
+			}
+			for i, info := range infos {
+				if info.DTS != syncs[i].DTS || info.PTS != syncs[i].PTS || !info.Sync || info.DependsOn != 2 {
+					t.Errorf("sample %d: got %+v for sync sample %+v", i+1, info, syncs[i])
+				}
+				got := buf.Bytes()[info.Offset : info.Offset+uint64(info.Size)]
+				if !bytes.Equal(got, sampleBytes(t, c.file, syncs[i])) {
+					t.Errorf("sample %d: data differs", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestAddIFrameSsix(t *testing.T) {
+	f := decodeTestFile(t, "testdata/v300_multiple_segments.mp4")
+	if err := f.AddIFrameSsix(2, mp4.SyncFromData); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := mp4.DecodeFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec.Ssix == nil || len(dec.Ssix.SubSegments) != len(dec.Segments) {
+		t.Fatal("no ssix box with one subsegment per segment")
+	}
+	si, err := mp4.ReadSegmentIndex(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncs, err := dec.SyncSampleInfos(2, mp4.SyncFromFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(si.Entries) != len(dec.Segments) {
+		t.Fatalf("got %d index entries for %d segments", len(si.Entries), len(dec.Segments))
+	}
+	for i, e := range si.Entries {
+		offset, size, ok := e.LevelRange(0)
+		if !ok {
+			t.Fatalf("entry %d: no level 0 range", i)
+		}
+		seg := dec.Segments[i]
+		if offset != seg.StartPos {
+			t.Errorf("entry %d: level 0 starts at %d instead of %d", i, offset, seg.StartPos)
+		}
+		found := false
+		for _, s := range syncs {
+			if s.Offset+uint64(s.Size) == offset+size {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("entry %d: level 0 range does not end with a sync sample", i)
+		}
+		if _, full, _ := e.LevelRange(1); full != e.Size {
+			t.Errorf("entry %d: level 1 range size %d instead of %d", i, full, e.Size)
+		}
+	}
+}
+
+func sampleBytes(t *testing.T, fileName string, info mp4.SampleInfo) []byte {
+	t.Helper()
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data[info.Offset : info.Offset+uint64(info.Size)]
+}
+
+func TestSsixRoundTripWithSeveralSidxs(t *testing.T) {
+	// Re-encode the file first, since free boxes are not kept
+	var base bytes.Buffer
+	if err := decodeTestFile(t, "testdata/bbb5s_aac_sidx.mp4").Encode(&base); err != nil {
+		t.Fatal(err)
+	}
+	data := base.Bytes()
+	f, err := mp4.DecodeFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidx := f.Sidx
+	sidxStart := sidx.AnchorPoint - sidx.FirstOffset - sidx.Size()
+	ssix := &mp4.SsixBox{SubSegments: []mp4.SubSegment{{Ranges: []mp4.SubSegmentRange{
+		mp4.NewSubSegmentRange(0, 1000), mp4.NewSubSegmentRange(1, 0)}}}}
+
+	// Two sidx boxes with the ssix box after the first or the second one
+	for ssixPos := 0; ssixPos < 2; ssixPos++ {
+		sidxs := []*mp4.SidxBox{{}, {}}
+		for i := range sidxs {
+			*sidxs[i] = *sidx
+		}
+		boxes := []mp4.Box{sidxs[0], sidxs[1]}
+		boxes = append(boxes[:ssixPos+1], append([]mp4.Box{ssix}, boxes[ssixPos+1:]...)...)
+		var after uint64
+		for _, b := range boxes[1:] {
+			after += b.Size()
+		}
+		sidxs[0].FirstOffset = after
+		sidxs[1].FirstOffset = 0
+		if ssixPos == 1 {
+			sidxs[1].FirstOffset = ssix.Size()
+		}
+		var buf bytes.Buffer
+		buf.Write(data[:sidxStart])
+		for _, b := range boxes {
+			if err := b.Encode(&buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+		buf.Write(data[sidx.AnchorPoint:])
+
+		dec, err := mp4.DecodeFile(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dec.Sidxs) != 2 || dec.Ssix == nil {
+			t.Fatalf("ssix after sidx %d: got %d sidx boxes and ssix %v", ssixPos, len(dec.Sidxs), dec.Ssix != nil)
+		}
+		var out bytes.Buffer
+		if err := dec.Encode(&out); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), buf.Bytes()) {
+			t.Errorf("ssix after sidx %d: encoded file differs from input", ssixPos)
+		}
+	}
+}
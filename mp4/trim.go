@@ -0,0 +1,277 @@
+package mp4
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// trimTrack - samples of one track for TrimFragmentedFile
+type trimTrack struct {
+	trak     *TrakBox
+	samples  []FullSample
+	fragNrs  []int // index of the input fragment of each sample
+	first    int   // first kept sample
+	end      int   // index after last kept sample
+	shift    uint64
+	timeline *Timeline
+}
+
+// TrimFragmentedFile returns a new fragmented file presenting [start, end) of f, where start and end
+// are presentation times in timescale after the edit lists of f.
+//
+// The reference track (video if present, otherwise audio) is cut at whole GOPs, starting at the last
+// sync sample at or before start and ending before the first sync sample at or after end.
+// The other tracks are cut at the corresponding decode times. The kept samples keep their
+// fragment and segment structure, decode times are shifted to start at 0, sequence numbers
+// restart at 1, and a new init segment has edit lists presenting exactly [start, end).
+// A sidx box is generated if f has one. Sample data must be loaded, and encrypted fragments
+// are not supported.
+func TrimFragmentedFile(f *File, start, end uint64, timescale uint32) (*File, error) {
+	if !f.IsFragmented() || f.Init == nil {
+		return nil, fmt.Errorf("not a fragmented file with init segment")
+	}
+	if end <= start || timescale == 0 {
+		return nil, fmt.Errorf("bad time range [%d, %d) with timescale %d", start, end, timescale)
+	}
+	init, err := copyInit(f.Init)
+	if err != nil {
+		return nil, err
+	}
+	moov := init.Moov
+	if moov.Mvex == nil {
+		return nil, fmt.Errorf("no mvex box in init segment")
+	}
+	refTrak, err := findReferenceTrak(init)
+	if err != nil {
+		return nil, err
+	}
+	var frags []*Fragment
+	var segNrs []int
+	for i, seg := range f.Segments {
+		for _, frag := range seg.Fragments {
+			frags = append(frags, frag)
+			segNrs = append(segNrs, i)
+		}
+	}
+	tracks := make([]*trimTrack, 0, len(moov.Traks))
+	var ref *trimTrack
+	for _, trak := range moov.Traks {
+		trex, ok := moov.Mvex.GetTrex(trak.Tkhd.TrackID)
+		if !ok {
+			return nil, fmt.Errorf("no trex for track %d", trak.Tkhd.TrackID)
+		}
+		tt := &trimTrack{trak: trak, timeline: trak.Timeline(moov.Mvhd.Timescale)}
+		for fNr, frag := range frags {
+			for _, traf := range frag.Moof.Trafs {
+				if traf.Tfhd.TrackID == trak.Tkhd.TrackID && traf.Senc != nil {
+					return nil, fmt.Errorf("encrypted fragments not supported")
+				}
+			}
+			samples, err := frag.GetFullSamples(trex)
+			if err != nil {
+				return nil, fmt.Errorf("fragment %d: %w", fNr, err)
+			}
+			for _, s := range samples {
+				tt.samples = append(tt.samples, s)
+				tt.fragNrs = append(tt.fragNrs, fNr)
+			}
+		}
+		tracks = append(tracks, tt)
+		if trak == refTrak {
+			ref = tt
+		}
+	}
+	if len(ref.samples) == 0 {
+		return nil, fmt.Errorf("no samples in reference track %d", refTrak.Tkhd.TrackID)
+	}
+
+	refTS := refTrak.Mdia.Mdhd.Timescale
+	refOffset := ref.timeline.Offset()
+	refStart := int64(RescaleTime(start, timescale, refTS))
+	refEnd := int64(RescaleTime(end, timescale, refTS))
+	ref.first = -1
+	for i, s := range ref.samples {
+		if !s.IsSync() {
+			continue
+		}
+		if ref.first < 0 || s.PresentationTime()+refOffset <= refStart {
+			ref.first = i
+		}
+		if s.PresentationTime()+refOffset > refStart {
+			break
+		}
+	}
+	if ref.first < 0 {
+		return nil, fmt.Errorf("no sync sample in reference track")
+	}
+	ref.end = len(ref.samples)
+	var contentEnd int64
+	for i := ref.first; i < len(ref.samples); i++ {
+		s := ref.samples[i]
+		if i > ref.first && s.IsSync() && s.PresentationTime()+refOffset >= refEnd {
+			ref.end = i
+			break
+		}
+		if pEnd := s.PresentationTime() + int64(s.Dur) + refOffset; pEnd > contentEnd {
+			contentEnd = pEnd
+		}
+	}
+	if contentEnd <= refStart {
+		return nil, fmt.Errorf("start %d after end of content", start)
+	}
+	if refEnd > contentEnd {
+		refEnd = contentEnd
+	}
+	decStart := ref.samples[ref.first].DecodeTime
+	decEnd := ref.samples[ref.end-1].DecodeTime + uint64(ref.samples[ref.end-1].Dur)
+	ref.shift = decStart
+
+	for _, tt := range tracks {
+		if tt == ref {
+			continue
+		}
+		ts := tt.trak.Mdia.Mdhd.Timescale
+		tStart := RescaleTime(decStart, refTS, ts)
+		tEnd := RescaleTime(decEnd, refTS, ts)
+		tt.first = len(tt.samples)
+		for i, s := range tt.samples {
+			if s.DecodeTime+uint64(s.Dur) > tStart {
+				tt.first = i
+				break
+			}
+		}
+		for tt.first > 0 && tt.first < len(tt.samples) && !tt.samples[tt.first].IsSync() {
+			tt.first--
+		}
+		tt.end = tt.first
+		for tt.end < len(tt.samples) && tt.samples[tt.end].DecodeTime < tEnd {
+			tt.end++
+		}
+		tt.shift = tStart
+		if tt.first < tt.end && tt.samples[tt.first].DecodeTime < tStart {
+			tt.shift = tt.samples[tt.first].DecodeTime
+		}
+	}
+
+	// Samples of other tracks that overlap the kept range are moved into the kept fragments.
+	firstFrag, lastFrag := ref.fragNrs[ref.first], ref.fragNrs[ref.end-1]
+	for _, tt := range tracks {
+		for i := tt.first; i < tt.end; i++ {
+			if tt.fragNrs[i] < firstFrag {
+				tt.fragNrs[i] = firstFrag
+			} else if tt.fragNrs[i] > lastFrag {
+				tt.fragNrs[i] = lastFrag
+			}
+		}
+	}
+
+	movieTS := moov.Mvhd.Timescale
+	presDur := uint64(refEnd - refStart)
+	for _, tt := range tracks {
+		ts := tt.trak.Mdia.Mdhd.Timescale
+		tStart := int64(RescaleTime(uint64(refStart), refTS, ts))
+		mStart, ok := tt.timeline.MediaTime(tStart)
+		if !ok {
+			mStart = tStart - tt.timeline.Offset()
+		}
+		mediaTime := mStart - int64(tt.shift)
+		if mediaTime < 0 {
+			mediaTime = 0
+		}
+		tt.trak.SetEdits(movieTS, []TimelineEdit{{
+			Duration:  RescaleTime(presDur, refTS, ts),
+			MediaTime: mediaTime,
+			MediaRate: 0x10000,
+		}})
+		tt.trak.Tkhd.Duration = RescaleTime(presDur, refTS, movieTS)
+	}
+	moov.Mvhd.Duration = RescaleTime(presDur, refTS, movieTS)
+	if moov.Mvex.Mehd != nil {
+		moov.Mvex.Mehd.FragmentDuration = int64(moov.Mvhd.Duration)
+	}
+
+	out := NewFile()
+	out.isFragmented = true
+	out.Init = init
+	out.Children = append(out.Children, init.Ftyp, init.Moov)
+	var seqNr uint32 = 1
+	var seg *MediaSegment
+	lastSegNr := -1
+	for fNr, inFrag := range frags {
+		var trackIDs []uint32
+		for _, tt := range tracks {
+			if tt.hasSamplesIn(fNr) {
+				trackIDs = append(trackIDs, tt.trak.Tkhd.TrackID)
+			}
+		}
+		if len(trackIDs) == 0 {
+			continue
+		}
+		var frag *Fragment
+		if len(inFrag.Moof.Trafs) == 1 && len(trackIDs) == 1 {
+			frag, err = CreateFragment(seqNr, trackIDs[0])
+		} else {
+			frag, err = CreateMultiTrackFragment(seqNr, trackIDs)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, tt := range tracks {
+			for i := tt.first; i < tt.end; i++ {
+				if tt.fragNrs[i] != fNr {
+					continue
+				}
+				s := tt.samples[i]
+				s.DecodeTime -= tt.shift
+				if err := frag.AddFullSampleToTrack(s, tt.trak.Tkhd.TrackID); err != nil {
+					return nil, err
+				}
+			}
+		}
+		seqNr++
+		if segNrs[fNr] != lastSegNr {
+			lastSegNr = segNrs[fNr]
+			if styp := f.Segments[lastSegNr].Styp; styp != nil {
+				seg = NewMediaSegmentWithStyp(styp)
+			} else {
+				seg = NewMediaSegmentWithoutStyp()
+			}
+			out.AddMediaSegment(seg)
+		}
+		seg.AddFragment(frag)
+	}
+	if len(out.Segments) == 0 {
+		return nil, fmt.Errorf("no samples in time range")
+	}
+	if f.Sidx != nil {
+		if err := addNewSidx(out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (tt *trimTrack) hasSamplesIn(fragNr int) bool {
+	for i := tt.first; i < tt.end; i++ {
+		if tt.fragNrs[i] == fragNr {
+			return true
+		}
+	}
+	return false
+}
+
+// copyInit returns a deep copy of an init segment by encoding and decoding it.
+func copyInit(init *InitSegment) (*InitSegment, error) {
+	var buf bytes.Buffer
+	if err := init.Encode(&buf); err != nil {
+		return nil, err
+	}
+	f, err := DecodeFile(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if f.Init == nil {
+		return nil, fmt.Errorf("could not copy init segment")
+	}
+	return f.Init, nil
+}
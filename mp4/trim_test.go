@@ -0,0 +1,159 @@
+package mp4_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// createTwoTrackFile creates a file with 25fps video with 10-frame GOPs and 48kHz audio,
+// with one two-track fragment per GOP.
+func createTwoTrackFile(t *testing.T, nrSegs int) *mp4.File {
+	t.Helper()
+	init := mp4.CreateEmptyInit()
+	init.Moov.Mvhd.Timescale = 1000
+	init.AddEmptyTrack(90000, "video", "und")
+	init.AddEmptyTrack(48000, "audio", "und")
+	f := mp4.NewFile()
+	f.AddChild(init.Ftyp, 0)
+	f.AddChild(init.Moov, 0)
+	var audioTime uint64
+	for i := 0; i < nrSegs; i++ {
+		seg := mp4.NewMediaSegment()
+		frag, err := mp4.CreateMultiTrackFragment(uint32(i+1), []uint32{1, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 10; j++ {
+			flags := mp4.NonSyncSampleFlags
+			if j == 0 {
+				flags = mp4.SyncSampleFlags
+			}
+			err = frag.AddFullSampleToTrack(mp4.FullSample{
+				Sample:     mp4.NewSample(flags, 3600, 4, 0),
+				DecodeTime: uint64(10*i+j) * 3600,
+				Data:       []byte{byte(i), byte(j), 0, 0},
+			}, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		segEnd := uint64(i+1) * 19200
+		for audioTime < segEnd {
+			err = frag.AddFullSampleToTrack(mp4.FullSample{
+				Sample:     mp4.NewSample(mp4.SyncSampleFlags, 1024, 2, 0),
+				DecodeTime: audioTime,
+				Data:       []byte{1, 2},
+			}, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			audioTime += 1024
+		}
+		seg.AddFragment(frag)
+		f.AddMediaSegment(seg)
+	}
+	var buf bytes.Buffer
+	if err := f.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decF, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decF.UpdateSidx(true, false); err != nil {
+		t.Fatal(err)
+	}
+	return decF
+}
+
+func TestTrimFragmentedFile(t *testing.T) {
+	f := createTwoTrackFile(t, 5)
+	out, err := mp4.TrimFragmentedFile(f, 500, 1300, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := out.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := mp4.DecodeFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.Segments) != 3 {
+		t.Fatalf("got %d segments instead of 3", len(dec.Segments))
+	}
+	if dec.Sidx == nil || len(dec.Sidx.SidxRefs) != 3 || dec.Sidx.SidxRefs[0].SubSegmentDuration != 36000 {
+		t.Errorf("bad sidx %+v", dec.Sidx)
+	}
+	moov := dec.Init.Moov
+	for i, seg := range dec.Segments {
+		frag := seg.Fragments[0]
+		if frag.Moof.Mfhd.SequenceNumber != uint32(i+1) {
+			t.Errorf("segment %d: sequence number %d", i, frag.Moof.Mfhd.SequenceNumber)
+		}
+		if tfdt := frag.Moof.Trafs[0].Tfdt.BaseMediaDecodeTime(); tfdt != uint64(i)*36000 {
+			t.Errorf("segment %d: video tfdt %d", i, tfdt)
+		}
+		samples, err := frag.GetFullSamples(moov.Mvex.Trexs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(samples) != 10 || !samples[0].IsSync() || samples[0].Data[0] != byte(i+1) {
+			t.Errorf("segment %d: wrong video samples", i)
+		}
+	}
+	audioSamples, err := dec.Segments[0].Fragments[0].GetFullSamples(moov.Mvex.Trexs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audioSamples[0].DecodeTime != 0 {
+		t.Errorf("audio tfdt %d", audioSamples[0].DecodeTime)
+	}
+	wantEdits := []mp4.ElstEntry{
+		{SegmentDuration: 800, MediaTime: 9000, MediaRateInteger: 1},
+		{SegmentDuration: 800, MediaTime: 24000 - 18432, MediaRateInteger: 1},
+	}
+	for i, trak := range moov.Traks {
+		if trak.Edts == nil {
+			t.Fatalf("track %d: no edit list", i+1)
+		}
+		if got := trak.Edts.Elst[0].Entries[0]; got != wantEdits[i] {
+			t.Errorf("track %d: got elst %+v instead of %+v", i+1, got, wantEdits[i])
+		}
+	}
+	if f.Init.Moov.Trak.Edts != nil {
+		t.Errorf("input init segment was changed")
+	}
+
+	if _, err := mp4.TrimFragmentedFile(f, 5000, 6000, 1000); err == nil {
+		t.Errorf("expected error for range after content")
+	}
+}
+
+func TestTrimFragmentedVideoFile(t *testing.T) {
+	f, err := mp4.ReadMP4File("testdata/v300_multiple_segments.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := mp4.TrimFragmentedFile(f, 1000, 2000, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Segments) == 0 || len(out.Segments) > len(f.Segments) {
+		t.Errorf("got %d segments", len(out.Segments))
+	}
+	first := out.Segments[0].Fragments[0]
+	if first.Moof.Traf.Tfdt.BaseMediaDecodeTime() != 0 || first.Moof.Mfhd.SequenceNumber != 1 {
+		t.Errorf("first fragment not rewritten")
+	}
+	var buf bytes.Buffer
+	if err := out.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mp4.DecodeFile(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/Eyevinn/mp4ff/bits"
+	"github.com/Eyevinn/mp4ff/vp9"
 )
 
 // VppCBox - VP Codec Configuration Box (vpcC)
@@ -26,6 +27,22 @@ type VppCBox struct {
 	CodecInitData           []byte
 }
 
+// CreateVppCFromVP9 creates a version 1 vpcC box from a VP9 codec configuration,
+// typically derived from the bitstream with vp9.CodecConfigFromSamples.
+func CreateVppCFromVP9(cfg *vp9.CodecConfig) *VppCBox {
+	return &VppCBox{
+		Version:                 1,
+		Profile:                 cfg.Profile,
+		Level:                   cfg.Level,
+		BitDepth:                cfg.BitDepth,
+		ChromaSubsampling:       cfg.ChromaSubsampling,
+		VideoFullRangeFlag:      cfg.VideoFullRangeFlag,
+		ColourPrimaries:         cfg.ColourPrimaries,
+		TransferCharacteristics: cfg.TransferCharacteristics,
+		MatrixCoefficients:      cfg.MatrixCoefficients,
+	}
+}
+
 // DecodeVppC - box-specific decode
 func DecodeVppC(hdr BoxHeader, startPos uint64, r io.Reader) (Box, error) {
 	if hdr.Size < 20 {
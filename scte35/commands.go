@@ -0,0 +1,267 @@
+package scte35
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/bits"
+)
+
+// Splice command types (splice_command_type).
+const (
+	SpliceNullType           = 0x00
+	SpliceScheduleType       = 0x04
+	SpliceInsertType         = 0x05
+	TimeSignalType           = 0x06
+	BandwidthReservationType = 0x07
+	PrivateCommandType       = 0xff
+)
+
+// SpliceCommand is the command of a splice_info_section.
+type SpliceCommand interface {
+	// Type returns the splice_command_type.
+	Type() byte
+	encode(w *bits.Writer)
+}
+
+// SpliceTime is splice_time(). PTSTime is in 90 kHz ticks and only valid if Specified is set.
+type SpliceTime struct {
+	Specified bool
+	PTSTime   uint64
+}
+
+func parseSpliceTime(r *bits.Reader) SpliceTime {
+	if !r.ReadFlag() {
+		_ = r.Read(7)
+		return SpliceTime{}
+	}
+	_ = r.Read(6)
+	return SpliceTime{Specified: true, PTSTime: uint64(r.Read(33))}
+}
+
+func (t SpliceTime) encode(w *bits.Writer) {
+	if !t.Specified {
+		w.Write(0x7f, 8)
+		return
+	}
+	w.Write(1, 1)
+	w.Write(0x3f, 6)
+	w.Write(uint(t.PTSTime), 33)
+}
+
+// BreakDuration is break_duration(). Duration is in 90 kHz ticks.
+type BreakDuration struct {
+	AutoReturn bool
+	Duration   uint64
+}
+
+// SpliceNull is the splice_null() command, used for heartbeats and to carry descriptors.
+type SpliceNull struct{}
+
+// Type returns SpliceNullType.
+func (c *SpliceNull) Type() byte { return SpliceNullType }
+
+func (c *SpliceNull) encode(w *bits.Writer) {}
+
+// BandwidthReservation is the bandwidth_reservation() command.
+type BandwidthReservation struct{}
+
+// Type returns BandwidthReservationType.
+func (c *BandwidthReservation) Type() byte { return BandwidthReservationType }
+
+func (c *BandwidthReservation) encode(w *bits.Writer) {}
+
+// TimeSignal is the time_signal() command. The meaning of the signal is given by the
+// segmentation descriptors of the section.
+type TimeSignal struct {
+	SpliceTime SpliceTime
+}
+
+// Type returns TimeSignalType.
+func (c *TimeSignal) Type() byte { return TimeSignalType }
+
+func (c *TimeSignal) encode(w *bits.Writer) {
+	c.SpliceTime.encode(w)
+}
+
+// SpliceInsertComponent is the splice time of one component of a component splice.
+type SpliceInsertComponent struct {
+	ComponentTag byte
+	SpliceTime   SpliceTime
+}
+
+// SpliceInsert is the splice_insert() command. If SpliceEventCancelIndicator is set, only
+// SpliceEventID is used. SpliceTime is used for program splices and Components otherwise.
+type SpliceInsert struct {
+	SpliceEventID              uint32
+	SpliceEventCancelIndicator bool
+	OutOfNetworkIndicator      bool
+	ProgramSpliceFlag          bool
+	SpliceImmediateFlag        bool
+	EventIDComplianceFlag      bool
+	SpliceTime                 SpliceTime
+	Components                 []SpliceInsertComponent
+	BreakDuration              *BreakDuration
+	UniqueProgramID            uint16
+	AvailNum                   byte
+	AvailsExpected             byte
+}
+
+// Type returns SpliceInsertType.
+func (c *SpliceInsert) Type() byte { return SpliceInsertType }
+
+func parseSpliceInsert(r *bits.Reader) *SpliceInsert {
+	c := &SpliceInsert{}
+	c.SpliceEventID = uint32(r.Read(32))
+	c.SpliceEventCancelIndicator = r.ReadFlag()
+	_ = r.Read(7)
+	if c.SpliceEventCancelIndicator {
+		return c
+	}
+	c.OutOfNetworkIndicator = r.ReadFlag()
+	c.ProgramSpliceFlag = r.ReadFlag()
+	durationFlag := r.ReadFlag()
+	c.SpliceImmediateFlag = r.ReadFlag()
+	c.EventIDComplianceFlag = r.ReadFlag()
+	_ = r.Read(3)
+	if c.ProgramSpliceFlag {
+		if !c.SpliceImmediateFlag {
+			c.SpliceTime = parseSpliceTime(r)
+		}
+	} else {
+		componentCount := int(r.Read(8))
+		for i := 0; i < componentCount && r.AccError() == nil; i++ {
+			comp := SpliceInsertComponent{ComponentTag: byte(r.Read(8))}
+			if !c.SpliceImmediateFlag {
+				comp.SpliceTime = parseSpliceTime(r)
+			}
+			c.Components = append(c.Components, comp)
+		}
+	}
+	if durationFlag {
+		c.BreakDuration = &BreakDuration{AutoReturn: r.ReadFlag()}
+		_ = r.Read(6)
+		c.BreakDuration.Duration = uint64(r.Read(33))
+	}
+	c.UniqueProgramID = uint16(r.Read(16))
+	c.AvailNum = byte(r.Read(8))
+	c.AvailsExpected = byte(r.Read(8))
+	return c
+}
+
+func (c *SpliceInsert) encode(w *bits.Writer) {
+	w.Write(uint(c.SpliceEventID), 32)
+	writeFlag(w, c.SpliceEventCancelIndicator)
+	w.Write(0x7f, 7)
+	if c.SpliceEventCancelIndicator {
+		return
+	}
+	writeFlag(w, c.OutOfNetworkIndicator)
+	writeFlag(w, c.ProgramSpliceFlag)
+	writeFlag(w, c.BreakDuration != nil)
+	writeFlag(w, c.SpliceImmediateFlag)
+	writeFlag(w, c.EventIDComplianceFlag)
+	w.Write(0x07, 3)
+	if c.ProgramSpliceFlag {
+		if !c.SpliceImmediateFlag {
+			c.SpliceTime.encode(w)
+		}
+	} else {
+		w.Write(uint(len(c.Components)), 8)
+		for _, comp := range c.Components {
+			w.Write(uint(comp.ComponentTag), 8)
+			if !c.SpliceImmediateFlag {
+				comp.SpliceTime.encode(w)
+			}
+		}
+	}
+	if c.BreakDuration != nil {
+		writeFlag(w, c.BreakDuration.AutoReturn)
+		w.Write(0x3f, 6)
+		w.Write(uint(c.BreakDuration.Duration), 33)
+	}
+	w.Write(uint(c.UniqueProgramID), 16)
+	w.Write(uint(c.AvailNum), 8)
+	w.Write(uint(c.AvailsExpected), 8)
+}
+
+// PrivateCommand is the private_command() command.
+type PrivateCommand struct {
+	Identifier uint32
+	Data       []byte
+}
+
+// Type returns PrivateCommandType.
+func (c *PrivateCommand) Type() byte { return PrivateCommandType }
+
+func (c *PrivateCommand) encode(w *bits.Writer) {
+	w.Write(uint(c.Identifier), 32)
+	writeBytes(w, c.Data)
+}
+
+// UnknownCommand is a command that is not decoded, such as splice_schedule().
+type UnknownCommand struct {
+	CommandType byte
+	Data        []byte
+}
+
+// Type returns the splice_command_type.
+func (c *UnknownCommand) Type() byte { return c.CommandType }
+
+func (c *UnknownCommand) encode(w *bits.Writer) {
+	writeBytes(w, c.Data)
+}
+
+// parseCommand parses a command from data and returns it with the number of bytes read.
+// If length is 0xfff (legacy unspecified length), the command must be of a known type.
+func parseCommand(cmdType byte, data []byte, length int) (SpliceCommand, int, error) {
+	if length != 0xfff {
+		if length > len(data) {
+			return nil, 0, fmt.Errorf("splice_command_length %d exceeds section", length)
+		}
+		data = data[:length]
+	}
+	r := bits.NewReader(bytes.NewReader(data))
+	var cmd SpliceCommand
+	switch cmdType {
+	case SpliceNullType:
+		cmd = &SpliceNull{}
+	case BandwidthReservationType:
+		cmd = &BandwidthReservation{}
+	case TimeSignalType:
+		cmd = &TimeSignal{SpliceTime: parseSpliceTime(r)}
+	case SpliceInsertType:
+		cmd = parseSpliceInsert(r)
+	case PrivateCommandType:
+		if length == 0xfff {
+			return nil, 0, fmt.Errorf("private_command without splice_command_length")
+		}
+		cmd = &PrivateCommand{Identifier: uint32(r.Read(32)), Data: r.ReadRemainingBytes()}
+	default:
+		if length == 0xfff {
+			return nil, 0, fmt.Errorf("command type %d without splice_command_length", cmdType)
+		}
+		return &UnknownCommand{CommandType: cmdType, Data: data}, length, nil
+	}
+	if err := r.AccError(); err != nil {
+		return nil, 0, fmt.Errorf("command type %d: %w", cmdType, err)
+	}
+	if length == 0xfff {
+		length = r.NrBytesRead()
+	}
+	return cmd, length, nil
+}
+
+func writeFlag(w *bits.Writer, flag bool) {
+	if flag {
+		w.Write(1, 1)
+	} else {
+		w.Write(0, 1)
+	}
+}
+
+func writeBytes(w *bits.Writer, data []byte) {
+	for _, b := range data {
+		w.Write(uint(b), 8)
+	}
+}
@@ -0,0 +1,353 @@
+package scte35
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/Eyevinn/mp4ff/bits"
+)
+
+// CUEIdentifier is the identifier "CUEI" of all descriptors defined by SCTE-35.
+const CUEIdentifier = 0x43554549
+
+// Splice descriptor tags (splice_descriptor_tag).
+const (
+	AvailDescriptorTag        = 0x00
+	DTMFDescriptorTag         = 0x01
+	SegmentationDescriptorTag = 0x02
+	TimeDescriptorTag         = 0x03
+	AudioDescriptorTag        = 0x04
+)
+
+// Segmentation types (segmentation_type_id).
+const (
+	SegmentationTypeNotIndicated                           = 0x00
+	SegmentationTypeContentIdentification                  = 0x01
+	SegmentationTypeProgramStart                           = 0x10
+	SegmentationTypeProgramEnd                             = 0x11
+	SegmentationTypeProgramEarlyTermination                = 0x12
+	SegmentationTypeProgramBreakaway                       = 0x13
+	SegmentationTypeProgramResumption                      = 0x14
+	SegmentationTypeChapterStart                           = 0x20
+	SegmentationTypeChapterEnd                             = 0x21
+	SegmentationTypeBreakStart                             = 0x22
+	SegmentationTypeBreakEnd                               = 0x23
+	SegmentationTypeProviderAdvertisementStart             = 0x30
+	SegmentationTypeProviderAdvertisementEnd               = 0x31
+	SegmentationTypeDistributorAdvertisementStart          = 0x32
+	SegmentationTypeDistributorAdvertisementEnd            = 0x33
+	SegmentationTypeProviderPlacementOpportunityStart      = 0x34
+	SegmentationTypeProviderPlacementOpportunityEnd        = 0x35
+	SegmentationTypeDistributorPlacementOpportunityStart   = 0x36
+	SegmentationTypeDistributorPlacementOpportunityEnd     = 0x37
+	SegmentationTypeProviderOverlayPlacementOpportunity    = 0x38
+	SegmentationTypeDistributorOverlayPlacementOpportunity = 0x3a
+	SegmentationTypeProviderAdBlockStart                   = 0x44
+	SegmentationTypeDistributorAdBlockStart                = 0x46
+)
+
+// Segmentation UPID types (segmentation_upid_type).
+const (
+	UPIDTypeNotUsed = 0x00
+	UPIDTypeAdID    = 0x03
+	UPIDTypeUMID    = 0x04
+	UPIDTypeISAN    = 0x06
+	UPIDTypeTID     = 0x07
+	UPIDTypeTI      = 0x08
+	UPIDTypeADI     = 0x09
+	UPIDTypeEIDR    = 0x0a
+	UPIDTypeATSC    = 0x0b
+	UPIDTypeMPU     = 0x0c
+	UPIDTypeMID     = 0x0d
+	UPIDTypeADSInfo = 0x0e
+	UPIDTypeURI     = 0x0f
+	UPIDTypeUUID    = 0x10
+	UPIDTypeSCR     = 0x11
+)
+
+// SpliceDescriptor is a splice_descriptor() of a splice_info_section.
+type SpliceDescriptor interface {
+	// Tag returns the splice_descriptor_tag.
+	Tag() byte
+	// payload returns the identifier and the bytes after it.
+	payload() (uint32, []byte, error)
+}
+
+// GenericDescriptor is a descriptor that is not decoded.
+type GenericDescriptor struct {
+	DescriptorTag byte
+	Identifier    uint32
+	Data          []byte
+}
+
+// Tag returns the splice_descriptor_tag.
+func (d *GenericDescriptor) Tag() byte { return d.DescriptorTag }
+
+func (d *GenericDescriptor) payload() (uint32, []byte, error) {
+	return d.Identifier, d.Data, nil
+}
+
+// UPID is a segmentation_upid() with its type. For UPIDTypeMID, Value holds the
+// concatenated UPIDs, which are returned by MID.
+type UPID struct {
+	Type  byte
+	Value []byte
+}
+
+// MID returns the UPIDs of a UPID of type UPIDTypeMID.
+func (u UPID) MID() ([]UPID, error) {
+	if u.Type != UPIDTypeMID {
+		return nil, fmt.Errorf("UPID type %d is not MID", u.Type)
+	}
+	var upids []UPID
+	data := u.Value
+	for len(data) > 0 {
+		if len(data) < 2 || int(data[1]) > len(data)-2 {
+			return nil, fmt.Errorf("truncated MID UPID")
+		}
+		upids = append(upids, UPID{Type: data[0], Value: data[2 : 2+int(data[1])]})
+		data = data[2+int(data[1]):]
+	}
+	return upids, nil
+}
+
+// CreateMID returns a UPID of type UPIDTypeMID holding upids.
+func CreateMID(upids []UPID) (UPID, error) {
+	mid := UPID{Type: UPIDTypeMID}
+	for _, u := range upids {
+		if len(u.Value) > 255 {
+			return UPID{}, fmt.Errorf("UPID of %d bytes is too long", len(u.Value))
+		}
+		mid.Value = append(mid.Value, u.Type, byte(len(u.Value)))
+		mid.Value = append(mid.Value, u.Value...)
+	}
+	return mid, nil
+}
+
+// String returns the UPID as text for text types, as a number for TI, and in hex otherwise.
+func (u UPID) String() string {
+	switch u.Type {
+	case UPIDTypeNotUsed:
+		return ""
+	case UPIDTypeAdID, UPIDTypeTID, UPIDTypeADI, UPIDTypeADSInfo, UPIDTypeURI:
+		return string(u.Value)
+	case UPIDTypeTI:
+		if len(u.Value) == 8 {
+			return strconv.FormatUint(binary.BigEndian.Uint64(u.Value), 10)
+		}
+	case UPIDTypeMID:
+		upids, err := u.MID()
+		if err == nil {
+			s := ""
+			for i, m := range upids {
+				if i > 0 {
+					s += ","
+				}
+				s += fmt.Sprintf("%d:%s", m.Type, m)
+			}
+			return s
+		}
+	}
+	return hex.EncodeToString(u.Value)
+}
+
+// SegmentationComponent is the PTS offset of one component of a component segmentation.
+type SegmentationComponent struct {
+	ComponentTag byte
+	PTSOffset    uint64
+}
+
+// SegmentationDescriptor is segmentation_descriptor(). If SegmentationEventCancelIndicator
+// is set, only SegmentationEventID and SegmentationEventIDComplianceIndicator are used.
+// SegmentationDuration is in 90 kHz ticks and only used if SegmentationDurationFlag is set.
+// SubSegmentNum and SubSegmentsExpected are only used if HasSubSegments is set, which is
+// allowed for the placement opportunity and ad block start types. Sections written before
+// these fields were added to the standard lack them.
+type SegmentationDescriptor struct {
+	SegmentationEventID                    uint32
+	SegmentationEventCancelIndicator       bool
+	SegmentationEventIDComplianceIndicator bool
+	ProgramSegmentationFlag                bool
+	SegmentationDurationFlag               bool
+	DeliveryNotRestrictedFlag              bool
+	WebDeliveryAllowedFlag                 bool
+	NoRegionalBlackoutFlag                 bool
+	ArchiveAllowedFlag                     bool
+	DeviceRestrictions                     byte
+	Components                             []SegmentationComponent
+	SegmentationDuration                   uint64
+	UPID                                   UPID
+	SegmentationTypeID                     byte
+	SegmentNum                             byte
+	SegmentsExpected                       byte
+	HasSubSegments                         bool
+	SubSegmentNum                          byte
+	SubSegmentsExpected                    byte
+}
+
+// Tag returns SegmentationDescriptorTag.
+func (d *SegmentationDescriptor) Tag() byte { return SegmentationDescriptorTag }
+
+// hasSubSegments returns true if the segmentation type carries sub_segment_num and
+// sub_segments_expected.
+func hasSubSegments(typeID byte) bool {
+	switch typeID {
+	case SegmentationTypeProviderPlacementOpportunityStart, SegmentationTypeDistributorPlacementOpportunityStart,
+		SegmentationTypeProviderOverlayPlacementOpportunity, SegmentationTypeDistributorOverlayPlacementOpportunity,
+		SegmentationTypeProviderAdBlockStart, SegmentationTypeDistributorAdBlockStart:
+		return true
+	}
+	return false
+}
+
+func parseSegmentationDescriptor(data []byte) (*SegmentationDescriptor, error) {
+	r := bits.NewReader(bytes.NewReader(data))
+	d := &SegmentationDescriptor{}
+	d.SegmentationEventID = uint32(r.Read(32))
+	d.SegmentationEventCancelIndicator = r.ReadFlag()
+	d.SegmentationEventIDComplianceIndicator = r.ReadFlag()
+	_ = r.Read(6)
+	if d.SegmentationEventCancelIndicator {
+		return d, r.AccError()
+	}
+	d.ProgramSegmentationFlag = r.ReadFlag()
+	d.SegmentationDurationFlag = r.ReadFlag()
+	d.DeliveryNotRestrictedFlag = r.ReadFlag()
+	if !d.DeliveryNotRestrictedFlag {
+		d.WebDeliveryAllowedFlag = r.ReadFlag()
+		d.NoRegionalBlackoutFlag = r.ReadFlag()
+		d.ArchiveAllowedFlag = r.ReadFlag()
+		d.DeviceRestrictions = byte(r.Read(2))
+	} else {
+		_ = r.Read(5)
+	}
+	if !d.ProgramSegmentationFlag {
+		componentCount := int(r.Read(8))
+		for i := 0; i < componentCount && r.AccError() == nil; i++ {
+			comp := SegmentationComponent{ComponentTag: byte(r.Read(8))}
+			_ = r.Read(7)
+			comp.PTSOffset = uint64(r.Read(33))
+			d.Components = append(d.Components, comp)
+		}
+	}
+	if d.SegmentationDurationFlag {
+		d.SegmentationDuration = uint64(r.Read(40))
+	}
+	d.UPID.Type = byte(r.Read(8))
+	upidLength := int(r.Read(8))
+	d.UPID.Value = make([]byte, 0, upidLength)
+	for i := 0; i < upidLength && r.AccError() == nil; i++ {
+		d.UPID.Value = append(d.UPID.Value, byte(r.Read(8)))
+	}
+	d.SegmentationTypeID = byte(r.Read(8))
+	d.SegmentNum = byte(r.Read(8))
+	d.SegmentsExpected = byte(r.Read(8))
+	if err := r.AccError(); err != nil {
+		return nil, fmt.Errorf("segmentation_descriptor: %w", err)
+	}
+	if hasSubSegments(d.SegmentationTypeID) && len(data)-r.NrBytesRead() >= 2 {
+		d.HasSubSegments = true
+		d.SubSegmentNum = byte(r.Read(8))
+		d.SubSegmentsExpected = byte(r.Read(8))
+	}
+	return d, r.AccError()
+}
+
+func (d *SegmentationDescriptor) payload() (uint32, []byte, error) {
+	if len(d.UPID.Value) > 255 {
+		return 0, nil, fmt.Errorf("segmentation_upid of %d bytes is too long", len(d.UPID.Value))
+	}
+	buf := bytes.Buffer{}
+	w := bits.NewWriter(&buf)
+	w.Write(uint(d.SegmentationEventID), 32)
+	writeFlag(w, d.SegmentationEventCancelIndicator)
+	writeFlag(w, d.SegmentationEventIDComplianceIndicator)
+	w.Write(0x3f, 6)
+	if !d.SegmentationEventCancelIndicator {
+		writeFlag(w, d.ProgramSegmentationFlag)
+		writeFlag(w, d.SegmentationDurationFlag)
+		writeFlag(w, d.DeliveryNotRestrictedFlag)
+		if !d.DeliveryNotRestrictedFlag {
+			writeFlag(w, d.WebDeliveryAllowedFlag)
+			writeFlag(w, d.NoRegionalBlackoutFlag)
+			writeFlag(w, d.ArchiveAllowedFlag)
+			w.Write(uint(d.DeviceRestrictions), 2)
+		} else {
+			w.Write(0x1f, 5)
+		}
+		if !d.ProgramSegmentationFlag {
+			w.Write(uint(len(d.Components)), 8)
+			for _, comp := range d.Components {
+				w.Write(uint(comp.ComponentTag), 8)
+				w.Write(0x7f, 7)
+				w.Write(uint(comp.PTSOffset), 33)
+			}
+		}
+		if d.SegmentationDurationFlag {
+			w.Write(uint(d.SegmentationDuration), 40)
+		}
+		w.Write(uint(d.UPID.Type), 8)
+		w.Write(uint(len(d.UPID.Value)), 8)
+		writeBytes(w, d.UPID.Value)
+		w.Write(uint(d.SegmentationTypeID), 8)
+		w.Write(uint(d.SegmentNum), 8)
+		w.Write(uint(d.SegmentsExpected), 8)
+		if d.HasSubSegments {
+			if !hasSubSegments(d.SegmentationTypeID) {
+				return 0, nil, fmt.Errorf("segmentation type 0x%02x has no sub-segments", d.SegmentationTypeID)
+			}
+			w.Write(uint(d.SubSegmentNum), 8)
+			w.Write(uint(d.SubSegmentsExpected), 8)
+		}
+	}
+	w.Flush()
+	return CUEIdentifier, buf.Bytes(), w.AccError()
+}
+
+// parseDescriptors parses a descriptor loop.
+func parseDescriptors(data []byte) ([]SpliceDescriptor, error) {
+	var descs []SpliceDescriptor
+	for len(data) > 0 {
+		if len(data) < 6 {
+			return nil, fmt.Errorf("truncated splice_descriptor")
+		}
+		tag, length := data[0], int(data[1])
+		if length < 4 || length > len(data)-2 {
+			return nil, fmt.Errorf("bad descriptor_length %d for tag %d", length, tag)
+		}
+		identifier := binary.BigEndian.Uint32(data[2:])
+		body := data[6 : 2+length]
+		data = data[2+length:]
+		if tag == SegmentationDescriptorTag && identifier == CUEIdentifier {
+			d, err := parseSegmentationDescriptor(body)
+			if err != nil {
+				return nil, err
+			}
+			descs = append(descs, d)
+			continue
+		}
+		descs = append(descs, &GenericDescriptor{DescriptorTag: tag, Identifier: identifier, Data: body})
+	}
+	return descs, nil
+}
+
+// encodeDescriptors returns the descriptor loop of descs.
+func encodeDescriptors(descs []SpliceDescriptor) ([]byte, error) {
+	var out []byte
+	for _, d := range descs {
+		identifier, body, err := d.payload()
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > 255-4 {
+			return nil, fmt.Errorf("descriptor with tag %d is too long", d.Tag())
+		}
+		out = append(out, d.Tag(), byte(4+len(body)))
+		out = binary.BigEndian.AppendUint32(out, identifier)
+		out = append(out, body...)
+	}
+	return out, nil
+}
@@ -0,0 +1,18 @@
+/*
+Package scte35 decodes and encodes SCTE-35 splice_info_section messages, which signal ad
+insertion opportunities and other content boundaries.
+
+Parse and SpliceInfoSection.Encode handle the section with its CRC-32. The splice_null,
+splice_insert, time_signal, bandwidth_reservation and private_command commands are decoded,
+other commands are kept as raw bytes. Segmentation descriptors are decoded including their
+UPIDs, other descriptors are kept as raw bytes.
+
+In ISOBMFF, SCTE-35 messages are carried in DASH event message boxes (emsg) with the scheme
+urn:scte:scte35:2013:bin (SCTE 214-1), or as ISO/IEC 23001-18 event message instance boxes
+(emib) in the samples of an event message track (evte). CreateEmsgV0, CreateEmsgV1 and
+CreateEmib wrap a section into these boxes, and SpliceInfoSection.EventTiming converts the
+90 kHz splice time to the media time of a track.
+
+The syntax follows ANSI/SCTE 35 2023r1.
+*/
+package scte35
@@ -0,0 +1,131 @@
+package scte35
+
+import (
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+)
+
+// SchemeIDURI is the scheme of emsg and emib boxes carrying a binary splice_info_section
+// (SCTE 214-1).
+const SchemeIDURI = "urn:scte:scte35:2013:bin"
+
+// UnknownDuration is the event duration of emsg and emib boxes for events of unknown duration.
+const UnknownDuration = mp4.EventDurationUnknown
+
+// PTSToMediaTime converts a 90 kHz PTS to media time in timescale. ptsAtZero is the PTS of
+// media time zero, for example the PTS of the first video frame when converting from MPEG-2
+// TS. The difference is taken modulo 2^33, so PTS wrap-around is handled.
+func PTSToMediaTime(pts, ptsAtZero uint64, timescale uint32) uint64 {
+	return mp4.RescaleTime((pts-ptsAtZero)&ptsMask, PTSTimescale, timescale)
+}
+
+// MediaTimeToPTS converts media time in timescale to a 90 kHz PTS, given the PTS of media
+// time zero. It is the inverse of PTSToMediaTime.
+func MediaTimeToPTS(mediaTime, ptsAtZero uint64, timescale uint32) uint64 {
+	return (ptsAtZero + mp4.RescaleTime(mediaTime, timescale, PTSTimescale)) & ptsMask
+}
+
+// EventTiming returns the splice time and duration of the section in timescale, for use as
+// presentation time and event duration of an emsg or emib box. ptsAtZero is the PTS of
+// media time zero (see PTSToMediaTime). The duration is UnknownDuration if the section has
+// none.
+func (s *SpliceInfoSection) EventTiming(timescale uint32, ptsAtZero uint64) (presentationTime uint64, duration uint32, err error) {
+	pts, ok := s.SplicePTS()
+	if !ok {
+		return 0, 0, fmt.Errorf("no splice time in section")
+	}
+	presentationTime = PTSToMediaTime(pts, ptsAtZero, timescale)
+	duration = UnknownDuration
+	if ticks, ok := s.Duration(); ok {
+		d := mp4.RescaleTime(ticks, PTSTimescale, timescale)
+		if d >= UnknownDuration {
+			return 0, 0, fmt.Errorf("duration %d does not fit in 32 bits", d)
+		}
+		duration = uint32(d)
+	}
+	return presentationTime, duration, nil
+}
+
+// CreateEmsgV1 returns a version 1 emsg box with the section as message data and an absolute
+// presentation time in timescale.
+func CreateEmsgV1(s *SpliceInfoSection, id, timescale uint32, presentationTime uint64, duration uint32) (*mp4.EmsgBox, error) {
+	data, err := s.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return &mp4.EmsgBox{
+		Version:          1,
+		TimeScale:        timescale,
+		PresentationTime: presentationTime,
+		EventDuration:    duration,
+		ID:               id,
+		SchemeIDURI:      SchemeIDURI,
+		MessageData:      data,
+	}, nil
+}
+
+// CreateEmsgV0 returns a version 0 emsg box with the section as message data. The
+// presentation time delta is relative to segmentStart, normally the tfdt base media
+// decode time of the first fragment of the segment, in the same timescale.
+func CreateEmsgV0(s *SpliceInfoSection, id, timescale uint32, presentationTime, segmentStart uint64, duration uint32) (*mp4.EmsgBox, error) {
+	if presentationTime < segmentStart {
+		return nil, fmt.Errorf("presentation time %d before segment start %d", presentationTime, segmentStart)
+	}
+	delta := presentationTime - segmentStart
+	if delta > 0xffffffff {
+		return nil, fmt.Errorf("presentation time delta %d does not fit in 32 bits", delta)
+	}
+	data, err := s.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return &mp4.EmsgBox{
+		Version:               0,
+		TimeScale:             timescale,
+		PresentationTimeDelta: uint32(delta),
+		EventDuration:         duration,
+		ID:                    id,
+		SchemeIDURI:           SchemeIDURI,
+		MessageData:           data,
+	}, nil
+}
+
+// CreateEmib returns an emib box with the section as message data for an event message
+// track sample with presentation time samplePresentationTime. Both times are in the
+// timescale of the event message track.
+func CreateEmib(s *SpliceInfoSection, id uint32, presentationTime, samplePresentationTime uint64, duration uint32) (*mp4.EmibBox, error) {
+	data, err := s.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return &mp4.EmibBox{
+		PresentationTimeDelta: int64(presentationTime) - int64(samplePresentationTime),
+		EventDuration:         duration,
+		Id:                    id,
+		SchemeIdURI:           SchemeIDURI,
+		MessageData:           data,
+	}, nil
+}
+
+// EventSampleData returns the data of an event message track sample holding emibs, or an
+// emeb box if there are none.
+func EventSampleData(emibs ...*mp4.EmibBox) ([]byte, error) {
+	return mp4.CreateEventSampleData(emibs)
+}
+
+// ParseEmsg returns the section carried by an emsg box with scheme SchemeIDURI.
+func ParseEmsg(emsg *mp4.EmsgBox) (*SpliceInfoSection, error) {
+	if emsg.SchemeIDURI != SchemeIDURI {
+		return nil, fmt.Errorf("emsg scheme %q is not %s", emsg.SchemeIDURI, SchemeIDURI)
+	}
+	return Parse(emsg.MessageData)
+}
+
+// ParseEmib returns the section carried by an emib box with scheme SchemeIDURI.
+func ParseEmib(emib *mp4.EmibBox) (*SpliceInfoSection, error) {
+	if emib.SchemeIdURI != SchemeIDURI {
+		return nil, fmt.Errorf("emib scheme %q is not %s", emib.SchemeIdURI, SchemeIDURI)
+	}
+	return Parse(emib.MessageData)
+}
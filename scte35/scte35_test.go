@@ -0,0 +1,224 @@
+package scte35_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/Eyevinn/mp4ff/scte35"
+	"github.com/go-test/deep"
+)
+
+// spliceInsertHex is the splice_insert of mp4/testdata/emib.dat.
+const spliceInsertHex = "fc302500000000000000fff01405000001007fefff41be51b0fe000d2f000000000000002636614b"
+
+// timeSignalB64 is the time_signal example with a placement opportunity start segmentation
+// descriptor from SCTE-35 Section 14.
+const timeSignalB64 = "/DA0AAAAAAAA///wBQb+cr0AUAAeAhxDVUVJSAAAjn/PAAGlmbAICAAAAAAsoKGKNAIAmsnRfg=="
+
+func mustParse(t *testing.T, data []byte) *scte35.SpliceInfoSection {
+	t.Helper()
+	s, err := scte35.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("re-encoded section differs:\n got %x\nwant %x", out, data)
+	}
+	return s
+}
+
+func TestSpliceInsert(t *testing.T) {
+	data, _ := hex.DecodeString(spliceInsertHex)
+	s := mustParse(t, data)
+	want := &scte35.SpliceInsert{
+		SpliceEventID:         256,
+		OutOfNetworkIndicator: true,
+		ProgramSpliceFlag:     true,
+		EventIDComplianceFlag: true,
+		SpliceTime:            scte35.SpliceTime{Specified: true, PTSTime: 0x141be51b0},
+		BreakDuration:         &scte35.BreakDuration{AutoReturn: true, Duration: 864000},
+	}
+	if diff := deep.Equal(s.Command, want); diff != nil {
+		t.Error(diff)
+	}
+	if s.SAPType != scte35.SAPTypeNotSpecified || s.Tier != 0xfff || len(s.Descriptors) != 0 {
+		t.Errorf("got SAP type %d, tier 0x%x and %d descriptors", s.SAPType, s.Tier, len(s.Descriptors))
+	}
+	// With PTS adjustment, the splice time wraps around 2^33
+	s.PTSAdjustment = 0x100000000
+	pts, ok := s.SplicePTS()
+	if !ok || pts != 0x41be51b0 {
+		t.Errorf("got splice PTS 0x%x, %t", pts, ok)
+	}
+	pt, dur, err := s.EventTiming(1000, 0x41be51b0-90000)
+	if err != nil || pt != 1000 || dur != 9600 {
+		t.Errorf("got timing %d, %d, %v", pt, dur, err)
+	}
+
+	data[10] ^= 0x01
+	if _, err := scte35.Parse(data); !errors.Is(err, scte35.ErrBadCRC) {
+		t.Errorf("expected CRC error, got %v", err)
+	}
+}
+
+func TestTimeSignal(t *testing.T) {
+	data, _ := base64.StdEncoding.DecodeString(timeSignalB64)
+	s := mustParse(t, data)
+	pts, ok := s.SplicePTS()
+	if !ok || pts != 0x072bd0050 {
+		t.Errorf("got splice PTS 0x%x, %t", pts, ok)
+	}
+	sds := s.SegmentationDescriptors()
+	if len(sds) != 1 {
+		t.Fatalf("got %d segmentation descriptors", len(sds))
+	}
+	want := &scte35.SegmentationDescriptor{
+		SegmentationEventID:                    0x4800008e,
+		SegmentationEventIDComplianceIndicator: true,
+		ProgramSegmentationFlag:                true,
+		SegmentationDurationFlag:               true,
+		NoRegionalBlackoutFlag:                 true,
+		ArchiveAllowedFlag:                     true,
+		DeviceRestrictions:                     3,
+		SegmentationDuration:                   0x0001a599b0,
+		UPID:                                   scte35.UPID{Type: scte35.UPIDTypeTI, Value: []byte{0, 0, 0, 0, 0x2c, 0xa0, 0xa1, 0x8a}},
+		SegmentationTypeID:                     scte35.SegmentationTypeProviderPlacementOpportunityStart,
+		SegmentNum:                             2,
+	}
+	if diff := deep.Equal(sds[0], want); diff != nil {
+		t.Error(diff)
+	}
+	if got := sds[0].UPID.String(); got != "748724618" {
+		t.Errorf("got UPID %s", got)
+	}
+	if d, ok := s.Duration(); !ok || d != 27630000 {
+		t.Errorf("got duration %d, %t", d, ok)
+	}
+}
+
+func TestCreateSection(t *testing.T) {
+	mid, err := scte35.CreateMID([]scte35.UPID{
+		{Type: scte35.UPIDTypeAdID, Value: []byte("ABCD0123456H")},
+		{Type: scte35.UPIDTypeURI, Value: []byte("urn:uuid:1234")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := scte35.NewSpliceInfoSection(&scte35.TimeSignal{SpliceTime: scte35.SpliceTime{Specified: true, PTSTime: 180000}})
+	s.Descriptors = []scte35.SpliceDescriptor{
+		&scte35.SegmentationDescriptor{
+			SegmentationEventID:       1,
+			DeliveryNotRestrictedFlag: true,
+			Components:                []scte35.SegmentationComponent{{ComponentTag: 1, PTSOffset: 10}},
+			UPID:                      mid,
+			SegmentationTypeID:        scte35.SegmentationTypeDistributorPlacementOpportunityStart,
+			HasSubSegments:            true,
+			SubSegmentNum:             1,
+			SubSegmentsExpected:       3,
+		},
+		&scte35.SegmentationDescriptor{SegmentationEventID: 2, SegmentationEventCancelIndicator: true},
+		&scte35.GenericDescriptor{DescriptorTag: scte35.AvailDescriptorTag, Identifier: scte35.CUEIdentifier, Data: []byte{0, 0, 0, 7}},
+	}
+	data, err := s.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := mustParse(t, data)
+	if diff := deep.Equal(got, s); diff != nil {
+		t.Error(diff)
+	}
+	if str := got.SegmentationDescriptors()[0].UPID.String(); str != "3:ABCD0123456H,15:urn:uuid:1234" {
+		t.Errorf("got MID %s", str)
+	}
+	if _, _, err := got.EventTiming(1000, 0); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := scte35.NewSpliceInfoSection(&scte35.SpliceNull{}).EventTiming(1000, 0); err == nil {
+		t.Error("expected error for splice_null timing")
+	}
+}
+
+func TestPTSConversion(t *testing.T) {
+	ptsAtZero := uint64(1<<33 - 45000) // half a second before wrap-around
+	if got := scte35.PTSToMediaTime(45000, ptsAtZero, 48000); got != 48000 {
+		t.Errorf("got media time %d", got)
+	}
+	if got := scte35.MediaTimeToPTS(48000, ptsAtZero, 48000); got != 45000 {
+		t.Errorf("got PTS %d", got)
+	}
+}
+
+func TestEventBoxes(t *testing.T) {
+	data, _ := hex.DecodeString(spliceInsertHex)
+	s, err := scte35.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, err := scte35.CreateEmsgV1(s, 1, 90000, 1000, 864000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v0, err := scte35.CreateEmsgV0(s, 1, 90000, 1000, 400, 864000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v0.PresentationTimeDelta != 600 {
+		t.Errorf("got presentation time delta %d", v0.PresentationTimeDelta)
+	}
+	if _, err := scte35.CreateEmsgV0(s, 1, 90000, 100, 400, 864000); err == nil {
+		t.Error("expected error for event before segment start")
+	}
+	for _, emsg := range []*mp4.EmsgBox{v0, v1} {
+		buf := bytes.Buffer{}
+		if err := emsg.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		box, err := mp4.DecodeBox(0, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := scte35.ParseEmsg(box.(*mp4.EmsgBox))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := deep.Equal(got, s); diff != nil {
+			t.Error(diff)
+		}
+	}
+
+	emib, err := scte35.CreateEmib(s, 1, 1000, 2000, 9600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample, err := scte35.EventSampleData(emib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, err := mp4.DecodeBox(0, bytes.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotEmib := box.(*mp4.EmibBox)
+	if gotEmib.PresentationTimeDelta != -1000 {
+		t.Errorf("got presentation time delta %d", gotEmib.PresentationTimeDelta)
+	}
+	if _, err := scte35.ParseEmib(gotEmib); err != nil {
+		t.Error(err)
+	}
+	empty, err := scte35.EventSampleData()
+	if err != nil || !bytes.Equal(empty, []byte{0, 0, 0, 8, 'e', 'm', 'e', 'b'}) {
+		t.Errorf("got empty sample %x, %v", empty, err)
+	}
+	v1.SchemeIDURI = "urn:other"
+	if _, err := scte35.ParseEmsg(v1); err == nil {
+		t.Error("expected scheme error")
+	}
+}
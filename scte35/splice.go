@@ -0,0 +1,195 @@
+package scte35
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/Eyevinn/mp4ff/bits"
+)
+
+const (
+	// TableID is the table_id of a splice_info_section.
+	TableID = 0xfc
+	// PTSTimescale is the timescale of PTS values and durations in SCTE-35.
+	PTSTimescale = 90000
+	// SAPTypeNotSpecified is the sap_type for sections that do not signal a SAP type.
+	SAPTypeNotSpecified = 3
+
+	ptsMask = 1<<33 - 1
+	// headerSize is the size up to and including splice_command_type.
+	headerSize = 14
+)
+
+// ErrBadCRC is returned for a section with a CRC_32 mismatch.
+var ErrBadCRC = errors.New("splice_info_section CRC_32 mismatch")
+
+// SpliceInfoSection is a splice_info_section(). Encrypted sections are not supported.
+type SpliceInfoSection struct {
+	SAPType         byte
+	ProtocolVersion byte
+	// PTSAdjustment is added to all PTS values of the section (modulo 2^33).
+	PTSAdjustment uint64
+	CWIndex       byte
+	// Tier is a 12-bit authorization tier, where 0xfff means that the tier is not used.
+	Tier        uint16
+	Command     SpliceCommand
+	Descriptors []SpliceDescriptor
+}
+
+// NewSpliceInfoSection returns a section carrying cmd, with the SAP type and tier not used.
+func NewSpliceInfoSection(cmd SpliceCommand) *SpliceInfoSection {
+	return &SpliceInfoSection{
+		SAPType: SAPTypeNotSpecified,
+		Tier:    0xfff,
+		Command: cmd,
+	}
+}
+
+// Parse decodes a complete splice_info_section and checks its CRC_32.
+func Parse(data []byte) (*SpliceInfoSection, error) {
+	if len(data) < headerSize+2+4 {
+		return nil, fmt.Errorf("splice_info_section too short: %d bytes", len(data))
+	}
+	if data[0] != TableID {
+		return nil, fmt.Errorf("table_id 0x%02x is not splice_info_section", data[0])
+	}
+	sectionLength := int(binary.BigEndian.Uint16(data[1:]) & 0x0fff)
+	if 3+sectionLength > len(data) || sectionLength < headerSize-3+2+4 {
+		return nil, fmt.Errorf("bad section_length %d for %d bytes", sectionLength, len(data))
+	}
+	data = data[:3+sectionLength]
+	if bits.CRC32MPEG2(data) != 0 {
+		return nil, ErrBadCRC
+	}
+	r := bits.NewReader(bytes.NewReader(data[1:headerSize]))
+	_ = r.Read(2) // section_syntax_indicator, private_indicator
+	s := &SpliceInfoSection{}
+	s.SAPType = byte(r.Read(2))
+	_ = r.Read(12) // section_length
+	s.ProtocolVersion = byte(r.Read(8))
+	if r.ReadFlag() {
+		return nil, fmt.Errorf("encrypted splice_info_section not supported")
+	}
+	_ = r.Read(6) // encryption_algorithm
+	s.PTSAdjustment = uint64(r.Read(33))
+	s.CWIndex = byte(r.Read(8))
+	s.Tier = uint16(r.Read(12))
+	cmdLength := int(r.Read(12))
+	cmdType := byte(r.Read(8))
+	if err := r.AccError(); err != nil {
+		return nil, err
+	}
+	body := data[headerSize : len(data)-4]
+	cmd, n, err := parseCommand(cmdType, body, cmdLength)
+	if err != nil {
+		return nil, err
+	}
+	s.Command = cmd
+	body = body[n:]
+	if len(body) < 2 {
+		return nil, fmt.Errorf("missing descriptor_loop_length")
+	}
+	loopLength := int(binary.BigEndian.Uint16(body))
+	if loopLength > len(body)-2 {
+		return nil, fmt.Errorf("descriptor_loop_length %d exceeds section", loopLength)
+	}
+	s.Descriptors, err = parseDescriptors(body[2 : 2+loopLength])
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Encode returns the splice_info_section with its CRC_32.
+func (s *SpliceInfoSection) Encode() ([]byte, error) {
+	if s.Command == nil {
+		return nil, fmt.Errorf("no splice command")
+	}
+	cmdBuf := bytes.Buffer{}
+	cw := bits.NewWriter(&cmdBuf)
+	s.Command.encode(cw)
+	cw.Flush()
+	if err := cw.AccError(); err != nil {
+		return nil, err
+	}
+	descs, err := encodeDescriptors(s.Descriptors)
+	if err != nil {
+		return nil, err
+	}
+	sectionLength := headerSize - 3 + cmdBuf.Len() + 2 + len(descs) + 4
+	if sectionLength > 4093 {
+		return nil, fmt.Errorf("section_length %d too large", sectionLength)
+	}
+	buf := bytes.Buffer{}
+	buf.Grow(3 + sectionLength)
+	w := bits.NewWriter(&buf)
+	w.Write(TableID, 8)
+	w.Write(0, 2) // section_syntax_indicator, private_indicator
+	w.Write(uint(s.SAPType), 2)
+	w.Write(uint(sectionLength), 12)
+	w.Write(uint(s.ProtocolVersion), 8)
+	w.Write(0, 7) // encrypted_packet, encryption_algorithm
+	w.Write(uint(s.PTSAdjustment&ptsMask), 33)
+	w.Write(uint(s.CWIndex), 8)
+	w.Write(uint(s.Tier), 12)
+	w.Write(uint(cmdBuf.Len()), 12)
+	w.Write(uint(s.Command.Type()), 8)
+	writeBytes(w, cmdBuf.Bytes())
+	w.Write(uint(len(descs)), 16)
+	writeBytes(w, descs)
+	if err := w.AccError(); err != nil {
+		return nil, err
+	}
+	return binary.BigEndian.AppendUint32(buf.Bytes(), bits.CRC32MPEG2(buf.Bytes())), nil
+}
+
+// SegmentationDescriptors returns the segmentation descriptors of the section.
+func (s *SpliceInfoSection) SegmentationDescriptors() []*SegmentationDescriptor {
+	var sds []*SegmentationDescriptor
+	for _, d := range s.Descriptors {
+		if sd, ok := d.(*SegmentationDescriptor); ok {
+			sds = append(sds, sd)
+		}
+	}
+	return sds
+}
+
+// SplicePTS returns the splice time of a time_signal or a splice_insert, with PTSAdjustment
+// applied. For a component splice, the time of the first component is used. ok is false
+// for immediate splices, cancellations and other commands.
+func (s *SpliceInfoSection) SplicePTS() (pts uint64, ok bool) {
+	var t SpliceTime
+	switch c := s.Command.(type) {
+	case *TimeSignal:
+		t = c.SpliceTime
+	case *SpliceInsert:
+		if c.SpliceEventCancelIndicator || c.SpliceImmediateFlag {
+			return 0, false
+		}
+		if c.ProgramSpliceFlag {
+			t = c.SpliceTime
+		} else if len(c.Components) > 0 {
+			t = c.Components[0].SpliceTime
+		}
+	}
+	if !t.Specified {
+		return 0, false
+	}
+	return (t.PTSTime + s.PTSAdjustment) & ptsMask, true
+}
+
+// Duration returns the duration in 90 kHz ticks from the break_duration of a splice_insert
+// or the first segmentation descriptor with a segmentation_duration.
+func (s *SpliceInfoSection) Duration() (ticks uint64, ok bool) {
+	if c, isInsert := s.Command.(*SpliceInsert); isInsert && c.BreakDuration != nil {
+		return c.BreakDuration.Duration, true
+	}
+	for _, sd := range s.SegmentationDescriptors() {
+		if !sd.SegmentationEventCancelIndicator && sd.SegmentationDurationFlag {
+			return sd.SegmentationDuration, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,65 @@
+package sei
+
+import "fmt"
+
+// cc_type values of a cc_data() construct (CTA-708-E Section 4.4).
+const (
+	CCTypeNTSCField1     = 0 // CTA-608 field 1 byte pair
+	CCTypeNTSCField2     = 1 // CTA-608 field 2 byte pair
+	CCTypeDTVCCData      = 2 // DTVCC packet data (continuation)
+	CCTypeDTVCCStart     = 3 // DTVCC packet start
+	maxCCCount           = 31
+	ccDataMarkerByte     = 0xff
+	ccDataFlagsByte      = 0xc0 // reserved bit and process_cc_data_flag
+	ccConstructMarkerBit = 0xf8 // one_bit and reserved bits
+)
+
+// CCTriplet is one cc_data construct: a byte pair with its validity and type.
+// Parity bits of CTA-608 pairs are kept.
+type CCTriplet struct {
+	Valid bool
+	Type  byte
+	Data  [2]byte
+}
+
+// ParseCCData returns all constructs of a cc_data() structure (ATSC A/53 Part 4
+// Section 6.2.2 and CTA-708-E Section 4.3), including invalid padding constructs.
+// Unlike ParseCTA608, it keeps the DTVCC constructs of cc_type 2 and 3.
+func ParseCCData(ccData []byte) ([]CCTriplet, error) {
+	if len(ccData) < 2 {
+		return nil, fmt.Errorf("cc_data too short: %d bytes", len(ccData))
+	}
+	ccCount := int(ccData[0] & 0x1f)
+	if len(ccData) < 2+3*ccCount {
+		return nil, fmt.Errorf("cc_data with cc_count %d truncated at %d bytes", ccCount, len(ccData))
+	}
+	triplets := make([]CCTriplet, ccCount)
+	for i := range triplets {
+		pos := 2 + 3*i
+		triplets[i] = CCTriplet{
+			Valid: ccData[pos]&0x04 != 0,
+			Type:  ccData[pos] & 0x03,
+			Data:  [2]byte{ccData[pos+1], ccData[pos+2]},
+		}
+	}
+	return triplets, nil
+}
+
+// CreateCCData returns a cc_data() structure with process_cc_data_flag set and the
+// given constructs. It is the inverse of ParseCCData and can be wrapped with
+// CreateCTA608SEIMessage or av1.CreateCTA608MetadataOBU.
+func CreateCCData(triplets []CCTriplet) ([]byte, error) {
+	if len(triplets) > maxCCCount {
+		return nil, fmt.Errorf("%d cc_data constructs, max %d", len(triplets), maxCCCount)
+	}
+	out := make([]byte, 0, 3+3*len(triplets))
+	out = append(out, ccDataFlagsByte|byte(len(triplets)), ccDataMarkerByte)
+	for _, t := range triplets {
+		b := byte(ccConstructMarkerBit) | t.Type&0x03
+		if t.Valid {
+			b |= 0x04
+		}
+		out = append(out, b, t.Data[0], t.Data[1])
+	}
+	return append(out, ccDataMarkerByte), nil
+}
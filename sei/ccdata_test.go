@@ -0,0 +1,46 @@
+package sei_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+func TestCCDataRoundTrip(t *testing.T) {
+	// One CTA-608 field 1 pair, invalid field 2 padding, a DTVCC packet start and
+	// invalid DTVCC padding.
+	ccData := "c4ff" + "fc942c" + "f90000" + "ff0241" + "fa0000" + "ff"
+	data, err := hex.DecodeString(ccData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	triplets, err := sei.ParseCCData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sei.CCTriplet{
+		{Valid: true, Type: sei.CCTypeNTSCField1, Data: [2]byte{0x94, 0x2c}},
+		{Valid: false, Type: sei.CCTypeNTSCField2},
+		{Valid: true, Type: sei.CCTypeDTVCCStart, Data: [2]byte{0x02, 0x41}},
+		{Valid: false, Type: sei.CCTypeDTVCCData},
+	}
+	if len(triplets) != len(want) {
+		t.Fatalf("got %d triplets, want %d", len(triplets), len(want))
+	}
+	for i := range want {
+		if triplets[i] != want[i] {
+			t.Errorf("triplet %d: got %+v, want %+v", i, triplets[i], want[i])
+		}
+	}
+	back, err := sei.CreateCCData(triplets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(back) != ccData {
+		t.Errorf("got %s, want %s", hex.EncodeToString(back), ccData)
+	}
+	if _, err := sei.ParseCCData(data[:8]); err == nil {
+		t.Error("expected error for truncated cc_data")
+	}
+}
@@ -0,0 +1,366 @@
+package sei
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/Eyevinn/mp4ff/bits"
+)
+
+// HDR10+ identification in a user_data_registered_itu_t_t35 payload (SMPTE ST 2094-40 and
+// CTA-861-G Annex S): country code USA, terminal provider Samsung, provider oriented code 1,
+// and application identifier 4.
+const (
+	HDR10PlusCountryCode           = 0xb5
+	HDR10PlusProviderCode          = 0x003c
+	HDR10PlusProviderOrientedCode  = 0x0001
+	HDR10PlusApplicationIdentifier = 4
+)
+
+// HDR10Plus is the dynamic HDR metadata of SMPTE ST 2094-40 Application 4, as carried in an
+// HEVC SEI message of type 4 or an AV1 metadata OBU of type ITU-T T.35.
+// The first window covers the whole picture; it is the only one in practice.
+type HDR10Plus struct {
+	ApplicationVersion byte
+	Windows            []HDR10PlusWindow
+	// TargetedSystemDisplayMaximumLuminance is in cd/m2 (0-10000).
+	TargetedSystemDisplayMaximumLuminance uint32
+	// TargetedSystemDisplayActualPeakLuminance is a rows x cols matrix of 4-bit values,
+	// or nil if not present.
+	TargetedSystemDisplayActualPeakLuminance [][]byte
+	// MasteringDisplayActualPeakLuminance is a rows x cols matrix of 4-bit values,
+	// or nil if not present.
+	MasteringDisplayActualPeakLuminance [][]byte
+}
+
+// HDR10PlusWindow holds the per-window part of HDR10Plus.
+// MaxSCL, AverageMaxRGB and the percentiles are linearized values in units of 0.1 cd/m2 (0-100000).
+type HDR10PlusWindow struct {
+	// Geometry is nil for the first window, which is the full picture.
+	Geometry             *HDR10PlusWindowGeometry
+	MaxSCL               [3]uint32
+	AverageMaxRGB        uint32
+	DistributionMaxRGB   []HDR10PlusPercentile
+	FractionBrightPixels uint16
+	ToneMapping          *HDR10PlusToneMapping
+	// ColorSaturationWeight is only present if ColorSaturationMapping is true.
+	ColorSaturationMapping bool
+	ColorSaturationWeight  byte
+}
+
+// HDR10PlusWindowGeometry is the position and elliptical shape of a window after the first.
+type HDR10PlusWindowGeometry struct {
+	UpperLeftCornerX             uint16
+	UpperLeftCornerY             uint16
+	LowerRightCornerX            uint16
+	LowerRightCornerY            uint16
+	CenterOfEllipseX             uint16
+	CenterOfEllipseY             uint16
+	RotationAngle                byte
+	SemimajorAxisInternalEllipse uint16
+	SemimajorAxisExternalEllipse uint16
+	SemiminorAxisExternalEllipse uint16
+	OverlapProcessOption         byte
+}
+
+// HDR10PlusPercentile is one point of the maxRGB distribution.
+type HDR10PlusPercentile struct {
+	Percentage byte
+	Percentile uint32
+}
+
+// HDR10PlusToneMapping is the knee point and Bezier curve of a window.
+type HDR10PlusToneMapping struct {
+	KneePointX         uint16
+	KneePointY         uint16
+	BezierCurveAnchors []uint16
+}
+
+// HDR10PlusITUData returns the ITUData that starts an HDR10+ payload with the given
+// application version. The UserDataTypeCode byte holds the start of the metadata itself
+// and is therefore zero here.
+func HDR10PlusITUData(applicationVersion byte) ITUData {
+	return ITUData{
+		CountryCode:    HDR10PlusCountryCode,
+		ProviderCode:   HDR10PlusProviderCode,
+		UserIdentifier: HDR10PlusProviderOrientedCode<<16 | HDR10PlusApplicationIdentifier<<8 | uint32(applicationVersion),
+	}
+}
+
+// IsHDR10Plus checks if ITU-T data corresponds to HDR10+ (ST 2094-40). Since the HDR10+
+// header is one byte shorter than the ITUData header, UserDataTypeCode is not checked.
+func (i ITUData) IsHDR10Plus() bool {
+	return (i.CountryCode == HDR10PlusCountryCode &&
+		i.ProviderCode == HDR10PlusProviderCode &&
+		i.UserIdentifier>>8 == HDR10PlusProviderOrientedCode<<8|HDR10PlusApplicationIdentifier)
+}
+
+// ParseHDR10Plus parses a full HDR10+ T.35 payload starting with the country code.
+// Bytes after the byte-aligned end of the metadata are ignored.
+func ParseHDR10Plus(payload []byte) (*HDR10Plus, error) {
+	if len(payload) < ITUDataSize {
+		return nil, errShortITUTT35Payload(len(payload))
+	}
+	r := bits.NewReader(bytes.NewReader(payload))
+	countryCode := r.Read(8)
+	providerCode := r.Read(16)
+	orientedCode := r.Read(16)
+	appID := r.Read(8)
+	if countryCode != HDR10PlusCountryCode || providerCode != HDR10PlusProviderCode ||
+		orientedCode != HDR10PlusProviderOrientedCode || appID != HDR10PlusApplicationIdentifier {
+		return nil, fmt.Errorf("not an HDR10+ payload")
+	}
+	h := &HDR10Plus{ApplicationVersion: byte(r.Read(8))}
+	nrWindows := int(r.Read(2))
+	if nrWindows == 0 {
+		return nil, fmt.Errorf("HDR10+: num_windows is 0")
+	}
+	h.Windows = make([]HDR10PlusWindow, nrWindows)
+	for w := 1; w < nrWindows; w++ {
+		h.Windows[w].Geometry = &HDR10PlusWindowGeometry{
+			UpperLeftCornerX:             uint16(r.Read(16)),
+			UpperLeftCornerY:             uint16(r.Read(16)),
+			LowerRightCornerX:            uint16(r.Read(16)),
+			LowerRightCornerY:            uint16(r.Read(16)),
+			CenterOfEllipseX:             uint16(r.Read(16)),
+			CenterOfEllipseY:             uint16(r.Read(16)),
+			RotationAngle:                byte(r.Read(8)),
+			SemimajorAxisInternalEllipse: uint16(r.Read(16)),
+			SemimajorAxisExternalEllipse: uint16(r.Read(16)),
+			SemiminorAxisExternalEllipse: uint16(r.Read(16)),
+			OverlapProcessOption:         byte(r.Read(1)),
+		}
+	}
+	h.TargetedSystemDisplayMaximumLuminance = uint32(r.Read(27))
+	if r.ReadFlag() {
+		h.TargetedSystemDisplayActualPeakLuminance = readPeakLuminanceMatrix(r)
+	}
+	for w := range h.Windows {
+		win := &h.Windows[w]
+		for i := range win.MaxSCL {
+			win.MaxSCL[i] = uint32(r.Read(17))
+		}
+		win.AverageMaxRGB = uint32(r.Read(17))
+		nrPercentiles := int(r.Read(4))
+		win.DistributionMaxRGB = make([]HDR10PlusPercentile, nrPercentiles)
+		for i := range win.DistributionMaxRGB {
+			win.DistributionMaxRGB[i].Percentage = byte(r.Read(7))
+			win.DistributionMaxRGB[i].Percentile = uint32(r.Read(17))
+		}
+		win.FractionBrightPixels = uint16(r.Read(10))
+	}
+	if r.ReadFlag() {
+		h.MasteringDisplayActualPeakLuminance = readPeakLuminanceMatrix(r)
+	}
+	for w := range h.Windows {
+		win := &h.Windows[w]
+		if r.ReadFlag() {
+			tm := &HDR10PlusToneMapping{
+				KneePointX: uint16(r.Read(12)),
+				KneePointY: uint16(r.Read(12)),
+			}
+			tm.BezierCurveAnchors = make([]uint16, r.Read(4))
+			for i := range tm.BezierCurveAnchors {
+				tm.BezierCurveAnchors[i] = uint16(r.Read(10))
+			}
+			win.ToneMapping = tm
+		}
+		win.ColorSaturationMapping = r.ReadFlag()
+		if win.ColorSaturationMapping {
+			win.ColorSaturationWeight = byte(r.Read(6))
+		}
+	}
+	if err := r.AccError(); err != nil {
+		return nil, fmt.Errorf("HDR10+: %w", err)
+	}
+	return h, nil
+}
+
+func readPeakLuminanceMatrix(r *bits.Reader) [][]byte {
+	rows := r.Read(5)
+	cols := r.Read(5)
+	m := make([][]byte, rows)
+	for i := range m {
+		m[i] = make([]byte, cols)
+		for j := range m[i] {
+			m[i][j] = byte(r.Read(4))
+		}
+	}
+	return m
+}
+
+// Encode returns the full HDR10+ T.35 payload starting with the country code,
+// zero-padded to a byte boundary. It is the inverse of ParseHDR10Plus.
+func (h *HDR10Plus) Encode() ([]byte, error) {
+	if len(h.Windows) < 1 || len(h.Windows) > 3 {
+		return nil, fmt.Errorf("HDR10+: %d windows, must be 1-3", len(h.Windows))
+	}
+	var buf bytes.Buffer
+	w := bits.NewWriter(&buf)
+	w.Write(HDR10PlusCountryCode, 8)
+	w.Write(HDR10PlusProviderCode, 16)
+	w.Write(HDR10PlusProviderOrientedCode, 16)
+	w.Write(HDR10PlusApplicationIdentifier, 8)
+	w.Write(uint(h.ApplicationVersion), 8)
+	w.Write(uint(len(h.Windows)), 2)
+	for i, win := range h.Windows[1:] {
+		g := win.Geometry
+		if g == nil {
+			return nil, fmt.Errorf("HDR10+: window %d has no geometry", i+1)
+		}
+		w.Write(uint(g.UpperLeftCornerX), 16)
+		w.Write(uint(g.UpperLeftCornerY), 16)
+		w.Write(uint(g.LowerRightCornerX), 16)
+		w.Write(uint(g.LowerRightCornerY), 16)
+		w.Write(uint(g.CenterOfEllipseX), 16)
+		w.Write(uint(g.CenterOfEllipseY), 16)
+		w.Write(uint(g.RotationAngle), 8)
+		w.Write(uint(g.SemimajorAxisInternalEllipse), 16)
+		w.Write(uint(g.SemimajorAxisExternalEllipse), 16)
+		w.Write(uint(g.SemiminorAxisExternalEllipse), 16)
+		w.Write(uint(g.OverlapProcessOption), 1)
+	}
+	w.Write(uint(h.TargetedSystemDisplayMaximumLuminance), 27)
+	if err := writePeakLuminanceMatrix(w, h.TargetedSystemDisplayActualPeakLuminance); err != nil {
+		return nil, err
+	}
+	for i, win := range h.Windows {
+		for _, v := range win.MaxSCL {
+			w.Write(uint(v), 17)
+		}
+		w.Write(uint(win.AverageMaxRGB), 17)
+		if len(win.DistributionMaxRGB) > 15 {
+			return nil, fmt.Errorf("HDR10+: window %d has %d percentiles, max 15", i, len(win.DistributionMaxRGB))
+		}
+		w.Write(uint(len(win.DistributionMaxRGB)), 4)
+		for _, p := range win.DistributionMaxRGB {
+			w.Write(uint(p.Percentage), 7)
+			w.Write(uint(p.Percentile), 17)
+		}
+		w.Write(uint(win.FractionBrightPixels), 10)
+	}
+	if err := writePeakLuminanceMatrix(w, h.MasteringDisplayActualPeakLuminance); err != nil {
+		return nil, err
+	}
+	for i, win := range h.Windows {
+		if tm := win.ToneMapping; tm != nil {
+			if len(tm.BezierCurveAnchors) > 15 {
+				return nil, fmt.Errorf("HDR10+: window %d has %d Bezier curve anchors, max 15", i, len(tm.BezierCurveAnchors))
+			}
+			w.Write(1, 1)
+			w.Write(uint(tm.KneePointX), 12)
+			w.Write(uint(tm.KneePointY), 12)
+			w.Write(uint(len(tm.BezierCurveAnchors)), 4)
+			for _, a := range tm.BezierCurveAnchors {
+				w.Write(uint(a), 10)
+			}
+		} else {
+			w.Write(0, 1)
+		}
+		if win.ColorSaturationMapping {
+			w.Write(1, 1)
+			w.Write(uint(win.ColorSaturationWeight), 6)
+		} else {
+			w.Write(0, 1)
+		}
+	}
+	w.Flush()
+	if err := w.AccError(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writePeakLuminanceMatrix writes the presence flag and, if m is not nil, the matrix.
+func writePeakLuminanceMatrix(w *bits.Writer, m [][]byte) error {
+	if m == nil {
+		w.Write(0, 1)
+		return nil
+	}
+	cols := 0
+	if len(m) > 0 {
+		cols = len(m[0])
+	}
+	if len(m) > 25 || cols > 25 {
+		return fmt.Errorf("HDR10+: peak luminance matrix %dx%d larger than 25x25", len(m), cols)
+	}
+	w.Write(1, 1)
+	w.Write(uint(len(m)), 5)
+	w.Write(uint(cols), 5)
+	for _, row := range m {
+		if len(row) != cols {
+			return fmt.Errorf("HDR10+: peak luminance matrix rows differ in length")
+		}
+		for _, v := range row {
+			w.Write(uint(v), 4)
+		}
+	}
+	return nil
+}
+
+// String gives the per-frame statistics of all windows on one line.
+func (h *HDR10Plus) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "version=%d, targetMaxLum=%d", h.ApplicationVersion, h.TargetedSystemDisplayMaximumLuminance)
+	for i, win := range h.Windows {
+		fmt.Fprintf(&sb, ", window %d: maxscl=%v, avgMaxRGB=%d, percentiles=[", i, win.MaxSCL, win.AverageMaxRGB)
+		for j, p := range win.DistributionMaxRGB {
+			if j > 0 {
+				sb.WriteString(" ")
+			}
+			fmt.Fprintf(&sb, "%d:%d", p.Percentage, p.Percentile)
+		}
+		fmt.Fprintf(&sb, "], brightPixels=%d", win.FractionBrightPixels)
+		if tm := win.ToneMapping; tm != nil {
+			fmt.Fprintf(&sb, ", knee=(%d, %d), anchors=%v", tm.KneePointX, tm.KneePointY, tm.BezierCurveAnchors)
+		}
+	}
+	return sb.String()
+}
+
+// HDR10PlusSEI is a user_data_registered_itu_t_t35 (type 4) SEI message carrying HDR10+.
+type HDR10PlusSEI struct {
+	payload  []byte
+	Metadata *HDR10Plus
+}
+
+// ExtractHDR10PlusSEI parses an HDR10+ SEI message. CreateHDR10PlusSEIMessage is the inverse.
+func ExtractHDR10PlusSEI(sd *SEIData) (*HDR10PlusSEI, error) {
+	md, err := ParseHDR10Plus(sd.payload)
+	if err != nil {
+		return nil, err
+	}
+	return &HDR10PlusSEI{payload: sd.payload, Metadata: md}, nil
+}
+
+// CreateHDR10PlusSEIMessage returns a user_data_registered_itu_t_t35 (type 4) SEI message
+// carrying HDR10+ metadata. Turn it into a NAL unit with hevc.CreateSEINalu; the AV1
+// counterpart is av1.CreateHDR10PlusMetadataOBU.
+func CreateHDR10PlusSEIMessage(md *HDR10Plus) (*HDR10PlusSEI, error) {
+	payload, err := md.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return &HDR10PlusSEI{payload: payload, Metadata: md}, nil
+}
+
+// Type returns the SEI payload type.
+func (s *HDR10PlusSEI) Type() uint {
+	return SEIUserDataRegisteredITUtT35Type
+}
+
+// Size is size in bytes of raw SEI message rbsp payload.
+func (s *HDR10PlusSEI) Size() uint {
+	return uint(len(s.payload))
+}
+
+// String provides the per-frame statistics of the HDR10+ metadata.
+func (s *HDR10PlusSEI) String() string {
+	return fmt.Sprintf("SEI type %d HDR10+, size=%d, %s", s.Type(), s.Size(), s.Metadata)
+}
+
+// Payload returns the SEI raw rbsp payload.
+func (s *HDR10PlusSEI) Payload() []byte {
+	return s.payload
+}
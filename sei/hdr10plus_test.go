@@ -0,0 +1,111 @@
+package sei_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/Eyevinn/mp4ff/sei"
+)
+
+// hdr10PlusTestMetadata returns metadata typical of an HDR10+ encoder: one window with
+// nine percentiles and a tone mapping curve.
+func hdr10PlusTestMetadata() *sei.HDR10Plus {
+	return &sei.HDR10Plus{
+		ApplicationVersion:                    1,
+		TargetedSystemDisplayMaximumLuminance: 400,
+		Windows: []sei.HDR10PlusWindow{
+			{
+				MaxSCL:        [3]uint32{17830, 16895, 12862},
+				AverageMaxRGB: 1038,
+				DistributionMaxRGB: []sei.HDR10PlusPercentile{
+					{Percentage: 1, Percentile: 5}, {Percentage: 5, Percentile: 3}, {Percentage: 10, Percentile: 12}, {Percentage: 25, Percentile: 264}, {Percentage: 50, Percentile: 1034},
+					{Percentage: 75, Percentile: 1551}, {Percentage: 90, Percentile: 2403}, {Percentage: 95, Percentile: 3600}, {Percentage: 99, Percentile: 8979},
+				},
+				FractionBrightPixels: 2,
+				ToneMapping: &sei.HDR10PlusToneMapping{
+					KneePointX:         17,
+					KneePointY:         64,
+					BezierCurveAnchors: []uint16{265, 666, 921, 1000, 1000, 1000, 1000, 1000, 1000},
+				},
+			},
+		},
+	}
+}
+
+func TestHDR10PlusRoundTrip(t *testing.T) {
+	md := hdr10PlusTestMetadata()
+	md.Windows = append(md.Windows, sei.HDR10PlusWindow{
+		Geometry: &sei.HDR10PlusWindowGeometry{
+			UpperLeftCornerX: 10, UpperLeftCornerY: 20, LowerRightCornerX: 100, LowerRightCornerY: 200,
+			CenterOfEllipseX: 55, CenterOfEllipseY: 110, RotationAngle: 45,
+			SemimajorAxisInternalEllipse: 30, SemimajorAxisExternalEllipse: 40, SemiminorAxisExternalEllipse: 20,
+			OverlapProcessOption: 1,
+		},
+		MaxSCL:                 [3]uint32{100000, 0, 1},
+		DistributionMaxRGB:     []sei.HDR10PlusPercentile{},
+		ColorSaturationMapping: true,
+		ColorSaturationWeight:  33,
+	})
+	md.TargetedSystemDisplayActualPeakLuminance = [][]byte{{1, 2, 3}, {4, 5, 6}}
+	md.MasteringDisplayActualPeakLuminance = [][]byte{{15}}
+	payload, err := md.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(payload[:7]), "b5003c00010401"; got != want {
+		t.Errorf("header %s, want %s", got, want)
+	}
+	back, err := sei.ParseHDR10Plus(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(back, md); diff != nil {
+		t.Error(diff)
+	}
+	if _, err := sei.ParseHDR10Plus(payload[:len(payload)-4]); err == nil {
+		t.Error("expected error for truncated payload")
+	}
+}
+
+func TestDecodeHDR10PlusSEI(t *testing.T) {
+	msg, err := sei.CreateHDR10PlusSEIMessage(hdr10PlusTestMetadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := sei.WriteSEIMessages(&buf, []sei.SEIMessage{msg}); err != nil {
+		t.Fatal(err)
+	}
+	seis, err := sei.ExtractSEIData(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := sei.DecodeSEIMessage(&seis[0], sei.HEVC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, ok := decoded.(*sei.HDR10PlusSEI)
+	if !ok {
+		t.Fatalf("got %T, want *sei.HDR10PlusSEI", decoded)
+	}
+	if diff := deep.Equal(h.Metadata, hdr10PlusTestMetadata()); diff != nil {
+		t.Error(diff)
+	}
+	wantStr := "SEI type 4 HDR10+, size=64, version=1, targetMaxLum=400, window 0: maxscl=[17830 16895 12862], " +
+		"avgMaxRGB=1038, percentiles=[1:5 5:3 10:12 25:264 50:1034 75:1551 90:2403 95:3600 99:8979], " +
+		"brightPixels=2, knee=(17, 64), anchors=[265 666 921 1000 1000 1000 1000 1000 1000]"
+	if got := h.String(); got != wantStr {
+		t.Errorf("got  %s\nwant %s", got, wantStr)
+	}
+	// The CTA-608 identification must not be mistaken for HDR10+ and vice versa.
+	if sei.CTA608ITUData().IsHDR10Plus() || sei.HDR10PlusITUData(1).IsCTA608() || !sei.HDR10PlusITUData(0).IsHDR10Plus() {
+		t.Error("wrong ITU-T T.35 identification")
+	}
+	if !strings.HasPrefix(hex.EncodeToString(sei.HDR10PlusITUData(1).Encode()), "b5003c00010401") {
+		t.Error("wrong HDR10PlusITUData encoding")
+	}
+}
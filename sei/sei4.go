@@ -20,6 +20,9 @@ func DecodeUserDataRegisteredSEI(sd *SEIData) (SEIMessage, error) {
 	if itutData.IsCTA608() {
 		return ExtractCTA608sei(sd)
 	}
+	if itutData.IsHDR10Plus() {
+		return ExtractHDR10PlusSEI(sd)
+	}
 	return NewRegisteredSEI(sd, itutData), nil
 }
 
@@ -0,0 +1,74 @@
+package vp9
+
+import (
+	"fmt"
+)
+
+// CodecConfig holds the VPCodecConfigurationRecord (vpcC) fields of a VP9 stream, as derived
+// from the bitstream by CodecConfigFromSamples.
+type CodecConfig struct {
+	Profile                 byte
+	Level                   byte
+	BitDepth                byte
+	ChromaSubsampling       byte
+	VideoFullRangeFlag      byte
+	ColourPrimaries         byte
+	TransferCharacteristics byte
+	MatrixCoefficients      byte
+	// MaxWidth and MaxHeight are the largest coded frame dimensions in the stream.
+	MaxWidth  uint32
+	MaxHeight uint32
+}
+
+// CodecConfigFromSamples parses all frames of a sequence of VP9 samples (superframes or single
+// frames) in decode order and returns the codec configuration for the stream. The profile and
+// the level cover every frame, not only the first key frame, and the level is computed from the
+// largest frame size at frameRate. The color configuration must be the same in all intra frames.
+func CodecConfigFromSamples(samples [][]byte, frameRate float64) (*CodecConfig, error) {
+	p := NewParser()
+	var (
+		cfg   CodecConfig
+		color *Header
+	)
+	for i, s := range samples {
+		frames, err := p.ParseSample(s)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", i, err)
+		}
+		for _, f := range frames {
+			h := f.Header
+			if h.Profile > cfg.Profile {
+				cfg.Profile = h.Profile
+			}
+			if h.Width > cfg.MaxWidth {
+				cfg.MaxWidth = h.Width
+			}
+			if h.Height > cfg.MaxHeight {
+				cfg.MaxHeight = h.Height
+			}
+			if !h.KeyFrame && !(h.IntraOnly && h.Profile > 0) {
+				continue // no color_config() in this frame
+			}
+			if color == nil {
+				color = h
+				continue
+			}
+			if h.BitDepth != color.BitDepth || h.ColorSpace != color.ColorSpace ||
+				h.ColorRange != color.ColorRange || h.SubsamplingX != color.SubsamplingX ||
+				h.SubsamplingY != color.SubsamplingY {
+				return nil, fmt.Errorf("sample %d: color config differs from first key frame", i)
+			}
+		}
+	}
+	if color == nil {
+		return nil, fmt.Errorf("vp9: no key frame in samples")
+	}
+	cfg.Level = Level(cfg.MaxWidth, cfg.MaxHeight, frameRate)
+	cfg.BitDepth = color.BitDepth
+	cfg.ChromaSubsampling = color.VpcCChromaSubsampling()
+	if color.ColorRange {
+		cfg.VideoFullRangeFlag = 1
+	}
+	cfg.ColourPrimaries, cfg.TransferCharacteristics, cfg.MatrixCoefficients = color.CICP()
+	return &cfg, nil
+}
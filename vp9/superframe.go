@@ -0,0 +1,81 @@
+package vp9
+
+import (
+	"fmt"
+)
+
+// superframeMarker is the top three bits (0b110) of the first and last byte of a superframe index.
+const (
+	superframeMarkerMask = 0xe0
+	superframeMarker     = 0xc0
+)
+
+// ParseSuperframeIndex returns the sizes of the frames in a superframe (VP9 spec Annex B).
+// A sample without a superframe index is a single frame, and the returned slice is nil.
+// The sizes cover the sample data up to, but not including, the index itself.
+func ParseSuperframeIndex(data []byte) ([]uint32, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("vp9: empty sample")
+	}
+	marker := data[len(data)-1]
+	if marker&superframeMarkerMask != superframeMarker {
+		return nil, nil
+	}
+	bytesPerSize := int(marker>>3&0x3) + 1
+	nrFrames := int(marker&0x7) + 1
+	indexSize := 2 + bytesPerSize*nrFrames
+	if len(data) < indexSize || data[len(data)-indexSize] != marker {
+		return nil, nil // last byte looks like a marker, but there is no matching index
+	}
+	sizes := make([]uint32, nrFrames)
+	pos := len(data) - indexSize + 1
+	total := 0
+	for i := range sizes {
+		var size uint32
+		for j := 0; j < bytesPerSize; j++ {
+			size |= uint32(data[pos]) << (8 * j) // little-endian
+			pos++
+		}
+		sizes[i] = size
+		total += int(size)
+	}
+	if total > len(data)-indexSize {
+		return nil, fmt.Errorf("vp9: superframe frame sizes %d exceed data size %d", total, len(data)-indexSize)
+	}
+	return sizes, nil
+}
+
+// SplitSuperframe splits a VP9 sample into its frames. A sample without a superframe index is
+// returned as a single frame. Zero-sized entries in the index are skipped.
+func SplitSuperframe(data []byte) ([][]byte, error) {
+	sizes, err := ParseSuperframeIndex(data)
+	if err != nil {
+		return nil, err
+	}
+	if sizes == nil {
+		return [][]byte{data}, nil
+	}
+	frames := make([][]byte, 0, len(sizes))
+	pos := 0
+	for _, size := range sizes {
+		if size == 0 {
+			continue
+		}
+		frames = append(frames, data[pos:pos+int(size)])
+		pos += int(size)
+	}
+	return frames, nil
+}
+
+// Frame is one coded frame of a VP9 sample together with its parsed uncompressed header.
+type Frame struct {
+	Offset uint32 // byte offset of the frame in the sample
+	Size   uint32
+	Header *Header
+}
+
+// Shown reports whether the frame produces an output picture, either by show_frame or by
+// show_existing_frame. Hidden frames (typically alt-ref frames) are only used as references.
+func (f Frame) Shown() bool {
+	return f.Header.ShowFrame || f.Header.ShowExistingFrame
+}
@@ -0,0 +1,173 @@
+package vp9_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/Eyevinn/mp4ff/ivf"
+	"github.com/Eyevinn/mp4ff/vp9"
+)
+
+// buildSuperframe appends a superframe index with 1-byte sizes to the concatenated frames.
+func buildSuperframe(frames ...[]byte) []byte {
+	marker := byte(0xc0 | (len(frames) - 1))
+	var sf []byte
+	for _, f := range frames {
+		sf = append(sf, f...)
+	}
+	sf = append(sf, marker)
+	for _, f := range frames {
+		sf = append(sf, byte(len(f)))
+	}
+	return append(sf, marker)
+}
+
+func TestSplitSuperframe(t *testing.T) {
+	hidden := []byte{0x84, 0x01, 0x02} // frame_type=1, show_frame=0
+	shown := []byte{0x88}              // show_existing_frame, frame_to_show_map_idx=0
+	sf := buildSuperframe(hidden, shown)
+
+	sizes, err := vp9.ParseSuperframeIndex(sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 2 || sizes[0] != 3 || sizes[1] != 1 {
+		t.Errorf("sizes = %v, want [3 1]", sizes)
+	}
+	frames, err := vp9.SplitSuperframe(sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || len(frames[0]) != 3 || frames[1][0] != 0x88 {
+		t.Errorf("unexpected frames %v", frames)
+	}
+
+	// A single frame has no index
+	sizes, err = vp9.ParseSuperframeIndex(vp9KeyFrame)
+	if err != nil || sizes != nil {
+		t.Errorf("single frame: got (%v, %v), want (nil, nil)", sizes, err)
+	}
+	frames, err = vp9.SplitSuperframe(vp9KeyFrame)
+	if err != nil || len(frames) != 1 {
+		t.Errorf("single frame: got %d frames, err %v", len(frames), err)
+	}
+
+	// Sizes larger than the data
+	bad := []byte{0x00, 0xc0, 0x10, 0xc0}
+	if _, err := vp9.ParseSuperframeIndex(bad); err == nil {
+		t.Error("expected error for frame size exceeding data")
+	}
+}
+
+func TestParserSuperframe(t *testing.T) {
+	keyFrame := readIVFSamples(t)[0]
+	p := vp9.NewParser()
+	frames, err := p.ParseSample(keyFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || !frames[0].Header.KeyFrame || !frames[0].Shown() {
+		t.Fatalf("expected one shown key frame")
+	}
+	// show_existing_frame of slot 0 gets its size from the key frame
+	frames, err = p.ParseSample(buildSuperframe([]byte{0x88}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := frames[0].Header
+	if !frames[0].Shown() || !h.Complete() || h.Width != 320 || h.Height != 180 {
+		t.Errorf("show_existing_frame: shown=%t complete=%t size=%dx%d", frames[0].Shown(), h.Complete(), h.Width, h.Height)
+	}
+	if _, err := vp9.NewParser().ParseSample([]byte{0x88}); err == nil {
+		t.Error("expected error for show_existing_frame without reference")
+	}
+}
+
+func TestParserStream(t *testing.T) {
+	samples := readIVFSamples(t)
+	p := vp9.NewParser()
+	nrKey := 0
+	for i, s := range samples {
+		frames, err := p.ParseSample(s)
+		if err != nil {
+			t.Fatalf("sample %d: %v", i, err)
+		}
+		for _, f := range frames {
+			h := f.Header
+			if !h.Complete() {
+				t.Errorf("sample %d: incomplete header", i)
+			}
+			if h.Width != 320 || h.Height != 180 {
+				t.Errorf("sample %d: size %dx%d, want 320x180", i, h.Width, h.Height)
+			}
+			if h.KeyFrame {
+				nrKey++
+				if h.RefreshFrameFlags != 0xff || h.SizeFromRef != 0 {
+					t.Errorf("sample %d: key frame refresh=%x sizeFromRef=%d", i, h.RefreshFrameFlags, h.SizeFromRef)
+				}
+				continue
+			}
+			if h.SizeFromRef == 0 {
+				t.Errorf("sample %d: expected inter frame size from reference", i)
+			}
+			if int(h.UncompressedHeaderSize)+int(h.HeaderSizeInBytes) > len(s) {
+				t.Errorf("sample %d: header sizes exceed frame size", i)
+			}
+		}
+	}
+	if nrKey != 3 {
+		t.Errorf("got %d key frames, want 3", nrKey)
+	}
+	if _, err := vp9.NewParser().ParseFrameHeader(samples[1]); err == nil {
+		t.Error("expected error for inter frame without key frame")
+	}
+}
+
+func TestCodecConfigFromSamples(t *testing.T) {
+	cfg, err := vp9.CodecConfigFromSamples(readIVFSamples(t), 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := vp9.CodecConfig{
+		Profile:                 0,
+		Level:                   11,
+		BitDepth:                8,
+		ChromaSubsampling:       1,
+		ColourPrimaries:         2,
+		TransferCharacteristics: 2,
+		MatrixCoefficients:      2,
+		MaxWidth:                320,
+		MaxHeight:               180,
+	}
+	if *cfg != want {
+		t.Errorf("got %+v, want %+v", *cfg, want)
+	}
+}
+
+// readIVFSamples returns all frames of testdata/vp9.ivf (320x180, 25 frames, key frames at 0, 10, 20).
+func readIVFSamples(t *testing.T) [][]byte {
+	t.Helper()
+	f, err := os.Open("testdata/vp9.ivf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rd, err := ivf.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples [][]byte
+	for {
+		fr, err := rd.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, fr.Data)
+	}
+	return samples
+}
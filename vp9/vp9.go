@@ -1,8 +1,11 @@
-// Package vp9 parses the VP9 uncompressed frame header.
+// Package vp9 parses the VP9 uncompressed frame header and superframe index.
 //
-// It reads enough of uncompressed_header() (VP9 Bitstream & Decoding Process Specification v0.6,
-// §6.2) to detect key frames (random-access points) and, for key frames, the color configuration
-// and picture size needed to build a vpcC (VPCodecConfigurationRecord) when muxing VP9 into mp4.
+// ParseFrameHeader reads enough of uncompressed_header() (VP9 Bitstream & Decoding Process
+// Specification v0.6, §6.2) to detect key frames (random-access points) and, for key frames, the
+// color configuration and picture size. A Parser reads the complete header of every frame in
+// decode order, tracking the reference frame sizes that inter frames may copy. SplitSuperframe
+// and ParseSuperframeIndex handle samples with several frames (Annex B), and CodecConfigFromSamples
+// derives the vpcC (VPCodecConfigurationRecord) fields from a sequence of samples.
 package vp9
 
 import (
@@ -26,14 +29,33 @@ const (
 
 const frameSyncCode = 0x498342
 
-// Header is a parsed VP9 uncompressed frame header. For key frames the color-config and size
-// fields are populated; for other frames only the leading flags are meaningful.
+// VP9 interpolation filter types (interp_filter, spec §7.2).
+const (
+	InterpEightTapSmooth = 0
+	InterpEightTap       = 1
+	InterpEightTapSharp  = 2
+	InterpBilinear       = 3
+	InterpSwitchable     = 4
+)
+
+// literalToInterpFilter maps raw_interpolation_filter to interp_filter (spec §7.2).
+var literalToInterpFilter = [4]byte{InterpEightTapSmooth, InterpEightTap, InterpEightTapSharp, InterpBilinear}
+
+// NumRefFrames is the number of reference frame slots (NUM_REF_FRAMES).
+const NumRefFrames = 8
+
+// Header is a parsed VP9 uncompressed frame header. ParseFrameHeader fills in the leading flags,
+// and for key frames the color config and frame size. Parser.ParseFrameHeader reads the complete
+// header for every frame type, see Complete.
 type Header struct {
 	Profile           byte
 	ShowExistingFrame bool
+	FrameToShowMapIdx byte
 	KeyFrame          bool // frame_type == KEY_FRAME (0), and not a show_existing_frame
 	ShowFrame         bool
 	ErrorResilient    bool
+	IntraOnly         bool
+	ResetFrameContext byte
 	BitDepth          byte // 8, 10 or 12
 	ColorSpace        byte
 	ColorRange        bool
@@ -41,12 +63,147 @@ type Header struct {
 	SubsamplingY      byte
 	Width             uint32
 	Height            uint32
+	RenderWidth       uint32
+	RenderHeight      uint32
+	// RefreshFrameFlags has bit i set if reference slot i is updated by this frame.
+	RefreshFrameFlags byte
+	// RefFrameIdx are the slots used for LAST, GOLDEN and ALTREF in inter frames.
+	RefFrameIdx      [3]byte
+	RefFrameSignBias [3]bool
+	// SizeFromRef is 1 + the index into RefFrameIdx that the frame size was copied from
+	// (found_ref), or 0 if the size was coded explicitly.
+	SizeFromRef               byte
+	AllowHighPrecisionMV      bool
+	InterpFilter              byte
+	RefreshFrameContext       bool
+	FrameParallelDecodingMode bool
+	FrameContextIdx           byte
+	LoopFilter                LoopFilterParams
+	Quantization              QuantizationParams
+	Segmentation              SegmentationParams
+	TileColsLog2              byte
+	TileRowsLog2              byte
+	// HeaderSizeInBytes is the size of the compressed header that follows.
+	HeaderSizeInBytes uint16
+	// UncompressedHeaderSize is the byte size of the uncompressed header (after trailing_bits).
+	UncompressedHeaderSize uint32
+	complete               bool
+}
+
+// LoopFilterParams are the loop_filter_params() syntax elements (spec §6.2.8).
+type LoopFilterParams struct {
+	Level        byte
+	Sharpness    byte
+	DeltaEnabled bool
+	DeltaUpdate  bool
+	// RefDeltas and ModeDeltas are only valid where the corresponding Update flag is set.
+	UpdateRefDelta  [4]bool
+	RefDeltas       [4]int8
+	UpdateModeDelta [2]bool
+	ModeDeltas      [2]int8
+}
+
+// QuantizationParams are the quantization_params() syntax elements (spec §6.2.9).
+type QuantizationParams struct {
+	BaseQIdx   byte
+	DeltaQYDc  int8
+	DeltaQUVDc int8
+	DeltaQUVAc int8
+}
+
+// Lossless reports whether the frame is coded losslessly.
+func (q QuantizationParams) Lossless() bool {
+	return q.BaseQIdx == 0 && q.DeltaQYDc == 0 && q.DeltaQUVDc == 0 && q.DeltaQUVAc == 0
+}
+
+// SegmentationParams are the segmentation_params() syntax elements (spec §6.2.11).
+type SegmentationParams struct {
+	Enabled          bool
+	UpdateMap        bool
+	TreeProbs        [7]byte
+	TemporalUpdate   bool
+	PredProbs        [3]byte
+	UpdateData       bool
+	AbsOrDeltaUpdate bool
+	FeatureEnabled   [8][4]bool
+	FeatureData      [8][4]int16
 }
 
+var (
+	segmentationFeatureBits   = [4]int{8, 6, 2, 0}
+	segmentationFeatureSigned = [4]bool{true, true, false, false}
+)
+
 // ParseFrameHeader parses the uncompressed header at the start of a VP9 frame (an IVF frame
 // payload, or the first coded frame of a superframe). It reads through frame_size() for key
-// frames and stops early for show_existing_frame and non-key frames.
+// frames and stops early for show_existing_frame and non-key frames, since their sizes may
+// depend on reference frames. Use a Parser for complete headers of all frames.
 func ParseFrameHeader(frame []byte) (*Header, error) {
+	return parseHeader(frame, nil)
+}
+
+// Complete reports whether all fields of the header were parsed.
+func (h *Header) Complete() bool {
+	return h.complete
+}
+
+// refFrame is the state kept for one reference slot.
+type refFrame struct {
+	valid        bool
+	width        uint32
+	height       uint32
+	bitDepth     byte
+	subsamplingX byte
+	subsamplingY byte
+}
+
+// Parser parses a sequence of VP9 frames in decode order and keeps the state needed for
+// complete parsing of inter frames: the reference frame sizes and the color configuration
+// of the last intra frame.
+type Parser struct {
+	refs         [NumRefFrames]refFrame
+	colorSet     bool
+	bitDepth     byte
+	colorSpace   byte
+	colorRange   bool
+	subsamplingX byte
+	subsamplingY byte
+}
+
+// NewParser returns a Parser without reference frames. The first frame must be a key frame.
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// ParseFrameHeader parses the complete uncompressed header of a VP9 frame and updates the
+// reference frame state. Frames must be given in decode order.
+func (p *Parser) ParseFrameHeader(frame []byte) (*Header, error) {
+	return parseHeader(frame, p)
+}
+
+// ParseSample splits a sample (a superframe or a single frame) into its frames and parses
+// each frame header in order.
+func (p *Parser) ParseSample(sample []byte) ([]Frame, error) {
+	frames, err := SplitSuperframe(sample)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Frame, 0, len(frames))
+	offset := 0
+	for i, f := range frames {
+		h, err := p.ParseFrameHeader(f)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		out = append(out, Frame{Offset: uint32(offset), Size: uint32(len(f)), Header: h})
+		offset += len(f)
+	}
+	return out, nil
+}
+
+// parseHeader parses uncompressed_header(). With a nil Parser, it stops after frame_size() for
+// key frames and after the leading flags for other frames.
+func parseHeader(frame []byte, p *Parser) (*Header, error) {
 	r := bits.NewReader(bytes.NewReader(frame))
 	h := &Header{}
 	if r.Read(2) != 2 {
@@ -62,22 +219,277 @@ func ParseFrameHeader(frame []byte) (*Header, error) {
 	}
 	h.ShowExistingFrame = r.ReadFlag()
 	if h.ShowExistingFrame {
-		_ = r.Read(3) // frame_to_show_map_idx; header ends here
-		return h, r.AccError()
+		h.FrameToShowMapIdx = byte(r.Read(3)) // header ends here
+		if err := r.AccError(); err != nil {
+			return nil, err
+		}
+		if p != nil {
+			ref := p.refs[h.FrameToShowMapIdx]
+			if !ref.valid {
+				return nil, fmt.Errorf("vp9: show_existing_frame of empty slot %d", h.FrameToShowMapIdx)
+			}
+			h.Width, h.Height = ref.width, ref.height
+			h.RenderWidth, h.RenderHeight = ref.width, ref.height
+			h.BitDepth, h.SubsamplingX, h.SubsamplingY = ref.bitDepth, ref.subsamplingX, ref.subsamplingY
+			h.complete = true
+		}
+		h.UncompressedHeaderSize = uint32(r.NrBytesRead())
+		return h, nil
 	}
 	h.KeyFrame = r.Read(1) == 0 // frame_type: 0 = KEY_FRAME
 	h.ShowFrame = r.ReadFlag()
 	h.ErrorResilient = r.ReadFlag()
-	if !h.KeyFrame {
-		return h, r.AccError()
+	if h.KeyFrame {
+		if r.Read(24) != frameSyncCode {
+			return nil, fmt.Errorf("vp9: invalid frame_sync_code")
+		}
+		h.parseColorConfig(r)
+		h.parseFrameSize(r)
+		if p == nil {
+			return h, r.AccError()
+		}
+		h.parseRenderSize(r)
+		h.RefreshFrameFlags = 0xff
+	} else {
+		if !h.ShowFrame {
+			h.IntraOnly = r.ReadFlag()
+		}
+		if p == nil {
+			return h, r.AccError()
+		}
+		if !h.ErrorResilient {
+			h.ResetFrameContext = byte(r.Read(2))
+		}
+		if h.IntraOnly {
+			if r.Read(24) != frameSyncCode {
+				return nil, fmt.Errorf("vp9: invalid frame_sync_code")
+			}
+			if h.Profile > 0 {
+				h.parseColorConfig(r)
+			} else {
+				h.ColorSpace = CSBT601
+				h.SubsamplingX, h.SubsamplingY = 1, 1
+				h.BitDepth = 8
+			}
+			h.RefreshFrameFlags = byte(r.Read(8))
+			h.parseFrameSize(r)
+			h.parseRenderSize(r)
+		} else {
+			if !p.colorSet {
+				return nil, fmt.Errorf("vp9: inter frame before first key frame")
+			}
+			h.BitDepth, h.ColorSpace, h.ColorRange = p.bitDepth, p.colorSpace, p.colorRange
+			h.SubsamplingX, h.SubsamplingY = p.subsamplingX, p.subsamplingY
+			h.RefreshFrameFlags = byte(r.Read(8))
+			for i := 0; i < 3; i++ {
+				h.RefFrameIdx[i] = byte(r.Read(3))
+				h.RefFrameSignBias[i] = r.ReadFlag()
+			}
+			if err := h.parseFrameSizeWithRefs(r, p); err != nil {
+				return nil, err
+			}
+			h.AllowHighPrecisionMV = r.ReadFlag()
+			if r.ReadFlag() { // is_filter_switchable
+				h.InterpFilter = InterpSwitchable
+			} else {
+				h.InterpFilter = literalToInterpFilter[r.Read(2)]
+			}
+		}
 	}
-	if r.Read(24) != frameSyncCode {
-		return nil, fmt.Errorf("vp9: invalid frame_sync_code")
+	if !h.ErrorResilient {
+		h.RefreshFrameContext = r.ReadFlag()
+		h.FrameParallelDecodingMode = r.ReadFlag()
+	} else {
+		h.FrameParallelDecodingMode = true
+	}
+	h.FrameContextIdx = byte(r.Read(2))
+	h.LoopFilter.parse(r)
+	h.Quantization.parse(r)
+	h.Segmentation.parse(r)
+	h.parseTileInfo(r)
+	h.HeaderSizeInBytes = uint16(r.Read(16))
+	if err := r.AccError(); err != nil {
+		return nil, err
+	}
+	h.UncompressedHeaderSize = uint32(r.NrBytesRead())
+	h.complete = true
+	if p != nil {
+		p.update(h)
+	}
+	return h, nil
+}
+
+// update stores the color configuration and refreshes reference slots after a frame.
+func (p *Parser) update(h *Header) {
+	if h.KeyFrame || h.IntraOnly {
+		p.colorSet = true
+		p.bitDepth, p.colorSpace, p.colorRange = h.BitDepth, h.ColorSpace, h.ColorRange
+		p.subsamplingX, p.subsamplingY = h.SubsamplingX, h.SubsamplingY
 	}
-	h.parseColorConfig(r)
+	for i := 0; i < NumRefFrames; i++ {
+		if h.RefreshFrameFlags&(1<<i) != 0 {
+			p.refs[i] = refFrame{
+				valid:        true,
+				width:        h.Width,
+				height:       h.Height,
+				bitDepth:     h.BitDepth,
+				subsamplingX: h.SubsamplingX,
+				subsamplingY: h.SubsamplingY,
+			}
+		}
+	}
+}
+
+func (h *Header) parseFrameSize(r *bits.Reader) {
 	h.Width = uint32(r.Read(16)) + 1
 	h.Height = uint32(r.Read(16)) + 1
-	return h, r.AccError()
+}
+
+func (h *Header) parseRenderSize(r *bits.Reader) {
+	if r.ReadFlag() { // render_and_frame_size_different
+		h.RenderWidth = uint32(r.Read(16)) + 1
+		h.RenderHeight = uint32(r.Read(16)) + 1
+	} else {
+		h.RenderWidth, h.RenderHeight = h.Width, h.Height
+	}
+}
+
+func (h *Header) parseFrameSizeWithRefs(r *bits.Reader, p *Parser) error {
+	for i := 0; i < 3; i++ {
+		if r.ReadFlag() { // found_ref
+			ref := p.refs[h.RefFrameIdx[i]]
+			if !ref.valid {
+				return fmt.Errorf("vp9: frame size from empty reference slot %d", h.RefFrameIdx[i])
+			}
+			h.Width, h.Height = ref.width, ref.height
+			h.SizeFromRef = byte(i + 1)
+			break
+		}
+	}
+	if h.SizeFromRef == 0 {
+		h.parseFrameSize(r)
+	}
+	h.parseRenderSize(r)
+	return nil
+}
+
+// readSU reads the su(n) signed integer: n bits magnitude followed by a sign bit.
+func readSU(r *bits.Reader, n int) int {
+	v := int(r.Read(n))
+	if r.ReadFlag() {
+		return -v
+	}
+	return v
+}
+
+func (lf *LoopFilterParams) parse(r *bits.Reader) {
+	lf.Level = byte(r.Read(6))
+	lf.Sharpness = byte(r.Read(3))
+	lf.DeltaEnabled = r.ReadFlag()
+	if !lf.DeltaEnabled {
+		return
+	}
+	lf.DeltaUpdate = r.ReadFlag()
+	if !lf.DeltaUpdate {
+		return
+	}
+	for i := range lf.RefDeltas {
+		lf.UpdateRefDelta[i] = r.ReadFlag()
+		if lf.UpdateRefDelta[i] {
+			lf.RefDeltas[i] = int8(readSU(r, 6))
+		}
+	}
+	for i := range lf.ModeDeltas {
+		lf.UpdateModeDelta[i] = r.ReadFlag()
+		if lf.UpdateModeDelta[i] {
+			lf.ModeDeltas[i] = int8(readSU(r, 6))
+		}
+	}
+}
+
+func (q *QuantizationParams) parse(r *bits.Reader) {
+	q.BaseQIdx = byte(r.Read(8))
+	q.DeltaQYDc = readDeltaQ(r)
+	q.DeltaQUVDc = readDeltaQ(r)
+	q.DeltaQUVAc = readDeltaQ(r)
+}
+
+func readDeltaQ(r *bits.Reader) int8 {
+	if r.ReadFlag() { // delta_coded
+		return int8(readSU(r, 4))
+	}
+	return 0
+}
+
+// readProb reads an optionally coded probability. Uncoded probabilities are 255.
+func readProb(r *bits.Reader) byte {
+	if r.ReadFlag() { // prob_coded
+		return byte(r.Read(8))
+	}
+	return 255
+}
+
+func (s *SegmentationParams) parse(r *bits.Reader) {
+	s.Enabled = r.ReadFlag()
+	if !s.Enabled {
+		return
+	}
+	s.UpdateMap = r.ReadFlag()
+	if s.UpdateMap {
+		for i := range s.TreeProbs {
+			s.TreeProbs[i] = readProb(r)
+		}
+		s.TemporalUpdate = r.ReadFlag()
+		for i := range s.PredProbs {
+			s.PredProbs[i] = 255
+			if s.TemporalUpdate {
+				s.PredProbs[i] = readProb(r)
+			}
+		}
+	}
+	s.UpdateData = r.ReadFlag()
+	if !s.UpdateData {
+		return
+	}
+	s.AbsOrDeltaUpdate = r.ReadFlag()
+	for i := range s.FeatureEnabled {
+		for j := range s.FeatureEnabled[i] {
+			s.FeatureEnabled[i][j] = r.ReadFlag()
+			if !s.FeatureEnabled[i][j] {
+				continue
+			}
+			v := int16(r.Read(segmentationFeatureBits[j]))
+			if segmentationFeatureSigned[j] && r.ReadFlag() {
+				v = -v
+			}
+			s.FeatureData[i][j] = v
+		}
+	}
+}
+
+// parseTileInfo reads tile_info(), which depends on the frame width (spec §6.2.14).
+func (h *Header) parseTileInfo(r *bits.Reader) {
+	miCols := (h.Width + 7) >> 3
+	sb64Cols := (miCols + 7) >> 3
+	minLog2 := byte(0)
+	for (64 << minLog2) < sb64Cols { // MAX_TILE_WIDTH_B64
+		minLog2++
+	}
+	maxLog2 := byte(1)
+	for (sb64Cols >> maxLog2) >= 4 { // MIN_TILE_WIDTH_B64
+		maxLog2++
+	}
+	maxLog2--
+	h.TileColsLog2 = minLog2
+	for h.TileColsLog2 < maxLog2 {
+		if !r.ReadFlag() { // increment_tile_cols_log2
+			break
+		}
+		h.TileColsLog2++
+	}
+	if r.ReadFlag() { // tile_rows_log2
+		h.TileRowsLog2 = 1 + byte(r.Read(1))
+	}
 }
 
 func (h *Header) parseColorConfig(r *bits.Reader) {